@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"io/fs"
 	"net/http"
 	"path"
@@ -37,13 +38,14 @@ func NewAPIServerHandler(
 	groups ...*rest.APIGroupInfo,
 ) (*APIServerHandler, error) {
 	container := rest.NewContainer()
+	installFilters(container, cfg)
 
 	director := director{
 		name:      cfg.Name,
 		container: container,
 	}
 	a := &APIServerHandler{
-		FullHandlerChain:   buildChain(director, cfg),
+		FullHandlerChain:   director,
 		GoRestfulContainer: container,
 		Director:           director,
 		serializer:         runtime.NewCodecFactory(),
@@ -59,7 +61,13 @@ func NewAPIServerHandler(
 
 func (a *APIServerHandler) InstallAPIs() error {
 	logger.Infof("installing lcp-server APIs...")
-	return rest.InstallAPIGroups(a.GoRestfulContainer, a.serializer, a.groups...)
+	if err := rest.InstallAPIGroups(a.GoRestfulContainer, a.serializer, a.groups...); err != nil {
+		return err
+	}
+	if err := a.GoRestfulContainer.CheckRouteConflicts(); err != nil {
+		return fmt.Errorf("conflicting API routes: %w", err)
+	}
+	return nil
 }
 
 // ServeHTTP makes it an http.Handler.
@@ -120,47 +128,29 @@ type director struct {
 	container *rest.Container
 }
 
+// ServeHTTP dispatches all the requests to the container, so requests to unknown paths
+// pass the container filters, e.g. authentication, before they are rejected with 404
 func (d director) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p := r.URL.Path
-
-	for _, ws := range d.container.RegisteredWebServices() {
-		switch {
-		case ws.RootPath() == "/apis":
-			if p == "/apis" || p == "/apis/" {
-				d.container.Dispatch(w, r)
-				return
-			}
-		case strings.HasPrefix(p, ws.RootPath()):
-			if len(p) == len(ws.RootPath()) || p[len(ws.RootPath())] == '/' {
-				d.container.Dispatch(w, r)
-				return
-			}
-		}
-	}
+	d.container.Dispatch(w, r)
 }
 
-// buildChain assembles the middleware chain from APIServerConfig.
-// Order (innermost → outermost): director → WithAuthorization → WithAudit → WithRequestInfo → WithAuthentication → WithRequestLog
-func buildChain(apiHandler http.Handler, cfg APIServerConfig) http.Handler {
-	handler := apiHandler
-	if authz := cfg.Authorizer; authz != nil {
-		if authz.Lookup != nil && authz.Checker != nil {
-			handler = filters.WithAuthorization(authz.Lookup, authz.Checker, filters.PermListCode)(handler)
-		}
+// installFilters registers the container filters from APIServerConfig.
+// They run before route selection in this order: WithServerTiming → WithRequestLog → WithAuthentication → WithRequestInfo → WithAudit → WithAuthorization
+func installFilters(container *rest.Container, cfg APIServerConfig) {
+	container.Filter(filters.WithServerTiming)
+	container.Filter(filters.WithRequestLog)
+	if cfg.OIDCProvider != nil {
+		container.Filter(filters.WithAuthentication(cfg.OIDCProvider))
 	}
-	if cfg.AuditLogger != nil {
-		handler = filters.WithAudit(cfg.AuditLogger)(handler)
+	if authz := cfg.Authorizer; authz != nil && authz.NSResolver != nil {
+		container.Filter(filters.WithRequestInfo(authz.NSResolver))
 	}
-	if authz := cfg.Authorizer; authz != nil {
-		if authz.NSResolver != nil {
-			handler = filters.WithRequestInfo(authz.NSResolver)(handler)
-		}
+	if cfg.AuditLogger != nil {
+		container.Filter(filters.WithAudit(cfg.AuditLogger))
 	}
-	if cfg.OIDCProvider != nil {
-		handler = filters.WithAuthentication(cfg.OIDCProvider)(handler)
+	if authz := cfg.Authorizer; authz != nil && authz.Lookup != nil && authz.Checker != nil {
+		container.Filter(filters.WithAuthorization(authz.Lookup, authz.Checker, filters.PermListCode))
 	}
-	handler = filters.WithRequestLog(handler)
-	return handler
 }
 
 // serveFrontend serves static files from the embedded frontend.
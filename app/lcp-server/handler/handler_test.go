@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lcp.io/lcp/lib/oidc"
+)
+
+// fakeUsers returns an active user for any id
+type fakeUsers struct{}
+
+func (fakeUsers) GetByIdentifier(_ context.Context, identifier string) (*oidc.OIDCUser, error) {
+	return nil, fmt.Errorf("user %q not found", identifier)
+}
+
+func (fakeUsers) GetByID(_ context.Context, id int64) (*oidc.OIDCUser, error) {
+	return &oidc.OIDCUser{ID: id, Username: "alice", Status: "active"}, nil
+}
+
+func (fakeUsers) UpdateLastLogin(_ context.Context, _ int64) error {
+	return nil
+}
+
+func TestAPIServerHandler_UnknownPath(t *testing.T) {
+	const issuer = "https://lcp.example.com"
+	ks, err := oidc.GenerateKeySet(oidc.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("cannot generate key set: %s", err)
+	}
+	provider := oidc.NewProvider(&oidc.ProviderConfig{
+		Issuer:         issuer,
+		AccessTokenTTL: time.Hour,
+	}, ks, fakeUsers{}, nil)
+	token, err := oidc.NewTokenService(ks, issuer, time.Hour).IssueAccessToken(42, "test", []string{"openid"})
+	if err != nil {
+		t.Fatalf("cannot issue access token: %s", err)
+	}
+
+	h, err := NewAPIServerHandler(APIServerConfig{
+		Name:         "test",
+		OIDCProvider: provider,
+	})
+	if err != nil {
+		t.Fatalf("cannot create API server handler: %s", err)
+	}
+
+	f := func(path, authorization string, wantCode int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s with Authorization %q; got %d; want %d; body: %s",
+				path, authorization, rec.Code, wantCode, rec.Body.String())
+		}
+	}
+
+	// unknown paths pass the authentication filter before they are rejected
+	f("/api/unknown/v1/items", "", http.StatusUnauthorized)
+	f("/api/unknown/v1/items", "Bearer invalid", http.StatusUnauthorized)
+	f("/api/unknown/v1/items", "Bearer "+token, http.StatusNotFound)
+	f("/apis", "", http.StatusUnauthorized)
+	f("/apis", "Bearer "+token, http.StatusNotFound)
+}
@@ -1,18 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"io/fs"
 	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"lcp.io/lcp/app/lcp-server/handler"
+	"lcp.io/lcp/lib/appmetrics"
+	"lcp.io/lcp/lib/audit"
 	"lcp.io/lcp/lib/buildinfo"
+	"lcp.io/lcp/lib/cgroup"
 	"lcp.io/lcp/lib/config"
 	"lcp.io/lcp/lib/httpserver"
 	"lcp.io/lcp/lib/lflag"
 	"lcp.io/lcp/lib/logger"
+	"lcp.io/lcp/lib/memory"
+	"lcp.io/lcp/lib/oidc"
 	"lcp.io/lcp/lib/profile"
+	"lcp.io/lcp/lib/rest"
 	"lcp.io/lcp/lib/utils/procutil"
 
 	localapis "lcp.io/lcp/app/lcp-server/apis"
@@ -26,6 +38,8 @@ var (
 	httpListenAddrs  = lflag.NewArrayString("httpListenerAddr", "The address to listen on for HTTP requests")
 	useProxyProtocol = lflag.NewArrayBool("httpListenerAddr.useProxyProtocol", "Whether to use proxy protocol for connections accepted at the corresponding -httpListenAddr")
 	configPath       = flag.String("config", "/etc/lcp/config.yaml", "Path to the YAML configuration file")
+	dryRun           = flag.Bool("dryRun", false, "Whether to check command-line flags, the -config file, listener settings such as TLS certificates and API routes registration, "+
+		"print the registered API routes and then exit. The exit code is non-zero if the check fails. Neither the database is accessed nor -httpListenerAddr is listened")
 )
 
 const (
@@ -42,90 +56,223 @@ func main() {
 	initCLIFlags()
 	buildinfo.Init()
 	logger.Init()
+	cgroup.SetupAutoMaxProcs()
+	memory.SetupAutoMemLimit()
 
 	ctx := procutil.SetupSignalContext()
 	cfg := loadConfig()
+	if *dryRun {
+		runDryRun()
+		return
+	}
+	appmetrics.StartGoroutineLeakDetector(ctx)
 
-	// Database
-	database, err := db.NewDB(ctx, dbConfigFrom(cfg))
-	if err != nil {
-		logger.Fatalf("cannot create database: %v", err)
+	// 2. Start components
+	startTime := time.Now()
+	var c components
+	c.registerStartupHooks(ctx, cfg)
+	if err := procutil.RunStartupHooks(); err != nil {
+		logger.Fatalf("cannot start lcp-server components: %s", err)
 	}
 
-	// Run database migrations
-	if err := db.Migrate(ctx, database.GetPool(), migrations.FS); err != nil {
-		logger.Fatalf("cannot run database migrations: %v", err)
+	if ctx.Err() != nil {
+		// SIGTERM or SIGINT has been received during startup, so do not start listeners
+		// and stop the already started components.
+		logger.Infof("shutdown signal has been received during startup; stopping lcp-server without starting http server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpserver.MaxGracefulShutdownDuration())
+		defer cancel()
+		runShutdownHooks(shutdownCtx)
+		return
 	}
-	logger.Infof("database migrations applied")
 
-	// Hot-reload
-	config.RegisterReloadCallback(func(c *config.Config) {
-		logger.Reload(c.Logger.Level, c.Logger.Format)
-		if err := database.Reload(ctx, dbConfigFrom(c)); err != nil {
-			logger.Errorf("failed to reload database config: %v", err)
-		}
-	})
-	go watchSIGHUP()
+	// 3. Start HTTP server
+	listenAddrs := getListenAddrs()
+	// Serve returns after the listeners are registered, so a shutdown signal received at any moment after it
+	// can be handled by httpserver.Stop below.
+	serverOpts := httpserver.ServerOptions{
+		UseProxyProtocol: useProxyProtocol,
+	}
+	httpserver.Serve(listenAddrs, c.rootHandler, serverOpts)
+	logger.Infof("lcp-server started at %q in %.3f seconds", listenAddrs, time.Since(startTime).Seconds())
+	logStartupSummary(listenAddrs, serverOpts)
 
-	// Audit writer (async, must start before HTTP server)
-	auditWriter := apis.NewAuditWriter(database)
-	auditWriter.Start(ctx)
+	// 4. Wait for shutdown signal
+	<-ctx.Done()
 
-	// OIDC provider
-	oidcProvider := apis.NewOIDCProvider(database, &cfg.OIDC)
+	logger.Infof("gracefully shutting down lcp-server at %q", listenAddrs)
+	startTime = time.Now()
+	// The http server and the components share a single deadline, so the whole shutdown
+	// doesn't take longer than -http.shutdownDelay plus -http.maxGracefulShutdownDuration.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpserver.ShutdownDelay()+httpserver.MaxGracefulShutdownDuration())
+	defer cancel()
+	if err := httpserver.StopContext(shutdownCtx, listenAddrs); err != nil {
+		logger.Fatalf("cannot stop the lcp-server: %s", err)
+	}
+	runShutdownHooks(shutdownCtx)
+	logger.Infof("successfully shut down lcp-server in %.3f seconds", time.Since(startTime).Seconds())
+}
+
+// components holds the lcp-server components initialized by the startup hooks
+type components struct {
+	database     *db.DB
+	auditWriter  *audit.Writer
+	oidcProvider *oidc.Provider
+	apiGroups    []*rest.APIGroupInfo
+	rootHandler  httpserver.RequestHandler
+}
 
-	// API modules (permission sync, role seeding)
-	apisResult := apis.NewAPIGroupInfos(ctx, database)
+// registerStartupHooks registers the initialization of c via procutil.OnStartup.
+//
+// Every hook declares the hooks it depends on, so new components may be added without reordering the existing ones.
+func (c *components) registerStartupHooks(ctx context.Context, cfg *config.Config) {
+	procutil.OnStartup("database", nil, func() error {
+		database, err := db.NewDB(ctx, dbConfigFrom(cfg))
+		if err != nil {
+			return fmt.Errorf("cannot create database: %w", err)
+		}
+		c.database = database
+		procutil.OnShutdown(func(_ context.Context) error {
+			database.Close()
+			return nil
+		})
+		return nil
+	})
+	procutil.OnStartup("migrations", []string{"database"}, func() error {
+		if err := db.Migrate(ctx, c.database.GetPool(), migrations.FS); err != nil {
+			return fmt.Errorf("cannot run database migrations: %w", err)
+		}
+		logger.Infof("database migrations applied")
+		return nil
+	})
+	procutil.OnStartup("configReload", []string{"database"}, func() error {
+		config.RegisterReloadCallback(func(cfg *config.Config) {
+			logger.Reload(cfg.Logger.Level, cfg.Logger.Format)
+			applyConfigFlags(cfg)
+			if err := c.database.Reload(ctx, dbConfigFrom(cfg)); err != nil {
+				logger.Errorf("failed to reload database config: %v", err)
+			}
+		})
+		go watchSIGHUP()
+		return nil
+	})
+	// The audit writer is asynchronous, so it must start before the HTTP server
+	procutil.OnStartup("auditWriter", []string{"migrations"}, func() error {
+		auditWriter := apis.NewAuditWriter(c.database)
+		auditWriter.Start(ctx)
+		c.auditWriter = auditWriter
+		procutil.OnShutdown(func(_ context.Context) error {
+			auditWriter.Stop()
+			return nil
+		})
+		return nil
+	})
+	procutil.OnStartup("oidcProvider", []string{"migrations"}, func() error {
+		c.oidcProvider = apis.NewOIDCProvider(c.database, &cfg.OIDC)
+		return nil
+	})
+	// API modules seed built-in roles and sync permissions
+	procutil.OnStartup("apiModules", []string{"migrations"}, func() error {
+		c.apiGroups = apis.NewAPIGroupInfos(ctx, c.database).Groups
+		return nil
+	})
+	procutil.OnStartup("httpHandler", []string{"auditWriter", "oidcProvider", "apiModules"}, func() error {
+		apiHandler, err := newAPIServerHandler(c.database, c.oidcProvider, c.auditWriter, c.apiGroups)
+		if err != nil {
+			return fmt.Errorf("cannot create API server handler: %w", err)
+		}
+		distFS, err := fs.Sub(ui.DistFS, "dist")
+		if err != nil {
+			return fmt.Errorf("cannot load embedded frontend: %w", err)
+		}
+		c.rootHandler = handler.NewRootHandler(handler.RootHandlerConfig{
+			APIHandler:  apiHandler,
+			OIDCMux:     apis.NewOIDCMux(c.oidcProvider, c.auditWriter),
+			OpenAPISpec: localapis.OpenAPISpec,
+			FrontendFS:  distFS,
+		})
+		return nil
+	})
+}
 
-	// RBAC authorizer
-	authorizer := apis.NewAuthorizer(database, apisResult.Groups)
+// runShutdownHooks stops components registered via procutil.OnShutdown until ctx is done
+func runShutdownHooks(ctx context.Context) {
+	if err := procutil.RunShutdownHooks(ctx); err != nil {
+		logger.Errorf("cannot gracefully stop lcp-server components: %s", err)
+	}
+}
 
-	// 2. Start HTTP server
+func getListenAddrs() []string {
 	listenAddrs := *httpListenAddrs
 	if len(listenAddrs) == 0 {
 		listenAddrs = []string{":8428"}
 	}
+	return listenAddrs
+}
 
-	startTime := time.Now()
+// logStartupSummary logs the effective configuration summary of the server started with opts as a single log message
+func logStartupSummary(listenAddrs []string, opts httpserver.ServerOptions) {
+	urls := make([]string, len(listenAddrs))
+	for idx, addr := range listenAddrs {
+		urls[idx] = fmt.Sprintf("%s://%s/", httpserver.ListenerScheme(idx), addr)
+	}
+	flagValue := func(name string) string {
+		return flag.Lookup(name).Value.String()
+	}
+	logger.InfoFields("lcp-server startup summary",
+		logger.Field{Key: "version", Value: buildinfo.Version},
+		logger.Field{Key: "listenAddrs", Value: strings.Join(urls, ",")},
+		logger.Field{Key: "builtinRoutes", Value: strconv.FormatBool(!opts.DisableBuiltinRoutes)},
+		logger.Field{Key: "httpAuth", Value: strconv.FormatBool(flagValue("httpAuth.username") != "")},
+		logger.Field{Key: "loggerLevel", Value: flagValue("loggerLevel")},
+		logger.Field{Key: "loggerFormat", Value: flagValue("loggerFormat")},
+		logger.Field{Key: "gomaxprocs", Value: strconv.Itoa(runtime.GOMAXPROCS(0))},
+		logger.Field{Key: "gomemlimit", Value: strconv.FormatInt(debug.SetMemoryLimit(-1), 10)},
+	)
+}
 
-	apiHandler, err := handler.NewAPIServerHandler(handler.APIServerConfig{
+// newAPIServerHandler builds the API handler with RBAC authorization for the given API groups
+func newAPIServerHandler(database *db.DB, oidcProvider *oidc.Provider, auditWriter *audit.Writer, groups []*rest.APIGroupInfo) (*handler.APIServerHandler, error) {
+	return handler.NewAPIServerHandler(handler.APIServerConfig{
 		Name:         LCPAPIServer,
 		OIDCProvider: oidcProvider,
-		Authorizer:   authorizer,
+		Authorizer:   apis.NewAuthorizer(database, groups),
 		AuditLogger:  auditWriter,
-	}, apisResult.Groups...)
-	if err != nil {
-		logger.Fatalf("cannot create API server handler: %v", err)
+	}, groups...)
+}
+
+// runDryRun checks listener settings and API routes, prints the routes to stdout and exits with non-zero code on errors.
+//
+// Flags and the config file are already checked at this point.
+func runDryRun() {
+	listenAddrs := getListenAddrs()
+	opts := httpserver.ServerOptions{
+		UseProxyProtocol: useProxyProtocol,
+	}
+	if err := httpserver.CheckServeOptions(listenAddrs, opts); err != nil {
+		logger.Fatalf("dry run failed: %s", err)
+	}
+	for idx, addr := range listenAddrs {
+		logger.Infof("dry run: lcp-server would listen on %s://%s/", httpserver.ListenerScheme(idx), addr)
 	}
 
-	distFS, err := fs.Sub(ui.DistFS, "dist")
+	// The API handler is built the same way as on startup, but the database isn't connected,
+	// so the API modules are built without accessing it and OIDC authentication, which needs keys from the database, is skipped.
+	database := &db.DB{}
+	apisResult := apis.NewAPIGroupInfosForRoutes(database)
+	apiHandler, err := newAPIServerHandler(database, nil, apis.NewAuditWriter(database), apisResult.Groups)
 	if err != nil {
-		logger.Fatalf("cannot load embedded frontend: %v", err)
+		logger.Fatalf("dry run failed: cannot create API server handler: %s", err)
 	}
-
-	rootHandler := handler.NewRootHandler(handler.RootHandlerConfig{
-		APIHandler:  apiHandler,
-		OIDCMux:     apis.NewOIDCMux(oidcProvider, auditWriter),
-		OpenAPISpec: localapis.OpenAPISpec,
-		FrontendFS:  distFS,
-	})
-
-	go httpserver.Serve(listenAddrs, rootHandler, httpserver.ServerOptions{
-		UseProxyProtocol: useProxyProtocol,
-	})
-	logger.Infof("lcp-server started at %q in %.3f seconds", listenAddrs, time.Since(startTime).Seconds())
-
-	// 3. Wait for shutdown signal
-	<-ctx.Done()
-
-	logger.Infof("gracefully shutting down lcp-server at %q", listenAddrs)
-	startTime = time.Now()
-	if err := httpserver.Stop(listenAddrs); err != nil {
-		logger.Fatalf("cannot stop the lcp-server: %s", err)
+	container := apiHandler.GoRestfulContainer
+	if err := container.DumpRoutes(os.Stdout); err != nil {
+		logger.Fatalf("dry run failed: cannot print API routes: %s", err)
 	}
-	auditWriter.Stop()
-	database.Close()
-	logger.Infof("successfully shut down lcp-server in %.3f seconds", time.Since(startTime).Seconds())
+	routes := 0
+	for _, ws := range container.RegisteredWebServices() {
+		routes += len(ws.Routes())
+	}
+	logger.Infof("dry run: %d API routes in %d API groups are registered without conflicts", routes, len(apisResult.Groups))
+	logger.Infof("dry run: command-line flags, config file %q, listener settings and API routes are valid", *configPath)
 }
 
 // loadConfig loads configuration: file → defaults → env overrides → CLI overrides.
@@ -137,10 +284,32 @@ func loadConfig() *config.Config {
 	config.ApplyEnvOverrides(cfg)
 	applyCLIOverrides(cfg)
 	config.Set(cfg)
+	applyConfigFlags(cfg)
 	logger.Infof("configuration loaded from %q", *configPath)
 	return cfg
 }
 
+// applyConfigFlags applies reloadable flags from the flags section of the config file.
+//
+// Flags set via command line take precedence over the config file.
+func applyConfigFlags(cfg *config.Config) {
+	values := make(map[string]string, len(cfg.Flags))
+	for name, value := range cfg.Flags {
+		if _, ok := cliFlags[name]; ok {
+			logger.Warnf("ignoring -%s=%q from the config file, since the flag is set via command line", name, value)
+			continue
+		}
+		values[name] = value
+	}
+	changes, err := lflag.ReloadFlags(values)
+	for _, change := range changes {
+		logger.Infof("%s according to the config file", change)
+	}
+	if err != nil {
+		logger.Warnf("cannot apply some flags from the config file; they are ignored: %s", err)
+	}
+}
+
 var cliFlags map[string]string
 
 func initCLIFlags() {
@@ -58,10 +58,19 @@ func NewConflictMessage(message string) *StatusError {
 	return newStatusError(http.StatusConflict, "Conflict", message, nil)
 }
 
+func NewUnauthorized(message string) *StatusError {
+	return newStatusError(http.StatusUnauthorized, "Unauthorized", message, nil)
+}
+
 func NewForbidden(message string) *StatusError {
 	return newStatusError(http.StatusForbidden, "Forbidden", message, nil)
 }
 
+func NewRequestEntityTooLarge(limit int64) *StatusError {
+	return newStatusError(http.StatusRequestEntityTooLarge, "RequestEntityTooLarge",
+		fmt.Sprintf("request body exceeds %d bytes", limit), nil)
+}
+
 func NewInternalError(err error) *StatusError {
 	msg := "internal server error"
 	if err != nil {
@@ -84,6 +93,13 @@ func IsConflict(err error) bool {
 	return false
 }
 
+func IsUnauthorized(err error) bool {
+	if se, ok := errors.AsType[*StatusError](err); ok {
+		return se.Status == http.StatusUnauthorized
+	}
+	return false
+}
+
 func IsForbidden(err error) bool {
 	if se, ok := errors.AsType[*StatusError](err); ok {
 		return se.Status == http.StatusForbidden
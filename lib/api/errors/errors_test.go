@@ -26,6 +26,13 @@ func TestNewConflict(t *testing.T) {
 	}
 }
 
+func TestNewRequestEntityTooLarge(t *testing.T) {
+	err := NewRequestEntityTooLarge(1024)
+	if err.Status != 413 || err.Reason != "RequestEntityTooLarge" {
+		t.Errorf("unexpected: %+v", err)
+	}
+}
+
 func TestNewInternalError(t *testing.T) {
 	err := NewInternalError(nil)
 	if err.Status != 500 {
@@ -33,6 +40,19 @@ func TestNewInternalError(t *testing.T) {
 	}
 }
 
+func TestNewUnauthorized(t *testing.T) {
+	err := NewUnauthorized("invalid signature")
+	if err.Status != 401 || err.Reason != "Unauthorized" {
+		t.Errorf("unexpected: %+v", err)
+	}
+	if !IsUnauthorized(err) {
+		t.Error("expected IsUnauthorized to be true")
+	}
+	if IsUnauthorized(NewForbidden("no access")) {
+		t.Error("expected IsUnauthorized to be false for Forbidden")
+	}
+}
+
 func TestNewForbidden(t *testing.T) {
 	err := NewForbidden("access denied")
 	if err.Status != 403 || err.Reason != "Forbidden" {
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,6 +15,7 @@ import (
 	"lcp.io/lcp/lib/buildinfo"
 	"lcp.io/lcp/lib/cgroup"
 	"lcp.io/lcp/lib/lflag"
+	"lcp.io/lcp/lib/logger"
 	"lcp.io/lcp/lib/memory"
 	"lcp.io/lcp/lib/utils/bytesutil"
 )
@@ -29,26 +32,59 @@ func initExposeMetadata() {
 
 // WritePrometheusMetrics writes all the registered metrics to w in Prometheus exposition format.
 func WritePrometheusMetrics(w io.Writer) {
+	bb, _ := getMetricsCache()
+	_, _ = w.Write(bb.B)
+}
+
+// getMetricsCache returns metrics in Prometheus exposition format, which are updated at most once per second,
+// together with their update time.
+func getMetricsCache() (*bytesutil.ByteBuffer, time.Time) {
 	exposeMetadataOnce.Do(initExposeMetadata)
 
 	currentTime := time.Now()
 	metricsCacheLock.Lock()
+	defer metricsCacheLock.Unlock()
 	if currentTime.Sub(metricsCacheLastUpdateTime) > time.Second {
-		var bb bytesutil.ByteBuffer
-		writePrometheusMetrics(&bb)
-		metricsCache.Store(&bb)
-		metricsCacheLastUpdateTime = currentTime
+		updateMetricsCacheLocked(currentTime, writePrometheusMetrics)
 	}
-	metricsCacheLock.Unlock()
+	return metricsCache.Load(), metricsCacheLastUpdateTime
+}
 
-	bb := metricsCache.Load()
-	_, _ = w.Write(bb.B)
+// updateMetricsCacheLocked refreshes metricsCache with the output of write.
+//
+// A panic in write mustn't take the whole process down, so it is logged and the previously cached metrics are kept.
+// The metrics written before the panic are served if there are no cached metrics yet.
+func updateMetricsCacheLocked(currentTime time.Time, write func(w io.Writer)) {
+	var bb bytesutil.ByteBuffer
+	if err := writeMetricsSafe(&bb, write); err != nil {
+		metricsWriteErrors.Inc()
+		logger.WithThrottler("writePrometheusMetrics", 5*time.Second).Errorf("%s; serving the previously collected metrics", err)
+		if metricsCache.Load() == nil {
+			metricsCache.Store(&bb)
+		}
+		return
+	}
+	metricsCache.Store(&bb)
+	metricsCacheLastUpdateTime = currentTime
+}
+
+// writeMetricsSafe calls write and converts its panic into an error
+func writeMetricsSafe(w io.Writer, write func(w io.Writer)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic when writing metrics: %v", r)
+		}
+	}()
+	write(w)
+	return nil
 }
 
 var (
 	metricsCacheLock           sync.Mutex
 	metricsCacheLastUpdateTime time.Time
 	metricsCache               atomic.Pointer[bytesutil.ByteBuffer]
+
+	metricsWriteErrors = metrics.NewCounter(`lcp_metrics_write_errors_total`)
 )
 
 func writePrometheusMetrics(w io.Writer) {
@@ -59,7 +95,15 @@ func writePrometheusMetrics(w io.Writer) {
 	metrics.WriteGaugeUint64(w, "lcp_allowed_memory_bytes", uint64(memory.Allowed()))
 	metrics.WriteGaugeUint64(w, "lcp_available_memory_bytes", uint64(memory.Allowed()+memory.Remaining()))
 	metrics.WriteGaugeUint64(w, "lcp_available_cpu_cores", uint64(cgroup.AvailableCPUs()))
+	metrics.WriteGaugeUint64(w, "lcp_available_cpu_cores_from_cgroup", boolToUint64(cgroup.CPULimitFromCgroup()))
+	metrics.WriteGaugeUint64(w, "lcp_available_memory_from_cgroup", boolToUint64(memory.LimitFromCgroup()))
 	metrics.WriteGaugeUint64(w, "lcp_gogc", uint64(cgroup.GetGOGC()))
+	metrics.WriteGaugeUint64(w, "lcp_goroutines_count", uint64(runtime.NumGoroutine()))
+
+	// Export Go runtime settings, which may be helpful for correlating performance anomalies with them
+	metrics.WriteGaugeUint64(w, fmt.Sprintf("lcp_go_info{version=%q, goos=%q, goarch=%q}", runtime.Version(), runtime.GOOS, runtime.GOARCH), 1)
+	metrics.WriteGaugeUint64(w, "lcp_go_maxprocs", uint64(runtime.GOMAXPROCS(0)))
+	metrics.WriteGaugeUint64(w, "lcp_go_memory_limit_bytes", uint64(debug.SetMemoryLimit(-1)))
 
 	// Export start time and uptime in seconds
 	metrics.WriteGaugeUint64(w, "lcp_app_start_timestamp", uint64(startTime.Unix()))
@@ -87,3 +131,10 @@ func writePrometheusMetrics(w io.Writer) {
 }
 
 var startTime = time.Now()
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package appmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateMetricsCache_Panic(t *testing.T) {
+	metricsCacheLock.Lock()
+	defer metricsCacheLock.Unlock()
+
+	prevCache := metricsCache.Load()
+	prevTime := metricsCacheLastUpdateTime
+	defer func() {
+		metricsCache.Store(prevCache)
+		metricsCacheLastUpdateTime = prevTime
+	}()
+
+	f := func(write func(w io.Writer), wantCache string) {
+		t.Helper()
+		updateMetricsCacheLocked(time.Now(), write)
+		if got := string(metricsCache.Load().B); got != wantCache {
+			t.Fatalf("unexpected metrics cache; got %q; want %q", got, wantCache)
+		}
+	}
+	panicking := func(w io.Writer) {
+		_, _ = io.WriteString(w, "partial 1\n")
+		panic("malformed metric name")
+	}
+
+	// the partially written metrics are served if nothing has been cached yet
+	metricsCache.Store(nil)
+	errorsBefore := metricsWriteErrors.Get()
+	f(panicking, "partial 1\n")
+	if n := metricsWriteErrors.Get() - errorsBefore; n != 1 {
+		t.Fatalf("unexpected number of metrics write errors; got %d; want 1", n)
+	}
+
+	f(func(w io.Writer) {
+		_, _ = io.WriteString(w, "full 1\n")
+	}, "full 1\n")
+	updateTime := metricsCacheLastUpdateTime
+
+	// the previously cached metrics are kept and the cache is refreshed on the next call
+	f(panicking, "full 1\n")
+	if !metricsCacheLastUpdateTime.Equal(updateTime) {
+		t.Fatalf("the update time mustn't change after a panic")
+	}
+}
+
+func TestWritePrometheusMetrics_GoMemoryLimit(t *testing.T) {
+	prevLimit := debug.SetMemoryLimit(-1)
+	defer debug.SetMemoryLimit(prevLimit)
+
+	f := func(limit int64) {
+		t.Helper()
+		debug.SetMemoryLimit(limit)
+		var bb bytes.Buffer
+		writePrometheusMetrics(&bb)
+		want := fmt.Sprintf("\nlcp_go_memory_limit_bytes %d\n", limit)
+		if !strings.Contains(bb.String(), want) {
+			t.Fatalf("missing %q in the exported metrics", strings.TrimSpace(want))
+		}
+	}
+
+	// the effective Go memory limit is exported, e.g. the one set via -runtime.autoMemLimit
+	f(123456789)
+	f(math.MaxInt64)
+}
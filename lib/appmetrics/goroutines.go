@@ -0,0 +1,67 @@
+package appmetrics
+
+import (
+	"context"
+	"flag"
+	"runtime"
+	"time"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+var (
+	goroutinesLeakThreshold = flag.Int("goroutines.leakThreshold", 0, "The number of goroutines, after which a warning is logged if the number of goroutines "+
+		"has been growing monotonically during -goroutines.leakCheckWindow. This may help detecting goroutine leaks. Zero disables the check")
+	goroutinesLeakCheckWindow = flag.Duration("goroutines.leakCheckWindow", 10*time.Minute, "The time window for detecting monotonic growth of goroutines. See -goroutines.leakThreshold")
+)
+
+// goroutinesLeakSamples is the number of goroutine count samples collected per -goroutines.leakCheckWindow
+const goroutinesLeakSamples = 10
+
+// StartGoroutineLeakDetector starts a background check for goroutine leaks if -goroutines.leakThreshold is set.
+//
+// The check stops when ctx is done.
+func StartGoroutineLeakDetector(ctx context.Context) {
+	if *goroutinesLeakThreshold <= 0 || *goroutinesLeakCheckWindow <= 0 {
+		return
+	}
+	go runGoroutineLeakDetector(ctx, *goroutinesLeakThreshold, *goroutinesLeakCheckWindow)
+}
+
+func runGoroutineLeakDetector(ctx context.Context, threshold int, window time.Duration) {
+	t := time.NewTicker(window / goroutinesLeakSamples)
+	defer t.Stop()
+
+	lt := logger.WithThrottler("goroutinesLeak", window)
+	var samples []int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		samples = append(samples, runtime.NumGoroutine())
+		if len(samples) > goroutinesLeakSamples {
+			samples = samples[1:]
+		}
+		if isGoroutineLeakSuspected(samples, threshold) {
+			lt.Warnf("the number of goroutines has been growing from %d to %d during the last %s and exceeds -goroutines.leakThreshold=%d; "+
+				"this may indicate a goroutine leak; inspect /debug/pprof/goroutine?debug=1 for details",
+				samples[0], samples[len(samples)-1], window, threshold)
+		}
+	}
+}
+
+// isGoroutineLeakSuspected returns true if samples cover the whole window, grow monotonically
+// and the last sample exceeds threshold
+func isGoroutineLeakSuspected(samples []int, threshold int) bool {
+	if len(samples) < goroutinesLeakSamples || samples[len(samples)-1] <= threshold {
+		return false
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i] <= samples[i-1] {
+			return false
+		}
+	}
+	return true
+}
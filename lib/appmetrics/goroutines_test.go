@@ -0,0 +1,24 @@
+package appmetrics
+
+import "testing"
+
+func TestIsGoroutineLeakSuspected(t *testing.T) {
+	f := func(samples []int, threshold int, expected bool) {
+		t.Helper()
+		if got := isGoroutineLeakSuspected(samples, threshold); got != expected {
+			t.Fatalf("unexpected result for samples=%v, threshold=%d; got %v; want %v", samples, threshold, got, expected)
+		}
+	}
+
+	// monotonic growth above the threshold
+	f([]int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, 15, true)
+
+	// the window isn't covered yet
+	f([]int{10, 11, 12}, 5, false)
+
+	// below the threshold
+	f([]int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, 100, false)
+
+	// non-monotonic growth
+	f([]int{10, 11, 12, 13, 12, 15, 16, 17, 18, 19}, 15, false)
+}
@@ -0,0 +1,158 @@
+package appmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteJSONMetrics writes all the registered metrics to w as a JSON object.
+//
+// Metrics without labels are written as "name": value. Metrics with labels are written as
+// "name": [{"labels": {"label": "value", ...}, "value": value}, ...].
+// Non-finite values (NaN, ±Inf) are written as null.
+//
+// The output is derived from the same cache as WritePrometheusMetrics, so it is updated at most once per second.
+func WriteJSONMetrics(w io.Writer) {
+	bb, updateTime := getMetricsCache()
+
+	jsonMetricsCacheLock.Lock()
+	if !updateTime.Equal(jsonMetricsCacheUpdateTime) {
+		data, err := prometheusToJSON(bb.B)
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"error":%q}`, err))
+		}
+		jsonMetricsCache = data
+		jsonMetricsCacheUpdateTime = updateTime
+	}
+	data := jsonMetricsCache
+	jsonMetricsCacheLock.Unlock()
+
+	_, _ = w.Write(data)
+}
+
+var (
+	jsonMetricsCacheLock       sync.Mutex
+	jsonMetricsCacheUpdateTime time.Time
+	jsonMetricsCache           []byte
+)
+
+type labeledValue struct {
+	Labels map[string]string `json:"labels"`
+	Value  *float64          `json:"value"`
+}
+
+// prometheusToJSON converts metrics in Prometheus text exposition format to JSON object
+func prometheusToJSON(data []byte) ([]byte, error) {
+	plain := make(map[string]*float64)
+	labeled := make(map[string][]labeledValue)
+	for len(data) > 0 {
+		line := data
+		if n := bytes.IndexByte(data, '\n'); n >= 0 {
+			line, data = data[:n], data[n+1:]
+		} else {
+			data = nil
+		}
+		s := strings.TrimSpace(string(line))
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		name, labels, value, err := parsePrometheusLine(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse metric line %q: %w", s, err)
+		}
+		if labels == nil {
+			plain[name] = value
+			continue
+		}
+		labeled[name] = append(labeled[name], labeledValue{
+			Labels: labels,
+			Value:  value,
+		})
+	}
+
+	result := make(map[string]any, len(plain)+len(labeled))
+	for name, v := range plain {
+		result[name] = v
+	}
+	for name, vs := range labeled {
+		result[name] = vs
+	}
+	return json.Marshal(result)
+}
+
+// parsePrometheusLine parses `name{label="value",...} value [timestamp]` line.
+//
+// nil labels are returned for metrics without labels. nil value is returned for non-finite values.
+func parsePrometheusLine(s string) (string, map[string]string, *float64, error) {
+	n := strings.IndexAny(s, "{ ")
+	if n <= 0 {
+		return "", nil, nil, fmt.Errorf("missing metric value")
+	}
+	name := s[:n]
+	s = s[n:]
+
+	var labels map[string]string
+	if s[0] == '{' {
+		labels = make(map[string]string)
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " ,")
+			if s == "" {
+				return "", nil, nil, fmt.Errorf("missing closing brace")
+			}
+			if s[0] == '}' {
+				s = s[1:]
+				break
+			}
+			eq := strings.IndexByte(s, '=')
+			if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+				return "", nil, nil, fmt.Errorf("cannot find label value")
+			}
+			key := strings.TrimSpace(s[:eq])
+			s = s[eq+1:]
+			end := findClosingQuote(s)
+			if end < 0 {
+				return "", nil, nil, fmt.Errorf("missing closing quote for label %q", key)
+			}
+			value, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("cannot unquote value for label %q: %w", key, err)
+			}
+			labels[key] = value
+			s = s[end+1:]
+		}
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return "", nil, nil, fmt.Errorf("missing metric value")
+	}
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("cannot parse metric value: %w", err)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return name, labels, nil, nil
+	}
+	return name, labels, &f, nil
+}
+
+// findClosingQuote returns the index of the closing quote for the quoted string at the start of s
+func findClosingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
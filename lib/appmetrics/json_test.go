@@ -0,0 +1,50 @@
+package appmetrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPrometheusToJSON(t *testing.T) {
+	data := []byte(`# HELP lcp_app_uptime_seconds uptime
+# TYPE lcp_app_uptime_seconds gauge
+lcp_app_uptime_seconds 42
+lcp_http_requests_total{path="/metrics"} 3
+lcp_http_requests_total{path="/debug/pprof/", reason="a \"quoted\", value"} 1
+process_start_time_seconds NaN
+`)
+	result, err := prometheusToJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatalf("cannot unmarshal result %s: %v", result, err)
+	}
+	expected := map[string]any{
+		"lcp_app_uptime_seconds": 42.0,
+		"lcp_http_requests_total": []any{
+			map[string]any{"labels": map[string]any{"path": "/metrics"}, "value": 3.0},
+			map[string]any{"labels": map[string]any{"path": "/debug/pprof/", "reason": `a "quoted", value`}, "value": 1.0},
+		},
+		"process_start_time_seconds": nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected result\nexpected: %v\ngot: %v", expected, got)
+	}
+}
+
+func TestPrometheusToJSON_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"metric",
+		`metric{label="value" 1`,
+		`metric{label=value} 1`,
+		"metric abc",
+	} {
+		if _, err := prometheusToJSON([]byte(s)); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package appmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// metricInfo describes a metric family in the output of WriteMetricsListJSON
+type metricInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WriteMetricsListJSON writes the names and types of all the metric families exposed at /metrics to w as a JSON object:
+//
+//	{"exposeMetadata": false, "metrics": [{"name": "lcp_http_requests_total", "type": "counter"}, ...]}
+//
+// The types are taken from the TYPE metadata if -metrics.exposeMetadata is set. Otherwise, they are derived
+// from the exposition format: histogram and summary families are detected by their vmrange, le and quantile labels,
+// metrics with the _total suffix are counters and the rest are gauges.
+// The metrics library doesn't support help text, so it isn't included.
+func WriteMetricsListJSON(w io.Writer) {
+	bb, _ := getMetricsCache()
+	data, err := json.Marshal(struct {
+		ExposeMetadata bool         `json:"exposeMetadata"`
+		Metrics        []metricInfo `json:"metrics"`
+	}{
+		ExposeMetadata: *exposeMetadata,
+		Metrics:        listMetrics(bb.B),
+	})
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"error":%q}`, err))
+	}
+	_, _ = w.Write(data)
+}
+
+// listMetrics returns the metric families found in data in Prometheus exposition format sorted by name
+func listMetrics(data []byte) []metricInfo {
+	types := make(map[string]string)
+	var names []string
+	// families with buckets or quantiles; their _sum and _count series belong to them
+	aggregates := make(map[string]string)
+	for len(data) > 0 {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte("\n"))
+		s := string(line)
+		if s == "" {
+			continue
+		}
+		if strings.HasPrefix(s, "#") {
+			if fields := strings.Fields(s); len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+				if fields[3] == "histogram" || fields[3] == "summary" {
+					aggregates[fields[2]] = fields[3]
+				}
+			}
+			continue
+		}
+		name, labels := s, ""
+		if n := strings.IndexAny(s, "{ "); n >= 0 {
+			name = s[:n]
+			labels = s[n:]
+		}
+		switch {
+		case strings.HasSuffix(name, "_bucket") && (strings.Contains(labels, "vmrange=") || strings.Contains(labels, "le=")):
+			name = strings.TrimSuffix(name, "_bucket")
+			aggregates[name] = "histogram"
+		case strings.Contains(labels, "quantile="):
+			aggregates[name] = "summary"
+		}
+		names = append(names, name)
+	}
+
+	seen := make(map[string]bool)
+	var result []metricInfo
+	for _, name := range names {
+		for _, suffix := range []string{"_sum", "_count"} {
+			if base, ok := strings.CutSuffix(name, suffix); ok && aggregates[base] != "" {
+				name = base
+			}
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		typ := types[name]
+		switch {
+		case typ != "":
+		case aggregates[name] != "":
+			typ = aggregates[name]
+		case strings.HasSuffix(name, "_total"):
+			typ = "counter"
+		default:
+			typ = "gauge"
+		}
+		result = append(result, metricInfo{Name: name, Type: typ})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
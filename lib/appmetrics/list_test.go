@@ -0,0 +1,87 @@
+package appmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestListMetrics(t *testing.T) {
+	f := func(data string, expected []metricInfo) {
+		t.Helper()
+		result := listMetrics([]byte(data))
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("unexpected result;\ngot\n%v\nwant\n%v", result, expected)
+		}
+	}
+
+	f("", nil)
+
+	// without metadata
+	f(`lcp_http_requests_total{path="/metrics"} 3
+lcp_http_requests_total{path="/health"} 1
+go_goroutines 12
+lcp_request_duration_seconds_bucket{vmrange="1.000e-01...1.136e-01"} 2
+lcp_request_duration_seconds_sum 0.21
+lcp_request_duration_seconds_count 2
+lcp_prom_histogram_bucket{le="0.5"} 1
+lcp_prom_histogram_bucket{le="+Inf"} 1
+lcp_prom_histogram_sum 0.3
+lcp_prom_histogram_count 1
+go_gc_duration_seconds{quantile="0.5"} 0.0001
+go_gc_duration_seconds_sum 0.01
+go_gc_duration_seconds_count 20
+flag{name="httpListenAddr", value=":8080", is_set="false"} 1
+lcp_queue_count 5
+`, []metricInfo{
+		{Name: "flag", Type: "gauge"},
+		{Name: "go_gc_duration_seconds", Type: "summary"},
+		{Name: "go_goroutines", Type: "gauge"},
+		{Name: "lcp_http_requests_total", Type: "counter"},
+		{Name: "lcp_prom_histogram", Type: "histogram"},
+		{Name: "lcp_queue_count", Type: "gauge"},
+		{Name: "lcp_request_duration_seconds", Type: "histogram"},
+	})
+
+	// with metadata
+	f(`# HELP lcp_conns
+# TYPE lcp_conns counter
+lcp_conns 3
+# HELP lcp_request_duration_seconds
+# TYPE lcp_request_duration_seconds histogram
+lcp_request_duration_seconds_bucket{vmrange="1.000e-01...1.136e-01"} 2
+lcp_request_duration_seconds_sum 0.21
+lcp_request_duration_seconds_count 2
+`, []metricInfo{
+		{Name: "lcp_conns", Type: "counter"},
+		{Name: "lcp_request_duration_seconds", Type: "histogram"},
+	})
+}
+
+func TestWriteMetricsListJSON(t *testing.T) {
+	var bb bytes.Buffer
+	WriteMetricsListJSON(&bb)
+	var result struct {
+		ExposeMetadata *bool        `json:"exposeMetadata"`
+		Metrics        []metricInfo `json:"metrics"`
+	}
+	if err := json.Unmarshal(bb.Bytes(), &result); err != nil {
+		t.Fatalf("cannot parse response %q: %v", bb.String(), err)
+	}
+	if result.ExposeMetadata == nil {
+		t.Fatalf("missing exposeMetadata in %s", bb.String())
+	}
+	found := false
+	for _, m := range result.Metrics {
+		if m.Name == "lcp_goroutines_count" {
+			found = true
+			if m.Type != "gauge" {
+				t.Fatalf("unexpected type for %s; got %s; want gauge", m.Name, m.Type)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("missing lcp_goroutines_count in %s", bb.String())
+	}
+}
@@ -0,0 +1,83 @@
+package appmetrics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// MetricName returns the name of the metric with the given labels in Prometheus exposition format.
+// labels must contain label name and value pairs. For example, MetricName("lcp_conns", "addr", ":8080")
+// returns `lcp_conns{addr=":8080"}`.
+//
+// Label values may contain arbitrary data such as listener addresses, so they are escaped.
+// An error is returned for invalid metric and label names, since they cannot be escaped.
+func MetricName(name string, labels ...string) (string, error) {
+	if !metricNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid metric name %q; it must match %s", name, metricNameRegexp)
+	}
+	if len(labels)%2 != 0 {
+		return "", fmt.Errorf("missing value for label %q of metric %q", labels[len(labels)-1], name)
+	}
+	if len(labels) == 0 {
+		return name, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		labelName := labels[i]
+		if !labelNameRegexp.MatchString(labelName) || strings.HasPrefix(labelName, "__") {
+			return "", fmt.Errorf("invalid label name %q of metric %q; it must match %s and mustn't start with __", labelName, name, labelNameRegexp)
+		}
+		for j := 0; j < i; j += 2 {
+			if labels[j] == labelName {
+				return "", fmt.Errorf("duplicate label %q of metric %q", labelName, name)
+			}
+		}
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(labelName)
+		sb.WriteString(`="`)
+		labelValueEscaper.WriteString(&sb, strings.ToValidUTF8(labels[i+1], "�"))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
+
+// NewCounter returns a counter with the given name and labels registered in the default metrics set.
+// See MetricName for the labels format.
+//
+// The existing counter is returned if it has been already registered.
+func NewCounter(name string, labels ...string) (*metrics.Counter, error) {
+	s, err := MetricName(name, labels...)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.GetOrCreateCounter(s), nil
+}
+
+// NewGauge returns a gauge with the given name and labels registered in the default metrics set.
+// The gauge value is obtained by calling f; the gauge may be updated via Set if f is nil.
+// See MetricName for the labels format.
+//
+// The existing gauge is returned if it has been already registered; f is ignored in this case.
+func NewGauge(name string, f func() float64, labels ...string) (*metrics.Gauge, error) {
+	s, err := MetricName(name, labels...)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.GetOrCreateGauge(s, f), nil
+}
@@ -0,0 +1,95 @@
+package appmetrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestMetricName_Success(t *testing.T) {
+	f := func(name string, labels []string, want string) {
+		t.Helper()
+		got, err := MetricName(name, labels...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("unexpected metric name; got %s; want %s", got, want)
+		}
+		if err := metrics.ValidateMetric(got); err != nil {
+			t.Fatalf("invalid metric %s: %v", got, err)
+		}
+	}
+
+	f("lcp_conns", nil, `lcp_conns`)
+	f("lcp:conns_total", []string{"name", "http", "addr", ":8080"}, `lcp:conns_total{name="http", addr=":8080"}`)
+	f("lcp_conns", []string{"addr", "[::1]:8080"}, `lcp_conns{addr="[::1]:8080"}`)
+	f("lcp_conns", []string{"addr", "/var/run/lcp.sock"}, `lcp_conns{addr="/var/run/lcp.sock"}`)
+
+	// unusual chars in label values are escaped
+	f("lcp_conns", []string{"addr", `host"name:80`}, `lcp_conns{addr="host\"name:80"}`)
+	f("lcp_conns", []string{"addr", `C:\lcp\sock`}, `lcp_conns{addr="C:\\lcp\\sock"}`)
+	f("lcp_conns", []string{"addr", "a\nb"}, `lcp_conns{addr="a\nb"}`)
+	f("lcp_conns", []string{"addr", `a}",b="c`}, `lcp_conns{addr="a}\",b=\"c"}`)
+	f("lcp_conns", []string{"addr", "\xff:80"}, `lcp_conns{addr="�:80"}`)
+	f("lcp_conns", []string{"addr", "节点:80"}, `lcp_conns{addr="节点:80"}`)
+	f("lcp_conns", []string{"addr", ""}, `lcp_conns{addr=""}`)
+}
+
+func TestMetricName_Failure(t *testing.T) {
+	f := func(name string, labels ...string) {
+		t.Helper()
+		if s, err := MetricName(name, labels...); err == nil {
+			t.Fatalf("expecting non-nil error; got metric %s", s)
+		}
+	}
+
+	f("")
+	f("1lcp_conns")
+	f("lcp-conns")
+	f(`lcp_conns{addr="x"}`)
+	f("lcp_conns", "addr")
+	f("lcp_conns", "", "x")
+	f("lcp_conns", "listen-addr", "x")
+	f("lcp_conns", "__name__", "x")
+	f("lcp_conns", "addr", "x", "addr", "y")
+}
+
+func TestNewCounter(t *testing.T) {
+	c, err := NewCounter("lcp_test_names_total", "addr", `weird"addr`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Inc()
+	c2, err := NewCounter("lcp_test_names_total", "addr", `weird"addr`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c2 != c {
+		t.Fatalf("expecting the already registered counter")
+	}
+
+	var bb bytes.Buffer
+	metrics.WritePrometheus(&bb, false)
+	if want := `lcp_test_names_total{addr="weird\"addr"} 1`; !bytes.Contains(bb.Bytes(), []byte(want)) {
+		t.Fatalf("missing %s in the metrics output:\n%s", want, bb.String())
+	}
+
+	if _, err := NewCounter("lcp-test", "addr", "x"); err == nil {
+		t.Fatalf("expecting non-nil error for invalid metric name")
+	}
+}
+
+func TestNewGauge(t *testing.T) {
+	g, err := NewGauge("lcp_test_names_gauge", func() float64 { return 42 }, "addr", "[::1]:8080")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v := g.Get(); v != 42 {
+		t.Fatalf("unexpected gauge value; got %v; want 42", v)
+	}
+	if _, err := NewGauge("lcp_test_names_gauge", nil, "bad-label", "x"); err == nil {
+		t.Fatalf("expecting non-nil error for invalid label name")
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"runtime"
 )
 
-var version = flag.Bool("version", false, "Show LCP Server version")
+var version = flag.Bool("version", false, "Show LCP Server version and Go version, then exit")
 
 // Version must be set via -ldflags '-X'
 var Version string
@@ -36,5 +37,13 @@ func init() {
 }
 
 func printVersion() {
-	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "%s\n", Version)
+	v := Version
+	if v == "" {
+		v = "unknown"
+	}
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "%s\n", v)
+	if sv := ShortVersion(); sv != "" && sv != v {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "short version: %s\n", sv)
+	}
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "go version: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
 }
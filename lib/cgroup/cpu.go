@@ -1,73 +1,180 @@
 package cgroup
 
 import (
+	"flag"
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"lcp.io/lcp/lib/logger"
 )
 
+var autoMaxProcs = flag.Bool("runtime.autoMaxProcs", false, "Whether to set GOMAXPROCS to the cgroup CPU quota rounded up to the next integer instead of the number of host CPU cores. "+
+	"GOMAXPROCS is updated when the CPU quota changes. This option is ignored if GOMAXPROCS environment variable is set")
+
 // AvailableCPUs returns the number of available CPU cores for the app.
 //
 // The number is rounded to the next integer value if fractional number of CPU cores are available.
 func AvailableCPUs() int {
+	cpuLimitsGlobal.refresh()
 	return runtime.GOMAXPROCS(-1)
 }
 
-func init() {
-	cpuQuota := getCPUQuota()
-	if cpuQuota > 0 {
-		updateGOMAXPROCSToCPUQuota(cpuQuota)
-	}
-	cpuCoresAvailable := float64(runtime.NumCPU())
-	if cpuQuota > 0 && cpuCoresAvailable > cpuQuota {
-		cpuCoresAvailable = cpuQuota
+// CPULimitFromCgroup returns true if the number of available CPU cores is limited by cgroup CPU quota.
+func CPULimitFromCgroup() bool {
+	cpuLimitsGlobal.refresh()
+	cpuLimitsGlobal.mu.Lock()
+	defer cpuLimitsGlobal.mu.Unlock()
+	return cpuLimitsGlobal.fromCgroup
+}
+
+// cpuLimitsRefreshInterval is the interval for re-reading cgroup CPU quota, since it may change at runtime,
+// e.g. after vertical autoscaling of the container
+const cpuLimitsRefreshInterval = 10 * time.Second
+
+// cpuLimits holds the CPU quota, which is re-read every cpuLimitsRefreshInterval
+type cpuLimits struct {
+	// getQuota, numCPU, now and setGOMAXPROCS are replaced in tests
+	getQuota      func() (float64, bool)
+	numCPU        func() int
+	now           func() time.Time
+	setGOMAXPROCS func(n int) int
+
+	mu             sync.Mutex
+	updateTime     time.Time
+	quota          float64
+	fromCgroup     bool
+	coresAvailable float64
+
+	// autoMaxProcs is set if GOMAXPROCS must follow the CPU quota according to -runtime.autoMaxProcs
+	autoMaxProcs bool
+
+	// gomaxprocsQuota is the CPU quota GOMAXPROCS has been set to according to -runtime.autoMaxProcs
+	gomaxprocsQuota float64
+}
+
+func newCPULimits() *cpuLimits {
+	return &cpuLimits{
+		getQuota:      getCPUQuota,
+		numCPU:        runtime.NumCPU,
+		now:           time.Now,
+		setGOMAXPROCS: runtime.GOMAXPROCS,
 	}
-	metrics.NewGauge(`process_cpu_cores_available`, func() float64 {
-		return cpuCoresAvailable
-	})
 }
 
-// updateGOMAXPROCSToCPUQuota updates GOMAXPROCS to cpuQuota if GOMAXPROCS isn't set in environment var
-func updateGOMAXPROCSToCPUQuota(cpuQuota float64) {
+var cpuLimitsGlobal = newCPULimits()
+
+var autoMaxProcsOnce sync.Once
+
+// SetupAutoMaxProcs sets GOMAXPROCS to the cgroup CPU quota if -runtime.autoMaxProcs is set.
+//
+// The CPU quota is re-read every cpuLimitsRefreshInterval afterwards and GOMAXPROCS is updated when it changes.
+// Setting GOMAXPROCS explicitly disables the Go runtime updates of GOMAXPROCS according to the CPU limit,
+// so the periodic re-read doesn't depend on calls to AvailableCPUs. This function must be called after flag.Parse.
+func SetupAutoMaxProcs() {
+	if !*autoMaxProcs {
+		return
+	}
 	if v := os.Getenv("GOMAXPROCS"); v != "" {
 		// Do not override explicitly set GOMAXPROCS.
+		logger.Infof("ignoring -runtime.autoMaxProcs, since GOMAXPROCS=%s environment variable is set", v)
 		return
 	}
+	autoMaxProcsOnce.Do(func() {
+		cpuLimitsGlobal.enableAutoMaxProcs()
+		go func() {
+			t := time.NewTicker(cpuLimitsRefreshInterval)
+			defer t.Stop()
+			for range t.C {
+				cpuLimitsGlobal.update()
+			}
+		}()
+	})
+}
+
+// enableAutoMaxProcs sets GOMAXPROCS to the current CPU quota and makes update set it to the changed quota
+func (cl *cpuLimits) enableAutoMaxProcs() {
+	cl.mu.Lock()
+	cl.autoMaxProcs = true
+	cl.mu.Unlock()
+	cl.update()
+}
+
+func init() {
+	cpuLimitsGlobal.update()
+	metrics.NewGauge(`process_cpu_cores_available`, func() float64 {
+		cpuLimitsGlobal.refresh()
+		cpuLimitsGlobal.mu.Lock()
+		defer cpuLimitsGlobal.mu.Unlock()
+		return cpuLimitsGlobal.coresAvailable
+	})
+}
+
+// refresh re-reads CPU limits if they weren't updated during the last cpuLimitsRefreshInterval
+func (cl *cpuLimits) refresh() {
+	cl.mu.Lock()
+	needUpdate := cl.now().Sub(cl.updateTime) > cpuLimitsRefreshInterval
+	cl.mu.Unlock()
+	if needUpdate {
+		cl.update()
+	}
+}
 
-	// Round gomaxprocs to the floor of cpuQuota, since Go runtime doesn't work well
-	// with fractional available CPU cores
-	gomaxprocs := int(cpuQuota)
-	if gomaxprocs <= 0 {
-		gomaxprocs = 1
+func (cl *cpuLimits) update() {
+	quota, fromCgroup := cl.getQuota()
+	coresAvailable := float64(cl.numCPU())
+	if quota > 0 && coresAvailable > quota {
+		coresAvailable = quota
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.updateTime.IsZero() && quota != cl.quota {
+		logger.Infof("CPU quota has been changed from %.1f to %.1f CPUs", cl.quota, quota)
 	}
-	if cpuQuota > float64(gomaxprocs) {
-		logger.Warnf("rounding CPU quota %.1f to %d CPUs for performance reasons", cpuQuota, gomaxprocs)
+	if cl.autoMaxProcs && quota > 0 && quota != cl.gomaxprocsQuota {
+		gomaxprocs := getGOMAXPROCSForQuota(quota, cl.numCPU())
+		prev := cl.setGOMAXPROCS(gomaxprocs)
+		logger.Infof("set GOMAXPROCS=%d according to CPU quota %.1f and -runtime.autoMaxProcs; previous GOMAXPROCS=%d", gomaxprocs, quota, prev)
+		cl.gomaxprocsQuota = quota
 	}
+	cl.quota = quota
+	cl.fromCgroup = fromCgroup
+	cl.coresAvailable = coresAvailable
+	cl.updateTime = cl.now()
+}
 
-	numCPU := runtime.NumCPU()
+// getGOMAXPROCSForQuota returns GOMAXPROCS for the given cpuQuota and the number of CPU cores
+func getGOMAXPROCSForQuota(cpuQuota float64, numCPU int) int {
+	// Round gomaxprocs to the ceiling of cpuQuota, so fractional CPU quota isn't left unused
+	gomaxprocs := int(math.Ceil(cpuQuota))
 	if gomaxprocs > numCPU {
 		// There is no sense in setting more GOMAXPROCS than the number of available CPU cores.
 		gomaxprocs = numCPU
 	}
-
-	runtime.GOMAXPROCS(gomaxprocs)
+	if gomaxprocs <= 0 {
+		gomaxprocs = 1
+	}
+	return gomaxprocs
 }
 
-func getCPUQuota() float64 {
-	cpuQuota, err := getCPUQuotaGeneric()
+// getCPUQuota returns CPU quota for the app and whether the quota is set by cgroup
+func getCPUQuota() (float64, bool) {
+	quota, err := getCPUQuotaGeneric()
 	if err != nil {
-		return 0
+		return 0, false
 	}
-	if cpuQuota <= 0 {
+	if quota <= 0 {
 		// The quota isn't set. This may be the case in multilevel containers.
-		return getOnlineCPUCount()
+		return getOnlineCPUCount(), false
 	}
-	return cpuQuota
+	return quota, true
 }
 
 func getCPUQuotaGeneric() (float64, error) {
@@ -0,0 +1,166 @@
+package cgroup
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+// fakeClock is a clock for tests, which is advanced manually
+type fakeClock struct {
+	t time.Time
+}
+
+func (fc *fakeClock) now() time.Time {
+	return fc.t
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.t = fc.t.Add(d)
+}
+
+func TestCPULimitsRefresh(t *testing.T) {
+	var sb strings.Builder
+	logger.SetOutputForTests(&sb)
+	defer logger.ResetOutputForTest()
+
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	quota := 2.0
+	fromCgroup := true
+	reads := 0
+	cl := &cpuLimits{
+		getQuota: func() (float64, bool) {
+			reads++
+			return quota, fromCgroup
+		},
+		numCPU: func() int { return 8 },
+		now:    clock.now,
+	}
+
+	f := func(advance time.Duration, readsExpected int, coresExpected float64, fromCgroupExpected bool, logExpected string) {
+		t.Helper()
+		sb.Reset()
+		clock.advance(advance)
+		cl.refresh()
+		if reads != readsExpected {
+			t.Fatalf("unexpected number of CPU quota reads; got %d; want %d", reads, readsExpected)
+		}
+		if cl.coresAvailable != coresExpected {
+			t.Fatalf("unexpected number of available CPU cores; got %g; want %g", cl.coresAvailable, coresExpected)
+		}
+		if cl.fromCgroup != fromCgroupExpected {
+			t.Fatalf("unexpected fromCgroup; got %v; want %v", cl.fromCgroup, fromCgroupExpected)
+		}
+		if logExpected == "" {
+			if sb.Len() > 0 {
+				t.Fatalf("unexpected log output: %s", sb.String())
+			}
+		} else if !strings.Contains(sb.String(), logExpected) {
+			t.Fatalf("missing %q in the log output: %s", logExpected, sb.String())
+		}
+	}
+
+	// the quota is read on the first call
+	f(0, 1, 2, true, "")
+
+	// the quota isn't re-read during the refresh interval
+	quota = 4
+	f(time.Second, 1, 2, true, "")
+	f(cpuLimitsRefreshInterval-time.Second, 1, 2, true, "")
+
+	// the changed quota is read after the refresh interval
+	f(time.Second, 2, 4, true, "CPU quota has been changed from 2.0 to 4.0 CPUs")
+
+	// the unchanged quota isn't logged
+	f(cpuLimitsRefreshInterval+time.Second, 3, 4, true, "")
+
+	// the quota exceeding the number of CPU cores is limited by it
+	quota = 12.5
+	f(cpuLimitsRefreshInterval+time.Second, 4, 8, true, "CPU quota has been changed from 4.0 to 12.5 CPUs")
+
+	// the cgroup quota has been removed, so the number of online CPUs is used
+	quota = 6
+	fromCgroup = false
+	f(cpuLimitsRefreshInterval+time.Second, 5, 6, false, "CPU quota has been changed from 12.5 to 6.0 CPUs")
+}
+
+func TestGetGOMAXPROCSForQuota(t *testing.T) {
+	f := func(cpuQuota float64, numCPU, expected int) {
+		t.Helper()
+		if n := getGOMAXPROCSForQuota(cpuQuota, numCPU); n != expected {
+			t.Fatalf("unexpected GOMAXPROCS for CPU quota %g and %d CPU cores; got %d; want %d", cpuQuota, numCPU, n, expected)
+		}
+	}
+
+	// fractional quota is rounded up
+	f(0.1, 8, 1)
+	f(1.5, 8, 2)
+	f(2, 8, 2)
+	f(2.01, 8, 3)
+
+	// the quota exceeding the number of CPU cores is limited by it
+	f(12.5, 8, 8)
+	f(64, 64, 64)
+
+	// GOMAXPROCS is at least 1
+	f(0, 8, 1)
+	f(0.5, 0, 1)
+}
+
+func TestCPULimitsAutoMaxProcs(t *testing.T) {
+	logger.SetOutputForTests(io.Discard)
+	defer logger.ResetOutputForTest()
+
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	quota := 1.5
+	gomaxprocs := 64
+	var gomaxprocsUpdates []int
+	cl := &cpuLimits{
+		getQuota: func() (float64, bool) {
+			return quota, true
+		},
+		numCPU: func() int { return 64 },
+		now:    clock.now,
+		setGOMAXPROCS: func(n int) int {
+			prev := gomaxprocs
+			gomaxprocs = n
+			gomaxprocsUpdates = append(gomaxprocsUpdates, n)
+			return prev
+		},
+	}
+
+	f := func(advance time.Duration, updatesExpected []int) {
+		t.Helper()
+		clock.advance(advance)
+		cl.refresh()
+		if !reflect.DeepEqual(gomaxprocsUpdates, updatesExpected) {
+			t.Fatalf("unexpected GOMAXPROCS updates; got %v; want %v", gomaxprocsUpdates, updatesExpected)
+		}
+	}
+
+	// GOMAXPROCS isn't updated until -runtime.autoMaxProcs is enabled
+	f(0, nil)
+	cl.enableAutoMaxProcs()
+	f(0, []int{2})
+
+	// GOMAXPROCS isn't updated if the quota isn't changed
+	f(cpuLimitsRefreshInterval+time.Second, []int{2})
+
+	// GOMAXPROCS is re-applied when the quota changes
+	quota = 3.2
+	f(time.Second, []int{2})
+	f(cpuLimitsRefreshInterval, []int{2, 4})
+	quota = 0.5
+	f(cpuLimitsRefreshInterval+time.Second, []int{2, 4, 1})
+
+	// the quota isn't set, so GOMAXPROCS is kept
+	quota = -1
+	f(cpuLimitsRefreshInterval+time.Second, []int{2, 4, 1})
+	if gomaxprocs != 1 {
+		t.Fatalf("unexpected GOMAXPROCS; got %d; want 1", gomaxprocs)
+	}
+}
@@ -0,0 +1,184 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ErrOpen is returned by CircuitBreaker.Execute without calling the function while the circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a CircuitBreaker.
+type State int
+
+const (
+	// StateClosed lets all calls pass and counts consecutive failures.
+	StateClosed State = iota
+	// StateOpen rejects all calls with ErrOpen until the open timeout expires.
+	StateOpen
+	// StateHalfOpen lets a single probe call pass; its result closes or re-opens the circuit.
+	StateHalfOpen
+)
+
+// String returns the name of s as used in metric labels
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// CircuitBreaker stops calling a failing backend after a number of consecutive failures,
+// so the failures do not cascade to the callers.
+//
+// The state is exposed as lcp_circuitbreaker_state{name="..."} gauge (0 - closed, 1 - open, 2 - half-open)
+// and state transitions are counted in lcp_circuitbreaker_transitions_total{name="...",state="..."}.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu            sync.Mutex
+	state         State
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New returns a CircuitBreaker, which opens after failureThreshold consecutive failures
+// and lets a probe call pass after openTimeout.
+//
+// name must be unique across the process, since it is used as metric label.
+func New(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+	cb := &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+	metrics.GetOrCreateGauge(fmt.Sprintf(`lcp_circuitbreaker_state{name=%q}`, name), func() float64 {
+		return float64(cb.State())
+	})
+	return cb
+}
+
+// Name returns the name of cb
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// State returns the current state of cb
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.currentStateLocked()
+}
+
+// Execute calls fn if cb allows it and records its result.
+//
+// It returns ErrOpen without calling fn if the circuit is open or a half-open probe is already in flight.
+// Any non-nil error returned by fn is counted as a failure, except of context.Canceled,
+// which means the caller has given up on the call, e.g. the client has closed the connection.
+// Such calls are counted neither as failures nor as successes.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+	err := fn()
+	if errors.Is(err, context.Canceled) {
+		cb.cancel()
+		return err
+	}
+	cb.after(err == nil)
+	return err
+}
+
+func (cb *CircuitBreaker) before() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.currentStateLocked() {
+	case StateOpen:
+		return ErrOpen
+	case StateHalfOpen:
+		if cb.probeInFlight {
+			return ErrOpen
+		}
+		cb.probeInFlight = true
+	}
+	return nil
+}
+
+// cancel releases the half-open probe slot without changing the state, so the next call becomes the probe
+func (cb *CircuitBreaker) cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.currentStateLocked() == StateHalfOpen {
+		cb.probeInFlight = false
+	}
+}
+
+func (cb *CircuitBreaker) after(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state := cb.currentStateLocked()
+	if state == StateHalfOpen {
+		cb.probeInFlight = false
+	}
+	if success {
+		cb.failures = 0
+		if state == StateHalfOpen {
+			cb.setStateLocked(StateClosed)
+		}
+		return
+	}
+	switch state {
+	case StateClosed:
+		cb.failures++
+		if cb.failures >= cb.failureThreshold {
+			cb.setStateLocked(StateOpen)
+		}
+	case StateHalfOpen:
+		cb.setStateLocked(StateOpen)
+	}
+}
+
+// currentStateLocked moves an open circuit to half-open once openTimeout has passed.
+func (cb *CircuitBreaker) currentStateLocked() State {
+	if cb.state == StateOpen && cb.now().Sub(cb.openedAt) >= cb.openTimeout {
+		cb.setStateLocked(StateHalfOpen)
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setStateLocked(s State) {
+	if cb.state == s {
+		return
+	}
+	cb.state = s
+	cb.failures = 0
+	cb.probeInFlight = false
+	if s == StateOpen {
+		cb.openedAt = cb.now()
+	}
+	metrics.GetOrCreateCounter(fmt.Sprintf(`lcp_circuitbreaker_transitions_total{name=%q,state=%q}`, cb.name, s)).Inc()
+}
@@ -0,0 +1,114 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	cb := New("test", 2, time.Second)
+	cb.now = func() time.Time { return now }
+
+	errBackend := errors.New("backend failure")
+	fail := func() error { return errBackend }
+	succeed := func() error { return nil }
+
+	f := func(fn func() error, resultExpected error, stateExpected State) {
+		t.Helper()
+		if err := cb.Execute(fn); !errors.Is(err, resultExpected) {
+			t.Fatalf("unexpected error; got %v; want %v", err, resultExpected)
+		}
+		if state := cb.State(); state != stateExpected {
+			t.Fatalf("unexpected state; got %s; want %s", state, stateExpected)
+		}
+	}
+
+	// consecutive failures open the circuit
+	f(fail, errBackend, StateClosed)
+	f(succeed, nil, StateClosed)
+	f(fail, errBackend, StateClosed)
+	f(fail, errBackend, StateOpen)
+
+	// open circuit rejects calls without calling fn
+	f(func() error {
+		t.Fatalf("unexpected call while the circuit is open")
+		return nil
+	}, ErrOpen, StateOpen)
+
+	// failed probe re-opens the circuit
+	now = now.Add(time.Second)
+	if state := cb.State(); state != StateHalfOpen {
+		t.Fatalf("unexpected state; got %s; want %s", state, StateHalfOpen)
+	}
+	f(fail, errBackend, StateOpen)
+	f(succeed, ErrOpen, StateOpen)
+
+	// successful probe closes the circuit
+	now = now.Add(time.Second)
+	f(succeed, nil, StateClosed)
+	f(fail, errBackend, StateClosed)
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	now := time.Unix(0, 0)
+	cb := New("test_single_probe", 1, time.Second)
+	cb.now = func() time.Time { return now }
+
+	_ = cb.Execute(func() error { return errors.New("failure") })
+	now = now.Add(time.Second)
+
+	err := cb.Execute(func() error {
+		// concurrent calls are rejected while the probe is in flight
+		if err := cb.Execute(func() error { return nil }); !errors.Is(err, ErrOpen) {
+			t.Fatalf("unexpected error for concurrent call; got %v; want %v", err, ErrOpen)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state := cb.State(); state != StateClosed {
+		t.Fatalf("unexpected state; got %s; want %s", state, StateClosed)
+	}
+}
+
+func TestCircuitBreaker_Canceled(t *testing.T) {
+	now := time.Unix(0, 0)
+	cb := New("test_canceled", 2, time.Second)
+	cb.now = func() time.Time { return now }
+
+	errBackend := errors.New("backend failure")
+	errCanceled := fmt.Errorf("cannot call backend: %w", context.Canceled)
+	f := func(fnErr error, stateExpected State) {
+		t.Helper()
+		if err := cb.Execute(func() error { return fnErr }); !errors.Is(err, fnErr) {
+			t.Fatalf("unexpected error; got %v; want %v", err, fnErr)
+		}
+		if state := cb.State(); state != stateExpected {
+			t.Fatalf("unexpected state; got %s; want %s", state, stateExpected)
+		}
+	}
+
+	// canceled calls don't count as failures
+	f(errBackend, StateClosed)
+	f(errCanceled, StateClosed)
+	f(errCanceled, StateClosed)
+	f(errBackend, StateOpen)
+
+	// canceled calls don't reset the consecutive failures either
+	now = now.Add(time.Second)
+	f(nil, StateClosed)
+	f(errBackend, StateClosed)
+	f(errCanceled, StateClosed)
+	f(errBackend, StateOpen)
+
+	// canceled probe keeps the circuit half-open and lets the next call probe the backend
+	now = now.Add(time.Second)
+	f(errCanceled, StateHalfOpen)
+	f(errCanceled, StateHalfOpen)
+	f(nil, StateClosed)
+}
@@ -16,6 +16,10 @@ type Config struct {
 	Logger   LoggerConfig   `yaml:"logger"`
 	OIDC     OIDCConfig     `yaml:"oidc"`
 	Admin    AdminConfig    `yaml:"admin"`
+
+	// Flags contains values for command-line flags, which can be changed at runtime.
+	// They are applied on startup and on config reload unless the corresponding flags are set via command line.
+	Flags map[string]string `yaml:"flags"`
 }
 
 // AdminConfig holds the initial admin user configuration.
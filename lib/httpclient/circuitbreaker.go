@@ -0,0 +1,62 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"lcp.io/lcp/lib/circuitbreaker"
+)
+
+// CircuitBreakerTransport is an http.RoundTripper, which sends requests via CircuitBreaker,
+// so requests to a failing backend fail fast instead of cascading the failure to the callers.
+//
+// Transport errors and responses with 5xx status codes are counted as failures. 5xx responses are still
+// returned to the caller as is. Requests rejected by the open circuit fail with an error wrapping circuitbreaker.ErrOpen.
+// Requests canceled by the caller are counted neither as failures nor as successes.
+type CircuitBreakerTransport struct {
+	// Transport is used for sending requests. http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+
+	// CircuitBreaker tracks the failures of the backend. Requests are passed to Transport as is if it is nil.
+	CircuitBreaker *circuitbreaker.CircuitBreaker
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.CircuitBreaker == nil {
+		return t.transport().RoundTrip(req)
+	}
+	var resp *http.Response
+	err := t.CircuitBreaker.Execute(func() error {
+		r, err := t.transport().RoundTrip(req)
+		if err != nil {
+			if errors.Is(req.Context().Err(), context.Canceled) {
+				// The caller has given up on the request, so it isn't a backend failure.
+				// Wrap context.Canceled, since the transport may return other errors for canceled requests
+				return fmt.Errorf("%w: %w", context.Canceled, err)
+			}
+			return err
+		}
+		resp = r
+		if r.StatusCode >= 500 {
+			return fmt.Errorf("unexpected response status code %d", r.StatusCode)
+		}
+		return nil
+	})
+	if resp != nil {
+		return resp, nil
+	}
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		return nil, fmt.Errorf("cannot send request to %s: %w", req.URL.Host, err)
+	}
+	return nil, err
+}
+
+func (t *CircuitBreakerTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,92 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lcp.io/lcp/lib/circuitbreaker"
+)
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var calls atomic.Int32
+	var statusCode atomic.Int32
+	statusCode.Store(http.StatusInternalServerError)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(statusCode.Load()))
+	}))
+	defer srv.Close()
+
+	cb := circuitbreaker.New("test_httpclient_transport", 2, 50*time.Millisecond)
+	client := &http.Client{Transport: &CircuitBreakerTransport{CircuitBreaker: cb}}
+
+	f := func(statusCodeExpected int, errExpected error) {
+		t.Helper()
+		resp, err := client.Get(srv.URL)
+		if errExpected != nil {
+			if !errors.Is(err, errExpected) {
+				t.Fatalf("unexpected error; got %v; want %v", err, errExpected)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, statusCodeExpected)
+		}
+	}
+
+	// 5xx responses are returned to the caller and open the circuit after 2 failures
+	f(http.StatusInternalServerError, nil)
+	f(http.StatusInternalServerError, nil)
+	if state := cb.State(); state != circuitbreaker.StateOpen {
+		t.Fatalf("unexpected state; got %s; want %s", state, circuitbreaker.StateOpen)
+	}
+
+	// the backend isn't called while the circuit is open
+	callsBefore := calls.Load()
+	f(0, circuitbreaker.ErrOpen)
+	if n := calls.Load() - callsBefore; n != 0 {
+		t.Fatalf("unexpected number of backend calls for the open circuit; got %d; want 0", n)
+	}
+
+	// the successful probe closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	statusCode.Store(http.StatusOK)
+	f(http.StatusOK, nil)
+	if state := cb.State(); state != circuitbreaker.StateClosed {
+		t.Fatalf("unexpected state; got %s; want %s", state, circuitbreaker.StateClosed)
+	}
+}
+
+func TestCircuitBreakerTransport_Canceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cb := circuitbreaker.New("test_httpclient_transport_canceled", 1, time.Minute)
+	client := &http.Client{Transport: &CircuitBreakerTransport{CircuitBreaker: cb}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error; got %v; want %v", err, context.Canceled)
+	}
+	if state := cb.State(); state != circuitbreaker.StateClosed {
+		t.Fatalf("the canceled request mustn't open the circuit; got state %s", state)
+	}
+}
@@ -0,0 +1,128 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var hedgedRequests = metrics.NewCounter(`lcp_httpclient_hedged_requests_total`)
+
+var hedgeDelayKey = any("hedgeDelay")
+
+// WithHedgeDelay returns a copy of ctx, which enables request hedging in HedgedTransport for requests using it.
+//
+// If the request hasn't received a response within delay, then a second identical request is sent.
+// The first response wins and the other request is cancelled.
+func WithHedgeDelay(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, hedgeDelayKey, delay)
+}
+
+// HedgedTransport is an http.RoundTripper, which sends a hedged request for idempotent requests
+// with the delay set via WithHedgeDelay. This reduces tail latency for read-heavy backends
+// at the cost of an additional request to the backend for slow responses.
+//
+// Requests without hedge delay, with non-idempotent methods or with a body are passed to Transport as is.
+type HedgedTransport struct {
+	// Transport is used for sending requests. http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+}
+
+type hedgeResult struct {
+	idx  int
+	resp *http.Response
+	err  error
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *HedgedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, ok := req.Context().Value(hedgeDelayKey).(time.Duration)
+	if !ok || delay <= 0 || !isHedgeable(req) {
+		return t.transport().RoundTrip(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.transport().RoundTrip(req.Clone(ctx))
+			results <- hedgeResult{idx: idx, resp: resp, err: err}
+		}()
+	}
+
+	send()
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			hedgedRequests.Inc()
+			send()
+			pending++
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				for i, cancel := range cancels {
+					if i != res.idx {
+						cancel()
+					}
+				}
+				go discardHedgeResults(results, pending, cancels)
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: cancels[res.idx]}
+				return res.resp, nil
+			}
+			cancels[res.idx]()
+			if pending == 0 {
+				// either the hedged request failed as well or the first request failed before the delay
+				return nil, res.err
+			}
+		}
+	}
+}
+
+func (t *HedgedTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// discardHedgeResults releases the resources of n requests, which lost the race
+func discardHedgeResults(results <-chan hedgeResult, n int, cancels []context.CancelFunc) {
+	for i := 0; i < n; i++ {
+		res := <-results
+		if res.resp != nil {
+			_ = res.resp.Body.Close()
+		}
+		cancels[res.idx]()
+	}
+}
+
+// isHedgeable returns true if req may be sent twice
+func isHedgeable(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// cancelOnClose cancels the request context of the winning request when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,91 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedTransport(t *testing.T) {
+	var calls atomic.Int32
+	var cancelled atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// the first request is slow and must be cancelled after the hedged request wins
+			select {
+			case <-r.Context().Done():
+				cancelled.Add(1)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "hedged")
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &HedgedTransport{}}
+	req, err := http.NewRequestWithContext(WithHedgeDelay(context.Background(), 10*time.Millisecond), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	hedgedBefore := hedgedRequests.Get()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("cannot read response body: %v", err)
+	}
+	if string(body) != "hedged" {
+		t.Fatalf("unexpected response; got %q; want %q", body, "hedged")
+	}
+	if n := hedgedRequests.Get() - hedgedBefore; n != 1 {
+		t.Fatalf("unexpected number of hedged requests; got %d; want 1", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cancelled.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the slow request wasn't cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgedTransport_NoHedging(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &HedgedTransport{}}
+	f := func(ctx context.Context, method string) {
+		t.Helper()
+		calls.Store(0)
+		req, err := http.NewRequestWithContext(ctx, method, srv.URL, strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("unexpected number of backend calls for %s; got %d; want 1", method, n)
+		}
+	}
+
+	// hedging isn't enabled for the request
+	f(context.Background(), http.MethodGet)
+	// non-idempotent method
+	f(WithHedgeDelay(context.Background(), time.Millisecond), http.MethodPost)
+}
@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	cleanPath = flag.Bool("http.cleanPath", false, "Whether to collapse duplicate slashes and resolve '.' and '..' segments in request paths before routing, "+
+		"e.g. '/apis//v1/./users' becomes '/apis/v1/users'. Paths escaping the root via '..' are rejected with '400 Bad Request'. "+
+		"Path parameters, which legitimately contain duplicate slashes such as wildcards, must encode them as %2F, since only unencoded slashes are collapsed. "+
+		"See also -http.cleanPathRedirect")
+	cleanPathRedirect = flag.Bool("http.cleanPathRedirect", false, "Whether to redirect requests to the canonical path instead of serving them, if -http.cleanPath is set. "+
+		"GET and HEAD requests are redirected with '302 Found', the rest of requests with '307 Temporary Redirect', so the method and body are preserved")
+)
+
+var pathTraversalErrors = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="path_traversal"}`)
+
+// cleanEscapedPath collapses duplicate slashes and resolves "." and ".." segments of the escaped path p.
+// Segments are compared in the decoded form, so "%2e%2e" is resolved as "..", while encoded slashes (%2F)
+// stay within their segments. A trailing slash is preserved.
+//
+// It returns false if p escapes the root via "..".
+func cleanEscapedPath(p string) (string, bool) {
+	segments := strings.Split(p, "/")
+	result := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			decoded = segment
+		}
+		switch decoded {
+		case "", ".":
+		case "..":
+			if len(result) == 0 {
+				return "", false
+			}
+			result = result[:len(result)-1]
+		default:
+			result = append(result, segment)
+		}
+	}
+	cleaned := "/" + strings.Join(result, "/")
+	if len(result) > 0 && hasTrailingSlash(p) {
+		cleaned += "/"
+	}
+	return cleaned, true
+}
+
+// hasTrailingSlash returns true if the last segment of p is a directory, e.g. for "/a/", "/a/." and "/a/.."
+func hasTrailingSlash(p string) bool {
+	n := strings.LastIndexByte(p, '/')
+	last, err := url.PathUnescape(p[n+1:])
+	if err != nil {
+		return false
+	}
+	return last == "" || last == "." || last == ".."
+}
+
+// handleCleanPath cleans the path of r if -http.cleanPath is set. See cleanEscapedPath.
+//
+// It returns false if the response has been written to w, e.g. for rejected or redirected requests.
+func handleCleanPath(w http.ResponseWriter, r *http.Request) bool {
+	if !*cleanPath {
+		return true
+	}
+	escapedPath := r.URL.EscapedPath()
+	cleaned, ok := cleanEscapedPath(escapedPath)
+	if !ok {
+		pathTraversalErrors.Inc()
+		http.Error(w, "the requested path escapes the root via '..'", http.StatusBadRequest)
+		return false
+	}
+	if cleaned == escapedPath {
+		return true
+	}
+	if *cleanPathRedirect {
+		code := http.StatusFound
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusTemporaryRedirect
+		}
+		RedirectWithStatus(w, r, cleaned, code)
+		return false
+	}
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot parse the cleaned path: %s", err), http.StatusBadRequest)
+		return false
+	}
+	r.URL.Path = u.Path
+	r.URL.RawPath = u.RawPath
+	return true
+}
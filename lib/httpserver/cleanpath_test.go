@@ -0,0 +1,107 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanEscapedPath(t *testing.T) {
+	f := func(p, resultExpected string, okExpected bool) {
+		t.Helper()
+		result, ok := cleanEscapedPath(p)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for %q; got %v; want %v", p, ok, okExpected)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %q; want %q", p, result, resultExpected)
+		}
+	}
+
+	f("/", "/", true)
+	f("", "/", true)
+	f("/apis/v1/users", "/apis/v1/users", true)
+	f("/apis/v1/users/", "/apis/v1/users/", true)
+
+	// duplicate slashes
+	f("//", "/", true)
+	f("/apis//v1///users", "/apis/v1/users", true)
+	f("///user//info//", "/user/info/", true)
+
+	// dot segments
+	f("/apis/./v1/users", "/apis/v1/users", true)
+	f("/apis/v1/../v2/users", "/apis/v2/users", true)
+	f("/apis/v1/users/..", "/apis/v1/", true)
+	f("/apis/v1/users/.", "/apis/v1/users/", true)
+	f("/apis/%2e%2E/users", "/users", true)
+	f("/a/..", "/", true)
+	f("/..a/b.", "/..a/b.", true)
+
+	// encoded slashes stay within segments
+	f("/files/a%2F%2Fb//c", "/files/a%2F%2Fb/c", true)
+	f("/files/%2F..%2F/x", "/files/%2F..%2F/x", true)
+
+	// traversal
+	f("/..", "", false)
+	f("/../etc/passwd", "", false)
+	f("/apis/../../etc/passwd", "", false)
+	f("/%2e%2e/etc/passwd", "", false)
+}
+
+func TestHandlerWrapper_CleanPath(t *testing.T) {
+	defer func(clean, redirect bool) {
+		*cleanPath = clean
+		*cleanPathRedirect = redirect
+	}(*cleanPath, *cleanPathRedirect)
+
+	var pathServed, escapedPathServed string
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		pathServed = r.URL.Path
+		escapedPathServed = r.URL.EscapedPath()
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	f := func(method, requestURI string, statusCodeExpected int, pathExpected, escapedPathExpected, locationExpected string) {
+		t.Helper()
+		pathServed, escapedPathServed = "", ""
+		rec := httptest.NewRecorder()
+		handlerWrapper(rec, httptest.NewRequest(method, requestURI, nil), rh)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s %s; got %d; want %d; body: %s", method, requestURI, rec.Code, statusCodeExpected, rec.Body.String())
+		}
+		if pathServed != pathExpected {
+			t.Fatalf("unexpected path for %s; got %q; want %q", requestURI, pathServed, pathExpected)
+		}
+		if escapedPathServed != escapedPathExpected {
+			t.Fatalf("unexpected escaped path for %s; got %q; want %q", requestURI, escapedPathServed, escapedPathExpected)
+		}
+		if location := rec.Header().Get("Location"); location != locationExpected {
+			t.Fatalf("unexpected Location for %s; got %q; want %q", requestURI, location, locationExpected)
+		}
+	}
+
+	// disabled by default
+	*cleanPath = false
+	*cleanPathRedirect = false
+	f(http.MethodGet, "/apis//v1/./users", http.StatusNoContent, "/apis//v1/./users", "/apis//v1/./users", "")
+	f(http.MethodGet, "/../etc/passwd", http.StatusNoContent, "/../etc/passwd", "/../etc/passwd", "")
+
+	// the path is cleaned before routing
+	*cleanPath = true
+	f(http.MethodGet, "/apis//v1/./users?limit=10", http.StatusNoContent, "/apis/v1/users", "/apis/v1/users", "")
+	f(http.MethodGet, "/files//a%2F%2Fb", http.StatusNoContent, "/files/a//b", "/files/a%2F%2Fb", "")
+	f(http.MethodGet, "/apis/v1/users", http.StatusNoContent, "/apis/v1/users", "/apis/v1/users", "")
+
+	traversalsBefore := pathTraversalErrors.Get()
+	f(http.MethodGet, "/apis/../../etc/passwd", http.StatusBadRequest, "", "", "")
+	if n := pathTraversalErrors.Get() - traversalsBefore; n != 1 {
+		t.Fatalf("unexpected number of path traversal errors; got %d; want 1", n)
+	}
+
+	// redirect to the canonical path
+	*cleanPathRedirect = true
+	f(http.MethodGet, "/apis//v1/./users?limit=10", http.StatusFound, "", "", "/apis/v1/users?limit=10")
+	f(http.MethodPost, "/apis//v1/users", http.StatusTemporaryRedirect, "", "", "/apis/v1/users")
+	f(http.MethodGet, "/apis/v1/users", http.StatusNoContent, "/apis/v1/users", "/apis/v1/users", "")
+	f(http.MethodGet, "/../etc/passwd", http.StatusBadRequest, "", "", "")
+}
@@ -2,12 +2,14 @@ package httpserver
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"sync/atomic"
+	"time"
 
+	"lcp.io/lcp/lib/appmetrics"
 	"lcp.io/lcp/lib/fasttime"
+	"lcp.io/lcp/lib/logger"
 
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -25,23 +27,37 @@ type connMetrics struct {
 
 	closeErrors *metrics.Counter
 
-	conns *metrics.Gauge
+	conns        *metrics.Gauge
+	closedConns  *metrics.Counter
+	connLifetime *metrics.Histogram
 }
 
 func (cm *connMetrics) init(ms *metrics.Set, group, name, addr string) {
-	cm.readCalls = ms.NewCounter(fmt.Sprintf(`%s_read_calls_total{name=%q, addr=%q}`, group, name, addr))
-	cm.readBytes = ms.NewCounter(fmt.Sprintf(`%s_read_bytes_total{name=%q, addr=%q}`, group, name, addr))
-	cm.readErrors = ms.NewCounter(fmt.Sprintf(`%s_errors_total{name=%q, addr=%q, type="read"}`, group, name, addr))
-	cm.readTimeouts = ms.NewCounter(fmt.Sprintf(`%s_read_timeouts_total{name=%q, addr=%q}`, group, name, addr))
+	cm.readCalls = ms.NewCounter(listenerMetricName(group+"_read_calls_total", name, addr))
+	cm.readBytes = ms.NewCounter(listenerMetricName(group+"_read_bytes_total", name, addr))
+	cm.readErrors = ms.NewCounter(listenerMetricName(group+"_errors_total", name, addr, "type", "read"))
+	cm.readTimeouts = ms.NewCounter(listenerMetricName(group+"_read_timeouts_total", name, addr))
 
-	cm.writeCalls = ms.NewCounter(fmt.Sprintf(`%s_write_calls_total{name=%q, addr=%q}`, group, name, addr))
-	cm.writtenBytes = ms.NewCounter(fmt.Sprintf(`%s_written_bytes_total{name=%q, addr=%q}`, group, name, addr))
-	cm.writeErrors = ms.NewCounter(fmt.Sprintf(`%s_errors_total{name=%q, addr=%q, type="write"}`, group, name, addr))
-	cm.writeTimeouts = ms.NewCounter(fmt.Sprintf(`%s_write_timeouts_total{name=%q, addr=%q}`, group, name, addr))
+	cm.writeCalls = ms.NewCounter(listenerMetricName(group+"_write_calls_total", name, addr))
+	cm.writtenBytes = ms.NewCounter(listenerMetricName(group+"_written_bytes_total", name, addr))
+	cm.writeErrors = ms.NewCounter(listenerMetricName(group+"_errors_total", name, addr, "type", "write"))
+	cm.writeTimeouts = ms.NewCounter(listenerMetricName(group+"_write_timeouts_total", name, addr))
 
-	cm.closeErrors = ms.NewCounter(fmt.Sprintf(`%s_errors_total{name=%q, addr=%q, type="close"}`, group, name, addr))
+	cm.closeErrors = ms.NewCounter(listenerMetricName(group+"_errors_total", name, addr, "type", "close"))
 
-	cm.conns = ms.NewGauge(fmt.Sprintf(`%s_conns{name=%q, addr=%q}`, group, name, addr), nil)
+	cm.conns = ms.NewGauge(listenerMetricName(group+"_conns", name, addr), nil)
+	cm.closedConns = ms.NewCounter(listenerMetricName(group+"_closed_conns_total", name, addr))
+	cm.connLifetime = ms.NewHistogram(listenerMetricName(group+"_conn_lifetime_seconds", name, addr))
+}
+
+// listenerMetricName returns the name of the metric for the listener with the given name and addr.
+// The addr is escaped, since it is passed by the user and may contain arbitrary chars.
+func listenerMetricName(metric, name, addr string, extraLabels ...string) string {
+	s, err := appmetrics.MetricName(metric, append([]string{"name", name, "addr", addr}, extraLabels...)...)
+	if err != nil {
+		logger.Panicf("BUG: %s", err)
+	}
+	return s
 }
 
 type statConn struct {
@@ -50,6 +66,12 @@ type statConn struct {
 	net.Conn
 
 	cm *connMetrics
+
+	// startTime is the time the connection has been accepted at
+	startTime time.Time
+
+	// connsSem is the semaphore for limiting the number of open connections. It may be nil
+	connsSem chan struct{}
 }
 
 func (sc *statConn) Read(p []byte) (int, error) {
@@ -91,6 +113,11 @@ func (sc *statConn) Close() error {
 	}
 	err := sc.Conn.Close()
 	sc.cm.conns.Dec()
+	sc.cm.closedConns.Inc()
+	sc.cm.connLifetime.UpdateDuration(sc.startTime)
+	if sc.connsSem != nil {
+		<-sc.connsSem
+	}
 	if err != nil {
 		sc.cm.closeErrors.Inc()
 	}
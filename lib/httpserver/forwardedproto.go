@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"lcp.io/lcp/lib/lflag"
+)
+
+var (
+	trustForwardedProto = flag.Bool("http.trustForwardedProto", false, "Whether to treat requests with 'X-Forwarded-Proto: https' header from -http.trustedProxies as https requests. "+
+		"This is needed behind TLS-terminating proxies for sending -http.header.hsts and for building https redirect urls")
+	trustedProxies = lflag.NewArrayString("http.trustedProxies", "IP addresses or CIDR subnets of reverse proxies, which are trusted to set X-Forwarded-* headers, "+
+		"e.g. '10.0.0.0/8'. It must be set if -http.trustForwardedProto is set. See also -http.trustForwardedProto")
+)
+
+// trustedProxyPrefixes holds parsed -http.trustedProxies. It is initialized by Serve before the servers are started
+var trustedProxyPrefixes []netip.Prefix
+
+// parseTrustedProxies parses IP addresses and CIDR subnets from -http.trustedProxies
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range proxies {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if strings.Contains(s, "/") {
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse CIDR subnet %q: %w", s, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse IP address %q: %w", s, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// initTrustedProxies validates -http.trustForwardedProto and -http.trustedProxies and initializes trustedProxyPrefixes
+func initTrustedProxies() error {
+	prefixes, err := parseTrustedProxies(*trustedProxies)
+	if err != nil {
+		return err
+	}
+	if *trustForwardedProto && len(prefixes) == 0 {
+		return fmt.Errorf("-http.trustedProxies must be set if -http.trustForwardedProto is set")
+	}
+	trustedProxyPrefixes = prefixes
+	return nil
+}
+
+// isTrustedProxy returns true if the client connection with the given remoteAddr is made by a trusted proxy
+func isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxyPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPS returns true if r has been received over TLS either directly or via a trusted TLS-terminating proxy.
+//
+// X-Forwarded-Proto is taken into account only if -http.trustForwardedProto is set and the request comes from -http.trustedProxies,
+// since otherwise clients could set it to arbitrary values
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !*trustForwardedProto || !isTrustedProxy(r.RemoteAddr) {
+		return false
+	}
+	// The first value is set by the proxy closest to the client if there is a chain of proxies
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// RequestScheme returns the scheme the client used for sending r - "https" or "http".
+//
+// It should be used for building absolute redirect urls. See -http.trustForwardedProto
+func RequestScheme(r *http.Request) string {
+	if isHTTPS(r) {
+		return "https"
+	}
+	return "http"
+}
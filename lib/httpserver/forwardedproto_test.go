@@ -0,0 +1,126 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseTrustedProxies_Success(t *testing.T) {
+	f := func(proxies []string, prefixesExpected []netip.Prefix) {
+		t.Helper()
+		prefixes, err := parseTrustedProxies(proxies)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(prefixes, prefixesExpected) {
+			t.Fatalf("unexpected prefixes for %q; got %v; want %v", proxies, prefixes, prefixesExpected)
+		}
+	}
+
+	f(nil, nil)
+	f([]string{""}, nil)
+	f([]string{"10.0.0.0/8"}, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	f([]string{"10.1.2.3/8"}, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	f([]string{"192.0.2.1", " fd00::/8 "}, []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	})
+	f([]string{"::ffff:192.0.2.1"}, []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")})
+}
+
+func TestParseTrustedProxies_Failure(t *testing.T) {
+	f := func(proxy string) {
+		t.Helper()
+		if _, err := parseTrustedProxies([]string{proxy}); err == nil {
+			t.Fatalf("expecting non-nil error for %q", proxy)
+		}
+	}
+
+	f("proxy.local")
+	f("10.0.0.0/33")
+	f("10.0.0.256")
+	f("10.0.0.1:8080")
+}
+
+func TestInitTrustedProxies(t *testing.T) {
+	defer func(v bool, proxies []string, prefixes []netip.Prefix) {
+		*trustForwardedProto = v
+		*trustedProxies = proxies
+		trustedProxyPrefixes = prefixes
+	}(*trustForwardedProto, *trustedProxies, trustedProxyPrefixes)
+
+	f := func(trust bool, proxies []string, resultExpected bool) {
+		t.Helper()
+		*trustForwardedProto = trust
+		*trustedProxies = proxies
+		err := initTrustedProxies()
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for -http.trustForwardedProto=%v -http.trustedProxies=%q; got %v; want %v; err: %v", trust, proxies, result, resultExpected, err)
+		}
+	}
+
+	f(false, nil, true)
+	f(false, []string{"10.0.0.0/8"}, true)
+	f(true, []string{"10.0.0.0/8"}, true)
+	f(true, nil, false)
+	f(true, []string{"foo"}, false)
+}
+
+func TestIsHTTPS(t *testing.T) {
+	defer func(v bool, prefixes []netip.Prefix) {
+		*trustForwardedProto = v
+		trustedProxyPrefixes = prefixes
+	}(*trustForwardedProto, trustedProxyPrefixes)
+	trustedProxyPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	f := func(remoteAddr, forwardedProto string, useTLS, resultExpected bool) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedProto != "" {
+			r.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		if useTLS {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if result := isHTTPS(r); result != resultExpected {
+			t.Fatalf("unexpected isHTTPS for remoteAddr=%q, X-Forwarded-Proto=%q, tls=%v; got %v; want %v", remoteAddr, forwardedProto, useTLS, result, resultExpected)
+		}
+		schemeExpected := "http"
+		if resultExpected {
+			schemeExpected = "https"
+		}
+		if scheme := RequestScheme(r); scheme != schemeExpected {
+			t.Fatalf("unexpected scheme for remoteAddr=%q, X-Forwarded-Proto=%q, tls=%v; got %q; want %q", remoteAddr, forwardedProto, useTLS, scheme, schemeExpected)
+		}
+	}
+
+	// X-Forwarded-Proto is ignored unless -http.trustForwardedProto is set
+	*trustForwardedProto = false
+	f("10.0.0.1:1234", "", false, false)
+	f("10.0.0.1:1234", "https", false, false)
+	f("10.0.0.1:1234", "", true, true)
+
+	*trustForwardedProto = true
+	f("10.0.0.1:1234", "https", false, true)
+	f("10.0.0.1:1234", "HTTPS", false, true)
+	f("10.0.0.1:1234", "https, http", false, true)
+	f("[fd00::1]:1234", "https", false, true)
+	f("[::ffff:10.0.0.1]:1234", "https", false, true)
+	f("10.0.0.1:1234", "http", false, false)
+	f("10.0.0.1:1234", "http, https", false, false)
+	f("10.0.0.1:1234", "", false, false)
+	f("10.0.0.1:1234", "http", true, true)
+
+	// untrusted clients cannot spoof X-Forwarded-Proto
+	f("192.0.2.1:1234", "https", false, false)
+	f("[2001:db8::1]:1234", "https", false, false)
+	f("invalid", "https", false, false)
+}
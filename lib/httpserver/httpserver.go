@@ -8,6 +8,7 @@ import (
 	"flag"
 	"fmt"
 	"html"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,6 +31,7 @@ import (
 	"lcp.io/lcp/lib/fasttime"
 	"lcp.io/lcp/lib/lflag"
 	"lcp.io/lcp/lib/logger"
+	"lcp.io/lcp/lib/utils/httputil"
 	"lcp.io/lcp/lib/utils/stringsutil"
 )
 
@@ -41,24 +44,56 @@ var (
 	disableHTTP2 = flag.Bool("http.disableHTTP2", false, "Whether to disable HTTP/2 for the server")
 	disableCORS  = flag.Bool("http.disableCORS", false, "Disable CORS for all origins (*)")
 
+	// The defaults shrink the per-stream buffer and the max frame size from the 1MB defaults of golang.org/x/net/http2,
+	// while still accommodating most API POST requests in a single frame.
+	http2MaxConcurrentStreams = flag.Int("http2.maxConcurrentStreams", 100, "The maximum number of concurrent HTTP/2 streams per client connection")
+	http2MaxFrameSize         = lflag.NewBytes("http2.maxFrameSize", 256*1024, "The maximum size of HTTP/2 frames the server reads from clients. "+
+		"Larger values allow receiving bigger request bodies in a single frame. It must be in the range [16KiB...16MiB) according to the HTTP/2 spec")
+	http2MaxUploadBufferPerStream = lflag.NewBytes("http2.maxUploadBufferPerStream", 256*1024, "The size of the HTTP/2 flow control window per stream. "+
+		"Larger values allow clients to upload bigger request bodies without waiting for window updates. "+
+		"The window per connection is -http2.maxConcurrentStreams times bigger, up to the 2GiB limit of the HTTP/2 spec")
+
 	pathPrefix = flag.String("http.pathPrefix", "", "An optional prefix to add to all the paths handled by http server. For example, if '-http.pathPrefix=/foo/bar' is set, "+
-		"then all the http requests will be handled on '/foo/bar/*' paths. This may be useful for proxied requests")
+		"then all the http requests will be handled on '/foo/bar/*' paths. This may be useful for proxied requests. "+
+		"The leading and trailing slashes are optional, so '-http.pathPrefix=/' is equivalent to no prefix")
 
 	httpAuthUsername = flag.String("httpAuth.username", "", "Username for HTTP server's Basic Auth. The authentication is disabled if empty. See also -httpAuth.password")
 	httpAuthPassword = lflag.NewPassword("httpAuth.password", "Password for HTTP server's Basic Auth. The authentication is disabled if -httpAuth.username is empty")
-	metricsAuthKey   = lflag.NewPassword("metricsAuthKey", "Auth key for /metrics endpoint. It must be passed via authKey query arg. It overrides -httpAuth.*")
-	flagsAuthKey     = lflag.NewPassword("flagsAuthKey", "Auth key for /flags endpoint. It must be passed via authKey query arg. It overrides -httpAuth.*")
-	pprofAuthKey     = lflag.NewPassword("pprofAuthKey", "Auth key for /debug/pprof/* endpoints. It must be passed via authKey query arg. It overrides -httpAuth.*")
+	metricsAuthKey   = lflag.NewPassword("metricsAuthKey", "Auth key for /metrics, /metrics.json and /debug/metrics/list endpoints. It must be passed via authKey query arg. It overrides -httpAuth.*")
+	flagsAuthKey     = lflag.NewPassword("flagsAuthKey", "Auth key for /flags and /flags.json endpoints. It must be passed via authKey query arg. It overrides -httpAuth.*")
+	pprofAuthKey     = lflag.NewPassword("pprofAuthKey", "Auth key for /debug/pprof/* and /debug/requests endpoints. It must be passed via authKey query arg. It overrides -httpAuth.*")
 
 	maxGracefulShutdownDuration = flag.Duration("http.maxGracefulShutdownDuration", 7*time.Second, `The maximum duration for a graceful shutdown of the HTTP server. A highly loaded server may require increased value for a graceful shutdown`)
 	shutdownDelay               = flag.Duration("http.shutdownDelay", 0, `Optional delay before http server shutdown. During this delay, the server returns non-OK responses from /health page, so load balancers can route new requests to other servers`)
 	idleConnTimeout             = flag.Duration("http.idleConnTimeout", time.Minute, "Timeout for incoming idle http connections")
-	connTimeout                 = flag.Duration("http.connTimeout", 2*time.Minute, "Incoming connections to -httpListenAddr are closed after the configured timeout. "+
+	connTimeout                 = lflag.NewArrayDuration("http.connTimeout", 2*time.Minute, "Incoming connections to the corresponding -httpListenAddr are closed after the configured timeout. "+
 		"This may help evenly spreading load among a cluster of services behind TCP-level load balancer. Zero value disables closing of incoming connections")
 
-	headerHSTS         = flag.String("http.header.hsts", "max-age=31536000; includeSubDomains", "Value for 'Strict-Transport-Security' header, recommended: 'max-age=31536000; includeSubDomains'")
-	headerFrameOptions = flag.String("http.header.frameOptions", "SAMEORIGIN", "Value for 'X-Frame-Options' header")
-	headerCSP          = flag.String("http.header.csp", "default-src 'self'; script-src 'self' 'unsafe-eval'; style-src 'self' 'unsafe-inline'", `Value for 'Content-Security-Policy' header`)
+	maxPathLength = flag.Int("http.maxPathLength", 8*1024, "The maximum length of the requested path. Requests with longer paths are rejected with '414 URI Too Long' response "+
+		"before routing. This protects from pathological paths. Zero disables the limit")
+
+	allowTrace = flag.Bool("http.allowTrace", false, "Whether to pass HTTP TRACE requests to the request handlers. TRACE requests are rejected with '405 Method Not Allowed' by default, "+
+		"since reflecting the request back to the client exposes cookies and auth headers to scripts, which is known as Cross-Site Tracing (XST). "+
+		"Enable it only if a handler explicitly registers TRACE routes")
+
+	requireHost = flag.Bool("http.requireHost", false, "Whether to reject requests without Host header with '400 Bad Request'. "+
+		"net/http rejects such HTTP/1.1 requests on its own, while HTTP/1.0 clients such as legacy health checkers may omit the header")
+
+	maxRequestBodyDrainSize = lflag.NewBytes("http.maxRequestBodyDrainSize", 1024*1024, "The maximum number of unread request body bytes to discard after the request handler returns, "+
+		"so the keep-alive connection can be reused for the next request. The connection is closed if the unread body is bigger. Zero disables draining")
+
+	gzipMinSize = lflag.NewBytes("http.gzipMinSize", gzhttp.DefaultMinSize, "The minimum size of responses to compress. Smaller responses are sent uncompressed, "+
+		"since the compression overhead exceeds the savings for them. Zero compresses all the responses")
+
+	headerHSTS = flag.String("http.header.hsts", "max-age=31536000; includeSubDomains", "Value for 'Strict-Transport-Security' header, recommended: 'max-age=31536000; includeSubDomains'. "+
+		"It is sent only with responses to https requests. See -http.trustForwardedProto for requests from TLS-terminating proxies. Empty value disables the header")
+	headerFrameOptions = flag.String("http.header.frameOptions", "SAMEORIGIN", "Value for 'X-Frame-Options' header. Empty value disables the header")
+	headerCSP          = flag.String("http.header.csp", "default-src 'self'; script-src 'self' 'unsafe-eval'; style-src 'self' 'unsafe-inline'", `Value for 'Content-Security-Policy' header. Empty value disables the header`)
+	headerHTMLOnly     = flag.Bool("http.header.htmlOnly", false, "Whether to send 'X-Frame-Options' and 'Content-Security-Policy' headers only with HTML and SVG responses, "+
+		"since they have no effect on API responses such as JSON. Responses without Content-Type keep the headers, since their type is detected after the headers are sent")
+	serverHeader          = flag.String("http.serverHeader", "", "Value for 'Server' response header. Empty value omits the header, so the server software isn't disclosed to clients")
+	disableHostnameHeader = flag.Bool("http.disableHostnameHeader", false, "Whether to omit 'X-Server-Hostname' response header, "+
+		"which may leak internal infrastructure names to external clients")
 )
 
 var (
@@ -70,8 +105,13 @@ var (
 	requestsTotal          = metrics.NewCounter(`lcp_http_requests_all_total`)
 	metricsRequests        = metrics.NewCounter(`lcp_http_requests_total{path="/metrics"}`)
 	metricsHandlerDuration = metrics.NewHistogram(`lcp_http_request_duration_seconds{path="/metrics"}`)
+	metricsJSONRequests    = metrics.NewCounter(`lcp_http_requests_total{path="/metrics.json"}`)
+	metricsListRequests    = metrics.NewCounter(`lcp_http_requests_total{path="/debug/metrics/list"}`)
+	flagsJSONRequests      = metrics.NewCounter(`lcp_http_requests_total{path="/flags.json"}`)
 	connTimeoutClosedConns = metrics.NewCounter(`lcp_http_conn_timeout_closed_conns_total`)
 
+	http2StreamsTerminatedByShutdown = metrics.NewCounter(`lcp_http2_streams_terminated_by_shutdown_total`)
+
 	pprofRequests        = metrics.NewCounter(`lcp_http_requests_total{path="/debug/pprof/"}`)
 	pprofCmdlineRequests = metrics.NewCounter(`lcp_http_requests_total{path="/debug/pprof/cmdline"}`)
 	pprofProfileRequests = metrics.NewCounter(`lcp_http_requests_total{path="/debug/pprof/profile"}`)
@@ -80,11 +120,16 @@ var (
 	pprofMutexRequests   = metrics.NewCounter(`lcp_http_requests_total{path="/debug/pprof/mutex"}`)
 	pprofDefaultRequests = metrics.NewCounter(`lcp_http_requests_total{path="/debug/pprof/default"}`)
 
-	faviconRequests = metrics.NewCounter(`lcp_http_requests_total{path="*/favicon.ico"}`)
+	faviconRequests       = metrics.NewCounter(`lcp_http_requests_total{path="*/favicon.ico"}`)
+	debugRequestsRequests = metrics.NewCounter(`lcp_http_requests_total{path="/debug/requests"}`)
 
 	authBasicRequestErrors   = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="wrong_basic_auth"}`)
 	authKeyRequestErrors     = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="wrong_auth_key"}`)
 	unsupportedRequestErrors = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="unsupported"}`)
+	pathTooLongErrors        = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="path_too_long"}`)
+	traceNotAllowedErrors    = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="trace_not_allowed"}`)
+	missingHostErrors        = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="missing_host"}`)
+	undrainedRequestBodies   = metrics.NewCounter(`lcp_http_undrained_request_bodies_total`)
 )
 
 var hostname = func() string {
@@ -98,21 +143,46 @@ var hostname = func() string {
 	return h
 }()
 
-var gzipHandlerWrapper = func() func(http.Handler) http.HandlerFunc {
+// newGzipHandlerWrapper returns the response compression wrapper configured by command-line flags
+func newGzipHandlerWrapper() func(http.Handler) http.HandlerFunc {
 	hw, err := gzhttp.NewWrapper(
 		gzhttp.CompressionLevel(1),
 		// Prefer gzip over zstd compression if the client supports both methods
 		gzhttp.PreferZstd(false),
+		gzhttp.ContentTypeFilter(isCompressibleContentType),
+		gzhttp.MinSize(int(gzipMinSize.N)),
 	)
 	if err != nil {
-		panic(fmt.Errorf("BUG: cannot initialize gzip http wrapper: %w", err))
+		logger.Fatalf("cannot initialize gzip http wrapper: %s", err)
 	}
 	return hw
-}()
+}
+
+// isCompressibleContentType returns false for already compressed content, which isn't worth compressing again.
+//
+// It extends gzhttp.DefaultContentTypeFilter, which skips audio, video, jpeg and archives such as application/gzip
+// and application/zip, with the rest of images. Responses with Content-Encoding set by the handler aren't compressed
+// regardless of their type. See also DisableResponseCompression.
+func isCompressibleContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(contentType))
+	if strings.HasPrefix(mediaType, "image/") && !strings.HasPrefix(mediaType, "image/svg+xml") {
+		return false
+	}
+	return gzhttp.DefaultContentTypeFilter(contentType)
+}
+
+// DisableResponseCompression disables compression of the response written to w.
+// It must be called before the response headers are sent.
+func DisableResponseCompression(w http.ResponseWriter) {
+	w.Header().Set(gzhttp.HeaderNoCompression, "1")
+}
 
 type server struct {
 	s                     *http.Server
 	shutdownDelayDeadline atomic.Int64
+
+	// activeHTTP2Streams is the number of HTTP/2 requests in flight
+	activeHTTP2Streams atomic.Int64
 }
 
 // RequestHandler must serve the given request r and write response to w
@@ -134,24 +204,109 @@ type ServerOptions struct {
 }
 
 // Serve starts an http server on the given addresses with the given optional request handler
+//
+// Serve returns after all the addresses are listened, so Stop may be called right after it.
+// Requests are served in background goroutines.
 func Serve(addrs []string, rh RequestHandler, opts ServerOptions) {
 	if rh == nil {
 		rh = func(_ http.ResponseWriter, _ *http.Request) bool { return false }
 	}
+	if err := checkPerListenerFlags(len(addrs), opts); err != nil {
+		logger.Fatalf("invalid per-listener flags for %d listen addrs %q: %s", len(addrs), addrs, err)
+	}
+	if err := initTrustedProxies(); err != nil {
+		logger.Fatalf("invalid -http.trustedProxies: %s", err)
+	}
+	if !*disableHTTP2 {
+		if err := checkHTTP2Flags(); err != nil {
+			logger.Fatalf("invalid -http2.* flags: %s", err)
+		}
+	}
 	for idx, addr := range addrs {
 		if addr == "" {
 			continue
 		}
 		logger.Infof("starting http server on %s", addr)
-		go serve(addr, rh, idx, opts)
+		startServer(addr, rh, idx, opts)
 	}
 }
 
-func serve(addr string, rh RequestHandler, idx int, opts ServerOptions) {
-	scheme := "http"
+// CheckServeOptions verifies that Serve can be called with the given addrs and opts without errors.
+//
+// It verifies per-listener flags and loads TLS certificates for listeners with enabled TLS.
+// It doesn't bind the addrs.
+func CheckServeOptions(addrs []string, opts ServerOptions) error {
+	errs := []error{checkPerListenerFlags(len(addrs), opts)}
+	for idx, addr := range addrs {
+		if addr == "" || !tlsEnable.GetOptionalArg(idx) {
+			continue
+		}
+		certFile := tlsCertFile.GetOptionalArg(idx)
+		keyFile := tlsKeyFile.GetOptionalArg(idx)
+		if _, err := GetServerTLSConfig(certFile, keyFile); err != nil {
+			errs = append(errs, fmt.Errorf("cannot load TLS cert for %s from -tlsCertFile=%q, -tlsKeyFile=%q: %w", addr, certFile, keyFile, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListenerScheme returns the scheme for the listen addr with the given idx according to -tls flag
+func ListenerScheme(idx int) string {
 	if tlsEnable.GetOptionalArg(idx) {
-		scheme = "https"
+		return "https"
+	}
+	return "http"
+}
+
+// checkPerListenerFlags verifies that array flags applied to listen addrs by index contain either a single value or n values
+func checkPerListenerFlags(n int, opts ServerOptions) error {
+	err := lflag.CheckArrayFlags(n, "tls", "tlsCertFile", "tlsKeyFile", "http.connTimeout", "tcp.maxConcurrentConns", "tcp.maxAcceptRate")
+	if opts.UseProxyProtocol != nil {
+		if m := opts.UseProxyProtocol.Len(); m > 1 && m != n {
+			err = errors.Join(err, fmt.Errorf("useProxyProtocol flag must contain either a single value or %d values; got %d values: %s", n, m, opts.UseProxyProtocol))
+		}
+	}
+	return err
+}
+
+// HTTP/2 frame and flow control window bounds. See https://www.rfc-editor.org/rfc/rfc9113#section-6.5.2
+const (
+	http2FrameSizeMin  = 1 << 14
+	http2FrameSizeMax  = 1<<24 - 1
+	http2WindowSizeMax = 1<<31 - 1
+)
+
+// checkHTTP2Flags verifies that -http2.* flags are within the bounds allowed by the HTTP/2 spec
+func checkHTTP2Flags() error {
+	var err error
+	if n := *http2MaxConcurrentStreams; n <= 0 {
+		err = errors.Join(err, fmt.Errorf("-http2.maxConcurrentStreams must be positive; got %d", n))
+	}
+	if n := http2MaxFrameSize.N; n < http2FrameSizeMin || n > http2FrameSizeMax {
+		err = errors.Join(err, fmt.Errorf("-http2.maxFrameSize must be in the range [%d...%d]; got %d", http2FrameSizeMin, http2FrameSizeMax, n))
 	}
+	if n := http2MaxUploadBufferPerStream.N; n <= 0 || n > http2WindowSizeMax {
+		err = errors.Join(err, fmt.Errorf("-http2.maxUploadBufferPerStream must be in the range [1...%d]; got %d", http2WindowSizeMax, n))
+	}
+	return err
+}
+
+// newHTTP2Server returns HTTP/2 server options configured via -http2.* flags
+func newHTTP2Server() *http2.Server {
+	perStream := http2MaxUploadBufferPerStream.N
+	perConn := min(perStream*int64(*http2MaxConcurrentStreams), http2WindowSizeMax)
+	return &http2.Server{
+		IdleTimeout:                  90 * time.Second,
+		MaxUploadBufferPerStream:     int32(perStream),
+		MaxUploadBufferPerConnection: int32(perConn),
+		MaxReadFrameSize:             uint32(http2MaxFrameSize.N),
+		MaxConcurrentStreams:         uint32(*http2MaxConcurrentStreams),
+	}
+}
+
+// startServer listens the given addr and starts serving requests on it in background
+func startServer(addr string, rh RequestHandler, idx int, opts ServerOptions) {
+	scheme := ListenerScheme(idx)
 	useProxyProto := false
 	if opts.UseProxyProtocol != nil {
 		useProxyProto = opts.UseProxyProtocol.GetOptionalArg(idx)
@@ -179,7 +334,7 @@ func serve(addr string, rh RequestHandler, idx int, opts ServerOptions) {
 	}
 
 	// create a TCP listener
-	ln, err := NewTCPListener(scheme, addr, useProxyProto, tlsConfig)
+	ln, err := NewTCPListener(scheme, addr, idx, useProxyProto, tlsConfig)
 	if err != nil {
 		logger.Fatalf("cannot start http server on %s: %v", addr, err)
 	}
@@ -188,23 +343,42 @@ func serve(addr string, rh RequestHandler, idx int, opts ServerOptions) {
 		logger.Infof("pprof handlers are exposed at %s://%s/debug/pprof/", scheme, ln.Addr())
 	}
 
-	serveWithListener(addr, ln, rh, opts.DisableBuiltinRoutes)
+	httpsRedirect := *redirectToHTTPS && tlsConfig == nil
+	if httpsRedirect {
+		logger.Infof("redirecting requests to %s://%s/ to https, see -http.redirectToHTTPS", scheme, ln.Addr())
+	}
+
+	s := newServer(addr, rh, connTimeout.GetOptionalArg(idx), opts.DisableBuiltinRoutes, httpsRedirect)
+	go s.serve(addr, ln)
 }
 
-func serveWithListener(addr string, ln net.Listener, rh RequestHandler, disableBuiltinRoutes bool) {
-	var s server
+func serveWithListener(addr string, ln net.Listener, rh RequestHandler, connTimeout time.Duration, disableBuiltinRoutes, httpsRedirect bool) {
+	s := newServer(addr, rh, connTimeout, disableBuiltinRoutes, httpsRedirect)
+	s.serve(addr, ln)
+}
+
+// newServer creates the server for the given addr and registers it for Stop
+func newServer(addr string, rh RequestHandler, connTimeout time.Duration, disableBuiltinRoutes, httpsRedirect bool) *server {
+	s := &server{}
 
 	rhw := rh
 	if !disableBuiltinRoutes {
 		rhw = func(w http.ResponseWriter, r *http.Request) bool {
-			return builtinRoutesHandler(&s, r, w, rh)
+			return builtinRoutesHandler(s, r, w, rh)
 		}
 	}
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			s.activeHTTP2Streams.Add(1)
+			defer s.activeHTTP2Streams.Add(-1)
+		}
 		handlerWrapper(w, r, rhw)
 	})
+	if httpsRedirect {
+		h = newHTTPSRedirectHandler(h).ServeHTTP
+	}
 
-	h = gzipHandlerWrapper(h)
+	h = newGzipHandlerWrapper()(h)
 
 	s.s = &http.Server{
 		Handler:           h,
@@ -216,24 +390,15 @@ func serveWithListener(addr string, ln net.Listener, rh RequestHandler, disableB
 	if *disableHTTP2 {
 		s.s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 	} else {
-		const resourceBody99Percentile = 256 * 1024
-
-		http2Options := &http2.Server{
-			IdleTimeout: 90 * time.Second,
-			// shrink the per-stream buffer and max frame size from the 1MB default while still accommodating most API POST requests in a single frame
-			MaxUploadBufferPerStream: resourceBody99Percentile,
-			MaxReadFrameSize:         resourceBody99Percentile,
-			MaxConcurrentStreams:     100,
-		}
-
-		http2Options.MaxUploadBufferPerConnection = http2Options.MaxUploadBufferPerStream * int32(http2Options.MaxConcurrentStreams)
-		// apply settings to the server
+		http2Options := newHTTP2Server()
+		// apply settings to the server. This also registers the shutdown hook, which sends GOAWAY to HTTP/2 connections
+		// on Shutdown, so clients stop opening new streams while the in-flight streams are completed
 		if err := http2.ConfigureServer(s.s, http2Options); err != nil {
 			logger.Panicf("cannot configure http/2 for http server on %s: %v", addr, err)
 		}
 	}
 
-	if *connTimeout > 0 {
+	if connTimeout > 0 {
 		s.s.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
 			timeoutSec := connTimeout.Seconds()
 			// Add a jitter for connection timeout in order to prevent Thundering herd problem
@@ -247,8 +412,13 @@ func serveWithListener(addr string, ln net.Listener, rh RequestHandler, disableB
 	//s.s.SetKeepAlivesEnabled(true)
 
 	serversLock.Lock()
-	servers[addr] = &s
+	servers[addr] = s
 	serversLock.Unlock()
+	return s
+}
+
+// serve serves requests on ln until the server is stopped
+func (s *server) serve(addr string, ln net.Listener) {
 	if err := s.s.Serve(ln); err != nil {
 		if errors.Is(err, http.ErrServerClosed) {
 			return
@@ -257,8 +427,30 @@ func serveWithListener(addr string, ln net.Listener, rh RequestHandler, disableB
 	}
 }
 
+// MaxGracefulShutdownDuration returns the value of -http.maxGracefulShutdownDuration
+//
+// It may be used for limiting the duration of application shutdown steps performed after Stop
+func MaxGracefulShutdownDuration() time.Duration {
+	return *maxGracefulShutdownDuration
+}
+
+// ShutdownDelay returns the value of -http.shutdownDelay
+//
+// Stop waits for it before the graceful shutdown, so it must be added to MaxGracefulShutdownDuration
+// when the deadline of the whole shutdown is calculated
+func ShutdownDelay() time.Duration {
+	return *shutdownDelay
+}
+
 // Stop stops the http server on the given addrs, which has been started via Serve func
 func Stop(addrs []string) error {
+	return StopContext(context.Background(), addrs)
+}
+
+// StopContext is like Stop, but it stops waiting for -http.shutdownDelay and in-flight requests when ctx is done.
+//
+// This allows sharing a single shutdown deadline between Stop and the shutdown steps performed after it.
+func StopContext(ctx context.Context, addrs []string) error {
 	var errGlobalLock sync.Mutex
 	var errGlobal error
 
@@ -269,7 +461,7 @@ func Stop(addrs []string) error {
 		}
 		wg.Add(1)
 		go func(addr string) {
-			if err := stop(addr); err != nil {
+			if err := stop(ctx, addr); err != nil {
 				errGlobalLock.Lock()
 				errGlobal = err
 				errGlobalLock.Unlock()
@@ -285,12 +477,47 @@ func Stop(addrs []string) error {
 //go:embed favicon.ico
 var faviconData []byte
 
+// faviconLastModified is the Last-Modified time for the embedded favicon.
+//
+// The favicon can change only together with the binary, so the build time is used,
+// which doesn't change on restarts. See embeddedFilesModTime
+var faviconLastModified = embeddedFilesModTime()
+
+// embeddedFilesModTime returns the modification time of the files embedded into the binary.
+//
+// This is the time of the VCS commit the binary is built from if it is known, otherwise the modification time of the binary.
+// Zero time is returned if both are unknown, so Last-Modified isn't set.
+func embeddedFilesModTime() time.Time {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key != "vcs.time" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				return t
+			}
+		}
+	}
+	path, err := os.Executable()
+	if err != nil {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
 func builtinRoutesHandler(s *server, r *http.Request, w http.ResponseWriter, rh RequestHandler) bool {
 	h := w.Header()
 	path := r.URL.Path
 	if strings.HasSuffix(path, "/favicon.ico") {
 		w.Header().Set("Cache-Control", "max-age=3600")
 		faviconRequests.Inc()
+		if httputil.CheckNotModified(w, r, faviconLastModified) {
+			return true
+		}
 		_, _ = w.Write(faviconData)
 		return true
 	}
@@ -307,6 +534,7 @@ func builtinRoutesHandler(s *server, r *http.Request, w http.ResponseWriter, rh
 		// Load balancers must notify these responses and re-route new requests to other servers
 		d := max(time.Until(time.Unix(0, deadline)), 0)
 		errMsg := fmt.Sprintf("The server is in delayed shutdown mode, which will end in %.3fs", d.Seconds())
+		SetRetryAfter(w, d)
 		http.Error(w, errMsg, http.StatusServiceUnavailable)
 		return true
 	case "/ping":
@@ -326,6 +554,22 @@ func builtinRoutesHandler(s *server, r *http.Request, w http.ResponseWriter, rh
 		appmetrics.WritePrometheusMetrics(w)
 		metricsHandlerDuration.UpdateDuration(startTime)
 		return true
+	case "/metrics.json":
+		metricsJSONRequests.Inc()
+		if !CheckAuthFlag(w, r, metricsAuthKey) {
+			return true
+		}
+		h.Set("Content-Type", "application/json")
+		appmetrics.WriteJSONMetrics(w)
+		return true
+	case "/debug/metrics/list":
+		metricsListRequests.Inc()
+		if !CheckAuthFlag(w, r, metricsAuthKey) {
+			return true
+		}
+		h.Set("Content-Type", "application/json")
+		appmetrics.WriteMetricsListJSON(w)
+		return true
 	case "/flags":
 		if !CheckAuthFlag(w, r, flagsAuthKey) {
 			return true
@@ -333,6 +577,22 @@ func builtinRoutesHandler(s *server, r *http.Request, w http.ResponseWriter, rh
 		h.Set("Content-Type", "text/plain; charset=utf-8")
 		lflag.WriteFlags(w)
 		return true
+	case "/flags.json":
+		flagsJSONRequests.Inc()
+		if !CheckAuthFlag(w, r, flagsAuthKey) {
+			return true
+		}
+		h.Set("Content-Type", "application/json")
+		lflag.WriteFlagsJSON(w)
+		return true
+	case "/debug/requests":
+		debugRequestsRequests.Inc()
+		if !CheckAuthFlag(w, r, pprofAuthKey) {
+			return true
+		}
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		requests.writeRequests(w)
+		return true
 	case "/-/healthy":
 		// This is needed for Prometheus compatibility
 		_, _ = fmt.Fprintf(w, "LCP is Healthy.\n")
@@ -359,10 +619,15 @@ func builtinRoutesHandler(s *server, r *http.Request, w http.ResponseWriter, rh
 			return true
 		}
 	}
+	// Bearer tokens aren't verified yet, so such requests are limited per client IP here.
+	// The API authentication filter applies the per-principal limit after the token is verified.
+	if !CheckRateLimit(w, r) {
+		return true
+	}
 	return rh(w, r)
 }
 
-func stop(addr string) error {
+func stop(ctx context.Context, addr string) error {
 	serversLock.Lock()
 	s := servers[addr]
 	delete(servers, addr)
@@ -379,13 +644,25 @@ func stop(addr string) error {
 		// Sleep for a while until load balancer in front of the server
 		// notifies that "/health" endpoint returns non-OK responses
 		logger.Infof("Waiting for %.3fs before shutdown of http server %q, so load balancers could re-route requests to other servers", shutdownDelay.Seconds(), addr)
-		time.Sleep(*shutdownDelay)
+		t := time.NewTimer(*shutdownDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
 		logger.Infof("Starting shutdown for http server %q", addr)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), *maxGracefulShutdownDuration)
+	// Shutdown sends GOAWAY to HTTP/2 connections and waits until their in-flight streams are completed.
+	ctx, cancel := context.WithTimeout(ctx, *maxGracefulShutdownDuration)
 	defer cancel()
 	if err := s.s.Shutdown(ctx); err != nil {
+		// Shutdown leaves the connections with unfinished requests open, so close them explicitly.
+		if n := s.activeHTTP2Streams.Load(); n > 0 {
+			http2StreamsTerminatedByShutdown.Add(int(n))
+			logger.Warnf("terminating %d in-flight HTTP/2 streams at http server %q, since they weren't completed in %.3fs", n, addr, maxGracefulShutdownDuration.Seconds())
+		}
+		_ = s.s.Close()
 		return fmt.Errorf("cannot gracefully shutdown http server at %q in %.3fs; "+
 			"probably, `-http.maxGracefulShutdownDuration` command-line flag value must be increased; error: %s", addr, maxGracefulShutdownDuration.Seconds(), err)
 	}
@@ -395,6 +672,10 @@ func stop(addr string) error {
 func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 	defer func() {
 		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				// The response has been aborted on purpose. net/http closes the connection or resets the HTTP/2 stream for it
+				panic(err)
+			}
 			buf := make([]byte, 1<<20)
 			n := runtime.Stack(buf, false)
 			_, _ = fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", err, buf[:n])
@@ -403,7 +684,8 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 	}()
 
 	h := w.Header()
-	if *headerHSTS != "" {
+	if *headerHSTS != "" && isHTTPS(r) {
+		// HSTS received over plain http must be ignored by browsers, see https://www.rfc-editor.org/rfc/rfc6797#section-8.1
 		h.Add("Strict-Transport-Security", *headerHSTS)
 	}
 	if *headerFrameOptions != "" {
@@ -412,7 +694,12 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 	if *headerCSP != "" {
 		h.Add("Content-Security-Policy", *headerCSP)
 	}
-	h.Add("X-Server-Hostname", hostname)
+	if *serverHeader != "" {
+		h.Set("Server", *serverHeader)
+	}
+	if !*disableHostnameHeader {
+		h.Add("X-Server-Hostname", hostname)
+	}
 	requestsTotal.Inc()
 	if whetherToCloseConn(r) {
 		connTimeoutClosedConns.Inc()
@@ -420,6 +707,29 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 	}
 
 	path := r.URL.Path
+	if *maxPathLength > 0 && len(path) > *maxPathLength {
+		// Do not use Errorf, since it logs the whole request uri
+		pathTooLongErrors.Inc()
+		http.Error(w, fmt.Sprintf("the requested path length %d exceeds -http.maxPathLength=%d", len(path), *maxPathLength), http.StatusRequestURITooLong)
+		return
+	}
+
+	if r.Method == http.MethodTrace && !*allowTrace {
+		traceNotAllowedErrors.Inc()
+		http.Error(w, "TRACE method is not allowed; see -http.allowTrace", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if *requireHost && r.Host == "" {
+		missingHostErrors.Inc()
+		http.Error(w, "missing Host header; see -http.requireHost", http.StatusBadRequest)
+		return
+	}
+
+	if !handleCleanPath(w, r) {
+		return
+	}
+	path = r.URL.Path
 
 	prefix := GetPathPrefix()
 	if prefix != "" {
@@ -442,9 +752,24 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 		r.URL.Path = path
 	}
 
-	w = &responseWriterWithAbort{
+	rwa := &responseWriterWithAbort{
 		ResponseWriter: w,
 	}
+	w = rwa
+	requestID := requests.start(r)
+	defer func() {
+		requests.finish(requestID, rwa.getStatusCode())
+	}()
+	defer func() {
+		if rwa.resetStream {
+			// See responseWriterWithAbort.abort
+			panic(http.ErrAbortHandler)
+		}
+	}()
+	if r.ProtoMajor == 1 && r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 && !expectsContinue(r) {
+		defer drainRequestBody(rwa, r.Body)
+	}
+	r = withPrincipalHolder(r)
 	if rh(w, r) {
 		return
 	}
@@ -453,6 +778,35 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 	unsupportedRequestErrors.Inc()
 }
 
+// drainRequestBody discards up to -http.maxRequestBodyDrainSize bytes of body left unread by the request handler,
+// so net/http can reuse the keep-alive connection. The connection is closed if the remaining body is bigger.
+func drainRequestBody(rwa *responseWriterWithAbort, body io.ReadCloser) {
+	if rwa.aborted || maxRequestBodyDrainSize.N <= 0 {
+		return
+	}
+	n, err := io.CopyN(io.Discard, body, maxRequestBodyDrainSize.N+1)
+	if err == nil && n > maxRequestBodyDrainSize.N {
+		// The remaining body is too big. net/http closes the connection after the response
+		// when the body isn't fully read; let the client know if the response hasn't been sent yet.
+		if !rwa.sentHeaders {
+			rwa.Header().Set("Connection", "close")
+		}
+		undrainedRequestBodies.Inc()
+		return
+	}
+	_ = body.Close()
+}
+
+// expectsContinue returns true if the client waits for `100 Continue` before sending the request body.
+//
+// net/http sends `100 Continue` on the first read of the body until the response status is written,
+// so the handler may reject such a request (e.g. with 401 or 413) without the client sending the body.
+// The unread body mustn't be drained, since this could solicit the body the handler didn't accept.
+// net/http closes the connection instead.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+}
+
 func isProtectedByAuthFlag(path string) bool {
 	// These paths must explicitly call CheckAuthFlag()
 	return strings.HasSuffix(path, "/config") || strings.HasSuffix(path, "/reload") ||
@@ -473,28 +827,22 @@ func EnableCORS(w http.ResponseWriter, _ *http.Request) {
 var connDeadlineTimeKey = any("connDeadlineSecs")
 
 func whetherToCloseConn(r *http.Request) bool {
-	if *connTimeout <= 0 {
-		return false
-	}
+	// The deadline is set only if -http.connTimeout is enabled for the listener the request came from.
 	ctx := r.Context()
 	v := ctx.Value(connDeadlineTimeKey)
 	deadline, ok := v.(*uint64)
 	return ok && fasttime.UnixTimestamp() > *deadline
 }
 
-// GetPathPrefix - returns http server path prefix.
+// GetPathPrefix - returns http server path prefix with the leading and trailing slashes, e.g. "/foo/bar/".
+//
+// An empty string is returned if -http.pathPrefix is empty or consists of slashes only, since "/" is effectively no prefix.
 func GetPathPrefix() string {
-	prefix := *pathPrefix
+	prefix := strings.Trim(*pathPrefix, "/")
 	if prefix == "" {
 		return ""
 	}
-	if !strings.HasPrefix(prefix, "/") {
-		prefix = "/" + prefix
-	}
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
-	}
-	return prefix
+	return "/" + prefix + "/"
 }
 
 // Redirect redirects to the given url.
@@ -508,6 +856,35 @@ func Redirect(w http.ResponseWriter, url string) {
 	w.WriteHeader(http.StatusFound)
 }
 
+// RedirectWithStatus redirects to the given url with the given redirect status code.
+//
+// The query string of r is appended to the url if r isn't nil and the url has no query string,
+// so canonicalizing redirects keep the query args. Pass nil r in order to drop them.
+// The code must be one of 301, 302, 303, 307 or 308.
+func RedirectWithStatus(w http.ResponseWriter, r *http.Request, url string, code int) {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		logger.Panicf("BUG: unexpected redirect status code %d; want 301, 302, 303, 307 or 308", code)
+	}
+	if r != nil && r.URL.RawQuery != "" && !strings.Contains(url, "?") {
+		url += "?" + r.URL.RawQuery
+	}
+	// Do not use http.Redirect for the same reasons as in Redirect
+	w.Header().Set("Location", url)
+	w.WriteHeader(code)
+}
+
+// SetRetryAfter sets 'Retry-After' header for '429 Too Many Requests' and '503 Service Unavailable' responses,
+// so clients back off for d before retrying the request.
+//
+// d is rounded up to whole seconds, since clients must not retry earlier than d. The header is at least one second.
+// It must be called before writing the response status code.
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := max(int64((d+time.Second-1)/time.Second), 1)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
 // Errorf writes formatted error message to w and to logger.
 func Errorf(w http.ResponseWriter, r *http.Request, format string, args ...any) {
 	errStr := fmt.Sprintf(format, args...)
@@ -611,11 +988,31 @@ func (e *ErrorWithStatusCode) Error() string {
 	return e.Err.Error()
 }
 
+// GetStatus returns e.StatusCode
+//
+// This allows lib/rest to render the error with the given status code
+func (e *ErrorWithStatusCode) GetStatus() int {
+	return e.StatusCode
+}
+
 type responseWriterWithAbort struct {
 	http.ResponseWriter
 
 	sentHeaders bool
 	aborted     bool
+	statusCode  int
+
+	// resetStream is set by abort if the connection cannot be hijacked, e.g. for HTTP/2 requests.
+	// The response is aborted by handlerWrapper after the request handler returns then
+	resetStream bool
+}
+
+// getStatusCode returns the response status code sent to the client, or 0 if headers haven't been sent yet
+func (rwa *responseWriterWithAbort) getStatusCode() int {
+	if rwa.statusCode == 0 && rwa.sentHeaders {
+		return http.StatusOK
+	}
+	return rwa.statusCode
 }
 
 func (rwa *responseWriterWithAbort) Write(data []byte) (int, error) {
@@ -623,6 +1020,7 @@ func (rwa *responseWriterWithAbort) Write(data []byte) (int, error) {
 		return 0, fmt.Errorf("response connection is aborted")
 	}
 	if !rwa.sentHeaders {
+		rwa.prepareHeaders()
 		rwa.sentHeaders = true
 	}
 	return rwa.ResponseWriter.Write(data)
@@ -637,23 +1035,60 @@ func (rwa *responseWriterWithAbort) WriteHeader(statusCode int) {
 		logger.WarnfSkipFrames(1, "cannot write response headers with statusCode=%d, since they were already sent", statusCode)
 		return
 	}
+	rwa.prepareHeaders()
 	rwa.ResponseWriter.WriteHeader(statusCode)
 	rwa.sentHeaders = true
+	rwa.statusCode = statusCode
 }
 
 // Flush implements net/http.Flusher interface
 func (rwa *responseWriterWithAbort) Flush() {
+	// The error is ignored, since http.Flusher cannot return it. Use http.ResponseController in order to get it
+	_ = rwa.FlushError()
+}
+
+// FlushError flushes buffered data to the client and returns the error if it cannot be sent, e.g. if the client has closed the connection.
+//
+// It is used by http.ResponseController.Flush. The response is sent when the request handler returns
+// if the underlying ResponseWriter doesn't support flushing.
+func (rwa *responseWriterWithAbort) FlushError() error {
 	if rwa.aborted {
-		return
+		return fmt.Errorf("response connection is aborted")
 	}
 	if !rwa.sentHeaders {
+		rwa.prepareHeaders()
 		rwa.sentHeaders = true
 	}
-	flusher, ok := rwa.ResponseWriter.(http.Flusher)
-	if !ok {
-		logger.Panicf("BUG: it is expected http.ResponseWriter (%T) supports http.Flusher interface", rwa.ResponseWriter)
+	// Use ResponseController, since the ResponseWriter may be wrapped, e.g. by response compression
+	err := http.NewResponseController(rwa.ResponseWriter).Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
 	}
-	flusher.Flush()
+	return err
+}
+
+// prepareHeaders is called just before the response headers are sent
+func (rwa *responseWriterWithAbort) prepareHeaders() {
+	if *headerHTMLOnly {
+		dropDocumentSecurityHeaders(rwa.Header())
+	}
+}
+
+// dropDocumentSecurityHeaders removes the security headers, which only apply to documents rendered by browsers,
+// from responses with other content types. See -http.header.htmlOnly
+func dropDocumentSecurityHeaders(h http.Header) {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "text/html", "application/xhtml+xml", "image/svg+xml":
+		// SVG documents may contain scripts, so they need CSP too
+		return
+	}
+	h.Del("X-Frame-Options")
+	h.Del("Content-Security-Policy")
 }
 
 // Unwrap returns the original ResponseWriter wrapped by rwa.
@@ -666,7 +1101,10 @@ func (rwa *responseWriterWithAbort) Unwrap() http.ResponseWriter {
 // abort aborts the client connection associated with rwa
 //
 // The last http chunk in the response stream is intentionally written incorrectly,
-// so the client, which reads the response, could notice this error
+// so the client, which reads the response, could notice this error.
+//
+// HTTP/2 connections are shared by concurrent requests, so they cannot be hijacked.
+// The response stream is reset when the request handler returns instead, see handlerWrapper.
 func (rwa *responseWriterWithAbort) abort() {
 	if !rwa.sentHeaders {
 		logger.Panicf("BUG: abort can be called only after http response headers are sent")
@@ -675,13 +1113,15 @@ func (rwa *responseWriterWithAbort) abort() {
 		// Nothing to do. The connection has been already aborted
 		return
 	}
-	hj, ok := rwa.ResponseWriter.(http.Hijacker)
-	if !ok {
-		logger.Panicf("BUG: ResponseWriter must implement http.Hijacker interface")
-	}
-	conn, bw, err := hj.Hijack()
+	rc := http.NewResponseController(rwa.ResponseWriter)
+	conn, bw, err := rc.Hijack()
 	if err != nil {
-		logger.WarnfSkipFrames(2, "cannot hijack response connection: %s", err)
+		// The connection cannot be hijacked, e.g. because of HTTP/2. Wrappers such as response compression
+		// may return their own errors instead of http.ErrNotSupported for it, so fall back on any error.
+		// Send the error message written by the caller before resetting the stream
+		_ = rc.Flush()
+		rwa.aborted = true
+		rwa.resetStream = true
 		return
 	}
 
@@ -714,11 +1154,14 @@ func CheckAuthFlag(w http.ResponseWriter, r *http.Request, expectedKey *lflag.Pa
 		http.Error(w, fmt.Sprintf("The provided authKey doesn't match -%s", expectedKey.Name()), http.StatusUnauthorized)
 		return false
 	}
+	SetPrincipal(r, expectedKey.Name())
 	return true
 }
 
 // CheckBasicAuth validates credentials provided in request if httpAuth.* flags are set
 // returns true if credentials are valid or httpAuth.* flags are not set
+//
+// The username is recorded as the request Principal on success
 func CheckBasicAuth(w http.ResponseWriter, r *http.Request) bool {
 	if len(*httpAuthUsername) == 0 {
 		// HTTP Basic Auth is disabled.
@@ -727,6 +1170,7 @@ func CheckBasicAuth(w http.ResponseWriter, r *http.Request) bool {
 	username, password, ok := r.BasicAuth()
 	if ok {
 		if username == *httpAuthUsername && password == httpAuthPassword.Get() {
+			SetPrincipal(r, username)
 			return true
 		}
 		authBasicRequestErrors.Inc()
@@ -0,0 +1,1203 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzhttp"
+)
+
+func TestHandlerWrapper_MaxPathLength(t *testing.T) {
+	defaultMaxPathLength := *maxPathLength
+	defer func() {
+		*maxPathLength = defaultMaxPathLength
+	}()
+	*maxPathLength = 16
+
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	f := func(path string, statusCodeExpected int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handlerWrapper(rec, httptest.NewRequest(http.MethodGet, path, nil), rh)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for path of length %d; got %d; want %d", len(path), rec.Code, statusCodeExpected)
+		}
+	}
+
+	rejectedBefore := pathTooLongErrors.Get()
+	f("/"+strings.Repeat("a", 15), http.StatusNoContent)
+	f("/"+strings.Repeat("a", 16), http.StatusRequestURITooLong)
+	if n := pathTooLongErrors.Get() - rejectedBefore; n != 1 {
+		t.Fatalf("unexpected number of rejected requests; got %d; want 1", n)
+	}
+
+	*maxPathLength = 0
+	f("/"+strings.Repeat("a", 1024), http.StatusNoContent)
+}
+
+func TestGetPathPrefix(t *testing.T) {
+	defer func(v string) {
+		*pathPrefix = v
+	}(*pathPrefix)
+
+	f := func(prefix, prefixExpected string) {
+		t.Helper()
+		*pathPrefix = prefix
+		if got := GetPathPrefix(); got != prefixExpected {
+			t.Fatalf("unexpected path prefix for -http.pathPrefix=%q; got %q; want %q", prefix, got, prefixExpected)
+		}
+	}
+
+	f("", "")
+	f("/", "")
+	f("//", "")
+	f("foo", "/foo/")
+	f("/foo", "/foo/")
+	f("foo/", "/foo/")
+	f("/foo/", "/foo/")
+	f("//foo//", "/foo/")
+	f("foo/bar", "/foo/bar/")
+}
+
+func TestHandlerWrapper_PathPrefix(t *testing.T) {
+	defer func(v string) {
+		*pathPrefix = v
+	}(*pathPrefix)
+
+	var handledPath string
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		handledPath = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	f := func(prefix, requestURI string, statusCodeExpected int, pathExpected string) {
+		t.Helper()
+		*pathPrefix = prefix
+		handledPath = ""
+		rec := httptest.NewRecorder()
+		handlerWrapper(rec, httptest.NewRequest(http.MethodGet, requestURI, nil), rh)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for -http.pathPrefix=%q and %q; got %d; want %d", prefix, requestURI, rec.Code, statusCodeExpected)
+		}
+		if statusCodeExpected == http.StatusFound {
+			if location := rec.Header().Get("Location"); location != pathExpected {
+				t.Fatalf("unexpected Location for -http.pathPrefix=%q and %q; got %q; want %q", prefix, requestURI, location, pathExpected)
+			}
+			return
+		}
+		if handledPath != pathExpected {
+			t.Fatalf("unexpected handled path for -http.pathPrefix=%q and %q; got %q; want %q", prefix, requestURI, handledPath, pathExpected)
+		}
+	}
+
+	// "/" is no prefix
+	for _, prefix := range []string{"", "/", "//"} {
+		f(prefix, "/", http.StatusNoContent, "/")
+		f(prefix, "/metrics", http.StatusNoContent, "/metrics")
+		f(prefix, "/foo/metrics", http.StatusNoContent, "/foo/metrics")
+	}
+
+	// all the normalizations of the prefix behave the same
+	for _, prefix := range []string{"foo", "/foo", "foo/", "/foo/"} {
+		f(prefix, "/foo", http.StatusFound, "/foo/")
+		f(prefix, "/foo/", http.StatusNoContent, "/")
+		f(prefix, "/foo/metrics", http.StatusNoContent, "/metrics")
+		f(prefix, "/foo/api/v1/users", http.StatusNoContent, "/api/v1/users")
+		f(prefix, "/metrics", http.StatusBadRequest, "")
+		f(prefix, "/foobar/metrics", http.StatusBadRequest, "")
+		f(prefix, "/", http.StatusBadRequest, "")
+	}
+
+	f("foo/bar", "/foo/bar", http.StatusFound, "/foo/bar/")
+	f("foo/bar", "/foo/bar/metrics", http.StatusNoContent, "/metrics")
+	f("foo/bar", "/foo/metrics", http.StatusBadRequest, "")
+}
+
+func TestBuiltinRoutesHandler_MetricsList(t *testing.T) {
+	defer func() {
+		_ = metricsAuthKey.Set("")
+	}()
+	if err := metricsAuthKey.Set("secret"); err != nil {
+		t.Fatalf("cannot set -metricsAuthKey: %v", err)
+	}
+
+	f := func(path string, statusCodeExpected int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		builtinRoutesHandler(&server{}, httptest.NewRequest(http.MethodGet, path, nil), rec, nil)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", path, rec.Code, statusCodeExpected)
+		}
+		if statusCodeExpected == http.StatusOK && !strings.Contains(rec.Body.String(), `"exposeMetadata":`) {
+			t.Fatalf("unexpected response body: %s", rec.Body.String())
+		}
+	}
+
+	f("/debug/metrics/list", http.StatusUnauthorized)
+	f("/debug/metrics/list?authKey=wrong", http.StatusUnauthorized)
+	f("/debug/metrics/list?authKey=secret", http.StatusOK)
+}
+
+func TestHandlerWrapper_DrainRequestBody(t *testing.T) {
+	defaultDrainSize := maxRequestBodyDrainSize.N
+	defer func() {
+		maxRequestBodyDrainSize.N = defaultDrainSize
+	}()
+	maxRequestBodyDrainSize.N = 1024 * 1024
+
+	// the handler rejects requests without reading their body
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusBadRequest)
+		return true
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerWrapper(w, r, rh)
+	}))
+	defer srv.Close()
+
+	client := srv.Client()
+	f := func(bodySize int, reusedExpected bool) {
+		t.Helper()
+		send := func() bool {
+			t.Helper()
+			var reused bool
+			trace := &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					reused = info.Reused
+				},
+			}
+			req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodPost, srv.URL, strings.NewReader(strings.Repeat("a", bodySize)))
+			if err != nil {
+				t.Fatalf("cannot create request: %v", err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+			return reused
+		}
+		client.CloseIdleConnections()
+		send()
+		if reused := send(); reused != reusedExpected {
+			t.Fatalf("unexpected connection reuse for body of %d bytes; got %v; want %v", bodySize, reused, reusedExpected)
+		}
+	}
+
+	// net/http discards only up to 256KiB of unread body on its own
+	f(512*1024, true)
+
+	undrainedBefore := undrainedRequestBodies.Get()
+	f(2*1024*1024, false)
+	if n := undrainedRequestBodies.Get() - undrainedBefore; n == 0 {
+		t.Fatalf("expecting non-zero undrained request bodies")
+	}
+}
+
+func TestHandlerWrapper_ExpectContinue(t *testing.T) {
+	f := func(statusCode int) {
+		t.Helper()
+		// the handler responds without reading the request body
+		rh := func(w http.ResponseWriter, r *http.Request) bool {
+			if statusCode != http.StatusOK {
+				w.WriteHeader(statusCode)
+			}
+			return true
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerWrapper(w, r, rh)
+		}))
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("cannot connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		// the body is never sent, so the response must be returned without waiting for it
+		req := "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1048576\r\nExpect: 100-continue\r\n\r\n"
+		if _, err := conn.Write([]byte(req)); err != nil {
+			t.Fatalf("cannot send request: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("cannot read response: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != statusCode {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, statusCode)
+		}
+	}
+
+	f(http.StatusUnauthorized)
+
+	// the status code is written by net/http after the handler returns
+	f(http.StatusOK)
+}
+
+func TestHandlerWrapper_Trace(t *testing.T) {
+	defer func(v bool) {
+		*allowTrace = v
+	}(*allowTrace)
+
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	f := func(method string, statusCodeExpected int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handlerWrapper(rec, httptest.NewRequest(method, "/api/v1/users", nil), rh)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", method, rec.Code, statusCodeExpected)
+		}
+	}
+
+	*allowTrace = false
+	rejectedBefore := traceNotAllowedErrors.Get()
+	f(http.MethodTrace, http.StatusMethodNotAllowed)
+	f(http.MethodGet, http.StatusNoContent)
+	if n := traceNotAllowedErrors.Get() - rejectedBefore; n != 1 {
+		t.Fatalf("unexpected number of rejected TRACE requests; got %d; want 1", n)
+	}
+
+	*allowTrace = true
+	f(http.MethodTrace, http.StatusNoContent)
+}
+
+func TestHandlerWrapper_Abort(t *testing.T) {
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "partial response")
+		w.(http.Flusher).Flush()
+		// the error occurs after the response headers are sent, so the response must be aborted
+		Errorf(w, r, "cannot generate the rest of response")
+		if _, err := io.WriteString(w, "must not be sent"); err == nil {
+			t.Errorf("expecting non-nil error when writing to aborted response")
+		}
+		return true
+	}
+
+	f := func(http2, gzip bool) {
+		t.Helper()
+		var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerWrapper(w, r, rh)
+		})
+		if gzip {
+			h = newGzipHandlerWrapper()(h)
+		}
+		ts := httptest.NewUnstartedServer(h)
+		ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+		if http2 {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		} else {
+			ts.Start()
+		}
+		defer ts.Close()
+
+		resp, err := ts.Client().Get(ts.URL + "/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if protoMajor := resp.ProtoMajor; (protoMajor == 2) != http2 {
+			t.Fatalf("unexpected protocol %s; http2=%v", resp.Proto, http2)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when reading aborted response with http2=%v, gzip=%v; body: %q", http2, gzip, body)
+		}
+		if !strings.HasPrefix(string(body), "partial response") {
+			t.Fatalf("unexpected body with http2=%v, gzip=%v; got %q; want prefix %q", http2, gzip, body, "partial response")
+		}
+		if strings.Contains(string(body), "must not be sent") {
+			t.Fatalf("unexpected data after the abort with http2=%v, gzip=%v: %q", http2, gzip, body)
+		}
+	}
+
+	f(false, false)
+	f(false, true)
+	f(true, false)
+	f(true, true)
+}
+
+func TestResponseWriterWithAbort_ResponseController(t *testing.T) {
+	f := func(http2 bool) {
+		t.Helper()
+		firstChunkReceived := make(chan struct{})
+		handlerErr := make(chan error, 1)
+		h := newGzipHandlerWrapper()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerWrapper(w, r, func(w http.ResponseWriter, r *http.Request) bool {
+				handlerErr <- func() error {
+					rc := http.NewResponseController(w)
+					if err := rc.SetReadDeadline(time.Now().Add(time.Minute)); err != nil {
+						return fmt.Errorf("cannot set read deadline: %w", err)
+					}
+					if err := rc.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+						return fmt.Errorf("cannot set write deadline: %w", err)
+					}
+					w.Header().Set("Content-Type", "text/plain")
+					_, _ = io.WriteString(w, "first\n")
+					if err := rc.Flush(); err != nil {
+						return fmt.Errorf("cannot flush response: %w", err)
+					}
+					// the flushed chunk must reach the client before the handler returns
+					select {
+					case <-firstChunkReceived:
+					case <-time.After(5 * time.Second):
+						return fmt.Errorf("the client didn't receive the flushed chunk")
+					}
+					_, _ = io.WriteString(w, "second\n")
+					return nil
+				}()
+				return true
+			})
+		}))
+		ts := httptest.NewUnstartedServer(h)
+		if http2 {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		} else {
+			ts.Start()
+		}
+		defer ts.Close()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if protoMajor := resp.ProtoMajor; (protoMajor == 2) != http2 {
+			t.Fatalf("unexpected protocol %s; http2=%v", resp.Proto, http2)
+		}
+		br := bufio.NewReader(resp.Body)
+		line, err := br.ReadString('\n')
+		if err != nil || line != "first\n" {
+			t.Fatalf("unexpected first chunk; got %q; err: %v", line, err)
+		}
+		close(firstChunkReceived)
+		rest, err := io.ReadAll(br)
+		if err != nil || string(rest) != "second\n" {
+			t.Fatalf("unexpected rest of response; got %q; err: %v", rest, err)
+		}
+		if err := <-handlerErr; err != nil {
+			t.Fatalf("unexpected error with http2=%v: %v", http2, err)
+		}
+	}
+
+	f(false)
+	f(true)
+}
+
+func TestResponseWriterWithAbort_Hijack(t *testing.T) {
+	hijacked := make(chan error, 1)
+	ts := httptest.NewServer(newGzipHandlerWrapper()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerWrapper(w, r, func(w http.ResponseWriter, r *http.Request) bool {
+			conn, bw, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				_, _ = bw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+				_ = bw.Flush()
+				_ = conn.Close()
+			}
+			hijacked <- err
+			return true
+		})
+	})))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot read response body: %v", err)
+	}
+	if err := <-hijacked; err != nil {
+		t.Fatalf("cannot hijack the connection: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "hijacked" {
+		t.Fatalf("unexpected response; got %d %q; want %d %q", resp.StatusCode, body, http.StatusOK, "hijacked")
+	}
+}
+
+func TestResponseWriterWithAbort_FlushError(t *testing.T) {
+	rwa := &responseWriterWithAbort{
+		ResponseWriter: httptest.NewRecorder(),
+		sentHeaders:    true,
+		aborted:        true,
+	}
+	if err := http.NewResponseController(rwa).Flush(); err == nil {
+		t.Fatalf("expecting non-nil error when flushing aborted response")
+	}
+}
+
+func TestResponseWriterWithAbort_FlushUnsupported(t *testing.T) {
+	// http.ResponseWriter without http.Flusher support
+	w := struct{ http.ResponseWriter }{httptest.NewRecorder()}
+	rwa := &responseWriterWithAbort{
+		ResponseWriter: w,
+	}
+	rwa.Flush()
+	if !rwa.sentHeaders {
+		t.Fatalf("expecting the response headers to be marked as sent after Flush")
+	}
+}
+
+func TestStop_HTTP2(t *testing.T) {
+	defaultMaxGracefulShutdownDuration := *maxGracefulShutdownDuration
+	defer func() {
+		*maxGracefulShutdownDuration = defaultMaxGracefulShutdownDuration
+	}()
+
+	// borrow the self-signed certificate and the HTTP/2 client from httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	tlsConfig := ts.TLS.Clone()
+	client := ts.Client()
+	ts.Close()
+
+	f := func(handlerDuration, gracePeriod time.Duration, terminatedExpected bool) {
+		t.Helper()
+		*maxGracefulShutdownDuration = gracePeriod
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("cannot create listener: %v", err)
+		}
+		addr := ln.Addr().String()
+		requestStarted := make(chan struct{})
+		handlerDone := make(chan struct{})
+		rh := func(w http.ResponseWriter, r *http.Request) bool {
+			defer close(handlerDone)
+			if r.ProtoMajor != 2 {
+				t.Errorf("unexpected protocol %s; want HTTP/2", r.Proto)
+			}
+			close(requestStarted)
+			select {
+			case <-time.After(handlerDuration):
+			case <-r.Context().Done():
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+		serverDone := make(chan struct{})
+		go func() {
+			serveWithListener(addr, tls.NewListener(ln, tlsConfig), rh, 0, true, false)
+			close(serverDone)
+		}()
+
+		respCh := make(chan error, 1)
+		go func() {
+			resp, err := client.Get("https://" + addr + "/")
+			if err == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				if err == nil && resp.StatusCode != http.StatusNoContent {
+					err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+				}
+			}
+			respCh <- err
+		}()
+		<-requestStarted
+
+		terminatedBefore := http2StreamsTerminatedByShutdown.Get()
+		stopErr := stop(context.Background(), addr)
+		respErr := <-respCh
+		<-serverDone
+		// the handler of the terminated stream may outlive the server,
+		// so wait for it in order to avoid races with the flags changed by subsequent tests
+		<-handlerDone
+		terminated := http2StreamsTerminatedByShutdown.Get() - terminatedBefore
+		if terminatedExpected {
+			if stopErr == nil {
+				t.Fatalf("expecting non-nil error from stop")
+			}
+			if respErr == nil {
+				t.Fatalf("expecting non-nil error for the terminated stream")
+			}
+			if terminated != 1 {
+				t.Fatalf("unexpected number of terminated streams; got %d; want 1", terminated)
+			}
+		} else {
+			if stopErr != nil {
+				t.Fatalf("unexpected error from stop: %v", stopErr)
+			}
+			if respErr != nil {
+				t.Fatalf("unexpected error for the in-flight stream: %v", respErr)
+			}
+			if terminated != 0 {
+				t.Fatalf("unexpected number of terminated streams; got %d; want 0", terminated)
+			}
+		}
+	}
+
+	// the in-flight stream is completed within the grace period
+	f(200*time.Millisecond, 5*time.Second, false)
+
+	// the in-flight stream is terminated after the grace period
+	f(5*time.Second, 200*time.Millisecond, true)
+}
+
+func TestCheckHTTP2Flags(t *testing.T) {
+	defaultMaxConcurrentStreams := *http2MaxConcurrentStreams
+	defaultMaxFrameSize := http2MaxFrameSize.N
+	defaultMaxUploadBufferPerStream := http2MaxUploadBufferPerStream.N
+	defer func() {
+		*http2MaxConcurrentStreams = defaultMaxConcurrentStreams
+		http2MaxFrameSize.N = defaultMaxFrameSize
+		http2MaxUploadBufferPerStream.N = defaultMaxUploadBufferPerStream
+	}()
+
+	f := func(maxConcurrentStreams int, maxFrameSize, maxUploadBufferPerStream int64, resultExpected bool) {
+		t.Helper()
+		*http2MaxConcurrentStreams = maxConcurrentStreams
+		http2MaxFrameSize.N = maxFrameSize
+		http2MaxUploadBufferPerStream.N = maxUploadBufferPerStream
+		err := checkHTTP2Flags()
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v; error: %v", result, resultExpected, err)
+		}
+	}
+
+	// defaults
+	f(defaultMaxConcurrentStreams, defaultMaxFrameSize, defaultMaxUploadBufferPerStream, true)
+
+	// frame size bounds
+	f(100, 16*1024, 256*1024, true)
+	f(100, 16*1024*1024-1, 256*1024, true)
+	f(100, 16*1024-1, 256*1024, false)
+	f(100, 16*1024*1024, 256*1024, false)
+
+	// invalid streams and upload buffer
+	f(0, 256*1024, 256*1024, false)
+	f(100, 256*1024, 0, false)
+	f(100, 256*1024, 1<<31, false)
+}
+
+func TestNewHTTP2Server(t *testing.T) {
+	defaultMaxConcurrentStreams := *http2MaxConcurrentStreams
+	defaultMaxUploadBufferPerStream := http2MaxUploadBufferPerStream.N
+	defer func() {
+		*http2MaxConcurrentStreams = defaultMaxConcurrentStreams
+		http2MaxUploadBufferPerStream.N = defaultMaxUploadBufferPerStream
+	}()
+
+	f := func(maxConcurrentStreams int, maxUploadBufferPerStream int64, perConnExpected int32) {
+		t.Helper()
+		*http2MaxConcurrentStreams = maxConcurrentStreams
+		http2MaxUploadBufferPerStream.N = maxUploadBufferPerStream
+		s := newHTTP2Server()
+		if s.MaxConcurrentStreams != uint32(maxConcurrentStreams) {
+			t.Fatalf("unexpected MaxConcurrentStreams; got %d; want %d", s.MaxConcurrentStreams, maxConcurrentStreams)
+		}
+		if s.MaxUploadBufferPerStream != int32(maxUploadBufferPerStream) {
+			t.Fatalf("unexpected MaxUploadBufferPerStream; got %d; want %d", s.MaxUploadBufferPerStream, maxUploadBufferPerStream)
+		}
+		if s.MaxUploadBufferPerConnection != perConnExpected {
+			t.Fatalf("unexpected MaxUploadBufferPerConnection; got %d; want %d", s.MaxUploadBufferPerConnection, perConnExpected)
+		}
+	}
+
+	f(100, 256*1024, 100*256*1024)
+
+	// the connection window is capped by the HTTP/2 spec limit
+	f(1000, 16*1024*1024, 1<<31-1)
+}
+
+func TestCheckAuthFlag(t *testing.T) {
+	defer func() {
+		*httpAuthUsername = ""
+		_ = httpAuthPassword.Set("")
+		_ = metricsAuthKey.Set("")
+	}()
+
+	newRequest := func(authKey, bodyType string) *http.Request {
+		t.Helper()
+		switch bodyType {
+		case "query":
+			return httptest.NewRequest(http.MethodGet, "/metrics?authKey="+url.QueryEscape(authKey), nil)
+		case "form":
+			r := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(url.Values{"authKey": {authKey}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return r
+		case "multipart":
+			var bb bytes.Buffer
+			mw := multipart.NewWriter(&bb)
+			if err := mw.WriteField("authKey", authKey); err != nil {
+				t.Fatalf("cannot write multipart field: %v", err)
+			}
+			if err := mw.Close(); err != nil {
+				t.Fatalf("cannot close multipart writer: %v", err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/metrics", &bb)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			return r
+		default:
+			return httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		}
+	}
+
+	f := func(r *http.Request, basicUser, basicPassword string, resultExpected bool, principalExpected string) {
+		t.Helper()
+		if basicUser != "" {
+			r.SetBasicAuth(basicUser, basicPassword)
+		}
+		r = withPrincipalHolder(r)
+		rec := httptest.NewRecorder()
+		result := CheckAuthFlag(rec, r, metricsAuthKey)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+		if !result && rec.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusUnauthorized)
+		}
+		if principal := Principal(r); principal != principalExpected {
+			t.Fatalf("unexpected principal; got %q; want %q", principal, principalExpected)
+		}
+	}
+
+	// no auth configured
+	f(newRequest("", ""), "", "", true, "")
+
+	// basic auth is used when authKey isn't configured
+	*httpAuthUsername = "admin"
+	if err := httpAuthPassword.Set("pass"); err != nil {
+		t.Fatalf("cannot set -httpAuth.password: %v", err)
+	}
+	f(newRequest("", ""), "", "", false, "")
+	f(newRequest("", ""), "admin", "wrong", false, "")
+	f(newRequest("", ""), "admin", "pass", true, "admin")
+
+	// authKey overrides basic auth
+	if err := metricsAuthKey.Set("secret"); err != nil {
+		t.Fatalf("cannot set -metricsAuthKey: %v", err)
+	}
+	f(newRequest("", ""), "admin", "pass", false, "")
+	for _, bodyType := range []string{"query", "form", "multipart"} {
+		f(newRequest("secret", bodyType), "", "", true, "metricsAuthKey")
+		f(newRequest("wrong", bodyType), "", "", false, "")
+		f(newRequest("", bodyType), "", "", false, "")
+		f(newRequest("wrong", bodyType), "admin", "pass", false, "")
+	}
+}
+
+func TestCheckBasicAuth(t *testing.T) {
+	defer func() {
+		*httpAuthUsername = ""
+		_ = httpAuthPassword.Set("")
+	}()
+
+	f := func(username, password string, resultExpected bool) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+		rec := httptest.NewRecorder()
+		if result := CheckBasicAuth(rec, r); result != resultExpected {
+			t.Fatalf("unexpected result for user %q; got %v; want %v", username, result, resultExpected)
+		}
+		if resultExpected {
+			return
+		}
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code for user %q; got %d; want %d", username, rec.Code, http.StatusUnauthorized)
+		}
+		if h := rec.Header().Get("WWW-Authenticate"); h != `Basic realm="LCP"` {
+			t.Fatalf("unexpected WWW-Authenticate header for user %q: %q", username, h)
+		}
+	}
+
+	// no auth configured
+	f("", "", true)
+	f("admin", "any", true)
+
+	*httpAuthUsername = "admin"
+	if err := httpAuthPassword.Set("pass"); err != nil {
+		t.Fatalf("cannot set -httpAuth.password: %v", err)
+	}
+	f("", "", false)
+	f("admin", "", false)
+	f("admin", "wrong", false)
+	f("other", "pass", false)
+	f("admin", "pass", true)
+
+	// empty password
+	if err := httpAuthPassword.Set(""); err != nil {
+		t.Fatalf("cannot reset -httpAuth.password: %v", err)
+	}
+	f("admin", "pass", false)
+	f("admin", "", true)
+}
+
+func TestGetRequestURI_MasksAuthKey(t *testing.T) {
+	f := func(r *http.Request, uriExpected string) {
+		t.Helper()
+		if uri := GetRequestURI(r); uri != uriExpected {
+			t.Fatalf("unexpected request uri; got %q; want %q", uri, uriExpected)
+		}
+	}
+
+	newPost := func(uri string, form url.Values) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, uri, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	f(newPost("/metrics", url.Values{"authKey": {"top-secret"}}), "/metrics?authKey=secret")
+	f(newPost("/metrics?foo=bar", url.Values{"authKey": {"top-secret"}}), "/metrics?foo=bar&authKey=secret")
+	f(newPost("/metrics", url.Values{"foo": {"bar"}}), "/metrics?foo=bar")
+	f(newPost("/metrics", nil), "/metrics")
+}
+
+func TestRedirect(t *testing.T) {
+	w := httptest.NewRecorder()
+	Redirect(w, "/prefix/")
+	if w.Code != http.StatusFound {
+		t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusFound)
+	}
+	if location := w.Header().Get("Location"); location != "/prefix/" {
+		t.Fatalf("unexpected Location; got %q; want %q", location, "/prefix/")
+	}
+}
+
+func TestRedirectWithStatus(t *testing.T) {
+	f := func(requestURI, url string, preserveQuery bool, code int, locationExpected string) {
+		t.Helper()
+		var r *http.Request
+		if preserveQuery {
+			r = httptest.NewRequest(http.MethodGet, requestURI, nil)
+		}
+		w := httptest.NewRecorder()
+		RedirectWithStatus(w, r, url, code)
+		if w.Code != code {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, code)
+		}
+		if location := w.Header().Get("Location"); location != locationExpected {
+			t.Fatalf("unexpected Location; got %q; want %q", location, locationExpected)
+		}
+	}
+
+	// each redirect status code
+	for _, code := range []int{
+		http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect,
+	} {
+		f("/old?foo=bar", "/new", true, code, "/new?foo=bar")
+	}
+
+	// the query string is preserved as is
+	f("/old?foo=bar&baz=a%20b", "/new", true, http.StatusMovedPermanently, "/new?foo=bar&baz=a%20b")
+	f("/old?foo=bar", "https://lcp.io/new", true, http.StatusPermanentRedirect, "https://lcp.io/new?foo=bar")
+
+	// no query string to preserve
+	f("/old", "/new", true, http.StatusMovedPermanently, "/new")
+
+	// the query string of the url takes precedence
+	f("/old?foo=bar", "/new?x=y", true, http.StatusMovedPermanently, "/new?x=y")
+
+	// nil request drops the query string
+	f("/old?foo=bar", "/new", false, http.StatusMovedPermanently, "/new")
+}
+
+func TestRedirectWithStatus_InvalidCode(t *testing.T) {
+	f := func(code int) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			if recover() == nil {
+				t.Fatalf("expecting panic for status code %d", code)
+			}
+		}()
+		RedirectWithStatus(httptest.NewRecorder(), nil, "/new", code)
+	}
+
+	f(http.StatusOK)
+	f(http.StatusNotModified)
+	f(http.StatusUseProxy)
+	f(http.StatusBadRequest)
+	f(0)
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	f := func(d time.Duration, retryAfterExpected string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		SetRetryAfter(w, d)
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != retryAfterExpected {
+			t.Fatalf("unexpected Retry-After for %s; got %q; want %q", d, retryAfter, retryAfterExpected)
+		}
+	}
+
+	f(-time.Second, "1")
+	f(0, "1")
+	f(time.Millisecond, "1")
+	f(time.Second, "1")
+	f(time.Second+time.Millisecond, "2")
+	f(30*time.Second, "30")
+	f(time.Hour, "3600")
+}
+
+func TestCheckRateLimit_RetryAfter(t *testing.T) {
+	defer func(v string) {
+		if err := perPrincipalRateLimit.Set(v); err != nil {
+			t.Fatalf("cannot restore -http.perPrincipalRateLimit: %s", err)
+		}
+	}(perPrincipalRateLimit.String())
+	if err := perPrincipalRateLimit.Set("1"); err != nil {
+		t.Fatalf("cannot set -http.perPrincipalRateLimit: %s", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if !CheckRateLimit(httptest.NewRecorder(), r) {
+		t.Fatalf("the first request must fit the rate limit")
+	}
+	w := httptest.NewRecorder()
+	if CheckRateLimit(w, r) {
+		t.Fatalf("the second request must exceed the rate limit")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Fatalf("unexpected Retry-After; got %q; want %q", retryAfter, "1")
+	}
+}
+
+func TestBuiltinRoutesHandler_RateLimitBearerToken(t *testing.T) {
+	defer func(v string) {
+		if err := perPrincipalRateLimit.Set(v); err != nil {
+			t.Fatalf("cannot restore -http.perPrincipalRateLimit: %s", err)
+		}
+	}(perPrincipalRateLimit.String())
+	if err := perPrincipalRateLimit.Set("1"); err != nil {
+		t.Fatalf("cannot set -http.perPrincipalRateLimit: %s", err)
+	}
+
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusOK)
+		return true
+	}
+	f := func(statusCodeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		r.RemoteAddr = "192.0.2.2:1234"
+		// The token is invalid, so it must not bypass the per-IP limit
+		r.Header.Set("Authorization", "Bearer x")
+		w := httptest.NewRecorder()
+		builtinRoutesHandler(&server{}, r, w, rh)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+	}
+
+	f(http.StatusOK)
+	f(http.StatusTooManyRequests)
+}
+
+func TestHandlerWrapper_SecurityHeadersHTMLOnly(t *testing.T) {
+	defer func(v bool) {
+		*headerHTMLOnly = v
+	}(*headerHTMLOnly)
+
+	f := func(contentType string, writeHeader, documentHeadersExpected bool) {
+		t.Helper()
+		rh := func(w http.ResponseWriter, r *http.Request) bool {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			if writeHeader {
+				w.WriteHeader(http.StatusCreated)
+			}
+			_, _ = w.Write([]byte("<html></html>"))
+			return true
+		}
+		rec := httptest.NewRecorder()
+		handlerWrapper(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil), rh)
+		h := rec.Result().Header
+		for _, name := range []string{"X-Frame-Options", "Content-Security-Policy"} {
+			if present := h.Get(name) != ""; present != documentHeadersExpected {
+				t.Fatalf("unexpected %s header presence for Content-Type %q; got %v; want %v", name, contentType, present, documentHeadersExpected)
+			}
+		}
+	}
+
+	// the headers are sent with all the responses by default
+	*headerHTMLOnly = false
+	f("application/json", true, true)
+	f("text/html", true, true)
+
+	*headerHTMLOnly = true
+	for _, writeHeader := range []bool{false, true} {
+		f("application/json", writeHeader, false)
+		f("application/vnd.lcp.v1+json; charset=utf-8", writeHeader, false)
+		f("text/plain", writeHeader, false)
+		f("text/html; charset=utf-8", writeHeader, true)
+		f("TEXT/HTML", writeHeader, true)
+		f("application/xhtml+xml", writeHeader, true)
+		f("image/svg+xml", writeHeader, true)
+
+		// the type of responses without Content-Type is unknown until the body is sniffed
+		f("", writeHeader, true)
+	}
+}
+
+func TestHandlerWrapper_SecurityHeaders(t *testing.T) {
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	// f checks the header for plain http and https requests
+	f := func(name, flagValue string, valueExpected, tlsValueExpected string) {
+		t.Helper()
+		for _, useTLS := range []bool{false, true} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			want := valueExpected
+			if useTLS {
+				req.TLS = &tls.ConnectionState{}
+				want = tlsValueExpected
+			}
+			rec := httptest.NewRecorder()
+			handlerWrapper(rec, req, rh)
+			if value := rec.Result().Header.Get(name); value != want {
+				t.Fatalf("unexpected %s header for flag value %q and tls=%v; got %q; want %q", name, flagValue, useTLS, value, want)
+			}
+		}
+	}
+
+	t.Run("hsts", func(t *testing.T) {
+		defer func(v string) {
+			*headerHSTS = v
+		}(*headerHSTS)
+
+		// HSTS is sent only over https
+		*headerHSTS = "max-age=60"
+		f("Strict-Transport-Security", *headerHSTS, "", "max-age=60")
+
+		*headerHSTS = ""
+		f("Strict-Transport-Security", *headerHSTS, "", "")
+
+		// requests from a TLS-terminating proxy
+		defer func(v bool, prefixes []netip.Prefix) {
+			*trustForwardedProto = v
+			trustedProxyPrefixes = prefixes
+		}(*trustForwardedProto, trustedProxyPrefixes)
+		*headerHSTS = "max-age=60"
+		*trustForwardedProto = true
+		trustedProxyPrefixes = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+		fProxy := func(remoteAddr, valueExpected string) {
+			t.Helper()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+			handlerWrapper(rec, req, rh)
+			if value := rec.Result().Header.Get("Strict-Transport-Security"); value != valueExpected {
+				t.Fatalf("unexpected Strict-Transport-Security header for X-Forwarded-Proto: https from %s; got %q; want %q", remoteAddr, value, valueExpected)
+			}
+		}
+		fProxy("192.0.2.10:1234", "max-age=60")
+		fProxy("198.51.100.10:1234", "")
+	})
+
+	t.Run("frameOptions", func(t *testing.T) {
+		defer func(v string) {
+			*headerFrameOptions = v
+		}(*headerFrameOptions)
+
+		*headerFrameOptions = "DENY"
+		f("X-Frame-Options", *headerFrameOptions, "DENY", "DENY")
+
+		*headerFrameOptions = ""
+		f("X-Frame-Options", *headerFrameOptions, "", "")
+	})
+
+	t.Run("csp", func(t *testing.T) {
+		defer func(v string) {
+			*headerCSP = v
+		}(*headerCSP)
+
+		*headerCSP = "default-src 'none'"
+		f("Content-Security-Policy", *headerCSP, "default-src 'none'", "default-src 'none'")
+
+		*headerCSP = ""
+		f("Content-Security-Policy", *headerCSP, "", "")
+	})
+
+	t.Run("server", func(t *testing.T) {
+		defer func(v string) {
+			*serverHeader = v
+		}(*serverHeader)
+
+		*serverHeader = "lcp"
+		f("Server", *serverHeader, "lcp", "lcp")
+
+		*serverHeader = ""
+		f("Server", *serverHeader, "", "")
+	})
+
+	t.Run("hostname", func(t *testing.T) {
+		defer func(v bool) {
+			*disableHostnameHeader = v
+		}(*disableHostnameHeader)
+
+		*disableHostnameHeader = false
+		f("X-Server-Hostname", "false", hostname, hostname)
+
+		*disableHostnameHeader = true
+		f("X-Server-Hostname", "true", "", "")
+	})
+}
+
+func TestGzipHandlerWrapper(t *testing.T) {
+	body := strings.Repeat("compressible content ", 1024)
+	f := func(contentType, contentEncoding string, disable bool, compressionExpected bool) {
+		t.Helper()
+		h := newGzipHandlerWrapper()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			if contentEncoding != "" {
+				w.Header().Set("Content-Encoding", contentEncoding)
+			}
+			if disable {
+				DisableResponseCompression(w)
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		resp := rec.Result()
+		compressed := resp.Header.Get("Content-Encoding") == "gzip" && contentEncoding == ""
+		if compressed != compressionExpected {
+			t.Fatalf("unexpected compression for Content-Type %q, Content-Encoding %q and disable=%v; got %v; want %v",
+				contentType, contentEncoding, disable, compressed, compressionExpected)
+		}
+		if ce := resp.Header.Get("Content-Encoding"); contentEncoding != "" && ce != contentEncoding {
+			t.Fatalf("unexpected Content-Encoding; got %q; want %q", ce, contentEncoding)
+		}
+		if !compressed && rec.Body.String() != body {
+			t.Fatalf("unexpected response body for Content-Type %q; it must be passed as is", contentType)
+		}
+		if resp.Header.Get(gzhttp.HeaderNoCompression) != "" {
+			t.Fatalf("unexpected %s header in the response", gzhttp.HeaderNoCompression)
+		}
+	}
+
+	f("application/json", "", false, true)
+	f("text/html; charset=utf-8", "", false, true)
+	f("image/svg+xml", "", false, true)
+
+	// already compressed content
+	f("image/png", "", false, false)
+	f("image/webp", "", false, false)
+	f("image/jpeg", "", false, false)
+	f("video/mp4", "", false, false)
+	f("application/gzip", "", false, false)
+	f("application/zip", "", false, false)
+	f("application/json", "br", false, false)
+
+	// opt-out by the handler
+	f("application/json", "", true, false)
+}
+
+func TestGzipHandlerWrapper_MinSize(t *testing.T) {
+	defer func(n int64) {
+		gzipMinSize.N = n
+	}(gzipMinSize.N)
+
+	f := func(minSize int64, bodyLen int, setContentLength, compressionExpected bool) {
+		t.Helper()
+		gzipMinSize.N = minSize
+		body := strings.Repeat("x", bodyLen)
+		h := newGzipHandlerWrapper()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if setContentLength {
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		resp := rec.Result()
+		compressed := resp.Header.Get("Content-Encoding") == "gzip"
+		if compressed != compressionExpected {
+			t.Fatalf("unexpected compression for -http.gzipMinSize=%d and body length %d; got %v; want %v", minSize, bodyLen, compressed, compressionExpected)
+		}
+		// caches must distinguish the responses by Accept-Encoding in both cases
+		if vary := resp.Header.Get("Vary"); vary != "Accept-Encoding" {
+			t.Fatalf("unexpected Vary header; got %q; want %q", vary, "Accept-Encoding")
+		}
+		cl := resp.Header.Get("Content-Length")
+		if compressed {
+			// the length of the compressed body isn't known in advance
+			if cl != "" {
+				t.Fatalf("unexpected Content-Length for compressed response: %s", cl)
+			}
+			return
+		}
+		if rec.Body.String() != body {
+			t.Fatalf("unexpected body for uncompressed response")
+		}
+		if setContentLength && cl != fmt.Sprintf("%d", bodyLen) {
+			t.Fatalf("unexpected Content-Length for uncompressed response; got %q; want %d", cl, bodyLen)
+		}
+	}
+
+	for _, setContentLength := range []bool{false, true} {
+		// the default threshold
+		f(gzhttp.DefaultMinSize, 20, setContentLength, false)
+		f(gzhttp.DefaultMinSize, gzhttp.DefaultMinSize-1, setContentLength, false)
+		f(gzhttp.DefaultMinSize, gzhttp.DefaultMinSize, setContentLength, true)
+		f(gzhttp.DefaultMinSize, 64*1024, setContentLength, true)
+
+		// custom thresholds
+		f(100, 20, setContentLength, false)
+		f(100, 100, setContentLength, true)
+		f(0, 20, setContentLength, true)
+	}
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// multiListener accepts connections from multiple listeners.
+//
+// It is used for listening on both tcp4 and tcp6 when -dualStack is set.
+type multiListener struct {
+	lns []net.Listener
+
+	acceptCh chan acceptResult
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(lns []net.Listener) *multiListener {
+	ml := &multiListener{
+		lns:      lns,
+		acceptCh: make(chan acceptResult),
+		closeCh:  make(chan struct{}),
+	}
+	for _, ln := range lns {
+		ml.wg.Add(1)
+		go func(ln net.Listener) {
+			defer ml.wg.Done()
+			ml.acceptLoop(ln)
+		}(ln)
+	}
+	return ml
+}
+
+func (ml *multiListener) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		select {
+		case ml.acceptCh <- acceptResult{conn: conn, err: err}:
+		case <-ml.closeCh:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			if ne, ok := errors.AsType[net.Error](err); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+	}
+}
+
+// Accept returns the next connection accepted by any of the underlying listeners
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case ar := <-ml.acceptCh:
+		return ar.conn, ar.err
+	case <-ml.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all the underlying listeners
+func (ml *multiListener) Close() error {
+	var errs []error
+	ml.closeOnce.Do(func() {
+		close(ml.closeCh)
+		for _, ln := range ml.lns {
+			if err := ln.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ml.wg.Wait()
+	})
+	return errors.Join(errs...)
+}
+
+// Addr returns the addr of the first underlying listener
+func (ml *multiListener) Addr() net.Addr {
+	return ml.lns[0].Addr()
+}
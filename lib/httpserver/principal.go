@@ -0,0 +1,41 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+)
+
+var principalKey = any("principal")
+
+// principalHolder is stored in the request context by handlerWrapper,
+// so auth checks, which cannot replace the *http.Request, are able to record the principal
+type principalHolder struct {
+	name string
+}
+
+func withPrincipalHolder(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), principalKey, &principalHolder{})
+	return r.WithContext(ctx)
+}
+
+// SetPrincipal records name as the authenticated principal for r.
+//
+// It must be called only after successful authentication.
+// It is a no-op for requests which weren't served via Serve
+func SetPrincipal(r *http.Request, name string) {
+	if ph, ok := r.Context().Value(principalKey).(*principalHolder); ok {
+		ph.name = name
+	}
+}
+
+// Principal returns the authenticated principal for r.
+//
+// This is the Basic Auth username, the name of the authKey flag for authKey-protected endpoints,
+// or the JWT subject set by the API authentication filter.
+// An empty string is returned for anonymous requests
+func Principal(r *http.Request) string {
+	if ph, ok := r.Context().Value(principalKey).(*principalHolder); ok {
+		return ph.name
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"lcp.io/lcp/lib/lflag"
+)
+
+var perPrincipalRateLimit = lflag.NewInt("http.perPrincipalRateLimit", 0, "The maximum number of requests per second, which can be served for a single authenticated principal "+
+	"(-httpAuth.* username, authKey or Bearer token subject). Requests without verified principal, including requests with not yet verified Bearer tokens, are limited per client IP. "+
+	"Requests exceeding the limit receive '429 Too Many Requests' response. Zero disables the limit. The limit can be changed at runtime via flags section of -config file")
+
+func init() {
+	lflag.RegisterReloadableFlag("http.perPrincipalRateLimit")
+}
+
+var (
+	principalRateLimitedRequests = metrics.NewCounter(`lcp_http_rate_limited_requests_total{type="principal"}`)
+	ipRateLimitedRequests        = metrics.NewCounter(`lcp_http_rate_limited_requests_total{type="ip"}`)
+)
+
+var (
+	principalLimiter     *rateLimiter
+	ipLimiter            *rateLimiter
+	rateLimitersInitOnce sync.Once
+)
+
+func initRateLimiters() {
+	principalLimiter = newRateLimiter()
+	ipLimiter = newRateLimiter()
+	metrics.NewGauge(`lcp_http_rate_limiter_tracked_keys{type="principal"}`, func() float64 {
+		return float64(principalLimiter.trackedKeys())
+	})
+	metrics.NewGauge(`lcp_http_rate_limiter_tracked_keys{type="ip"}`, func() float64 {
+		return float64(ipLimiter.trackedKeys())
+	})
+}
+
+// CheckRateLimit checks whether r fits -http.perPrincipalRateLimit.
+//
+// The limit is applied per Principal(r), or per client IP for anonymous requests.
+// It writes '429 Too Many Requests' response to w and returns false if the limit is exceeded.
+func CheckRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	limit := perPrincipalRateLimit.Get()
+	if limit <= 0 {
+		return true
+	}
+	rateLimitersInitOnce.Do(initRateLimiters)
+
+	if principal := Principal(r); principal != "" {
+		if principalLimiter.allow(principal, limit) {
+			return true
+		}
+		principalRateLimitedRequests.Inc()
+	} else {
+		if ipLimiter.allow(clientIP(r), limit) {
+			return true
+		}
+		ipRateLimitedRequests.Inc()
+	}
+	// The limit is at least one request per second, so a token is available again in a second
+	SetRetryAfter(w, time.Second)
+	http.Error(w, "Too many requests; see -http.perPrincipalRateLimit", http.StatusTooManyRequests)
+	return false
+}
+
+// clientIP returns the IP of the client connection for r.
+//
+// X-Forwarded-For is intentionally ignored, since it may be set to arbitrary values by the client
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a set of token buckets keyed by an arbitrary string.
+//
+// Every bucket is refilled at limit tokens per second up to limit tokens.
+type rateLimiter struct {
+	mu              sync.Mutex
+	limit           float64
+	buckets         map[string]*tokenBucket
+	lastCleanupTime time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:         make(map[string]*tokenBucket),
+		lastCleanupTime: time.Now(),
+	}
+}
+
+// allow consumes a token from the bucket for the given key and returns false if the bucket is empty.
+//
+// limit is passed on every call, since it may be changed at runtime.
+func (rl *rateLimiter) allow(key string, limit int) bool {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit = float64(limit)
+
+	if now.Sub(rl.lastCleanupTime) > time.Minute {
+		rl.cleanupLocked(now)
+	}
+
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{
+			tokens:     rl.limit,
+			lastUpdate: now,
+		}
+		rl.buckets[key] = b
+	}
+	b.tokens = min(b.tokens+now.Sub(b.lastUpdate).Seconds()*rl.limit, rl.limit)
+	b.lastUpdate = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// cleanupLocked drops buckets, which have been refilled completely, since they are equivalent to missing buckets
+func (rl *rateLimiter) cleanupLocked(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.lastUpdate).Seconds()*rl.limit >= rl.limit {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastCleanupTime = now
+}
+
+func (rl *rateLimiter) trackedKeys() int {
+	rl.mu.Lock()
+	n := len(rl.buckets)
+	rl.mu.Unlock()
+	return n
+}
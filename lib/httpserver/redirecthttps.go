@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	redirectToHTTPS = flag.Bool("http.redirectToHTTPS", false, "Whether to redirect all the requests to listeners without -tls to https with '308 Permanent Redirect'. "+
+		"Requests to /health aren't redirected, so health checks keep working on plain http ports. "+
+		"Requests recognized as https via -http.trustForwardedProto aren't redirected either. See also -http.redirectToHTTPSAddr")
+	redirectToHTTPSAddr = flag.String("http.redirectToHTTPSAddr", "", "Optional host:port for redirects to https if -http.redirectToHTTPS is set, e.g. 'lcp.io:8443'. "+
+		"The host may be omitted, e.g. ':8443', in order to use the host from the Host request header. "+
+		"By default the host from the Host request header is used with the default https port")
+)
+
+var httpsRedirects = metrics.NewCounter(`lcp_http_https_redirects_total`)
+
+// newHTTPSRedirectHandler returns a handler, which redirects the requests to https, except of /health requests, which are passed to h
+func newHTTPSRedirectHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == "/health" || path == GetPathPrefix()+"health" || isHTTPS(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		host := httpsRedirectHost(r.Host, *redirectToHTTPSAddr)
+		if host == "" {
+			http.Error(w, "cannot redirect to https: missing Host header", http.StatusBadRequest)
+			return
+		}
+		httpsRedirects.Inc()
+		RedirectWithStatus(w, nil, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// httpsRedirectHost returns the host[:port] for redirecting the request with the given Host header to https.
+//
+// See -http.redirectToHTTPSAddr for the description of addr
+func httpsRedirectHost(requestHost, addr string) string {
+	host, port := addr, ""
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	if host == "" {
+		host = requestHost
+		if h, _, err := net.SplitHostPort(requestHost); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if host == "" {
+		return ""
+	}
+	if port != "" && port != "443" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 address
+		return "[" + host + "]"
+	}
+	return host
+}
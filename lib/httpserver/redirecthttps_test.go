@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestHTTPSRedirectHost(t *testing.T) {
+	f := func(requestHost, addr, hostExpected string) {
+		t.Helper()
+		if host := httpsRedirectHost(requestHost, addr); host != hostExpected {
+			t.Fatalf("unexpected host for Host=%q and -http.redirectToHTTPSAddr=%q; got %q; want %q", requestHost, addr, host, hostExpected)
+		}
+	}
+
+	// the host from the Host header with the default https port
+	f("lcp.io", "", "lcp.io")
+	f("lcp.io:80", "", "lcp.io")
+	f("lcp.io:8080", "", "lcp.io")
+	f("127.0.0.1:8080", "", "127.0.0.1")
+	f("[::1]:8080", "", "[::1]")
+	f("[::1]", "", "[::1]")
+
+	// the port from -http.redirectToHTTPSAddr
+	f("lcp.io:8080", ":8443", "lcp.io:8443")
+	f("[::1]:8080", ":8443", "[::1]:8443")
+	f("lcp.io:8080", ":443", "lcp.io")
+
+	// the host from -http.redirectToHTTPSAddr
+	f("127.0.0.1:8080", "lcp.io", "lcp.io")
+	f("127.0.0.1:8080", "lcp.io:8443", "lcp.io:8443")
+	f("", "lcp.io:443", "lcp.io")
+
+	// missing host
+	f("", "", "")
+	f("", ":8443", "")
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	defer func(addr, prefix string, trust bool, prefixes []netip.Prefix) {
+		*redirectToHTTPSAddr = addr
+		*pathPrefix = prefix
+		*trustForwardedProto = trust
+		trustedProxyPrefixes = prefixes
+	}(*redirectToHTTPSAddr, *pathPrefix, *trustForwardedProto, trustedProxyPrefixes)
+
+	h := newHTTPSRedirectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	f := func(host, requestURI, forwardedProto string, statusCodeExpected int, locationExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, requestURI, nil)
+		r.Host = host
+		if forwardedProto != "" {
+			r.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s%s; got %d; want %d", host, requestURI, w.Code, statusCodeExpected)
+		}
+		if location := w.Header().Get("Location"); location != locationExpected {
+			t.Fatalf("unexpected Location for %s%s; got %q; want %q", host, requestURI, location, locationExpected)
+		}
+	}
+
+	redirectsBefore := httpsRedirects.Get()
+	f("lcp.io:8080", "/api/v1/users?limit=10", "", http.StatusPermanentRedirect, "https://lcp.io/api/v1/users?limit=10")
+	f("lcp.io:8080", "/a%2Fb", "", http.StatusPermanentRedirect, "https://lcp.io/a%2Fb")
+	f("lcp.io:8080", "/metrics", "", http.StatusPermanentRedirect, "https://lcp.io/metrics")
+	f("", "/metrics", "", http.StatusBadRequest, "")
+	if n := httpsRedirects.Get() - redirectsBefore; n != 3 {
+		t.Fatalf("unexpected number of redirects; got %d; want 3", n)
+	}
+
+	*redirectToHTTPSAddr = ":8443"
+	f("lcp.io:8080", "/", "", http.StatusPermanentRedirect, "https://lcp.io:8443/")
+
+	// health checks aren't redirected
+	f("lcp.io:8080", "/health", "", http.StatusNoContent, "")
+	*pathPrefix = "/foo"
+	f("lcp.io:8080", "/foo/health", "", http.StatusNoContent, "")
+	f("lcp.io:8080", "/foo/metrics", "", http.StatusPermanentRedirect, "https://lcp.io:8443/foo/metrics")
+
+	// https requests from trusted proxies aren't redirected
+	*trustForwardedProto = true
+	trustedProxyPrefixes = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	f("lcp.io:8080", "/foo/metrics", "https", http.StatusNoContent, "")
+	f("lcp.io:8080", "/foo/metrics", "http", http.StatusPermanentRedirect, "https://lcp.io:8443/foo/metrics")
+}
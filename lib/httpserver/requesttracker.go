@@ -0,0 +1,122 @@
+package httpserver
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var debugRequestsHistorySize = flag.Int("http.debugRequestsHistorySize", 100, "The number of recently completed requests to show at /debug/requests page. "+
+	"In-flight requests are always shown")
+
+// requestTracker tracks in-flight requests and keeps a ring buffer of recently completed requests
+// for the /debug/requests page.
+//
+// It doesn't use a global lock, since start and finish are called for every request.
+type requestTracker struct {
+	nextID atomic.Uint64
+
+	// inflight contains *trackedRequest items by request id
+	inflight sync.Map
+
+	recentOnce sync.Once
+	recent     []atomic.Pointer[trackedRequest]
+	recentNext atomic.Uint64
+}
+
+// trackedRequest mustn't be modified after it is registered in requestTracker, since it may be read concurrently
+type trackedRequest struct {
+	method     string
+	path       string
+	remoteAddr string
+	startTime  time.Time
+
+	// the following fields are set when the request is completed
+	statusCode int
+	duration   time.Duration
+
+	// seq is the sequence number of the completed request
+	seq uint64
+}
+
+var requests = &requestTracker{}
+
+// start registers r as in-flight request and returns its id, which must be passed to finish
+func (rt *requestTracker) start(r *http.Request) uint64 {
+	tr := &trackedRequest{
+		method:     r.Method,
+		path:       r.URL.Path,
+		remoteAddr: r.RemoteAddr,
+		startTime:  time.Now(),
+	}
+	id := rt.nextID.Add(1)
+	rt.inflight.Store(id, tr)
+	return id
+}
+
+// finish moves the in-flight request with the given id to the recent requests
+func (rt *requestTracker) finish(id uint64, statusCode int) {
+	v, ok := rt.inflight.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	recent := rt.getRecent()
+	if len(recent) == 0 {
+		return
+	}
+	tr := *v.(*trackedRequest)
+	tr.statusCode = statusCode
+	tr.duration = time.Since(tr.startTime)
+	tr.seq = rt.recentNext.Add(1) - 1
+	recent[tr.seq%uint64(len(recent))].Store(&tr)
+}
+
+// getRecent returns the ring buffer for -http.debugRequestsHistorySize recent requests
+func (rt *requestTracker) getRecent() []atomic.Pointer[trackedRequest] {
+	rt.recentOnce.Do(func() {
+		if n := *debugRequestsHistorySize; n > 0 {
+			rt.recent = make([]atomic.Pointer[trackedRequest], n)
+		}
+	})
+	return rt.recent
+}
+
+// writeRequests writes in-flight requests sorted by age and recent requests sorted by completion time to w
+func (rt *requestTracker) writeRequests(w io.Writer) {
+	now := time.Now()
+
+	var inflight []trackedRequest
+	rt.inflight.Range(func(_, v any) bool {
+		inflight = append(inflight, *v.(*trackedRequest))
+		return true
+	})
+	var recent []trackedRequest
+	for i := range rt.getRecent() {
+		if tr := rt.recent[i].Load(); tr != nil {
+			recent = append(recent, *tr)
+		}
+	}
+
+	sort.Slice(inflight, func(i, j int) bool {
+		return inflight[i].startTime.Before(inflight[j].startTime)
+	})
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].seq < recent[j].seq
+	})
+
+	_, _ = fmt.Fprintf(w, "In-flight requests: %d\n", len(inflight))
+	for _, tr := range inflight {
+		_, _ = fmt.Fprintf(w, "  age=%.3fs method=%s path=%q remoteAddr=%q\n",
+			now.Sub(tr.startTime).Seconds(), tr.method, tr.path, tr.remoteAddr)
+	}
+	_, _ = fmt.Fprintf(w, "\nRecent requests: %d (most recent last)\n", len(recent))
+	for _, tr := range recent {
+		_, _ = fmt.Fprintf(w, "  start=%s duration=%.3fs status=%d method=%s path=%q remoteAddr=%q\n",
+			tr.startTime.UTC().Format(time.RFC3339), tr.duration.Seconds(), tr.statusCode, tr.method, tr.path, tr.remoteAddr)
+	}
+}
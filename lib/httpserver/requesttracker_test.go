@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestTracker(t *testing.T) {
+	defer func(n int) {
+		*debugRequestsHistorySize = n
+	}(*debugRequestsHistorySize)
+	*debugRequestsHistorySize = 2
+
+	rt := &requestTracker{}
+	start := func(path string) uint64 {
+		t.Helper()
+		id := rt.start(httptest.NewRequest(http.MethodGet, path, nil))
+		// make start times distinct, since in-flight requests are sorted by them
+		time.Sleep(time.Millisecond)
+		return id
+	}
+
+	slow := start("/slow")
+	first := start("/first")
+	second := start("/second")
+	third := start("/third")
+	stuck := start("/stuck")
+
+	// the requests are completed in the order other than they have been started
+	rt.finish(second, http.StatusOK)
+	rt.finish(first, http.StatusNotFound)
+	rt.finish(third, http.StatusInternalServerError)
+	// the request, which has been already completed, is ignored
+	rt.finish(third, http.StatusOK)
+
+	var sb strings.Builder
+	rt.writeRequests(&sb)
+	re := regexp.MustCompile(`age=[0-9.]+s|start=\S+ duration=[0-9.]+s`)
+	got := re.ReplaceAllString(sb.String(), "...")
+
+	// the oldest in-flight request goes first, while the most recent completed request goes last;
+	// the oldest completed request is evicted from the history
+	want := `In-flight requests: 2
+  ... method=GET path="/slow" remoteAddr="192.0.2.1:1234"
+  ... method=GET path="/stuck" remoteAddr="192.0.2.1:1234"
+
+Recent requests: 2 (most recent last)
+  ... status=404 method=GET path="/first" remoteAddr="192.0.2.1:1234"
+  ... status=500 method=GET path="/third" remoteAddr="192.0.2.1:1234"
+`
+	if got != want {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	rt.finish(slow, http.StatusOK)
+	rt.finish(stuck, http.StatusOK)
+	sb.Reset()
+	rt.writeRequests(&sb)
+	if !strings.Contains(sb.String(), "In-flight requests: 0\n") {
+		t.Fatalf("unexpected in-flight requests after all the requests are completed:\n%s", sb.String())
+	}
+}
+
+func TestRequestTracker_Concurrent(t *testing.T) {
+	defer func(n int) {
+		*debugRequestsHistorySize = n
+	}(*debugRequestsHistorySize)
+	*debugRequestsHistorySize = 10
+
+	rt := &requestTracker{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id := rt.start(httptest.NewRequest(http.MethodGet, "/concurrent", nil))
+				rt.finish(id, http.StatusOK)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		rt.writeRequests(&strings.Builder{})
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	rt.writeRequests(&sb)
+	if !strings.Contains(sb.String(), "In-flight requests: 0\n") || !strings.Contains(sb.String(), "Recent requests: 10 (most recent last)\n") {
+		t.Fatalf("unexpected output:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package httpserver
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+func setReusePort(_, _ string, _ syscall.RawConn) error {
+	return fmt.Errorf("-tcp.reusePort isn't supported on GOOS=%s", runtime.GOOS)
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package httpserver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNewTCPListener_ReusePort(t *testing.T) {
+	defer func(v bool) {
+		*reusePort = v
+	}(*reusePort)
+
+	newListener := func(addr string) (net.Listener, error) {
+		return NewTCPListener(newTestListenerName(), addr, 0, false, nil)
+	}
+
+	f := func(reusePortEnabled bool) {
+		t.Helper()
+		*reusePort = reusePortEnabled
+		ln1, err := newListener("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("cannot create the first listener: %s", err)
+		}
+		defer func() {
+			_ = ln1.Close()
+		}()
+		addr := ln1.Addr().String()
+
+		ln2, err := newListener(addr)
+		if !reusePortEnabled {
+			if err == nil {
+				_ = ln2.Close()
+				t.Fatalf("expecting non-nil error when binding %s twice without -tcp.reusePort", addr)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("cannot bind %s twice with -tcp.reusePort: %s", addr, err)
+		}
+		_ = ln2.Close()
+	}
+
+	f(true)
+	f(false)
+}
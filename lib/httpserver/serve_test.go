@@ -0,0 +1,477 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"lcp.io/lcp/lib/rest"
+)
+
+// testServer is an http server started via Serve on a random free port
+type testServer struct {
+	t      *testing.T
+	addr   string
+	client *http.Client
+}
+
+func newTestServer(t *testing.T, rh RequestHandler) *testServer {
+	t.Helper()
+
+	// Serve doesn't expose the bound address, so pick a free port upfront
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot pick free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	// Serve returns after the addr is listened, so the server accepts connections right away
+	Serve([]string{addr}, rh, ServerOptions{})
+	return &testServer{
+		t:    t,
+		addr: addr,
+		client: &http.Client{
+			Transport: &http.Transport{DisableKeepAlives: true},
+			Timeout:   10 * time.Second,
+		},
+	}
+}
+
+func (ts *testServer) do(req *http.Request) (int, http.Header, string) {
+	ts.t.Helper()
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		ts.t.Fatalf("cannot perform %s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("cannot read response body for %s %s: %v", req.Method, req.URL, err)
+	}
+	return resp.StatusCode, resp.Header, string(body)
+}
+
+func (ts *testServer) get(path string) (int, http.Header, string) {
+	ts.t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://"+ts.addr+path, nil)
+	if err != nil {
+		ts.t.Fatalf("cannot create request: %v", err)
+	}
+	return ts.do(req)
+}
+
+func (ts *testServer) stop() {
+	ts.t.Helper()
+	if err := Stop([]string{ts.addr}); err != nil {
+		ts.t.Fatalf("cannot stop the server at %s: %v", ts.addr, err)
+	}
+}
+
+func TestServe_StopRightAfterServe(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("cannot pick free port: %v", err)
+		}
+		addr := ln.Addr().String()
+		_ = ln.Close()
+
+		Serve([]string{addr}, nil, ServerOptions{})
+		if err := Stop([]string{addr}); err != nil {
+			t.Fatalf("unexpected error when stopping the server at %s: %v", addr, err)
+		}
+	}
+}
+
+func TestServe_BuiltinRoutes(t *testing.T) {
+	rh := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/hello" {
+			return false
+		}
+		_, _ = w.Write([]byte("hello"))
+		return true
+	}
+	ts := newTestServer(t, rh)
+	defer ts.stop()
+
+	f := func(path string, statusCodeExpected int, bodyExpected string) {
+		t.Helper()
+		statusCode, _, body := ts.get(path)
+		if statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d; body: %s", path, statusCode, statusCodeExpected, body)
+		}
+		if !strings.Contains(body, bodyExpected) {
+			t.Fatalf("missing %q in the response body for %s: %s", bodyExpected, path, body)
+		}
+	}
+
+	f("/health", http.StatusOK, "OK")
+	f("/ping", http.StatusNoContent, "")
+	f("/ping?verbose=true", http.StatusOK, "")
+	f("/-/healthy", http.StatusOK, "LCP is Healthy.")
+	f("/-/ready", http.StatusOK, "LCP is Ready.")
+	f("/robots.txt", http.StatusOK, "Disallow: /")
+	f("/metrics", http.StatusOK, "lcp_http_requests_all_total")
+	f("/metrics.json", http.StatusOK, "lcp_http_requests_all_total")
+	f("/debug/metrics/list", http.StatusOK, `"exposeMetadata":`)
+	f("/flags", http.StatusOK, "-test.timeout=")
+	f("/flags.json", http.StatusOK, `"http.maxGracefulShutdownDuration"`)
+	f("/debug/pprof/cmdline", http.StatusOK, "")
+	f("/debug/requests", http.StatusOK, "/debug/requests")
+
+	// requests not served by builtin routes are passed to the request handler
+	f("/api/hello", http.StatusOK, "hello")
+	f("/api/missing", http.StatusBadRequest, "unsupported path requested")
+}
+
+func TestServe_AuthKeys(t *testing.T) {
+	defer func() {
+		_ = metricsAuthKey.Set("")
+		_ = flagsAuthKey.Set("")
+		_ = pprofAuthKey.Set("")
+	}()
+	for _, key := range []interface{ Set(string) error }{metricsAuthKey, flagsAuthKey, pprofAuthKey} {
+		if err := key.Set("secret"); err != nil {
+			t.Fatalf("cannot set auth key: %v", err)
+		}
+	}
+
+	ts := newTestServer(t, nil)
+	defer ts.stop()
+
+	f := func(path string, statusCodeExpected int) {
+		t.Helper()
+		for _, authKey := range []string{"", "wrong", "secret"} {
+			u := path
+			if authKey != "" {
+				u += "?authKey=" + authKey
+			}
+			want := http.StatusUnauthorized
+			if authKey == "secret" {
+				want = statusCodeExpected
+			}
+			if statusCode, _, body := ts.get(u); statusCode != want {
+				t.Fatalf("unexpected status code for %s; got %d; want %d; body: %s", u, statusCode, want, body)
+			}
+		}
+	}
+
+	f("/metrics", http.StatusOK)
+	f("/metrics.json", http.StatusOK)
+	f("/debug/metrics/list", http.StatusOK)
+	f("/flags", http.StatusOK)
+	f("/flags.json", http.StatusOK)
+	f("/debug/pprof/cmdline", http.StatusOK)
+	f("/debug/requests", http.StatusOK)
+
+	// authKey may be passed in the POST body
+	req, err := http.NewRequest(http.MethodPost, "http://"+ts.addr+"/metrics", strings.NewReader(url.Values{"authKey": {"secret"}}.Encode()))
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if statusCode, _, body := ts.do(req); statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code for authKey in POST body; got %d; want %d; body: %s", statusCode, http.StatusOK, body)
+	}
+
+	// the health check isn't protected
+	if statusCode, _, _ := ts.get("/health"); statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code for /health; got %d; want %d", statusCode, http.StatusOK)
+	}
+}
+
+func TestServe_BasicAuth(t *testing.T) {
+	defer func() {
+		*httpAuthUsername = ""
+		_ = httpAuthPassword.Set("")
+		_ = metricsAuthKey.Set("")
+	}()
+	*httpAuthUsername = "admin"
+	if err := httpAuthPassword.Set("pass"); err != nil {
+		t.Fatalf("cannot set -httpAuth.password: %v", err)
+	}
+
+	ts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		_, _ = w.Write([]byte("hello"))
+		return true
+	})
+	defer ts.stop()
+
+	f := func(path, username, password string, statusCodeExpected int) {
+		t.Helper()
+		// authKey failures don't ask for basic auth credentials
+		challengeExpected := statusCodeExpected == http.StatusUnauthorized && metricsAuthKey.Get() == ""
+		req, err := http.NewRequest(http.MethodGet, "http://"+ts.addr+path, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		statusCode, h, body := ts.do(req)
+		if statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s with user %q; got %d; want %d; body: %s", path, username, statusCode, statusCodeExpected, body)
+		}
+		if challenge := h.Get("WWW-Authenticate") != ""; challenge != challengeExpected {
+			t.Fatalf("unexpected WWW-Authenticate header presence for %s with user %q; got %v; want %v", path, username, challenge, challengeExpected)
+		}
+	}
+
+	f("/api/hello", "", "", http.StatusUnauthorized)
+	f("/api/hello", "admin", "wrong", http.StatusUnauthorized)
+	f("/api/hello", "admin", "pass", http.StatusOK)
+	f("/metrics", "", "", http.StatusUnauthorized)
+	f("/metrics", "admin", "pass", http.StatusOK)
+
+	// the health check isn't protected
+	f("/health", "", "", http.StatusOK)
+
+	// authKey overrides basic auth
+	if err := metricsAuthKey.Set("secret"); err != nil {
+		t.Fatalf("cannot set -metricsAuthKey: %v", err)
+	}
+	f("/metrics", "admin", "pass", http.StatusUnauthorized)
+	f("/metrics?authKey=secret", "", "", http.StatusOK)
+}
+
+func TestServe_ShutdownDelay(t *testing.T) {
+	defaultShutdownDelay := *shutdownDelay
+	defer func() {
+		*shutdownDelay = defaultShutdownDelay
+	}()
+	*shutdownDelay = time.Second
+
+	ts := newTestServer(t, nil)
+
+	if statusCode, _, body := ts.get("/health"); statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code for /health before Stop; got %d; want %d; body: %s", statusCode, http.StatusOK, body)
+	}
+
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- Stop([]string{ts.addr})
+	}()
+
+	// /health must return non-OK responses during the shutdown delay, while the rest of routes are served
+	deadline := time.Now().Add(*shutdownDelay / 2)
+	for {
+		statusCode, header, body := ts.get("/health")
+		if statusCode == http.StatusServiceUnavailable {
+			if !strings.Contains(body, "delayed shutdown mode") {
+				t.Fatalf("unexpected response body for /health during shutdown delay: %s", body)
+			}
+			if retryAfter := header.Get("Retry-After"); retryAfter != "1" {
+				t.Fatalf("unexpected Retry-After for /health during shutdown delay; got %q; want %q", retryAfter, "1")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/health didn't return %d during shutdown delay; last status code: %d", http.StatusServiceUnavailable, statusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if statusCode, _, _ := ts.get("/ping"); statusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status code for /ping during shutdown delay; got %d; want %d", statusCode, http.StatusNoContent)
+	}
+
+	if err := <-stopErr; err != nil {
+		t.Fatalf("cannot stop the server: %v", err)
+	}
+	if _, err := ts.client.Get("http://" + ts.addr + "/health"); err == nil {
+		t.Fatalf("expecting non-nil error after the server is stopped")
+	}
+}
+
+func TestServe_StopContext(t *testing.T) {
+	defaultShutdownDelay := *shutdownDelay
+	defer func() {
+		*shutdownDelay = defaultShutdownDelay
+	}()
+	*shutdownDelay = time.Minute
+
+	ts := newTestServer(t, nil)
+
+	// the shutdown delay must be cut by the ctx deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	err := StopContext(ctx, []string{ts.addr})
+	if d := time.Since(startTime); d > 10*time.Second {
+		t.Fatalf("StopContext didn't return after the ctx deadline; it took %s", d)
+	}
+	if err != nil {
+		t.Fatalf("cannot stop the server: %v", err)
+	}
+	if _, err := ts.client.Get("http://" + ts.addr + "/health"); err == nil {
+		t.Fatalf("expecting non-nil error after the server is stopped")
+	}
+}
+
+func TestServe_Trailers(t *testing.T) {
+	ts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		rest.DeclareTrailers(w, "X-Checksum")
+		w.Header().Set("Content-Type", "text/plain")
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		for i := 0; i < n; i++ {
+			_, _ = w.Write([]byte("data\n"))
+		}
+		rest.SetTrailer(w, "X-Checksum", strconv.Itoa(n))
+		return true
+	})
+	defer ts.stop()
+
+	f := func(n int, acceptEncoding string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "http://"+ts.addr+"/export?n="+strconv.Itoa(n), nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("cannot perform request: %v", err)
+		}
+		defer resp.Body.Close()
+		if _, err := io.ReadAll(resp.Body); err != nil {
+			t.Fatalf("cannot read response body: %v", err)
+		}
+		// trailers are available after the body is read
+		if value := resp.Trailer.Get("X-Checksum"); value != strconv.Itoa(n) {
+			t.Fatalf("unexpected X-Checksum trailer for n=%d and Accept-Encoding %q; got %q; want %q", n, acceptEncoding, value, strconv.Itoa(n))
+		}
+	}
+
+	// small and big responses, both uncompressed and compressed
+	for _, acceptEncoding := range []string{"identity", "gzip"} {
+		f(1, acceptEncoding)
+		f(10000, acceptEncoding)
+	}
+}
+
+// rawRequest sends the raw HTTP request to ts and returns the response with the body read
+func (ts *testServer) rawRequest(req string) (*http.Response, string) {
+	ts.t.Helper()
+	conn, err := net.Dial("tcp", ts.addr)
+	if err != nil {
+		ts.t.Fatalf("cannot connect to server: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(req)); err != nil {
+		ts.t.Fatalf("cannot send request: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		ts.t.Fatalf("cannot read response: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("cannot read response body: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp, string(body)
+}
+
+func TestServe_HTTP10(t *testing.T) {
+	defer func(v bool) {
+		*requireHost = v
+	}(*requireHost)
+	defer func(v string) {
+		*pathPrefix = v
+	}(*pathPrefix)
+
+	ts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/host" {
+			return false
+		}
+		_, _ = w.Write([]byte("host=" + r.Host))
+		return true
+	})
+	defer ts.stop()
+
+	f := func(req string, statusCodeExpected int, bodyExpected string) {
+		t.Helper()
+		resp, body := ts.rawRequest(req)
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code for %q; got %d; want %d; body: %s", req, resp.StatusCode, statusCodeExpected, body)
+		}
+		if !strings.Contains(body, bodyExpected) {
+			t.Fatalf("missing %q in the response body for %q: %s", bodyExpected, req, body)
+		}
+		// HTTP/1.0 connections aren't kept alive by default
+		if resp.ProtoMajor == 1 && resp.ProtoMinor == 0 && !resp.Close {
+			t.Fatalf("expecting the connection to be closed after HTTP/1.0 response for %q", req)
+		}
+	}
+
+	*requireHost = false
+	f("GET /health HTTP/1.0\r\n\r\n", http.StatusOK, "OK")
+	f("GET /api/host HTTP/1.0\r\n\r\n", http.StatusOK, "host=")
+	f("GET /api/host HTTP/1.0\r\nHost: lcp.io\r\n\r\n", http.StatusOK, "host=lcp.io")
+
+	// net/http rejects HTTP/1.1 requests without Host on its own
+	resp, _ := ts.rawRequest("GET /health HTTP/1.1\r\nConnection: close\r\n\r\n")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code for HTTP/1.1 request without Host; got %d; want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// relative redirects don't need Host
+	*pathPrefix = "/prefix/"
+	resp, _ = ts.rawRequest("GET /prefix HTTP/1.0\r\n\r\n")
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/prefix/" {
+		t.Fatalf("unexpected redirect for HTTP/1.0 request without Host; got %d to %q; want %d to %q",
+			resp.StatusCode, resp.Header.Get("Location"), http.StatusFound, "/prefix/")
+	}
+	*pathPrefix = ""
+
+	*requireHost = true
+	errorsBefore := missingHostErrors.Get()
+	f("GET /health HTTP/1.0\r\n\r\n", http.StatusBadRequest, "missing Host header")
+	f("GET /api/host HTTP/1.0\r\n\r\n", http.StatusBadRequest, "missing Host header")
+	f("GET /api/host HTTP/1.0\r\nHost: lcp.io\r\n\r\n", http.StatusOK, "host=lcp.io")
+	if n := missingHostErrors.Get() - errorsBefore; n != 2 {
+		t.Fatalf("unexpected number of requests rejected for missing Host; got %d; want 2", n)
+	}
+}
+
+func TestServe_RedirectToHTTPS(t *testing.T) {
+	defer func(v bool) {
+		*redirectToHTTPS = v
+	}(*redirectToHTTPS)
+	*redirectToHTTPS = true
+
+	ts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	})
+	defer ts.stop()
+	ts.client.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	f := func(path string, statusCodeExpected int, locationExpected string) {
+		t.Helper()
+		statusCode, header, _ := ts.get(path)
+		if statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", path, statusCode, statusCodeExpected)
+		}
+		if location := header.Get("Location"); location != locationExpected {
+			t.Fatalf("unexpected Location for %s; got %q; want %q", path, location, locationExpected)
+		}
+	}
+
+	f("/api/v1/users?limit=10", http.StatusPermanentRedirect, "https://127.0.0.1/api/v1/users?limit=10")
+	f("/metrics", http.StatusPermanentRedirect, "https://127.0.0.1/metrics")
+	f("/health", http.StatusOK, "")
+}
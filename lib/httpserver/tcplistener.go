@@ -1,24 +1,54 @@
 package httpserver
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"flag"
-	"fmt"
 	"net"
+	"syscall"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
+	"lcp.io/lcp/lib/lflag"
 	"lcp.io/lcp/lib/logger"
 )
 
-var enableTCP6 = flag.Bool("enableTCP6", false, "Whether to enable IPv6 for listening and dialing. By default, only IPv4 TCP and UDP are used")
+var (
+	enableTCP6 = flag.Bool("enableTCP6", false, "Whether to enable IPv6 for listening and dialing. By default, only IPv4 TCP and UDP are used")
+	reusePort  = flag.Bool("tcp.reusePort", false, "Whether to set SO_REUSEPORT on listening sockets. This allows a new process to listen on the same addr before the old process exits, "+
+		"which may be used for zero-downtime restarts and for spreading the load among multiple processes. Supported on Linux and BSD")
+	maxConcurrentConns = lflag.NewArrayInt("tcp.maxConcurrentConns", 0, "The maximum number of concurrently open connections for the corresponding listen addr. "+
+		"New connections beyond the limit are closed and accepting is paused until some of the open connections are closed. "+
+		"This protects from file descriptors exhaustion. Zero means no limit")
+	maxAcceptRate = lflag.NewArrayInt("tcp.maxAcceptRate", 0, "The maximum number of connections per second to accept for the corresponding listen addr. Zero means no limit")
+	dualStack     = flag.Bool("dualStack", false, "Whether to listen on both IPv4 and IPv6 via separate tcp4 and tcp6 sockets for wildcard listen addrs such as :8080. "+
+		"This makes dual-stack listening independent of the OS default for IPv4-mapped IPv6 addresses. Non-wildcard addrs are listened according to -enableTCP6")
+)
 
-func NewTCPListener(name, addr string, useProxyProtocol bool, tlsConfig *tls.Config) (net.Listener, error) {
-	network := GetTCPNetwork()
-	ln, err := net.Listen(network, addr)
-	if err != nil {
-		return nil, err
+// NewTCPListener returns new TCP listener for the given addr.
+//
+// idx is the index of addr in the list of listen addrs. It is used for obtaining per-listener settings
+// from array flags such as -tcp.maxConcurrentConns.
+func NewTCPListener(name, addr string, idx int, useProxyProtocol bool, tlsConfig *tls.Config) (net.Listener, error) {
+	var lc net.ListenConfig
+	if *reusePort {
+		lc.Control = setReusePort
+	}
+	var lns []net.Listener
+	for _, la := range getListenAddrs(addr) {
+		ln, err := lc.Listen(context.Background(), la.network, la.addr)
+		if err != nil {
+			for _, ln := range lns {
+				_ = ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	ln := lns[0]
+	if len(lns) > 1 {
+		ln = newMultiListener(lns)
 	}
 
 	ms := metrics.GetDefaultSet()
@@ -27,11 +57,20 @@ func NewTCPListener(name, addr string, useProxyProtocol bool, tlsConfig *tls.Con
 		tlsConfig:        tlsConfig,
 		useProxyProtocol: useProxyProtocol,
 
-		accepts:      ms.NewCounter(fmt.Sprintf(`lcp_tcp_listeners_accepts_total{name=%q, addr=%q}`, name, addr)),
-		acceptErrors: ms.NewCounter(fmt.Sprintf(`lcp_tcp_listeners_errors_total{name=%q, addr=%q, type="accept"}`, name, addr)),
+		accepts:      ms.NewCounter(listenerMetricName("lcp_tcp_listeners_accepts_total", name, addr)),
+		acceptErrors: ms.NewCounter(listenerMetricName("lcp_tcp_listeners_errors_total", name, addr, "type", "accept")),
+		rejected:     ms.NewCounter(listenerMetricName("lcp_tcp_listener_conns_rejected_total", name, addr)),
+
+		tooManyOpenFilesErrors: ms.NewCounter(listenerMetricName("lcp_tcp_listeners_errors_total", name, addr, "type", "too_many_open_files")),
+	}
+	if n := maxConcurrentConns.GetOptionalArg(idx); n > 0 {
+		tln.connsSem = make(chan struct{}, n)
+	}
+	if rate := maxAcceptRate.GetOptionalArg(idx); rate > 0 {
+		tln.acceptInterval = time.Second / time.Duration(rate)
 	}
 	tln.cm.init(ms, "lcp_tcp_listener", name, addr)
-	return tln, err
+	return tln, nil
 }
 
 // TCPListener listens for the addr passed to NewTCPListener
@@ -42,18 +81,39 @@ type TCPListener struct {
 
 	accepts      *metrics.Counter
 	acceptErrors *metrics.Counter
+	rejected     *metrics.Counter
+
+	tooManyOpenFilesErrors *metrics.Counter
 
 	useProxyProtocol bool
 
 	cm connMetrics
+
+	// connsSem limits the number of concurrently open connections according to -tcp.maxConcurrentConns
+	connsSem chan struct{}
+
+	// acceptInterval is the minimum interval between accepted connections according to -tcp.maxAcceptRate
+	acceptInterval time.Duration
+	nextAcceptTime time.Time
 }
 
 // Accept accepts connections from the addr passed to NewTCPListener
 func (ln *TCPListener) Accept() (net.Conn, error) {
 	for {
+		ln.waitForAcceptRate()
 		conn, err := ln.Listener.Accept()
 		ln.accepts.Inc()
 		if err != nil {
+			if isTooManyOpenFilesError(err) {
+				// File descriptors exhaustion is usually transient, so do not stop accepting connections.
+				// It is handled separately from other temporary errors in order to expose a dedicated metric
+				// and to avoid flooding logs under fd pressure.
+				ln.tooManyOpenFilesErrors.Inc()
+				logger.WithThrottler("tcpAcceptTooManyOpenFiles", 5*time.Second).Errorf("cannot accept connection at TCP addr %q: %s; "+
+					"retrying in %s; consider increasing the limit on open files (ulimit -n) or setting -tcp.maxConcurrentConns", ln.Addr(), err, tooManyOpenFilesRetryDelay)
+				time.Sleep(tooManyOpenFilesRetryDelay)
+				continue
+			}
 			if ne, ok := errors.AsType[net.Error](err); ok && ne.Temporary() {
 				logger.Errorf("temporary error when listening for TCP addr %q: %s", ln.Addr(), err)
 				time.Sleep(time.Second)
@@ -63,6 +123,10 @@ func (ln *TCPListener) Accept() (net.Conn, error) {
 			return nil, err
 		}
 
+		if !ln.acquireConnSlot(conn) {
+			continue
+		}
+
 		if ln.useProxyProtocol {
 			pConn := newProxyProtocolConn(conn)
 			conn = pConn
@@ -70,8 +134,10 @@ func (ln *TCPListener) Accept() (net.Conn, error) {
 
 		ln.cm.conns.Inc()
 		sc := &statConn{
-			Conn: conn,
-			cm:   &ln.cm,
+			Conn:      conn,
+			cm:        &ln.cm,
+			startTime: time.Now(),
+			connsSem:  ln.connsSem,
 		}
 		if ln.tlsConfig == nil {
 			return sc, nil
@@ -81,6 +147,52 @@ func (ln *TCPListener) Accept() (net.Conn, error) {
 	}
 }
 
+// tooManyOpenFilesRetryDelay is the delay before accepting connections after file descriptors exhaustion
+var tooManyOpenFilesRetryDelay = 100 * time.Millisecond
+
+func isTooManyOpenFilesError(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// waitForAcceptRate sleeps until the next connection may be accepted according to -tcp.maxAcceptRate
+//
+// It mustn't be called concurrently, since net/http calls Accept from a single goroutine.
+func (ln *TCPListener) waitForAcceptRate() {
+	if ln.acceptInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	if d := ln.nextAcceptTime.Sub(now); d > 0 {
+		time.Sleep(d)
+		now = ln.nextAcceptTime
+	}
+	ln.nextAcceptTime = now.Add(ln.acceptInterval)
+}
+
+// acquireConnSlot acquires a slot for conn according to -tcp.maxConcurrentConns.
+//
+// If there are no free slots, then conn is closed and false is returned after a slot is freed,
+// so no new connections are accepted while the limit is reached.
+func (ln *TCPListener) acquireConnSlot(conn net.Conn) bool {
+	if ln.connsSem == nil {
+		return true
+	}
+	select {
+	case ln.connsSem <- struct{}{}:
+		return true
+	default:
+	}
+	ln.rejected.Inc()
+	_ = conn.Close()
+	logger.WithThrottler("tcpMaxConcurrentConns", 5*time.Second).Warnf("closing the connection from %q, since -tcp.maxConcurrentConns=%d open connections are reached at %q; "+
+		"pausing accepting new connections until some of the open connections are closed", conn.RemoteAddr(), cap(ln.connsSem), ln.Addr())
+
+	// Wait until a slot is freed.
+	ln.connsSem <- struct{}{}
+	<-ln.connsSem
+	return false
+}
+
 // EnableIPv6 enables IPv6 for dialing and listening
 func EnableIPv6() {
 	*enableTCP6 = true
@@ -108,3 +220,34 @@ func GetTCPNetwork() string {
 	}
 	return "tcp4"
 }
+
+type listenAddr struct {
+	network string
+	addr    string
+}
+
+// getListenAddrs returns networks and addrs to listen on for the given addr.
+//
+// Separate tcp4 and tcp6 listen addrs are returned for wildcard addr if -dualStack is set.
+func getListenAddrs(addr string) []listenAddr {
+	if *dualStack {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil && isWildcardHost(host) {
+			// Use empty host, so it is treated as the wildcard addr for both networks.
+			wildcardAddr := net.JoinHostPort("", port)
+			return []listenAddr{
+				{network: "tcp4", addr: wildcardAddr},
+				{network: "tcp6", addr: wildcardAddr},
+			}
+		}
+	}
+	return []listenAddr{{network: GetTCPNetwork(), addr: addr}}
+}
+
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,318 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"lcp.io/lcp/lib/lflag"
+)
+
+// fakeListener returns the given errors from Accept before returning connections
+type fakeListener struct {
+	net.Listener
+
+	errs []error
+}
+
+func (fl *fakeListener) Accept() (net.Conn, error) {
+	if len(fl.errs) > 0 {
+		err := fl.errs[0]
+		fl.errs = fl.errs[1:]
+		return nil, err
+	}
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func (fl *fakeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+}
+
+var testListenerID atomic.Uint64
+
+// newTestListenerName returns a unique listener name for NewTCPListener,
+// since the listener metrics are registered in the default set per name and addr
+func newTestListenerName() string {
+	return fmt.Sprintf("test%d", testListenerID.Add(1))
+}
+
+func newTestTCPListener(ln net.Listener) *TCPListener {
+	ms := metrics.NewSet()
+	tln := &TCPListener{
+		Listener: ln,
+
+		accepts:                ms.NewCounter(`accepts_total`),
+		acceptErrors:           ms.NewCounter(`accept_errors_total`),
+		rejected:               ms.NewCounter(`rejected_total`),
+		tooManyOpenFilesErrors: ms.NewCounter(`too_many_open_files_errors_total`),
+	}
+	tln.cm.init(ms, "test", "test", "127.0.0.1:8080")
+	return tln
+}
+
+func TestTCPListenerAccept_TooManyOpenFiles(t *testing.T) {
+	defer func(d time.Duration) {
+		tooManyOpenFilesRetryDelay = d
+	}(tooManyOpenFilesRetryDelay)
+	tooManyOpenFilesRetryDelay = time.Millisecond
+
+	f := func(err error) {
+		t.Helper()
+
+		tln := newTestTCPListener(&fakeListener{
+			errs: []error{err, err},
+		})
+		conn, err := tln.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_ = conn.Close()
+		if n := tln.tooManyOpenFilesErrors.Get(); n != 2 {
+			t.Fatalf("unexpected number of too many open files errors; got %d; want 2", n)
+		}
+		if n := tln.acceptErrors.Get(); n != 0 {
+			t.Fatalf("unexpected number of accept errors; got %d; want 0", n)
+		}
+	}
+
+	f(syscall.EMFILE)
+	f(syscall.ENFILE)
+	f(&net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept4", syscall.EMFILE)})
+}
+
+func TestTCPListenerAccept_PermanentError(t *testing.T) {
+	errPermanent := fmt.Errorf("use of closed network connection")
+	tln := newTestTCPListener(&fakeListener{
+		errs: []error{errPermanent},
+	})
+	if _, err := tln.Accept(); err != errPermanent {
+		t.Fatalf("unexpected error; got %v; want %v", err, errPermanent)
+	}
+	if n := tln.acceptErrors.Get(); n != 1 {
+		t.Fatalf("unexpected number of accept errors; got %d; want 1", n)
+	}
+}
+
+func TestTCPListenerAccept_MaxAcceptRate(t *testing.T) {
+	f := func(rate, n int, minDuration, maxDuration time.Duration) {
+		t.Helper()
+		tln := newTestTCPListener(&fakeListener{})
+		if rate > 0 {
+			tln.acceptInterval = time.Second / time.Duration(rate)
+		}
+		startTime := time.Now()
+		for i := 0; i < n; i++ {
+			conn, err := tln.Accept()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_ = conn.Close()
+		}
+		d := time.Since(startTime)
+		if d < minDuration {
+			t.Fatalf("unexpected duration of %d accepts at rate %d; got %s; want at least %s", n, rate, d, minDuration)
+		}
+		if d > maxDuration {
+			t.Fatalf("unexpected duration of %d accepts at rate %d; got %s; want at most %s", n, rate, d, maxDuration)
+		}
+	}
+
+	// n accepts at rate r take at least (n-1)/r, since the first connection is accepted immediately
+	f(50, 6, 100*time.Millisecond, 10*time.Second)
+	f(100, 11, 100*time.Millisecond, 10*time.Second)
+
+	// zero rate doesn't throttle accepts
+	f(0, 1000, 0, time.Second)
+}
+
+func TestTCPListenerConnMetrics(t *testing.T) {
+	ms := metrics.NewSet()
+	tln := newTestTCPListener(&fakeListener{})
+	tln.cm.init(ms, "lcp_tcp_listener", "test", "127.0.0.1:8080")
+
+	f := func(metric string, expected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		ms.WritePrometheus(&bb)
+		for _, line := range strings.Split(bb.String(), "\n") {
+			if value, ok := strings.CutPrefix(line, metric+" "); ok {
+				if value != expected {
+					t.Fatalf("unexpected value for %s; got %s; want %s", metric, value, expected)
+				}
+				return
+			}
+		}
+		t.Fatalf("cannot find %s in\n%s", metric, bb.String())
+	}
+
+	conn, err := tln.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(`lcp_tcp_listener_conns{name="test", addr="127.0.0.1:8080"}`, "1")
+	f(`lcp_tcp_listener_closed_conns_total{name="test", addr="127.0.0.1:8080"}`, "0")
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("unexpected error when closing the connection: %s", err)
+	}
+	f(`lcp_tcp_listener_conns{name="test", addr="127.0.0.1:8080"}`, "0")
+	f(`lcp_tcp_listener_closed_conns_total{name="test", addr="127.0.0.1:8080"}`, "1")
+	f(`lcp_tcp_listener_conn_lifetime_seconds_count{name="test", addr="127.0.0.1:8080"}`, "1")
+
+	// the repeated Close mustn't be counted
+	_ = conn.Close()
+	f(`lcp_tcp_listener_conns{name="test", addr="127.0.0.1:8080"}`, "0")
+	f(`lcp_tcp_listener_closed_conns_total{name="test", addr="127.0.0.1:8080"}`, "1")
+	f(`lcp_tcp_listener_conn_lifetime_seconds_count{name="test", addr="127.0.0.1:8080"}`, "1")
+}
+
+func TestTCPListenerAccept_MaxConcurrentConns(t *testing.T) {
+	tln := newTestTCPListener(&fakeListener{})
+	tln.connsSem = make(chan struct{}, 1)
+
+	conn, err := tln.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the limit is reached, so the next connection is closed and Accept blocks until the open connection is closed
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	resultCh := make(chan acceptResult, 1)
+	go func() {
+		conn, err := tln.Accept()
+		resultCh <- acceptResult{conn: conn, err: err}
+	}()
+	select {
+	case <-resultCh:
+		t.Fatalf("Accept must block while -tcp.maxConcurrentConns open connections are reached")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := tln.rejected.Get(); n != 1 {
+		t.Fatalf("unexpected number of rejected connections; got %d; want 1", n)
+	}
+
+	// closing the open connection resumes accepting
+	_ = conn.Close()
+	var result acceptResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Accept didn't resume after the open connection has been closed")
+	}
+	if result.err != nil {
+		t.Fatalf("unexpected error: %s", result.err)
+	}
+	if n := len(tln.connsSem); n != 1 {
+		t.Fatalf("unexpected number of acquired connection slots; got %d; want 1", n)
+	}
+	_ = result.conn.Close()
+	if n := len(tln.connsSem); n != 0 {
+		t.Fatalf("unexpected number of acquired connection slots after closing the connection; got %d; want 0", n)
+	}
+}
+
+func TestNewTCPListener_PerListenerLimits(t *testing.T) {
+	defer func(conns, rate lflag.ArrayInt) {
+		*maxConcurrentConns = conns
+		*maxAcceptRate = rate
+	}(*maxConcurrentConns, *maxAcceptRate)
+	if err := maxConcurrentConns.Set("10,,30"); err != nil {
+		t.Fatalf("cannot set -tcp.maxConcurrentConns: %s", err)
+	}
+	if err := maxAcceptRate.Set("100"); err != nil {
+		t.Fatalf("cannot set -tcp.maxAcceptRate: %s", err)
+	}
+
+	f := func(idx, connsExpected int, acceptIntervalExpected time.Duration) {
+		t.Helper()
+		ln, err := NewTCPListener(newTestListenerName(), "127.0.0.1:0", idx, false, nil)
+		if err != nil {
+			t.Fatalf("cannot create listener: %s", err)
+		}
+		defer func() {
+			_ = ln.Close()
+		}()
+		tln := ln.(*TCPListener)
+		if n := cap(tln.connsSem); n != connsExpected {
+			t.Fatalf("unexpected connections limit for listener #%d; got %d; want %d", idx, n, connsExpected)
+		}
+		if tln.acceptInterval != acceptIntervalExpected {
+			t.Fatalf("unexpected accept interval for listener #%d; got %s; want %s", idx, tln.acceptInterval, acceptIntervalExpected)
+		}
+	}
+
+	f(0, 10, 10*time.Millisecond)
+	// the empty value falls back to the default, which means no limit
+	f(1, 0, 10*time.Millisecond)
+	f(2, 30, 10*time.Millisecond)
+	// there is no value for the listener, so the default is used
+	f(3, 0, 10*time.Millisecond)
+}
+
+func TestGetListenAddrs(t *testing.T) {
+	defer func(dualStackOrig, enableTCP6Orig bool) {
+		*dualStack = dualStackOrig
+		*enableTCP6 = enableTCP6Orig
+	}(*dualStack, *enableTCP6)
+
+	f := func(addr string, dualStackEnabled, tcp6Enabled bool, expected []listenAddr) {
+		t.Helper()
+		*dualStack = dualStackEnabled
+		*enableTCP6 = tcp6Enabled
+		result := getListenAddrs(addr)
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("unexpected listen addrs for %q\ngot\n%v\nwant\n%v", addr, result, expected)
+		}
+	}
+
+	// -dualStack isn't set
+	f(":8080", false, false, []listenAddr{{network: "tcp4", addr: ":8080"}})
+	f(":8080", false, true, []listenAddr{{network: "tcp", addr: ":8080"}})
+
+	// -dualStack is set for wildcard addrs
+	dualStackAddrs := []listenAddr{
+		{network: "tcp4", addr: ":8080"},
+		{network: "tcp6", addr: ":8080"},
+	}
+	f(":8080", true, false, dualStackAddrs)
+	f("0.0.0.0:8080", true, false, dualStackAddrs)
+	f("[::]:8080", true, true, dualStackAddrs)
+
+	// -dualStack is set for non-wildcard addrs
+	f("127.0.0.1:8080", true, false, []listenAddr{{network: "tcp4", addr: "127.0.0.1:8080"}})
+	f("[::1]:8080", true, true, []listenAddr{{network: "tcp", addr: "[::1]:8080"}})
+	f("localhost:8080", true, false, []listenAddr{{network: "tcp4", addr: "localhost:8080"}})
+}
+
+func TestListenerMetricName(t *testing.T) {
+	f := func(addr, want string) {
+		t.Helper()
+		got := listenerMetricName("lcp_tcp_listener_conns", "http", addr)
+		if got != want {
+			t.Fatalf("unexpected metric name; got %s; want %s", got, want)
+		}
+		if err := metrics.ValidateMetric(got); err != nil {
+			t.Fatalf("invalid metric %s: %v", got, err)
+		}
+	}
+
+	f(":8080", `lcp_tcp_listener_conns{name="http", addr=":8080"}`)
+	f("[fe80::1%eth0]:8080", `lcp_tcp_listener_conns{name="http", addr="[fe80::1%eth0]:8080"}`)
+	f(`bad"addr\`, `lcp_tcp_listener_conns{name="http", addr="bad\"addr\\"}`)
+	f("tab\taddr\n", `lcp_tcp_listener_conns{name="http", addr="tab	addr\n"}`)
+
+	// all the listener metrics can be registered for unusual addresses
+	(&connMetrics{}).init(metrics.NewSet(), "lcp_tcp_listener", "http", `bad"addr\`)
+}
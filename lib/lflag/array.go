@@ -1,6 +1,7 @@
 package lflag
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"strconv"
@@ -220,7 +221,15 @@ func getTrailingBackslashesCount(s string) int {
 	return len(s) - n
 }
 
-// GetOptionalArg returns optional arg under the given argIdx
+// Len returns the number of values in a
+func (a *ArrayString) Len() int {
+	return len(*a)
+}
+
+// GetOptionalArg returns optional arg under the given argIdx.
+//
+// If a contains a single value, then it is returned for any argIdx. An empty string is returned
+// for argIdx outside a. Use CheckArrayFlags for detecting such misconfigurations at startup.
 func (a *ArrayString) GetOptionalArg(argIdx int) string {
 	x := *a
 	if argIdx >= len(x) {
@@ -265,7 +274,14 @@ func (a *ArrayBool) Set(value string) error {
 	return nil
 }
 
-// GetOptionalArg returns optional arg under the given argIdx
+// Len returns the number of values in a
+func (a *ArrayBool) Len() int {
+	return len(*a)
+}
+
+// GetOptionalArg returns optional arg under the given argIdx.
+//
+// It has the same semantics as ArrayString.GetOptionalArg, except of false is returned for argIdx outside a.
 func (a *ArrayBool) GetOptionalArg(argIdx int) bool {
 	x := *a
 	if argIdx >= len(x) {
@@ -311,7 +327,14 @@ func (a *ArrayDuration) Set(value string) error {
 	return nil
 }
 
+// Len returns the number of values in a
+func (a *ArrayDuration) Len() int {
+	return len(a.a)
+}
+
 // GetOptionalArg returns optional arg under the given argIdx, or default value, if argIdx not found.
+//
+// It has the same semantics as ArrayString.GetOptionalArg.
 func (a *ArrayDuration) GetOptionalArg(argIdx int) time.Duration {
 	x := a.a
 	if argIdx >= len(x) {
@@ -362,7 +385,14 @@ func (a *ArrayInt) Set(value string) error {
 	return nil
 }
 
+// Len returns the number of values in a
+func (a *ArrayInt) Len() int {
+	return len(a.a)
+}
+
 // GetOptionalArg returns optional arg under the given argIdx or default value.
+//
+// It has the same semantics as ArrayString.GetOptionalArg.
 func (a *ArrayInt) GetOptionalArg(argIdx int) int {
 	x := a.a
 	if argIdx < len(x) {
@@ -408,7 +438,14 @@ func (a *ArrayBytes) Set(value string) error {
 	return nil
 }
 
+// Len returns the number of values in a
+func (a *ArrayBytes) Len() int {
+	return len(a.a)
+}
+
 // GetOptionalArg returns optional arg under the given argIdx, or default value
+//
+// It has the same semantics as ArrayString.GetOptionalArg.
 func (a *ArrayBytes) GetOptionalArg(argIdx int) int64 {
 	x := a.a
 	if argIdx < len(x) {
@@ -419,3 +456,32 @@ func (a *ArrayBytes) GetOptionalArg(argIdx int) int64 {
 	}
 	return a.defaultValue
 }
+
+// CheckArrayFlags verifies that array flags with the given names can be used for n items via GetOptionalArg.
+//
+// The following rules apply to every array flag:
+//
+//   - if the flag isn't set, then the default value is applied to all the n items;
+//   - if the flag has a single value, then it is applied to all the n items;
+//   - otherwise the flag must have exactly n values, which are applied to items by index.
+//
+// An error is returned for all the flags violating these rules.
+func CheckArrayFlags(n int, names ...string) error {
+	var errs []error
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil {
+			errs = append(errs, fmt.Errorf("cannot find flag -%s", name))
+			continue
+		}
+		a, ok := f.Value.(interface{ Len() int })
+		if !ok {
+			errs = append(errs, fmt.Errorf("-%s isn't an array flag", name))
+			continue
+		}
+		if m := a.Len(); m > 1 && m != n {
+			errs = append(errs, fmt.Errorf("-%s must contain either a single value or %d values; got %d values: %s", name, n, m, f.Value))
+		}
+	}
+	return errors.Join(errs...)
+}
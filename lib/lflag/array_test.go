@@ -0,0 +1,165 @@
+package lflag
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArrayStringGetOptionalArg(t *testing.T) {
+	f := func(values []string, argIdx int, expected string) {
+		t.Helper()
+		a := ArrayString(values)
+		if v := a.GetOptionalArg(argIdx); v != expected {
+			t.Fatalf("unexpected value for argIdx=%d, values=%q; got %q; want %q", argIdx, values, v, expected)
+		}
+	}
+
+	// empty array
+	f(nil, 0, "")
+	f(nil, 1, "")
+
+	// a single value applies to all the args
+	f([]string{"foo"}, 0, "foo")
+	f([]string{"foo"}, 3, "foo")
+
+	// multiple values map by index
+	f([]string{"foo", "bar"}, 0, "foo")
+	f([]string{"foo", "bar"}, 1, "bar")
+	f([]string{"foo", "bar"}, 2, "")
+}
+
+func TestArrayDurationGetOptionalArg(t *testing.T) {
+	f := func(value string, argIdx int, expected time.Duration) {
+		t.Helper()
+		a := &ArrayDuration{
+			defaultValue: time.Minute,
+		}
+		if value != "" {
+			if err := a.Set(value); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if v := a.GetOptionalArg(argIdx); v != expected {
+			t.Fatalf("unexpected value for argIdx=%d, value=%q; got %s; want %s", argIdx, value, v, expected)
+		}
+	}
+
+	f("", 0, time.Minute)
+	f("5s", 0, 5*time.Second)
+	f("5s", 2, 5*time.Second)
+	f("5s,,10s", 1, time.Minute)
+	f("5s,,10s", 2, 10*time.Second)
+	f("5s,10s", 2, time.Minute)
+}
+
+func TestArrayIntGetOptionalArg(t *testing.T) {
+	f := func(value string, argIdx int, expected int) {
+		t.Helper()
+		a := &ArrayInt{
+			defaultValue: 42,
+		}
+		if value != "" {
+			if err := a.Set(value); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if v := a.GetOptionalArg(argIdx); v != expected {
+			t.Fatalf("unexpected value for argIdx=%d, value=%q; got %d; want %d", argIdx, value, v, expected)
+		}
+	}
+
+	f("", 0, 42)
+	f("", 1, 42)
+	f("5", 0, 5)
+	f("5", 2, 5)
+	f("5,,10", 0, 5)
+	f("5,,10", 1, 42)
+	f("5,,10", 2, 10)
+	f("5,10", 2, 42)
+	f("0,10", 0, 0)
+}
+
+func TestArrayFlagsPerListener(t *testing.T) {
+	f := func(args []string, expectedInts []int, expectedDurations []time.Duration) {
+		t.Helper()
+		fs := flag.CommandLine
+		defer func() {
+			flag.CommandLine = fs
+		}()
+		flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+		ints := NewArrayInt("testInts", 100, "test")
+		durations := NewArrayDuration("testDurations", time.Minute, "test")
+		if err := flag.CommandLine.Parse(args); err != nil {
+			t.Fatalf("cannot parse %q: %s", args, err)
+		}
+		for idx, want := range expectedInts {
+			if v := ints.GetOptionalArg(idx); v != want {
+				t.Fatalf("unexpected -testInts value for listener #%d; args=%q; got %d; want %d", idx, args, v, want)
+			}
+		}
+		for idx, want := range expectedDurations {
+			if v := durations.GetOptionalArg(idx); v != want {
+				t.Fatalf("unexpected -testDurations value for listener #%d; args=%q; got %s; want %s", idx, args, v, want)
+			}
+		}
+	}
+
+	// unset flags fall back to defaults for all the listeners
+	f(nil, []int{100, 100, 100}, []time.Duration{time.Minute, time.Minute, time.Minute})
+
+	// a single value applies to all the listeners
+	f([]string{"-testInts=5", "-testDurations=5s"}, []int{5, 5, 5}, []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second})
+
+	// per-listener values separated by comma; empty values fall back to defaults
+	f([]string{"-testInts=5,,7", "-testDurations=,10s"}, []int{5, 100, 7}, []time.Duration{time.Minute, 10 * time.Second})
+
+	// per-listener values specified via multiple flags
+	f([]string{"-testInts=5", "-testInts=", "-testInts=7", "-testDurations=1s", "-testDurations=2s"}, []int{5, 100, 7}, []time.Duration{time.Second, 2 * time.Second})
+
+	// listeners without values fall back to defaults if multiple values are set
+	f([]string{"-testInts=5,7", "-testDurations=1s,2s"}, []int{5, 7, 100}, []time.Duration{time.Second, 2 * time.Second, time.Minute})
+}
+
+func TestCheckArrayFlags(t *testing.T) {
+	fs := flag.CommandLine
+	defer func() {
+		flag.CommandLine = fs
+	}()
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+
+	strs := NewArrayString("testStrs", "test")
+	ints := NewArrayInt("testInts", 1, "test")
+	NewArrayBool("testBools", "test")
+	flag.String("testString", "", "test")
+
+	f := func(n int, names []string, errSubstr string) {
+		t.Helper()
+		err := CheckArrayFlags(n, names...)
+		if errSubstr == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil || !strings.Contains(err.Error(), errSubstr) {
+			t.Fatalf("expecting error containing %q; got %v", errSubstr, err)
+		}
+	}
+
+	_ = strs.Set("a,b")
+	_ = ints.Set("10")
+	names := []string{"testStrs", "testInts", "testBools"}
+
+	// unset, single value and n values are allowed
+	f(2, names, "")
+
+	// the number of values mismatches the number of items
+	f(3, names, "-testStrs must contain either a single value or 3 values; got 2 values")
+	f(1, names, "-testStrs must contain either a single value or 1 values; got 2 values")
+
+	// invalid flags
+	f(2, []string{"missing"}, "cannot find flag -missing")
+	f(2, []string{"testString"}, "-testString isn't an array flag")
+}
@@ -0,0 +1,4 @@
+// Package lflag provides command-line flags parsing with `%{ENV_VAR}` placeholders expansion
+// and additional flag types such as arrays, byte sizes, passwords and secrets.
+// It is the canonical flags package for lcp, so flags must be parsed via Parse instead of flag.Parse.
+package lflag
@@ -1,16 +1,21 @@
 package lflag
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Parse parses command-line flags
-// This function must be called instead of lflag.Parse() before using and flags in the program
+// This function must be called instead of flag.Parse() before using any flags in the program
 func Parse() {
 	ParseFlagSet(flag.CommandLine, os.Args[1:])
 }
@@ -24,6 +29,55 @@ func ParseFlagSet(fs *flag.FlagSet, args []string) {
 		log.Fatalf("unprocessed command-line args left: %s; the most likely reason is missing `=` between boolean flag name and value; "+
 			"see https://pkg.go.dev/flag#hdr-Command_line_flag_syntax", fs.Args())
 	}
+	if err := validateFlagSet(fs); err != nil {
+		log.Fatalf("invalid command-line flags:\n%s", err)
+	}
+}
+
+var (
+	validatorsLock sync.Mutex
+	validators     = make(map[string][]func(value string) error)
+)
+
+// RegisterValidator registers fn for validating the value of the flag with the given name.
+//
+// Validators are called by Parse and ParseFlagSet after the flags are parsed, so errors for all the invalid flags are reported at once.
+// Validators are called for default values as well.
+func RegisterValidator(name string, fn func(value string) error) {
+	validatorsLock.Lock()
+	validators[name] = append(validators[name], fn)
+	validatorsLock.Unlock()
+}
+
+// validateFlagSet calls validators registered via RegisterValidator for flags in fs
+func validateFlagSet(fs *flag.FlagSet) error {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err := validateFlagLocked(f.Name, f.Value.String()); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// validateFlag calls validators registered via RegisterValidator for the flag with the given name and value
+func validateFlag(name, value string) error {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	return validateFlagLocked(name, value)
+}
+
+func validateFlagLocked(name, value string) error {
+	var errs []error
+	for _, fn := range validators[name] {
+		if err := fn(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for -%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // expandArgs
@@ -38,6 +92,53 @@ func expandArgs(args []string) []string {
 	return dstArgs
 }
 
+// WriteFlagsJSON writes all the flags with their values to w as a JSON object.
+//
+// Flags are sorted by name, while secret flag values are masked. The hash field contains a hash of flag names
+// and values, so two instances are configured identically if their hashes match. Secret flag values
+// aren't taken into account in the hash.
+func WriteFlagsJSON(w io.Writer) {
+	writeFlagsJSON(w, flag.CommandLine)
+}
+
+type flagJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	IsSet bool   `json:"isSet"`
+}
+
+func writeFlagsJSON(w io.Writer, fs *flag.FlagSet) {
+	isSetMap := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		isSetMap[f.Name] = true
+	})
+
+	// VisitAll visits flags in lexicographical order, so the output and the hash are deterministic.
+	var flags []flagJSON
+	h := sha256.New()
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if IsSecretFlag(strings.ToLower(f.Name)) {
+			value = "secret"
+		}
+		flags = append(flags, flagJSON{
+			Name:  f.Name,
+			Value: value,
+			IsSet: isSetMap[f.Name],
+		})
+		_, _ = fmt.Fprintf(h, "%q=%q\n", f.Name, value)
+	})
+
+	result := struct {
+		Flags []flagJSON `json:"flags"`
+		Hash  string     `json:"hash"`
+	}{
+		Flags: flags,
+		Hash:  hex.EncodeToString(h.Sum(nil)),
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
 // WriteFlags writes all the explicitly set flags to w.
 func WriteFlags(w io.Writer) {
 	flag.Visit(func(f *flag.Flag) {
@@ -0,0 +1,150 @@
+package lflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("testValidatorColor", "red", "test")
+	fs.Int("testValidatorSize", 1, "test")
+
+	RegisterValidator("testValidatorColor", func(value string) error {
+		if value != "red" && value != "green" {
+			return fmt.Errorf("unsupported color %q", value)
+		}
+		return nil
+	})
+	RegisterValidator("testValidatorSize", func(value string) error {
+		if value == "0" {
+			return fmt.Errorf("size cannot be zero")
+		}
+		return nil
+	})
+	RegisterValidator("testValidatorMissing", func(_ string) error {
+		return fmt.Errorf("validators for missing flags mustn't be called")
+	})
+
+	f := func(args []string, errSubstrs []string) {
+		t.Helper()
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("cannot parse args %q: %s", args, err)
+		}
+		err := validateFlagSet(fs)
+		if len(errSubstrs) == 0 {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		for _, substr := range errSubstrs {
+			if !strings.Contains(err.Error(), substr) {
+				t.Fatalf("expecting error containing %q; got %q", substr, err)
+			}
+		}
+	}
+
+	// default values
+	f(nil, nil)
+
+	// valid values
+	f([]string{"-testValidatorColor=green", "-testValidatorSize=10"}, nil)
+
+	// all the invalid flags are reported at once
+	f([]string{"-testValidatorColor=blue", "-testValidatorSize=0"}, []string{
+		`invalid value for -testValidatorColor: unsupported color "blue"`,
+		`invalid value for -testValidatorSize: size cannot be zero`,
+	})
+}
+
+func TestWriteFlagsJSON(t *testing.T) {
+	newFlagSet := func(args ...string) *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("zeta", "z", "test")
+		fs.String("alpha", "a", "test")
+		fs.String("apiPassword", "", "test")
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("cannot parse args %q: %s", args, err)
+		}
+		return fs
+	}
+	f := func(fs *flag.FlagSet) (string, string) {
+		t.Helper()
+		var bb bytes.Buffer
+		writeFlagsJSON(&bb, fs)
+		var result struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &result); err != nil {
+			t.Fatalf("cannot unmarshal %q: %s", bb.String(), err)
+		}
+		return bb.String(), result.Hash
+	}
+
+	data, hash := f(newFlagSet("-zeta=foo", "-apiPassword=super-secret"))
+	expected := `{"flags":[{"name":"alpha","value":"a","isSet":false},{"name":"apiPassword","value":"secret","isSet":true},{"name":"zeta","value":"foo","isSet":true}],"hash":"` + hash + `"}` + "\n"
+	if data != expected {
+		t.Fatalf("unexpected output\ngot\n%s\nwant\n%s", data, expected)
+	}
+
+	// the same values result in the same hash, while secret values are ignored
+	if _, h := f(newFlagSet("-zeta=foo", "-apiPassword=another-secret")); h != hash {
+		t.Fatalf("unexpected hash for the same flags; got %s; want %s", h, hash)
+	}
+
+	// different values result in different hashes
+	if _, h := f(newFlagSet("-zeta=bar")); h == hash {
+		t.Fatalf("expecting different hash for different flags")
+	}
+}
+
+func TestReloadFlags(t *testing.T) {
+	reloadable := NewInt("testReloadableInt", 1, "test")
+	RegisterReloadableFlag("testReloadableInt")
+	RegisterValidator("testReloadableInt", func(value string) error {
+		if value == "-1" {
+			return fmt.Errorf("negative values aren't allowed")
+		}
+		return nil
+	})
+	flag.Int("testNonReloadableInt", 1, "test")
+
+	changes, err := ReloadFlags(map[string]string{
+		"testReloadableInt":    "10",
+		"testNonReloadableInt": "10",
+		"testMissingFlag":      "10",
+	})
+	if len(changes) != 1 || changes[0] != `-testReloadableInt changed from "1" to "10"` {
+		t.Fatalf("unexpected changes: %q", changes)
+	}
+	if err == nil || !strings.Contains(err.Error(), "-testNonReloadableInt cannot be changed without restart") ||
+		!strings.Contains(err.Error(), "unknown flag -testMissingFlag") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := reloadable.Get(); n != 10 {
+		t.Fatalf("unexpected flag value; got %d; want 10", n)
+	}
+
+	// unchanged values are ignored
+	changes, err = ReloadFlags(map[string]string{"testReloadableInt": "10"})
+	if len(changes) != 0 || err != nil {
+		t.Fatalf("unexpected result for unchanged value; changes=%q, err=%v", changes, err)
+	}
+
+	// invalid values are ignored
+	changes, err = ReloadFlags(map[string]string{"testReloadableInt": "-1"})
+	if len(changes) != 0 || err == nil || !strings.Contains(err.Error(), "negative values aren't allowed") {
+		t.Fatalf("unexpected result for invalid value; changes=%q, err=%v", changes, err)
+	}
+	if n := reloadable.Get(); n != 10 {
+		t.Fatalf("unexpected flag value after invalid reload; got %d; want 10", n)
+	}
+}
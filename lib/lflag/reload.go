@@ -0,0 +1,105 @@
+package lflag
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// NewInt returns new Int flag with the given name, defaultValue and description.
+//
+// Unlike flag.Int, the flag value may be updated via ReloadFlags while it is read concurrently via Get.
+func NewInt(name string, defaultValue int, description string) *Int {
+	var i Int
+	i.n.Store(int64(defaultValue))
+	flag.Var(&i, name, description)
+	return &i
+}
+
+// Int is a flag holding an int value, which can be safely updated at runtime.
+type Int struct {
+	n atomic.Int64
+}
+
+// Get returns the current flag value
+func (i *Int) Get() int {
+	return int(i.n.Load())
+}
+
+// String implements flag.Value interface
+func (i *Int) String() string {
+	return strconv.FormatInt(i.n.Load(), 10)
+}
+
+// Set implements flag.Value interface
+func (i *Int) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	i.n.Store(int64(n))
+	return nil
+}
+
+var (
+	reloadLock      sync.Mutex
+	reloadableFlags = make(map[string]bool)
+)
+
+// RegisterReloadableFlag registers the flag with the given name as reloadable via ReloadFlags.
+//
+// The flag value must be safe for updating while it is read concurrently, e.g. it must be created via NewInt.
+func RegisterReloadableFlag(name string) {
+	reloadLock.Lock()
+	reloadableFlags[name] = true
+	reloadLock.Unlock()
+}
+
+// ReloadFlags sets flags registered via RegisterReloadableFlag to the given values.
+//
+// Values are verified with validators registered via RegisterValidator before being applied.
+// Flags missing in values are left unchanged. It returns human-readable descriptions of the changed flags
+// together with an error for flags, which cannot be changed at runtime or have invalid values.
+func ReloadFlags(values map[string]string) ([]string, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []string
+	var errs []error
+	for _, name := range names {
+		value := values[name]
+		f := flag.Lookup(name)
+		if f == nil {
+			errs = append(errs, fmt.Errorf("unknown flag -%s", name))
+			continue
+		}
+		if !reloadableFlags[name] {
+			errs = append(errs, fmt.Errorf("-%s cannot be changed without restart", name))
+			continue
+		}
+		prevValue := f.Value.String()
+		if value == prevValue {
+			continue
+		}
+		if err := validateFlag(name, value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("cannot set -%s=%q: %w", name, value, err))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("-%s changed from %q to %q", name, prevValue, f.Value.String()))
+	}
+	return changes, errors.Join(errs...)
+}
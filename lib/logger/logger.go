@@ -8,15 +8,17 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"lcp.io/lcp/lib/lflag"
 	"lcp.io/lcp/lib/utils/stringsutil"
 )
 
 var (
-	loggerLevel    = flag.String("loggerLevel", "INFO", "Minimum level of errors to log. Possible values: INFO, WARN, ERROR, FATAL, PANIC")
+	loggerLevel    = flag.String("loggerLevel", "INFO", "Minimum level of errors to log. Possible values: DEBUG, INFO, WARN, ERROR, FATAL, PANIC")
 	loggerFormat   = flag.String("loggerFormat", "default", "Format for logs. Possible values: default, json")
 	loggerOutput   = flag.String("loggerOutput", "stderr", "Output for the logs. Supported values: stderr, stdout")
 	loggerTimezone = flag.String("loggerTimezone", "UTC", "Timezone to use for timestamps in logs. Timezone must be a valid IANA Time Zone. "+
@@ -24,8 +26,8 @@ var (
 	disableTimestamps = flag.Bool("loggerDisableTimestamps", false, "Whether to disable writing timestamps in logs")
 	maxLogArgLen      = flag.Int("loggerMaxArgLen", 5000, "The maximum length of a single logged argument. Longer arguments are replaced with 'arg_start...arg_end', "+
 		"where 'arg_start' and 'arg_end' is prefix and suffix of the arg with the length not exceeding -loggerMaxArgLen / 2")
-	errorsPerSecondLimit = flag.Int("loggerErrorsPerSecondLimit", 0, `Per-second limit on the number of ERROR messages. If more than the given number of errors are emitted per second, the remaining errors are suppressed. Zero values disable the rate limit`)
-	warnsPerSecondLimit  = flag.Int("loggerWarnsPerSecondLimit", 0, `Per-second limit on the number of WARN messages. If more than the given number of warns are emitted per second, then the remaining warns are suppressed. Zero values disable the rate limit`)
+	errorsPerSecondLimit = lflag.NewInt("loggerErrorsPerSecondLimit", 0, `Per-second limit on the number of ERROR messages. If more than the given number of errors are emitted per second, the remaining errors are suppressed. Zero values disable the rate limit`)
+	warnsPerSecondLimit  = lflag.NewInt("loggerWarnsPerSecondLimit", 0, `Per-second limit on the number of WARN messages. If more than the given number of warns are emitted per second, then the remaining warns are suppressed. Zero values disable the rate limit`)
 )
 
 var (
@@ -62,7 +64,7 @@ func Init() {
 func Reload(level, format string) {
 	if level != "" {
 		switch level {
-		case "INFO", "WARN", "ERROR", "FATAL", "PANIC":
+		case "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC":
 			*loggerLevel = level
 		default:
 			Errorf("invalid logger level %q during reload, keeping %q", level, *loggerLevel)
@@ -78,6 +80,33 @@ func Reload(level, format string) {
 	}
 }
 
+// Debugf logs debug message. Debug messages are skipped unless -loggerLevel=DEBUG.
+//
+// Use IsDebugEnabled on hot paths in order to avoid the overhead of building the args.
+func Debugf(format string, args ...any) {
+	logLevel("DEBUG", format, args)
+}
+
+// IsDebugEnabled returns true if debug messages are logged
+func IsDebugEnabled() bool {
+	return *loggerLevel == "DEBUG"
+}
+
+// SetOutputForTests redefines the output for the logger. Use for tests only.
+// Call ResetOutputForTest in order to return to the default output.
+func SetOutputForTests(w io.Writer) {
+	mu.Lock()
+	output = w
+	mu.Unlock()
+}
+
+// ResetOutputForTest resets the logger output to the value of -loggerOutput
+func ResetOutputForTest() {
+	mu.Lock()
+	setLoggerOutput()
+	mu.Unlock()
+}
+
 // Infof logs info message
 func Infof(format string, args ...any) {
 	logLevel("INFO", format, args)
@@ -177,32 +206,70 @@ func initInternal(logFlags bool) {
 	validateLoggerFormat()
 }
 
+func init() {
+	lflag.RegisterValidator("loggerLevel", checkLoggerLevel)
+	lflag.RegisterValidator("loggerFormat", checkLoggerFormat)
+	lflag.RegisterValidator("loggerOutput", checkLoggerOutput)
+	lflag.RegisterValidator("loggerTimezone", func(value string) error {
+		_, err := time.LoadLocation(value)
+		return err
+	})
+
+	lflag.RegisterReloadableFlag("loggerErrorsPerSecondLimit")
+	lflag.RegisterReloadableFlag("loggerWarnsPerSecondLimit")
+}
+
 func setLoggerOutput() {
+	if err := checkLoggerOutput(*loggerOutput); err != nil {
+		// We cannot use logger.Panicf here, since the logger isn't initialized yet
+		panic(fmt.Errorf("FATAL: %w", err))
+	}
 	switch *loggerOutput {
 	case "stderr":
 		output = os.Stderr
 	case "stdout":
 		output = os.Stdout
-	default:
-		panic(fmt.Errorf("FATAL: unsupported `loggerOutput` value: %q; supported values are: stderr, stdout", *loggerOutput))
 	}
 }
 
 func validateLoggerLevel() {
-	switch *loggerLevel {
-	case "INFO", "WARN", "ERROR", "FATAL", "PANIC":
-	default:
+	if err := checkLoggerLevel(*loggerLevel); err != nil {
 		// We cannot use logger.Panicf here, since the logger isn't initialized yet
-		panic(fmt.Errorf("FATAL: unsupported `-loggerLevel` value: %q; supported values are: INFO, WARN, ERROR, FATAL, PANIC", *loggerLevel))
+		panic(fmt.Errorf("FATAL: %w", err))
 	}
 }
 
 func validateLoggerFormat() {
-	switch *loggerFormat {
+	if err := checkLoggerFormat(*loggerFormat); err != nil {
+		// We cannot use logger.Panicf here, since the logger isn't initialized yet
+		panic(fmt.Errorf("FATAL: %w", err))
+	}
+}
+
+func checkLoggerOutput(value string) error {
+	switch value {
+	case "stderr", "stdout":
+		return nil
+	default:
+		return fmt.Errorf("unsupported `-loggerOutput` value: %q; supported values are: stderr, stdout", value)
+	}
+}
+
+func checkLoggerLevel(value string) error {
+	switch value {
+	case "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC":
+		return nil
+	default:
+		return fmt.Errorf("unsupported `-loggerLevel` value: %q; supported values are: DEBUG, INFO, WARN, ERROR, FATAL, PANIC", value)
+	}
+}
+
+func checkLoggerFormat(value string) error {
+	switch value {
 	case "default", "json":
+		return nil
 	default:
-		// We cannot use logger.Panicf here, since the logger isn't initialized yet
-		panic(fmt.Errorf("FATAL: unsupported `-loggerFormat` value: %q; supported values are: default, json", *loggerFormat))
+		return fmt.Errorf("unsupported `-loggerFormat` value: %q; supported values are: default, json", value)
 	}
 }
 
@@ -219,16 +286,35 @@ func logLevel(level, format string, args []any) {
 }
 
 func logLevelSkipFrames(skipFrames int, level, format string, args []any) {
-	location := getLogLocation(3 + skipFrames)
 	if shouldSkipLog(level) {
 		return
 	}
+	location := getLogLocation(3 + skipFrames)
 	msg := formatLogMessage(*maxLogArgLen, format, args)
-	_ = logMessageInternal(level, msg, location)
+	_ = logMessageInternal(level, msg, location, nil)
+}
+
+// Field is a key-value pair attached to a log message by InfoFields
+type Field struct {
+	Key   string
+	Value string
+}
+
+// InfoFields logs info message with the given fields.
+//
+// Fields are written as separate JSON fields if -loggerFormat=json, and as key=value pairs after msg otherwise.
+func InfoFields(msg string, fields ...Field) {
+	if shouldSkipLog("INFO") {
+		return
+	}
+	location := getLogLocation(2)
+	_ = logMessageInternal("INFO", msg, location, fields)
 }
 
 func shouldSkipLog(level string) bool {
 	switch *loggerLevel {
+	case "INFO":
+		return level == "DEBUG"
 	case "WARN":
 		switch level {
 		case "WARN", "ERROR", "FATAL", "PANIC":
@@ -283,7 +369,7 @@ func getLogLocation(skipFrames int) string {
 	return fmt.Sprintf("%s:%d", file, line)
 }
 
-func logMessageInternal(level, msg, location string) bool {
+func logMessageInternal(level, msg, location string, fields []Field) bool {
 	timestamp := ""
 	if !*disableTimestamps {
 		timestamp = time.Now().In(timezone).Format(time.RFC3339)
@@ -291,9 +377,9 @@ func logMessageInternal(level, msg, location string) bool {
 
 	// rate limit ERROR and WARN log messages with given limit
 	if level == "ERROR" || level == "WARN" {
-		limit := uint64(*errorsPerSecondLimit)
+		limit := uint64(errorsPerSecondLimit.Get())
 		if level == "WARN" {
-			limit = uint64(*warnsPerSecondLimit)
+			limit = uint64(warnsPerSecondLimit.Get())
 		}
 		ok, suppressMessage := logLimiter.needSuppress(location, limit)
 		if ok {
@@ -313,23 +399,36 @@ func logMessageInternal(level, msg, location string) bool {
 	var logMsg string
 	switch *loggerFormat {
 	case "json":
+		var extraFields string
+		for _, f := range fields {
+			extraFields += fmt.Sprintf(`,%q:%q`, f.Key, f.Value)
+		}
 		if *disableTimestamps {
 			logMsg = fmt.Sprintf(
-				`{%q:%q,%q:%q,%q:%q}`+"\n",
+				`{%q:%q,%q:%q,%q:%q%s}`+"\n",
 				fieldLevel, levelLowercase,
 				fieldCaller, location,
 				fieldMsg, msg,
+				extraFields,
 			)
 		} else {
 			logMsg = fmt.Sprintf(
-				`{%q:%q,%q:%q,%q:%q,%q:%q}`+"\n",
+				`{%q:%q,%q:%q,%q:%q,%q:%q%s}`+"\n",
 				fieldTs, timestamp,
 				fieldLevel, levelLowercase,
 				fieldCaller, location,
 				fieldMsg, msg,
+				extraFields,
 			)
 		}
 	default:
+		for _, f := range fields {
+			v := f.Value
+			if v == "" || strings.ContainsAny(v, " \t\"=") {
+				v = strconv.Quote(v)
+			}
+			msg += " " + f.Key + "=" + v
+		}
 		if *disableTimestamps {
 			logMsg = fmt.Sprintf("%s\t%s\t%s\n", levelLowercase, location, msg)
 		} else {
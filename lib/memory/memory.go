@@ -3,7 +3,10 @@ package memory
 import (
 	"flag"
 	"fmt"
+	"os"
+	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"lcp.io/lcp/lib/lflag"
@@ -15,15 +18,60 @@ var (
 	allowedBytes   = lflag.NewBytes("memory.allowedBytes", 0, `Allowed size of system memory caches may occupy. This option overrides -memory.allowedPercent if set to a non-zero value. Too low a value may increase the cache miss rate usually resulting in higher CPU and disk IO usage. Too high a value may evict too much data from the OS page cache resulting in higher disk IO usage`)
 )
 
+var (
+	autoMemLimit = flag.Bool("runtime.autoMemLimit", false, "Whether to set Go memory limit (aka GOMEMLIMIT) to -runtime.autoMemLimitRatio of the cgroup memory limit. "+
+		"This makes the garbage collector more aggressive when the memory usage approaches the container memory limit. "+
+		"The memory limit is updated when the cgroup memory limit changes and the initial limit is restored if the cgroup memory limit is removed. "+
+		"The effective limit is exported via lcp_go_memory_limit_bytes metric. This option is ignored if GOMEMLIMIT environment variable is set")
+	autoMemLimitRatio = flag.Float64("runtime.autoMemLimitRatio", 0.9, "The ratio of the cgroup memory limit to set as Go memory limit when -runtime.autoMemLimit is set. Must be in the range (0...1]")
+)
+
 var _ = metrics.NewGauge("process_memory_limit_bytes", func() float64 {
-	return float64(memoryLimit)
+	if !flag.Parsed() {
+		return 0
+	}
+	return float64(Limit())
 })
 
-var (
-	allowedMemory   int
-	remainingMemory int
-	memoryLimit     int
-)
+// limitsRefreshInterval is the interval for re-reading the memory limit, since it may change at runtime,
+// e.g. after vertical autoscaling of the container
+const limitsRefreshInterval = 10 * time.Second
+
+type limits struct {
+	allowed    int
+	remaining  int
+	limit      int
+	fromCgroup bool
+}
+
+// limitsTracker holds the memory limits, which are re-read every limitsRefreshInterval
+type limitsTracker struct {
+	// sysTotalMemory, now and setMemoryLimit are replaced in tests
+	sysTotalMemory func() (int, bool)
+	now            func() time.Time
+	setMemoryLimit func(limit int64) int64
+
+	mu         sync.Mutex
+	updateTime time.Time
+	current    limits
+
+	// autoMemLimit is set if Go memory limit must follow the cgroup memory limit according to -runtime.autoMemLimit
+	autoMemLimit bool
+
+	// initialMemoryLimit is Go memory limit before it has been set according to -runtime.autoMemLimit.
+	// It is restored if the cgroup memory limit is removed
+	initialMemoryLimit int64
+
+	// memoryLimitSet is set if Go memory limit has been set according to -runtime.autoMemLimit
+	memoryLimitSet bool
+}
+
+var limitsGlobal = &limitsTracker{
+	sysTotalMemory: sysTotalMemory,
+	now:            time.Now,
+	setMemoryLimit: debug.SetMemoryLimit,
+}
+
 var once sync.Once
 
 func initOnce() {
@@ -31,41 +79,173 @@ func initOnce() {
 		// Do not use logger.Panicf here, since logger may be uninitialized yet.
 		panic(fmt.Errorf("BUG: memory.Allowed must be called only after flag.Parse call"))
 	}
-	memoryLimit = sysTotalMemory()
-	if allowedBytes.N <= 0 {
-		if *allowedPercent < 1 || *allowedPercent > 100 {
-			logger.Fatalf("FATAL: -memory.allowedPercent must be in the range [1...100]; got %g", *allowedPercent)
+	if allowedBytes.N <= 0 && (*allowedPercent < 1 || *allowedPercent > 100) {
+		logger.Fatalf("FATAL: -memory.allowedPercent must be in the range [1...100]; got %g", *allowedPercent)
+	}
+	if *autoMemLimit && (*autoMemLimitRatio <= 0 || *autoMemLimitRatio > 1) {
+		logger.Fatalf("FATAL: -runtime.autoMemLimitRatio must be in the range (0...1]; got %g", *autoMemLimitRatio)
+	}
+	l, err := calculateLimits(limitsGlobal.sysTotalMemory)
+	if err != nil {
+		logger.Fatalf("FATAL: %s", err)
+	}
+	logLimits(l)
+	limitsGlobal.current = l
+	limitsGlobal.updateTime = limitsGlobal.now()
+	if *autoMemLimit {
+		if v := os.Getenv("GOMEMLIMIT"); v != "" {
+			// Do not override explicitly set GOMEMLIMIT.
+			logger.Infof("ignoring -runtime.autoMemLimit, since GOMEMLIMIT=%s environment variable is set", v)
+			return
+		}
+		limitsGlobal.enableAutoMemLimit()
+		go func() {
+			t := time.NewTicker(limitsRefreshInterval)
+			defer t.Stop()
+			for range t.C {
+				limitsGlobal.update()
+			}
+		}()
+	}
+}
+
+// SetupAutoMemLimit sets Go memory limit according to -runtime.autoMemLimit and -runtime.autoMemLimitRatio.
+//
+// The memory limit is re-read every limitsRefreshInterval afterwards and Go memory limit is updated when it changes.
+// This function must be called after flag.Parse.
+func SetupAutoMemLimit() {
+	once.Do(initOnce)
+}
+
+// enableAutoMemLimit sets Go memory limit according to the current cgroup memory limit and makes update set it to the changed limit
+func (lt *limitsTracker) enableAutoMemLimit() {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.autoMemLimit = true
+	lt.initialMemoryLimit = lt.setMemoryLimit(-1)
+	lt.updateGoMemoryLimit(lt.current)
+}
+
+// updateGoMemoryLimit sets Go memory limit to -runtime.autoMemLimitRatio of the cgroup memory limit from l if -runtime.autoMemLimit is set.
+//
+// The initial Go memory limit is restored if l isn't limited by cgroup, e.g. the cgroup memory limit has been removed.
+func (lt *limitsTracker) updateGoMemoryLimit(l limits) {
+	if !lt.autoMemLimit {
+		return
+	}
+	if !l.fromCgroup {
+		if !lt.memoryLimitSet {
+			logger.Warnf("ignoring -runtime.autoMemLimit, since cgroup memory limit isn't set")
+			return
 		}
+		lt.setMemoryLimit(lt.initialMemoryLimit)
+		lt.memoryLimitSet = false
+		logger.Infof("restored Go memory limit to %d bytes, since cgroup memory limit isn't set anymore", lt.initialMemoryLimit)
+		return
+	}
+	limit := int64(float64(l.limit) * *autoMemLimitRatio)
+	lt.setMemoryLimit(limit)
+	lt.memoryLimitSet = true
+	logger.Infof("set Go memory limit to %d bytes according to cgroup memory limit %d bytes and -runtime.autoMemLimitRatio=%g", limit, l.limit, *autoMemLimitRatio)
+}
+
+// calculateLimits reads the current memory limit via sysTotalMemory and calculates memory limits according to -memory.allowedPercent and -memory.allowedBytes
+func calculateLimits(sysTotalMemory func() (int, bool)) (limits, error) {
+	var l limits
+	l.limit, l.fromCgroup = sysTotalMemory()
+	if allowedBytes.N <= 0 {
 		percent := *allowedPercent / 100
-		allowedMemory = int(float64(memoryLimit) * percent)
-		remainingMemory = memoryLimit - allowedMemory
-		if remainingMemory <= 0 {
-			logger.Fatalf("BUG: remaining memory %d bytes cannot be less than or equal to zero, detected system memory limit %d bytes, -memory.allowedPercent=%g", remainingMemory, memoryLimit, *allowedPercent)
+		l.allowed = int(float64(l.limit) * percent)
+		l.remaining = l.limit - l.allowed
+		if l.remaining <= 0 {
+			return l, fmt.Errorf("remaining memory %d bytes cannot be less than or equal to zero, detected system memory limit %d bytes, -memory.allowedPercent=%g", l.remaining, l.limit, *allowedPercent)
 		}
-		logger.Infof("limiting caches to %d bytes, leaving %d bytes to the OS according to -memory.allowedPercent=%g, system memory limit %d bytes", allowedMemory, remainingMemory, *allowedPercent, memoryLimit)
 	} else {
-		allowedMemory = allowedBytes.IntN()
-		remainingMemory = memoryLimit - allowedMemory
-		if remainingMemory <= 0 {
-			logger.Fatalf("FATAL: remaining memory %d bytes cannot be less than or equal to zero, detected system memory limit %d bytes, -memory.allowedBytes=%s", remainingMemory, memoryLimit, allowedBytes.String())
+		l.allowed = allowedBytes.IntN()
+		l.remaining = l.limit - l.allowed
+		if l.remaining <= 0 {
+			return l, fmt.Errorf("remaining memory %d bytes cannot be less than or equal to zero, detected system memory limit %d bytes, -memory.allowedBytes=%s", l.remaining, l.limit, allowedBytes.String())
 		}
-		logger.Infof("limiting caches to %d bytes, leaving %d bytes to the OS according to -memory.allowedBytes=%s, system memory limit %d bytes", allowedMemory, remainingMemory, allowedBytes.String(), memoryLimit)
 	}
+	return l, nil
+}
 
+func logLimits(l limits) {
+	source := "host"
+	if l.fromCgroup {
+		source = "cgroup"
+	}
+	if allowedBytes.N <= 0 {
+		logger.Infof("limiting caches to %d bytes, leaving %d bytes to the OS according to -memory.allowedPercent=%g, %s memory limit %d bytes", l.allowed, l.remaining, *allowedPercent, source, l.limit)
+	} else {
+		logger.Infof("limiting caches to %d bytes, leaving %d bytes to the OS according to -memory.allowedBytes=%s, %s memory limit %d bytes", l.allowed, l.remaining, allowedBytes.String(), source, l.limit)
+	}
+}
+
+// getLimits returns the current memory limits, which are re-read every limitsRefreshInterval
+func getLimits() limits {
+	once.Do(initOnce)
+	return limitsGlobal.get()
+}
+
+// get returns lt.current after re-reading it if it wasn't updated during the last limitsRefreshInterval
+func (lt *limitsTracker) get() limits {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.now().Sub(lt.updateTime) > limitsRefreshInterval {
+		lt.updateLocked()
+	}
+	return lt.current
+}
+
+// update re-reads lt.current
+func (lt *limitsTracker) update() {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.updateLocked()
+}
+
+func (lt *limitsTracker) updateLocked() {
+	lt.updateTime = lt.now()
+	l, err := calculateLimits(lt.sysTotalMemory)
+	if err != nil {
+		logger.Errorf("cannot update memory limits; keeping the previous limits: %s", err)
+		return
+	}
+	if l == lt.current {
+		return
+	}
+	logLimits(l)
+	if l.limit != lt.current.limit || l.fromCgroup != lt.current.fromCgroup {
+		lt.updateGoMemoryLimit(l)
+	}
+	lt.current = l
 }
 
 // Allowed returns the amount of system memory allowed to use by the app.
 //
 // The function must be called only after flag.Parse is called.
 func Allowed() int {
-	once.Do(initOnce)
-	return allowedMemory
+	return getLimits().allowed
 }
 
 // Remaining returns the amount of memory remaining to the OS.
 //
 // This function must be called only after flag.Parse is called.
 func Remaining() int {
-	once.Do(initOnce)
-	return remainingMemory
+	return getLimits().remaining
+}
+
+// Limit returns the memory limit for the app, which is either cgroup memory limit or the total system memory.
+//
+// This function must be called only after flag.Parse is called.
+func Limit() int {
+	return getLimits().limit
+}
+
+// LimitFromCgroup returns true if the memory limit returned by Limit is set by cgroup.
+//
+// This function must be called only after flag.Parse is called.
+func LimitFromCgroup() bool {
+	return getLimits().fromCgroup
 }
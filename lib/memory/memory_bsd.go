@@ -6,10 +6,10 @@ import "lcp.io/lcp/lib/logger"
 
 // This code has been adopted from https://github.com/pbnjay/memory
 
-func sysTotalMemory() int {
+func sysTotalMemory() (int, bool) {
 	s, err := sysctlUint64("hw.physmem")
 	if err != nil {
 		logger.Panicf("FATAL: cannot determine system memory: %s", err)
 	}
-	return int(s)
+	return int(s), false
 }
@@ -3,10 +3,10 @@ package memory
 import "lcp.io/lcp/lib/logger"
 
 // This has been adapted from github.com/pbnjay/memory.
-func sysTotalMemory() int {
+func sysTotalMemory() (int, bool) {
 	s, err := sysctlUint64("hw.memsize")
 	if err != nil {
 		logger.Panicf("FATAL: cannot determine system memory: %s", err)
 	}
-	return int(s)
+	return int(s), false
 }
@@ -9,7 +9,8 @@ import (
 
 const maxInt = int(^uint(0) >> 1)
 
-func sysTotalMemory() int {
+// sysTotalMemory returns the memory limit for the app and whether the limit is set by cgroup
+func sysTotalMemory() (int, bool) {
 	var si syscall.Sysinfo_t
 	if err := syscall.Sysinfo(&si); err != nil {
 		logger.Panicf("FATAL: error in syscall.Sysinfo: %s", err)
@@ -23,8 +24,8 @@ func sysTotalMemory() int {
 		// Try reading hierarchical memory limit.
 		mem = cgroup.GetHierarchicalMemoryLimit()
 		if mem <= 0 || int64(int(mem)) != mem || int(mem) > totalMem {
-			return totalMem
+			return totalMem, false
 		}
 	}
-	return int(mem)
+	return int(mem), true
 }
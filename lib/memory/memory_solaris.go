@@ -7,7 +7,7 @@ import (
 
 const PHYS_PAGES = 0x1f4
 
-func sysTotalMemory() int {
+func sysTotalMemory() (int, bool) {
 	memPageSize := unix.Getpagesize()
 	// https://man7.org/linux/man-pages/man3/sysconf.3.html
 	// _SC_PHYS_PAGES
@@ -16,5 +16,5 @@ func sysTotalMemory() int {
 		logger.Panicf("FATAL: error in unix.Sysconf: %s", err)
 	}
 
-	return memPageSize * int(memPagesCnt)
+	return memPageSize * int(memPagesCnt), false
 }
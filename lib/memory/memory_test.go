@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+func TestLimitsTrackerGet(t *testing.T) {
+	var sb strings.Builder
+	logger.SetOutputForTests(&sb)
+	defer logger.ResetOutputForTest()
+
+	defer func(v float64) {
+		*allowedPercent = v
+	}(*allowedPercent)
+	*allowedPercent = 60
+
+	now := time.Unix(1_700_000_000, 0)
+	memLimit := 1000
+	fromCgroup := true
+	reads := 0
+	lt := &limitsTracker{
+		sysTotalMemory: func() (int, bool) {
+			reads++
+			return memLimit, fromCgroup
+		},
+		now: func() time.Time {
+			return now
+		},
+	}
+
+	f := func(advance time.Duration, readsExpected int, expected limits, logExpected string) {
+		t.Helper()
+		sb.Reset()
+		now = now.Add(advance)
+		l := lt.get()
+		if reads != readsExpected {
+			t.Fatalf("unexpected number of memory limit reads; got %d; want %d", reads, readsExpected)
+		}
+		if l != expected {
+			t.Fatalf("unexpected limits; got %+v; want %+v", l, expected)
+		}
+		if logExpected == "" {
+			if sb.Len() > 0 {
+				t.Fatalf("unexpected log output: %s", sb.String())
+			}
+		} else if !strings.Contains(sb.String(), logExpected) {
+			t.Fatalf("missing %q in the log output: %s", logExpected, sb.String())
+		}
+	}
+
+	// the limit is read on the first call
+	f(0, 1, limits{allowed: 600, remaining: 400, limit: 1000, fromCgroup: true}, "limiting caches to 600 bytes, leaving 400 bytes to the OS according to -memory.allowedPercent=60, cgroup memory limit 1000 bytes")
+
+	// the limit isn't re-read during the refresh interval
+	memLimit = 2000
+	f(time.Second, 1, limits{allowed: 600, remaining: 400, limit: 1000, fromCgroup: true}, "")
+	f(limitsRefreshInterval-time.Second, 1, limits{allowed: 600, remaining: 400, limit: 1000, fromCgroup: true}, "")
+
+	// the changed limit is read after the refresh interval
+	f(time.Second, 2, limits{allowed: 1200, remaining: 800, limit: 2000, fromCgroup: true}, "limiting caches to 1200 bytes")
+
+	// the unchanged limit isn't logged
+	f(limitsRefreshInterval+time.Second, 3, limits{allowed: 1200, remaining: 800, limit: 2000, fromCgroup: true}, "")
+
+	// the previous limits are kept on error
+	memLimit = 0
+	f(limitsRefreshInterval+time.Second, 4, limits{allowed: 1200, remaining: 800, limit: 2000, fromCgroup: true}, "keeping the previous limits")
+
+	// the cgroup limit has been removed, so the host memory is used
+	memLimit = 4000
+	fromCgroup = false
+	f(limitsRefreshInterval+time.Second, 5, limits{allowed: 2400, remaining: 1600, limit: 4000, fromCgroup: false}, "host memory limit 4000 bytes")
+}
+
+func TestLimitsTrackerAutoMemLimit(t *testing.T) {
+	logger.SetOutputForTests(io.Discard)
+	defer logger.ResetOutputForTest()
+
+	defer func(v float64) {
+		*autoMemLimitRatio = v
+	}(*autoMemLimitRatio)
+	*autoMemLimitRatio = 0.5
+
+	now := time.Unix(1_700_000_000, 0)
+	memLimit := 1000
+	fromCgroup := true
+	goMemLimit := int64(math.MaxInt64)
+	lt := &limitsTracker{
+		sysTotalMemory: func() (int, bool) {
+			return memLimit, fromCgroup
+		},
+		now: func() time.Time {
+			return now
+		},
+		setMemoryLimit: func(limit int64) int64 {
+			prev := goMemLimit
+			if limit >= 0 {
+				goMemLimit = limit
+			}
+			return prev
+		},
+	}
+
+	f := func(expected int64) {
+		t.Helper()
+		now = now.Add(limitsRefreshInterval + time.Second)
+		lt.get()
+		if goMemLimit != expected {
+			t.Fatalf("unexpected Go memory limit; got %d; want %d", goMemLimit, expected)
+		}
+	}
+
+	// Go memory limit isn't set until -runtime.autoMemLimit is enabled
+	f(math.MaxInt64)
+	lt.enableAutoMemLimit()
+	if goMemLimit != 500 {
+		t.Fatalf("unexpected Go memory limit after enabling -runtime.autoMemLimit; got %d; want 500", goMemLimit)
+	}
+
+	// Go memory limit follows the changed cgroup memory limit
+	memLimit = 4000
+	f(2000)
+
+	// the initial Go memory limit is restored when the cgroup memory limit is removed
+	fromCgroup = false
+	f(math.MaxInt64)
+
+	// Go memory limit is set again when the cgroup memory limit appears
+	memLimit = 3000
+	fromCgroup = true
+	f(1500)
+}
+
+func TestLimitsTrackerAutoMemLimit_NoCgroupLimit(t *testing.T) {
+	logger.SetOutputForTests(io.Discard)
+	defer logger.ResetOutputForTest()
+
+	goMemLimit := int64(math.MaxInt64)
+	lt := &limitsTracker{
+		sysTotalMemory: func() (int, bool) {
+			return 1000, false
+		},
+		now: time.Now,
+		setMemoryLimit: func(limit int64) int64 {
+			prev := goMemLimit
+			if limit >= 0 {
+				goMemLimit = limit
+			}
+			return prev
+		},
+	}
+	lt.get()
+	lt.enableAutoMemLimit()
+	if goMemLimit != math.MaxInt64 {
+		t.Fatalf("Go memory limit mustn't be set without cgroup memory limit; got %d", goMemLimit)
+	}
+}
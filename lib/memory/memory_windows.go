@@ -16,7 +16,7 @@ type memStatusEx struct {
 	unused       [6]uint64
 }
 
-func sysTotalMemory() int {
+func sysTotalMemory() (int, bool) {
 	kernel32, err := syscall.LoadDLL("kernel32.dll")
 	if err != nil {
 		logger.Panicf("FATAL: cannot load kernel32.dll: %s", err)
@@ -36,5 +36,5 @@ func sysTotalMemory() int {
 	if uint64(n) != msx.ullTotalPhys {
 		logger.Panicf("FATAL: int overflow for msx.ullTotalPhys=%d", msx.ullTotalPhys)
 	}
-	return n
+	return n, false
 }
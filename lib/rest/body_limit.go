@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+)
+
+var maxBodyBytesKey = any("maxBodyBytes")
+
+// NoBodyLimit disables the request body limit when passed to RouteBuilder.MaxBodyBytes or Container.DefaultMaxBodyBytes,
+// e.g. for proxy or upload routes streaming the body
+const NoBodyLimit int64 = -1
+
+// bodyLimit returns the maximum request body size for r or NoBodyLimit.
+//
+// The limit set via RouteBuilder.MaxBodyBytes is used if any, then containerDefault set via Container.DefaultMaxBodyBytes,
+// then maxRequestBodySize.
+func (r *Route) bodyLimit(containerDefault int64) int64 {
+	if r.maxBodyBytes != 0 {
+		return r.maxBodyBytes
+	}
+	if containerDefault != 0 {
+		return containerDefault
+	}
+	return maxRequestBodySize
+}
+
+// limitRequestBody wraps the body of r with http.MaxBytesReader and stores limit in the request context,
+// so the body readers of this package apply the same limit. The body isn't limited if limit is negative.
+//
+// It returns false if the Content-Length of r already exceeds limit. The body isn't read in this case,
+// so clients sending `Expect: 100-continue` get the response without transferring the body.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) (*http.Request, bool) {
+	if limit < 0 {
+		return r.WithContext(context.WithValue(r.Context(), maxBodyBytesKey, int64(math.MaxInt64))), true
+	}
+	if r.ContentLength > limit {
+		return r, false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	return r.WithContext(context.WithValue(r.Context(), maxBodyBytesKey, limit)), true
+}
+
+// requestBodyLimit returns the maximum body size for r set by the Container or maxRequestBodySize.
+// math.MaxInt64 is returned if the body of r isn't limited
+func requestBodyLimit(r *http.Request) int64 {
+	if limit, ok := r.Context().Value(maxBodyBytesKey).(int64); ok {
+		return limit
+	}
+	return maxRequestBodySize
+}
+
+// newBodyReadError returns 413 Request Entity Too Large if err is caused by exceeding the body limit of r.
+// Other errors are returned as 400 Bad Request with the given message.
+func newBodyReadError(r *http.Request, err error, message string) *apierrors.StatusError {
+	if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		return apierrors.NewRequestEntityTooLarge(requestBodyLimit(r))
+	}
+	return apierrors.NewBadRequest(message, nil)
+}
@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDispatch_MaxBodyBytes(t *testing.T) {
+	readAll := func(w http.ResponseWriter, r *http.Request) error {
+		body, err := readBody(r)
+		if err != nil {
+			return newBodyReadError(r, err, err.Error())
+		}
+		_, _ = w.Write(body)
+		return nil
+	}
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").MaxBodyBytes(16).ToErr(readAll))
+	ws.Route(ws.POST("/artifacts").MaxBodyBytes(2 * maxRequestBodySize).ToErr(readAll))
+	ws.Route(ws.POST("/default").ToErr(readAll))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(path string, size int, chunked bool, wantCode int) {
+		t.Helper()
+		var body io.Reader = strings.NewReader(strings.Repeat("a", size))
+		if chunked {
+			// hide the length of the body, so the limit can only be detected while reading
+			body = io.MultiReader(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s with %d bytes (chunked=%v); got %d; want %d; body: %s",
+				path, size, chunked, rec.Code, wantCode, rec.Body.String())
+		}
+		if wantCode == http.StatusOK && rec.Body.Len() != size {
+			t.Fatalf("unexpected response body length for %s; got %d; want %d", path, rec.Body.Len(), size)
+		}
+	}
+
+	for _, chunked := range []bool{false, true} {
+		// at limit
+		f("/api/users", 16, chunked, http.StatusOK)
+		f("/api/artifacts", 2*maxRequestBodySize, chunked, http.StatusOK)
+		f("/api/default", maxRequestBodySize, chunked, http.StatusOK)
+
+		// over limit
+		f("/api/users", 17, chunked, http.StatusRequestEntityTooLarge)
+		f("/api/artifacts", 2*maxRequestBodySize+1, chunked, http.StatusRequestEntityTooLarge)
+		f("/api/default", maxRequestBodySize+1, chunked, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestDispatch_DefaultMaxBodyBytes(t *testing.T) {
+	readAll := func(w http.ResponseWriter, r *http.Request) error {
+		body, err := readBody(r)
+		if err != nil {
+			return newBodyReadError(r, err, err.Error())
+		}
+		_, _ = w.Write(body)
+		return nil
+	}
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").MaxBodyBytes(16).ToErr(readAll))
+	ws.Route(ws.POST("/unlimited").MaxBodyBytes(NoBodyLimit).ToErr(readAll))
+	ws.Route(ws.POST("/default").ToErr(readAll))
+
+	f := func(containerLimit int64, path string, size int, wantCode int) {
+		t.Helper()
+		c := NewContainer()
+		c.DefaultMaxBodyBytes(containerLimit)
+		c.Add(ws)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("a", size)))
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s with %d bytes at container limit %d; got %d; want %d; body: %s",
+				path, size, containerLimit, rec.Code, wantCode, rec.Body.String())
+		}
+		if wantCode == http.StatusOK && rec.Body.Len() != size {
+			t.Fatalf("unexpected response body length for %s; got %d; want %d", path, rec.Body.Len(), size)
+		}
+	}
+
+	// the container default is applied to routes without their own limit
+	f(32, "/api/default", 32, http.StatusOK)
+	f(32, "/api/default", 33, http.StatusRequestEntityTooLarge)
+	f(NoBodyLimit, "/api/default", 2*maxRequestBodySize, http.StatusOK)
+
+	// the route limit overrides the container default
+	f(32, "/api/users", 17, http.StatusRequestEntityTooLarge)
+	f(NoBodyLimit, "/api/users", 17, http.StatusRequestEntityTooLarge)
+	f(0, "/api/unlimited", 2*maxRequestBodySize, http.StatusOK)
+	f(32, "/api/unlimited", 2*maxRequestBodySize, http.StatusOK)
+}
+
+func TestDispatch_MaxBodyBytes_ErrorBody(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").MaxBodyBytes(16).ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		var v map[string]string
+		return ReadEntity(r, &v)
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	dispatch := func(contentLength int64) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/users", io.MultiReader(strings.NewReader(`{"name":"`+strings.Repeat("a", 16)+`"}`)))
+		req.ContentLength = contentLength
+		req.Header.Set(HEADER_ContentType, MIME_JSON)
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("unexpected status code for Content-Length %d; got %d; want %d", contentLength, rec.Code, http.StatusRequestEntityTooLarge)
+		}
+		return rec
+	}
+
+	// the limit exceeded by Content-Length and while reading the body results in the same response
+	upfront := dispatch(26)
+	whileReading := dispatch(-1)
+	if upfront.Body.String() != whileReading.Body.String() {
+		t.Fatalf("unexpected response body for the exceeded Content-Length; got %q; want %q", upfront.Body.String(), whileReading.Body.String())
+	}
+}
+
+func TestDispatch_MaxBodyBytes_ReadEntity(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").MaxBodyBytes(32).ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		var v map[string]string
+		return ReadEntity(r, &v)
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(body string, wantCode int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/users", io.MultiReader(strings.NewReader(body)))
+		req.ContentLength = -1
+		req.Header.Set(HEADER_ContentType, MIME_JSON)
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %q; got %d; want %d", body, rec.Code, wantCode)
+		}
+	}
+
+	f(`{"name":"alice"}`, http.StatusOK)
+	f(`{"name":"`+strings.Repeat("a", 32)+`"}`, http.StatusRequestEntityTooLarge)
+}
+
+// unreadableBody fails the test if the request body is read
+type unreadableBody struct {
+	t *testing.T
+}
+
+func (b unreadableBody) Read(_ []byte) (int, error) {
+	b.t.Fatalf("unexpected read of the request body")
+	return 0, io.EOF
+}
+
+func TestDispatch_MaxBodyBytes_ExpectContinue(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").MaxBodyBytes(16).ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := readBody(r)
+		return err
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users", unreadableBody{t: t})
+	req.ContentLength = 17
+	req.Header.Set("Expect", "100-continue")
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,17 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"lcp.io/lcp/lib/utils/httputil"
+)
+
+// CheckNotModified sets the Last-Modified header to lastModified and checks it against
+// the If-Modified-Since request header; see httputil.CheckNotModified.
+//
+// It returns true after writing 304 Not Modified if the client's cached copy is current;
+// the caller must not write the response body in this case.
+func CheckNotModified(w http.ResponseWriter, r *http.Request, lastModified time.Time) bool {
+	return httputil.CheckNotModified(w, r, lastModified)
+}
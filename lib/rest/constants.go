@@ -6,6 +6,9 @@ const (
 	MIME_ZIP   = "application/zip"          // Accept or Content-Type used in Consumes() and/or Produces()
 	MIME_OCTET = "application/octet-stream" // If Content-Type is not present in request, use the default
 
+	MIME_FORM           = "application/x-www-form-urlencoded" // Content-Type used in Consumes() for routes reading the body with ReadForm
+	MIME_MULTIPART_FORM = "multipart/form-data"               // Content-Type used in Consumes() for routes reading the body with ReadForm
+
 	HEADER_Allow                         = "Allow"
 	HEADER_Accept                        = "Accept"
 	HEADER_Origin                        = "Origin"
@@ -13,6 +16,8 @@ const (
 	HEADER_ContentDisposition            = "Content-Disposition"
 	HEADER_LastModified                  = "Last-Modified"
 	HEADER_AcceptEncoding                = "Accept-Encoding"
+	HEADER_AcceptLanguage                = "Accept-Language"
+	HEADER_AcceptRanges                  = "Accept-Ranges"
 	HEADER_ContentEncoding               = "Content-Encoding"
 	HEADER_AccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HEADER_AccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -23,6 +28,13 @@ const (
 	HEADER_AccessControlAllowHeaders     = "Access-Control-Allow-Headers"
 	HEADER_AccessControlMaxAge           = "Access-Control-Max-Age"
 
+	// HEADER_APIVersion selects among the versions of a route registered via RouteBuilder.Version
+	HEADER_APIVersion = "X-API-Version"
+
+	// HEADER_NoCompression disables compression of the response by the gzip handler of the http server.
+	// The gzip handler removes it from the response sent to the client.
+	HEADER_NoCompression = "No-Gzip-Compression"
+
 	ENCODING_GZIP    = "gzip"
 	ENCODING_DEFLATE = "deflate"
 )
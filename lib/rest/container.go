@@ -1,13 +1,30 @@
 package rest
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/VictoriaMetrics/metrics"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
 	"lcp.io/lcp/lib/logger"
 )
 
+var (
+	nilRouteFunctionErrors   = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="nil_route_function"}`)
+	malformedMediaTypeErrors = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="malformed_media_type"}`)
+	routeTimeoutErrors       = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="route_timeout"}`)
+)
+
 // Container holds a collection of WebServices to dispatch HTTP requests
 // The requests are further dispatched to routes of WebServices using a RouteSelector
 type Container struct {
@@ -15,6 +32,12 @@ type Container struct {
 	webServices            []*WebService
 	router                 RouteSelector // default is a CurlyRouter
 	serviceErrorHandleFunc ServiceErrorHandleFunction
+	allowEncodedSlashes    bool
+	preserveEncodedParams  bool
+	defaultTimeout         time.Duration
+	maxBodyBytes           int64
+	strictMediaTypes       bool
+	filters                []FilterFunction
 }
 
 // NewContainer creates a new Container using a default router (CurlyRouter)
@@ -33,13 +56,31 @@ func (c *Container) Dispatch(w http.ResponseWriter, r *http.Request) {
 	if r == nil {
 		panic("HTTP request cannot be nil")
 	}
-	c.dispatch(w, r)
+	c.webServicesLock.RLock()
+	filters := c.filters
+	c.webServicesLock.RUnlock()
+	if len(filters) == 0 {
+		c.dispatch(w, r)
+		return
+	}
+	applyFilters(http.HandlerFunc(c.dispatch), filters).ServeHTTP(w, r)
 }
 
 // dispatch the incoming HTTP Request to the appropriate WebService
 func (c *Container) dispatch(w http.ResponseWriter, r *http.Request) {
+	if logger.IsDebugEnabled() {
+		logger.Debugf("dispatching request to %s", r.URL.Path)
+	}
+
+	if c.strictMediaTypes {
+		if err := validateMediaTypeHeaders(r); err != nil {
+			malformedMediaTypeErrors.Inc()
+			c.serviceErrorHandleFunc(NewError(http.StatusBadRequest, "400: "+err.Error()), w, r)
+			return
+		}
+	}
 
-	logger.Infof("dispatching request to %s", r.URL.Path)
+	routingStart := time.Now()
 
 	// Find best match Route
 	var webService *WebService
@@ -63,9 +104,71 @@ func (c *Container) dispatch(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		pathProcessor = defaultPathProcessor{}
 	}
-	pathParams := pathProcessor.ExtractParameters(route, webService, r.URL.Path)
+	pathParams, err := pathProcessor.ExtractParameters(route, webService, r.URL.EscapedPath())
+	if err == nil && !c.allowEncodedSlashes {
+		err = checkEncodedSlashes(route, pathParams)
+	}
+	if err != nil {
+		c.serviceErrorHandleFunc(NewError(http.StatusBadRequest, "400: "+err.Error()), w, r)
+		return
+	}
+	if c.preserveEncodedParams {
+		pathParams = extractPathParameters(route, TokenizePath(r.URL.EscapedPath()))
+	}
+	bodyLimit := route.bodyLimit(c.maxBodyBytes)
+	r, ok = limitRequestBody(w, r, bodyLimit)
+	if !ok {
+		// the same error is returned by the body readers if the limit is exceeded while reading
+		c.serviceErrorHandleFunc(toServiceError(apierrors.NewRequestEntityTooLarge(bodyLimit)), w, r)
+		return
+	}
+	if timeout := route.timeoutOrDefault(c.defaultTimeout); timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+		tw := &timeoutWriter{ResponseWriter: w}
+		w = tw
+		defer func() {
+			if tw.wroteHeader || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+			// The handler has returned without a response after the deadline, e.g. a handler bound via To
+			// has observed the canceled context, so respond with 503 instead of an empty 200 response
+			routeTimeoutErrors.Inc()
+			logger.WithThrottler("routeTimeout", 5*time.Second).Warnf("%s %s: the handler hasn't responded in %s; returning 503", r.Method, r.URL.Path, timeout)
+			c.serviceErrorHandleFunc(errRequestTimeout, tw.ResponseWriter, r)
+		}()
+	}
+	pathParams = webService.mergeHostParams(requestHost(r.Host), pathParams)
+	Timing(r).Measure("routing", time.Since(routingStart))
 	r = WithPathParams(r, pathParams)
-	route.Function(w, r)
+	r = withResponseMediaType(r, route.responseMediaType(r.Header.Get(HEADER_Accept)))
+	r = withServiceErrorHandler(r, c.serviceErrorHandleFunc)
+	if route.Function == nil {
+		// Routes built via RouteBuilder always have a function, but Route may be constructed or modified directly
+		nilRouteFunctionErrors.Inc()
+		logger.WithThrottler("nilRouteFunction", 5*time.Second).Errorf("misconfigured route %s: no function is set; returning 500", route)
+		c.serviceErrorHandleFunc(errInternalServerError, w, r)
+		return
+	}
+	var handler http.Handler = route.Function
+	handler = applyFilters(handler, route.filters)
+	handler = applyFilters(handler, webService.Filters())
+	handler.ServeHTTP(w, r)
+}
+
+// handleRouteError renders an error returned by a RouteErrorFunction via the ServiceErrorHandleFunction
+// of the Container dispatching r. The default writeServiceError is used if r hasn't been dispatched by a Container.
+func handleRouteError(err error, w http.ResponseWriter, r *http.Request) {
+	ser := toServiceError(err)
+	if ser.Code == http.StatusInternalServerError && errors.Is(err, context.DeadlineExceeded) && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		// the route timeout has expired
+		ser = errRequestTimeout
+	}
+	if ser.Code >= http.StatusInternalServerError {
+		logger.Errorf("[%d] %s %s: %v", ser.Code, r.Method, r.URL.Path, err)
+	}
+	serviceErrorHandler(r)(ser, w, r)
 }
 
 // Add a WebService to the Container. It will detect duplicate root paths and exit in that case
@@ -80,8 +183,8 @@ func (c *Container) Add(service *WebService) *Container {
 
 	// get rid of duplicate root paths
 	for _, each := range c.webServices {
-		if each.RootPath() == service.RootPath() {
-			logger.Fatalf("duplicate root path: " + service.RootPath())
+		if each.RootPath() == service.RootPath() && each.HostPattern() == service.HostPattern() {
+			logger.Fatalf("duplicate root path: %s%s", service.HostPattern(), service.RootPath())
 		}
 	}
 
@@ -89,12 +192,13 @@ func (c *Container) Add(service *WebService) *Container {
 	return c
 }
 
+// Remove removes the WebService with the same root path and host pattern as service
 func (c *Container) Remove(service *WebService) error {
 	c.webServicesLock.Lock()
 	defer c.webServicesLock.Unlock()
 	var newServices []*WebService
 	for _, each := range c.webServices {
-		if each.rootPath != service.rootPath {
+		if each.rootPath != service.rootPath || each.HostPattern() != service.HostPattern() {
 			newServices = append(newServices, each)
 		}
 	}
@@ -111,6 +215,211 @@ func (c *Container) RegisteredWebServices() []*WebService {
 	return result
 }
 
+// ServeMuxHandler returns an http.Handler for mounting c on an http.ServeMux at the given pattern,
+// so the routes can be adopted incrementally next to existing mux handlers:
+//
+//	mux.Handle("/teams/", c.ServeMuxHandler("/teams/"))
+//
+// The path of the pattern is stripped from the request path before dispatching, so the WebServices
+// of c are registered relative to the mount point, e.g. a WebService with path "/v1" serves "/teams/v1".
+// Method and host in pattern are allowed, but the path must not contain wildcards.
+func (c *Container) ServeMuxHandler(pattern string) http.Handler {
+	path := pattern
+	if n := strings.IndexAny(path, " \t"); n >= 0 {
+		// strip the method
+		path = strings.TrimLeft(path[n:], " \t")
+	}
+	if n := strings.IndexByte(path, '/'); n >= 0 {
+		// strip the host
+		path = path[n:]
+	}
+	if strings.Contains(path, "{") {
+		logger.Fatalf("cannot mount container at pattern %q: wildcards are not supported", pattern)
+	}
+	return http.StripPrefix(strings.TrimSuffix(path, "/"), http.HandlerFunc(c.Dispatch))
+}
+
+// DumpRoutes writes a listing of all routes of the registered WebServices to w, one route per line:
+//
+//	GET /api/v1/users consumes=*/* produces=application/json
+//
+// Routes registered via RouteBuilder.Version end with " version=N" and routes of WebServices bound
+// to a host via WebService.Host end with " host=pattern".
+// Routes are sorted by path, method, host and version, so the output of two releases can be diffed.
+func (c *Container) DumpRoutes(w io.Writer) error {
+	type hostRoute struct {
+		Route
+		host string
+	}
+	var routes []hostRoute
+	for _, ws := range c.RegisteredWebServices() {
+		for _, r := range ws.Routes() {
+			routes = append(routes, hostRoute{Route: r, host: ws.HostPattern()})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		if routes[i].Method != routes[j].Method {
+			return routes[i].Method < routes[j].Method
+		}
+		if routes[i].host != routes[j].host {
+			return routes[i].host < routes[j].host
+		}
+		return routes[i].Version < routes[j].Version
+	})
+
+	bw := bufio.NewWriter(w)
+	for i := range routes {
+		r := &routes[i]
+		bw.WriteString(r.Method)
+		bw.WriteByte(' ')
+		bw.WriteString(r.Path)
+		bw.WriteString(" consumes=")
+		writeMimeTypes(bw, r.Consumes)
+		bw.WriteString(" produces=")
+		writeMimeTypes(bw, r.Produces)
+		if r.Version != 0 {
+			bw.WriteString(" version=")
+			bw.WriteString(strconv.Itoa(r.Version))
+		}
+		if r.host != "" {
+			bw.WriteString(" host=")
+			bw.WriteString(r.host)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// writeMimeTypes writes the comma-separated mimeTypes to bw; "*/*" is written if mimeTypes is empty
+func writeMimeTypes(bw *bufio.Writer, mimeTypes []string) {
+	if len(mimeTypes) == 0 {
+		bw.WriteString("*/*")
+		return
+	}
+	for i, mt := range mimeTypes {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString(mt)
+	}
+}
+
+// CheckRouteConflicts returns an error listing the routes of the registered WebServices, which cannot be told apart
+// during dispatching, e.g. routes registered twice or routes differing only in the names of path parameters:
+//
+//	GET /api/v1/users/{id}
+//	GET /api/v1/users/{name}
+//
+// Routes conflict if they have the same host pattern, method, path template, version, consumes and produces.
+// Routes with different consumes or produces are selected via content negotiation, so they don't conflict.
+func (c *Container) CheckRouteConflicts() error {
+	seen := make(map[string]string)
+	var errs []error
+	for _, ws := range c.RegisteredWebServices() {
+		for _, r := range ws.Routes() {
+			key := routeConflictKey(ws.HostPattern(), &r)
+			desc := r.Method + " " + ws.HostPattern() + r.Path
+			if prev, ok := seen[key]; ok {
+				errs = append(errs, fmt.Errorf("route %s conflicts with route %s", desc, prev))
+				continue
+			}
+			seen[key] = desc
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// routeConflictKey returns the key, which is equal for the routes matching the same requests.
+//
+// The names of path parameters are dropped from the path template, since they don't affect matching.
+func routeConflictKey(host string, r *Route) string {
+	var sb strings.Builder
+	sb.WriteString(host)
+	sb.WriteByte(' ')
+	sb.WriteString(r.Method)
+	sb.WriteByte(' ')
+	for _, token := range tokenizeTemplate(r.Path) {
+		sb.WriteByte('/')
+		n := strings.LastIndexByte(token, '}')
+		if !strings.HasPrefix(token, "{") || n < 0 {
+			sb.WriteString(token)
+			continue
+		}
+		param := token[1:n]
+		if i := strings.IndexByte(param, ':'); i >= 0 {
+			// keep the regular expression, since parameters with different expressions match different paths
+			sb.WriteString("{:" + param[i+1:] + "}")
+		} else {
+			sb.WriteString("{}")
+		}
+		// keep the custom verb after the parameter
+		sb.WriteString(token[n+1:])
+	}
+	sb.WriteString(" version=")
+	sb.WriteString(strconv.Itoa(r.Version))
+	sb.WriteString(" default=")
+	sb.WriteString(strconv.FormatBool(r.isDefault))
+	sb.WriteString(" consumes=")
+	sb.WriteString(strings.Join(sortedMimeTypes(r.Consumes), ","))
+	sb.WriteString(" produces=")
+	sb.WriteString(strings.Join(sortedMimeTypes(r.Produces), ","))
+	return sb.String()
+}
+
+func sortedMimeTypes(mimeTypes []string) []string {
+	a := append([]string(nil), mimeTypes...)
+	sort.Strings(a)
+	return a
+}
+
+// AllowEncodedSlashes controls whether path parameters which are not wildcards ({path:*}) may contain
+// encoded slashes (%2F). They are rejected with 400 Bad Request by default, since a decoded slash inside
+// a single segment parameter may be used for path traversal. Wildcard parameters always accept them.
+func (c *Container) AllowEncodedSlashes(allowed bool) {
+	c.allowEncodedSlashes = allowed
+}
+
+// PreserveEncodedPathParams controls whether path parameter values are passed to handlers exactly as sent
+// by the client, i.e. without decoding percent-encoded characters. Routing and the AllowEncodedSlashes check
+// still use the decoded values. Path parameter values are never case-normalized.
+func (c *Container) PreserveEncodedPathParams(preserve bool) {
+	c.preserveEncodedParams = preserve
+}
+
+// DefaultTimeout sets the timeout for the handlers of routes without RouteBuilder.Timeout. There is no timeout by default.
+//
+// The request context of the handler is cancelled when the timeout expires; see RouteBuilder.Timeout.
+func (c *Container) DefaultTimeout(d time.Duration) {
+	c.defaultTimeout = d
+}
+
+// DefaultMaxBodyBytes sets the request body limit for routes without RouteBuilder.MaxBodyBytes.
+// The limit is 1 MB by default; NoBodyLimit disables it.
+//
+// Routes bound via RouteBuilder.ToProxy aren't limited unless RouteBuilder.MaxBodyBytes is set for them.
+func (c *Container) DefaultMaxBodyBytes(n int64) {
+	c.maxBodyBytes = n
+}
+
+// StrictMediaTypes controls whether requests with malformed Accept or Content-Type headers, e.g. "///;;;",
+// are rejected with 400 Bad Request before routing. By default such headers are parsed leniently, so garbage
+// may be treated as "*/*" or result in a confusing 406 or 415 response.
+func (c *Container) StrictMediaTypes(strict bool) {
+	c.strictMediaTypes = strict
+}
+
+// Filter adds a filter running for all the requests dispatched by the Container, e.g. authentication,
+// logging or recovery. Container filters run before route selection, so they see requests not matching
+// any route too, and before the filters of the WebService and the route; see FilterFunction.
+func (c *Container) Filter(filter FilterFunction) {
+	c.webServicesLock.Lock()
+	defer c.webServicesLock.Unlock()
+	c.filters = append(c.filters, filter)
+}
+
 // ServiceErrorHandleFunction declares functions that can be used to handle a service error situation.
 // The first argument is the service error, the second is the request that resulted in the error and
 // the third must be used to communicate an error response.
@@ -122,6 +431,19 @@ func (c *Container) ServiceErrorHandler(handler ServiceErrorHandleFunction) {
 	c.serviceErrorHandleFunc = handler
 }
 
+func withServiceErrorHandler(r *http.Request, handler ServiceErrorHandleFunction) *http.Request {
+	ctx := context.WithValue(r.Context(), serviceErrorHandlerKey, handler)
+	return r.WithContext(ctx)
+}
+
+// serviceErrorHandler returns the ServiceErrorHandleFunction of the Container dispatching r
+func serviceErrorHandler(r *http.Request) ServiceErrorHandleFunction {
+	if handler, ok := r.Context().Value(serviceErrorHandlerKey).(ServiceErrorHandleFunction); ok && handler != nil {
+		return handler
+	}
+	return writeServiceError
+}
+
 // writeServiceError is the default ServiceErrorHandleFunction and is called
 // when a ServiceError is returned during route selection. Default implementation
 // calls resp.WriteErrorString(err.Code, err.Message)
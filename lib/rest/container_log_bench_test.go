@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+func BenchmarkContainerDispatch(b *testing.B) {
+	ws := new(WebService).Path("/api/v1")
+	ws.Route(ws.GET("/users/{name}").To(func(w http.ResponseWriter, r *http.Request) {}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(b *testing.B, level string) {
+		logger.Reload(level, "")
+		logger.SetOutputForTests(io.Discard)
+		defer func() {
+			logger.Reload("INFO", "")
+			logger.ResetOutputForTest()
+		}()
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/alice", nil)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			w := &discardResponseWriter{h: make(http.Header)}
+			for pb.Next() {
+				c.Dispatch(w, req)
+			}
+		})
+	}
+
+	b.Run("logging=off", func(b *testing.B) { f(b, "INFO") })
+	b.Run("logging=on", func(b *testing.B) { f(b, "DEBUG") })
+}
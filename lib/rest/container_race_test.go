@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestContainer_ConcurrentUpdates must be run with -race to detect unsynchronized access
+// to the WebServices of a Container and the routes of a WebService during dispatch
+func TestContainer_ConcurrentUpdates(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	static := new(WebService).Path("/static")
+	static.Route(static.GET("/items/{name}").To(noop))
+	c := NewContainer()
+	c.Add(static)
+
+	const iterations = 200
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// dispatch requests until the updates are finished
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, path := range []string{"/static/items/x", "/static/items/x/y", "/dynamic/0/items", "/missing"} {
+					c.Dispatch(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+				}
+				_ = c.RegisteredWebServices()
+			}
+		}()
+	}
+
+	// add and remove routes of a registered WebService
+	var updates sync.WaitGroup
+	updates.Add(2)
+	go func() {
+		defer updates.Done()
+		for i := 0; i < iterations; i++ {
+			path := fmt.Sprintf("/items/{name}/%d", i)
+			static.Route(static.GET(path).To(noop))
+			static.RemoveRoute("/static"+path, http.MethodGet)
+		}
+	}()
+
+	// add and remove WebServices
+	go func() {
+		defer updates.Done()
+		for i := 0; i < iterations; i++ {
+			ws := new(WebService).Path(fmt.Sprintf("/dynamic/%d", i%3))
+			ws.Route(ws.GET("/items").To(noop))
+			c.Add(ws)
+			if err := c.Remove(ws); err != nil {
+				t.Errorf("cannot remove WebService: %v", err)
+				return
+			}
+		}
+	}()
+	updates.Wait()
+	close(stop)
+	wg.Wait()
+
+	// the container is consistent after the updates
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/static/items/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusOK)
+	}
+	if n := len(c.RegisteredWebServices()); n != 1 {
+		t.Fatalf("unexpected number of WebServices; got %d; want 1", n)
+	}
+	if n := len(static.Routes()); n != 1 {
+		t.Fatalf("unexpected number of routes; got %d; want 1", n)
+	}
+}
@@ -0,0 +1,248 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContainer_DumpRoutes(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	users := new(WebService).Path("/api/v1/users").Produces(MIME_JSON)
+	users.Route(users.POST("").Consumes(MIME_JSON, "application/yaml").To(noop))
+	users.Route(users.GET("/{name}").Version(2).To(noop))
+	users.Route(users.GET("/{name}").To(noop))
+	users.Route(users.GET("").To(noop))
+	users.Route(users.DELETE("/{name}").To(noop))
+	files := new(WebService).Path("/api/v1/files")
+	files.Route(files.GET("/{path:*}").Produces(MIME_OCTET).To(noop))
+
+	f := func(services []*WebService, want string) {
+		t.Helper()
+		c := NewContainer()
+		for _, ws := range services {
+			c.Add(ws)
+		}
+		var sb strings.Builder
+		if err := c.DumpRoutes(&sb); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := sb.String(); got != want {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", got, want)
+		}
+	}
+
+	want := `GET /api/v1/files/{path:*} consumes=*/* produces=application/octet-stream
+GET /api/v1/users/ consumes=*/* produces=application/json
+POST /api/v1/users/ consumes=application/json,application/yaml produces=application/json
+DELETE /api/v1/users/{name} consumes=*/* produces=application/json
+GET /api/v1/users/{name} consumes=*/* produces=application/json
+GET /api/v1/users/{name} consumes=*/* produces=application/json version=2
+`
+	// the output doesn't depend on the registration order
+	f([]*WebService{users, files}, want)
+	f([]*WebService{files, users}, want)
+	f(nil, "")
+}
+
+func TestContainer_CheckRouteConflicts(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	f := func(register func(ws *WebService), conflictsExpected int) {
+		t.Helper()
+		ws := new(WebService).Path("/api/v1")
+		register(ws)
+		c := NewContainer()
+		c.Add(ws)
+		err := c.CheckRouteConflicts()
+		if conflictsExpected == 0 {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if n := strings.Count(err.Error(), "conflicts with"); n != conflictsExpected {
+			t.Fatalf("unexpected number of conflicts; got %d; want %d; error: %v", n, conflictsExpected, err)
+		}
+	}
+
+	// no conflicts
+	f(func(ws *WebService) {}, 0)
+	f(func(ws *WebService) {
+		ws.Route(ws.GET("/users").To(noop))
+		ws.Route(ws.POST("/users").To(noop))
+		ws.Route(ws.GET("/users/{name}").To(noop))
+		ws.Route(ws.GET("/users/{name}").Version(2).To(noop))
+		ws.Route(ws.GET("/users/{name}:workspaces").To(noop))
+		ws.Route(ws.GET("/files/{id:[0-9]+}").To(noop))
+		ws.Route(ws.GET("/files/{name:[a-z]+}").To(noop))
+		ws.Route(ws.POST("/items").Consumes(MIME_JSON).To(noop))
+		ws.Route(ws.POST("/items").Consumes(MIME_XML).To(noop))
+	}, 0)
+
+	// the same route registered twice
+	f(func(ws *WebService) {
+		ws.Route(ws.GET("/users").To(noop))
+		ws.Route(ws.GET("/users").To(noop))
+	}, 1)
+
+	// path params with different names
+	f(func(ws *WebService) {
+		ws.Route(ws.GET("/users/{id}").To(noop))
+		ws.Route(ws.GET("/users/{name}").To(noop))
+		ws.Route(ws.GET("/users/{name}:workspaces").To(noop))
+		ws.Route(ws.GET("/users/{id}:workspaces").To(noop))
+	}, 2)
+
+	// the order of consumes doesn't matter
+	f(func(ws *WebService) {
+		ws.Route(ws.POST("/items").Consumes(MIME_JSON, MIME_XML).To(noop))
+		ws.Route(ws.POST("/items").Consumes(MIME_XML, MIME_JSON).To(noop))
+	}, 1)
+}
+
+func TestDispatch_NilRouteFunction(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/broken").To(func(w http.ResponseWriter, r *http.Request) {}))
+	// simulate a Route modified after it has been built
+	ws.routes[0].Function = nil
+	c := NewContainer()
+	c.Add(ws)
+
+	errorsBefore := nilRouteFunctionErrors.Get()
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/broken", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if n := nilRouteFunctionErrors.Get() - errorsBefore; n != 1 {
+		t.Fatalf("unexpected number of nil route function errors; got %d; want 1", n)
+	}
+}
+
+func TestContainer_ServeMuxHandler(t *testing.T) {
+	ws := new(WebService).Path("/v1")
+	ws.Route(ws.GET("/teams/{name}").To(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "team "+PathParam(r, "name"))
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(pattern, path string, wantCode int, wantBody string) {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pattern, c.ServeMuxHandler(pattern))
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s at %q; got %d; want %d", path, pattern, rec.Code, wantCode)
+		}
+		if wantBody != "" && rec.Body.String() != wantBody {
+			t.Fatalf("unexpected body for %s at %q; got %q; want %q", path, pattern, rec.Body.String(), wantBody)
+		}
+	}
+
+	f("/api/", "/api/v1/teams/core", http.StatusOK, "team core")
+	f("/api/", "/api/v1/teams/a%2Fb", http.StatusBadRequest, "")
+	f("/api/", "/api/v2/teams/core", http.StatusNotFound, "")
+	f("/api/", "/healthz", http.StatusOK, "ok")
+	f("GET /api/", "/api/v1/teams/core", http.StatusOK, "team core")
+	f("example.com/api/", "http://example.com/api/v1/teams/core", http.StatusOK, "team core")
+	f("/", "/v1/teams/core", http.StatusOK, "team core")
+}
+
+func ExampleContainer_ServeMuxHandler() {
+	ws := new(WebService).Path("/v1")
+	ws.Route(ws.GET("/teams/{name}").To(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "team "+PathParam(r, "name"))
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	// existing handlers stay on the mux, the container serves everything below /api/
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+	mux.Handle("/api/", c.ServeMuxHandler("/api/"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/teams/core", nil))
+	fmt.Println(rec.Body.String())
+	// Output: team core
+}
+
+func TestDispatch_RouteTimeout(t *testing.T) {
+	waitForDeadline := func(w http.ResponseWriter, r *http.Request) error {
+		if _, ok := r.Context().Deadline(); !ok {
+			_, _ = io.WriteString(w, "no deadline")
+			return nil
+		}
+		<-r.Context().Done()
+		return fmt.Errorf("cannot list items: %w", r.Context().Err())
+	}
+	checkContext := func(w http.ResponseWriter, r *http.Request) error {
+		<-r.Context().Done()
+		return CheckContext(r)
+	}
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/list").Timeout(10 * time.Millisecond).ToErr(waitForDeadline))
+	ws.Route(ws.GET("/check").Timeout(10 * time.Millisecond).ToErr(checkContext))
+	ws.Route(ws.GET("/default").ToErr(waitForDeadline))
+	ws.Route(ws.GET("/stream").Timeout(NoTimeout).ToErr(waitForDeadline))
+	// functions bound via To cannot return the error
+	ws.Route(ws.GET("/silent").Timeout(10 * time.Millisecond).To(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	ws.Route(ws.GET("/late").Timeout(10 * time.Millisecond).To(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	ws.Route(ws.GET("/fast").Timeout(time.Minute).To(func(w http.ResponseWriter, r *http.Request) {}))
+
+	f := func(c *Container, path string, wantCode int, wantBody string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", path, rec.Code, wantCode)
+		}
+		if wantBody != "" && rec.Body.String() != wantBody {
+			t.Fatalf("unexpected body for %s; got %q; want %q", path, rec.Body.String(), wantBody)
+		}
+	}
+
+	c := NewContainer()
+	c.Add(ws)
+	f(c, "/api/list", http.StatusServiceUnavailable, "")
+	f(c, "/api/check", http.StatusServiceUnavailable, "")
+	f(c, "/api/default", http.StatusOK, "no deadline")
+	f(c, "/api/stream", http.StatusOK, "no deadline")
+
+	timeoutsBefore := routeTimeoutErrors.Get()
+	f(c, "/api/silent", http.StatusServiceUnavailable, errRequestTimeout.Message)
+	if n := routeTimeoutErrors.Get() - timeoutsBefore; n != 1 {
+		t.Fatalf("unexpected number of route timeouts; got %d; want 1", n)
+	}
+	// the response written after the deadline is kept
+	f(c, "/api/late", http.StatusGatewayTimeout, "")
+	// the empty response written before the deadline is kept
+	f(c, "/api/fast", http.StatusOK, "")
+
+	c = NewContainer()
+	c.DefaultTimeout(10 * time.Millisecond)
+	c.Add(ws)
+	f(c, "/api/default", http.StatusServiceUnavailable, "")
+	f(c, "/api/stream", http.StatusOK, "no deadline")
+}
@@ -3,25 +3,22 @@ package rest
 import (
 	"fmt"
 	"net/http"
-	"regexp"
 	"sort"
 	"strings"
-	"sync"
 )
 
 type CurlyRouter struct{}
 
-var (
-	regexCache sync.Map // Cache for compiled regex patterns
-)
-
 func (c CurlyRouter) SelectRoute(
 	webServices []*WebService,
 	httpRequest *http.Request) (selectedService *WebService, selected *Route, err error) {
 
-	requestTokens := tokenizePath(httpRequest.URL.Path)
+	requestTokens, err := requestPathTokens(httpRequest)
+	if err != nil {
+		return nil, nil, NewError(http.StatusBadRequest, "400: "+err.Error())
+	}
 
-	detectedService := c.detectWebService(requestTokens, webServices)
+	detectedService := c.detectWebService(requestHost(httpRequest.Host), requestTokens, webServices)
 	if detectedService == nil {
 		return nil, nil, NewError(http.StatusNotFound, "404: page not found")
 	}
@@ -36,15 +33,39 @@ func (c CurlyRouter) SelectRoute(
 	return detectedService, selectedRoute, err
 }
 
-// detectWebService returns the best matching WebService given the list of path tokens
-func (c CurlyRouter) detectWebService(requestTokens []string, webServices []*WebService) *WebService {
+// requestPathTokens splits the escaped request path into segments and decodes each of them,
+// so an encoded slash (%2F) stays within its segment instead of acting as a separator
+func requestPathTokens(httpRequest *http.Request) ([]string, error) {
+	return decodePathTokens(TokenizePath(httpRequest.URL.EscapedPath()))
+}
+
+// ExtractParameters implements PathProcessor.
+//
+// It reuses the decoded request path tokens of the route returned by SelectRoute instead of tokenizing
+// and decoding urlPath again
+func (c CurlyRouter) ExtractParameters(route *Route, webService *WebService, urlPath string) (map[string]string, error) {
+	if route.requestTokens == nil {
+		return defaultPathProcessor{}.ExtractParameters(route, webService, urlPath)
+	}
+	return extractPathParameters(route, route.requestTokens), nil
+}
+
+// detectWebService returns the best matching WebService given the request host and the list of path tokens.
+// WebServices bound to more specific hosts are preferred; the path score decides among the ones with the same host score
+func (c CurlyRouter) detectWebService(host string, requestTokens []string, webServices []*WebService) *WebService {
 	var selected *WebService
 	score := -1
+	hostScore := -1
 	for _, service := range webServices {
+		matchesHost, serviceHostScore := service.matchHost(host)
+		if !matchesHost || serviceHostScore < hostScore {
+			continue
+		}
 		matches, serviceScore := c.computeWebServiceScore(requestTokens, service.pathExpr.tokens)
-		if matches && (serviceScore > score) {
+		if matches && (serviceHostScore > hostScore || serviceScore > score) {
 			selected = service
 			score = serviceScore
+			hostScore = serviceHostScore
 		}
 	}
 	return selected
@@ -91,12 +112,20 @@ func (c CurlyRouter) computeWebServiceScore(requestTokens []string, routeTokens
 
 func (c CurlyRouter) selectRoutes(ws *WebService, requestTokens []string) sortableCurlyRoutes {
 	candidates := make(sortableCurlyRoutes, 0, 8)
-	for _, eachRoute := range ws.routes {
+	for _, eachRoute := range ws.routesSnapshot() {
 		//match
-		matches, paramCount, staticCount := c.matchesRouteByPathTokens(eachRoute.pathParts, requestTokens, eachRoute.hasCustomVerb)
+		var matches bool
+		var paramCount, staticCount int
+		if eachRoute.isDefault {
+			matches, paramCount, staticCount = c.matchesDefaultRoute(eachRoute.pathParts, requestTokens, eachRoute.hasCustomVerb)
+		} else {
+			matches, paramCount, staticCount = c.matchesRouteByPathTokens(eachRoute.pathParts, requestTokens, eachRoute.hasCustomVerb)
+		}
 		eachRoute.paramCount = paramCount
 		eachRoute.staticCount = staticCount
 		if matches {
+			// eachRoute is a copy, so it may hold the request specific data for ExtractParameters
+			eachRoute.requestTokens = requestTokens
 			candidates = append(candidates, &eachRoute)
 		}
 	}
@@ -109,7 +138,7 @@ func (c CurlyRouter) matchesRouteByPathTokens(routeTokens, requestTokens []strin
 	if len(routeTokens) < len(requestTokens) {
 		// proceed in matching only if last routeToken is wildcard
 		count := len(routeTokens)
-		if count == 0 || !strings.HasSuffix(routeTokens[count-1], "*") {
+		if count == 0 || !strings.HasSuffix(routeTokens[count-1], "*}") {
 			return false, 0, 0
 		}
 		// proceed
@@ -152,6 +181,14 @@ func (c CurlyRouter) matchesRouteByPathTokens(routeTokens, requestTokens []strin
 	return true, paramCount, staticCount
 }
 
+// matchesDefaultRoute computes whether the request path is located below the path of a default route
+func (c CurlyRouter) matchesDefaultRoute(routeTokens, requestTokens []string, routeHasCustomVerb bool) (matches bool, paramCount, staticCount int) {
+	if len(requestTokens) < len(routeTokens) {
+		return false, 0, 0
+	}
+	return c.matchesRouteByPathTokens(routeTokens, requestTokens[:len(routeTokens)], routeHasCustomVerb)
+}
+
 // regularMatchesPathToken tests whether the regular expression part of routeToken matches the requestToken of all remaining tokens
 // format routeToken is {someVar:someExpression}, e.g. {zipcode:[\d][\d][\d][\d][A-Z][A-Z]}
 func (c CurlyRouter) regularMatchesPathToken(routeToken string, colon int, requestToken string) (matchesToken bool, matchesRemainder bool) {
@@ -159,23 +196,11 @@ func (c CurlyRouter) regularMatchesPathToken(routeToken string, colon int, reque
 	if regPart == "*" {
 		return true, true
 	}
-	// Check cache first (if enabled)
-	if regex, found := getCachedRegexp(&regexCache, regPart); found {
-		matched := regex.MatchString(requestToken)
-		return matched, false
-	}
-
-	// Compile the regex
-	regex, err := regexp.Compile(regPart)
+	regex, err := compilePathParamRegexp(regPart)
 	if err != nil {
 		return false, false
 	}
-
-	// Cache the regex
-	regexCache.Store(regPart, regex)
-	matched := regex.MatchString(requestToken)
-
-	return matched, false
+	return regex.MatchString(requestToken), false
 }
 
 func (c CurlyRouter) detectRoute(candidateRoutes sortableCurlyRoutes, httpRequest *http.Request) (*Route, error) {
@@ -244,5 +269,7 @@ func (c CurlyRouter) detectRoute(candidateRoutes sortableCurlyRoutes, httpReques
 			http.StatusNotAcceptable,
 			fmt.Sprintf("406: Not Acceptable\n\nAvailable representations: %s", strings.Join(available, ", ")))
 	}
-	return candidates[0], nil
+
+	// API version
+	return selectRouteVersion(candidates, httpRequest)
 }
@@ -1,6 +1,6 @@
 package rest
 
-// sortableCurlyRoutes orders by most parameters and path elements first.
+// sortableCurlyRoutes orders by most parameters and path elements first. Default routes come last.
 type sortableCurlyRoutes []*Route
 
 func (s sortableCurlyRoutes) Len() int {
@@ -13,6 +13,10 @@ func (s sortableCurlyRoutes) Less(i, j int) bool {
 	a := (s)[j]
 	b := (s)[i]
 
+	// default routes have the lowest priority
+	if a.isDefault != b.isDefault {
+		return a.isDefault
+	}
 	// primary key
 	if a.staticCount < b.staticCount {
 		return true
@@ -2,8 +2,14 @@ package rest
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func mockRouteFunction(w http.ResponseWriter, r *http.Request) {
@@ -57,3 +63,491 @@ func TestSelectRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectRoute_EncodedLiteral(t *testing.T) {
+	ws := new(WebService)
+	ws.Path("/api")
+	ws.Route(ws.GET("/search/hello world").To(mockRouteFunction))
+	ws.Route(ws.GET("/docs/a%40b").To(mockRouteFunction))
+
+	cases := []struct {
+		name string
+		url  string
+		path string
+	}{
+		{name: "encoded space", url: "/api/search/hello%20world", path: "/api/search/hello world"},
+		{name: "encoded template literal", url: "/api/docs/a%40b", path: "/api/docs/a%40b"},
+		{name: "unencoded request for encoded template literal", url: "/api/docs/a@b", path: "/api/docs/a%40b"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, c.url, nil)
+			if err != nil {
+				t.Fatalf("cannot create request: %v", err)
+			}
+			_, route, err := CurlyRouter{}.SelectRoute([]*WebService{ws}, req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if route.Path != c.path {
+				t.Errorf("unexpected route selected; got %q; want %q", route.Path, c.path)
+			}
+		})
+	}
+}
+
+func TestDispatch_DecodedPathParams(t *testing.T) {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api")
+	var got string
+	ws.Route(ws.GET("/users/{name}/orders").To(func(w http.ResponseWriter, r *http.Request) {
+		got = PathParam(r, "name")
+	}))
+	container.Add(ws)
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{url: "/api/users/John%20Doe/orders", expected: "John Doe"},
+		{url: "/api/users/%E2%82%AC/orders", expected: "€"},
+	}
+	for _, c := range cases {
+		got = ""
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodGet, c.url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status for %s; got %d; want %d", c.url, rec.Code, http.StatusOK)
+		}
+		if got != c.expected {
+			t.Errorf("unexpected path param for %s; got %q; want %q", c.url, got, c.expected)
+		}
+	}
+}
+
+func TestDispatch_EncodedSlashInPathParam(t *testing.T) {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api")
+	var got string
+	ws.Route(ws.GET("/users/{name}/orders").To(func(w http.ResponseWriter, r *http.Request) {
+		got = PathParam(r, "name")
+	}))
+	container.Add(ws)
+
+	rec := httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/users/a%2Fb/orders", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status; got %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	container.AllowEncodedSlashes(true)
+	rec = httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/users/a%2Fb/orders", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status; got %d; want %d", rec.Code, http.StatusOK)
+	}
+	if got != "a/b" {
+		t.Errorf("unexpected path param; got %q; want %q", got, "a/b")
+	}
+}
+
+func TestSelectRoute_DefaultRoute(t *testing.T) {
+	ws := new(WebService)
+	ws.Path("/api/v1")
+	ws.Route(ws.GET("/*").ToDefault(mockRouteFunction))
+	ws.Route(ws.GET("/users").To(mockRouteFunction))
+	ws.Route(ws.GET("/users/{id}").To(mockRouteFunction))
+	ws.Route(ws.GET("/files/{path:*}").To(mockRouteFunction))
+	ws.Route(ws.GET("/legacy").ToDefault(mockRouteFunction))
+
+	cases := []struct {
+		url  string
+		path string
+	}{
+		{url: "/api/v1/users", path: "/api/v1/users"},
+		{url: "/api/v1/users/123", path: "/api/v1/users/{id}"},
+		{url: "/api/v1/files/a/b", path: "/api/v1/files/{path:*}"},
+		{url: "/api/v1/users/123/orders", path: "/api/v1/"},
+		{url: "/api/v1/unknown", path: "/api/v1/"},
+		{url: "/api/v1", path: "/api/v1/"},
+		{url: "/api/v1/legacy/a/b", path: "/api/v1/legacy"},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, c.url, nil)
+			_, route, err := CurlyRouter{}.SelectRoute([]*WebService{ws}, req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if route.Path != c.path {
+				t.Errorf("unexpected route selected; got %q; want %q", route.Path, c.path)
+			}
+		})
+	}
+
+	// the default route does not match other methods
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/unknown", nil)
+	if _, _, err := (CurlyRouter{}).SelectRoute([]*WebService{ws}, req); err == nil {
+		t.Fatalf("expected error for unmatched method")
+	}
+}
+
+func TestDispatch_DefaultRoute(t *testing.T) {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api")
+	var handled string
+	ws.Route(ws.GET("/users").To(func(w http.ResponseWriter, r *http.Request) {
+		handled = "users"
+	}))
+	ws.Route(ws.GET("/*").ToDefault(func(w http.ResponseWriter, r *http.Request) {
+		handled = "default"
+	}))
+	container.Add(ws)
+
+	for url, expected := range map[string]string{
+		"/api/users":     "users",
+		"/api/users/123": "default",
+		"/api/other/a/b": "default",
+	} {
+		handled = ""
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status for %s; got %d; want %d", url, rec.Code, http.StatusOK)
+		}
+		if handled != expected {
+			t.Errorf("unexpected handler for %s; got %q; want %q", url, handled, expected)
+		}
+	}
+}
+
+func TestRegularMatchesPathToken(t *testing.T) {
+	f := func(routeToken, requestToken string, matchesExpected bool) {
+		t.Helper()
+		matches, _ := CurlyRouter{}.regularMatchesPathToken(routeToken, strings.Index(routeToken, ":"), requestToken)
+		if matches != matchesExpected {
+			t.Fatalf("unexpected match of %q for %q; got %v; want %v", routeToken, requestToken, matches, matchesExpected)
+		}
+	}
+
+	f("{id:[0-9]+}", "123", true)
+	f("{id:[0-9]+}", "abc", false)
+
+	// request tokens, which are valid expressions themselves, must be matched against the route expression
+	f("{id:[0-9]+}", ".*", false)
+	f("{id:[0-9]+}", "[a-z]+", false)
+	f("{id:[0-9]+}", "a|1", false)
+	f("{name:[a-z]+}", "[0-9]+", false)
+
+	// invalid route expressions don't match anything
+	f("{id:[0-9+}", "1", false)
+}
+
+func TestDispatch_RegexParam(t *testing.T) {
+	ws := new(WebService)
+	ws.Path("/api")
+	var id string
+	ws.Route(ws.GET("/users/{id:[0-9]+}").To(func(w http.ResponseWriter, r *http.Request) {
+		id = PathParam(r, "id")
+	}))
+	container := NewContainer()
+	container.Add(ws)
+
+	f := func(path string, statusCodeExpected int, idExpected string) {
+		t.Helper()
+		id = ""
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", path, rec.Code, statusCodeExpected)
+		}
+		if id != idExpected {
+			t.Fatalf("unexpected id for %s; got %q; want %q", path, id, idExpected)
+		}
+	}
+
+	f("/api/users/123", http.StatusOK, "123")
+	f("/api/users/abc", http.StatusNotFound, "")
+	f("/api/users/.*", http.StatusNotFound, "")
+	f("/api/users/[a-z]", http.StatusNotFound, "")
+}
+
+func TestRegularMatchesPathToken_NoBacktracking(t *testing.T) {
+	routeToken := "{id:^(a+)+$}"
+	requestToken := strings.Repeat("a", 1<<16) + "!"
+
+	start := time.Now()
+	matches, _ := CurlyRouter{}.regularMatchesPathToken(routeToken, strings.Index(routeToken, ":"), requestToken)
+	if matches {
+		t.Fatalf("unexpected match")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("matching took too long: %s", d)
+	}
+}
+
+func TestPrecompilePathParamRegexps(t *testing.T) {
+	if err := precompilePathParamRegexps(tokenizeTemplate("/users/{id:[0-9]+}:activate/{path:*}")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := getCachedRegexp(&regexCache, "[0-9]+"); !found {
+		t.Fatalf("expected the compiled regexp in the cache")
+	}
+	if err := precompilePathParamRegexps(tokenizeTemplate("/users/{id:[0-9+}")); err == nil {
+		t.Fatalf("expected error for invalid expression")
+	}
+}
+
+func TestSelectRoute_CustomVerbWithRegexParam(t *testing.T) {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api")
+	var got string
+	ws.Route(ws.POST("/users/{id:[0-9]+}:activate").To(func(w http.ResponseWriter, r *http.Request) {
+		got = PathParam(r, "id")
+	}))
+	container.Add(ws)
+
+	f := func(url string, statusCodeExpected int, idExpected string) {
+		t.Helper()
+		got = ""
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodPost, url, nil))
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", url, rec.Code, statusCodeExpected)
+		}
+		if got != idExpected {
+			t.Fatalf("unexpected id for %s; got %q; want %q", url, got, idExpected)
+		}
+	}
+
+	f("/api/users/123:activate", http.StatusOK, "123")
+	// the regex constraint applies to the value without the custom verb
+	f("/api/users/abc:activate", http.StatusNotFound, "")
+	// the custom verb must match
+	f("/api/users/123:deactivate", http.StatusNotFound, "")
+	f("/api/users/123", http.StatusNotFound, "")
+}
+
+func TestSelectRoutes_RegexParam(t *testing.T) {
+	ws := new(WebService)
+	ws.Path("/api")
+	ws.Route(ws.GET("/users/{id:[0-9]+}").To(mockRouteFunction))
+
+	f := func(path string, candidatesExpected int) {
+		t.Helper()
+		candidates := CurlyRouter{}.selectRoutes(ws, tokenizePath(path))
+		if len(candidates) != candidatesExpected {
+			t.Fatalf("unexpected number of candidates for %s; got %d; want %d", path, len(candidates), candidatesExpected)
+		}
+	}
+
+	f("/api/users/123", 1)
+	f("/api/users/abc", 0)
+	// the expression must match the whole path segment
+	f("/api/users/abc1", 0)
+	f("/api/users/1a", 0)
+}
+
+func TestDispatch_PreserveEncodedPathParams(t *testing.T) {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api")
+	var got, gotPath string
+	ws.Route(ws.GET("/users/{name}/files/{path:*}").To(func(w http.ResponseWriter, r *http.Request) {
+		got = PathParam(r, "name")
+		gotPath = PathParam(r, "path")
+	}))
+	container.Add(ws)
+
+	f := func(url string, statusCodeExpected int, nameExpected, pathExpected string) {
+		t.Helper()
+		got, gotPath = "", ""
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status for %s; got %d; want %d", url, rec.Code, statusCodeExpected)
+		}
+		if got != nameExpected || gotPath != pathExpected {
+			t.Fatalf("unexpected path params for %s; got %q, %q; want %q, %q", url, got, gotPath, nameExpected, pathExpected)
+		}
+	}
+
+	// mixed-case values are never normalized
+	f("/api/users/John%20DOE/files/A%2Fb/C.txt", http.StatusOK, "John DOE", "A%2Fb/C.txt")
+
+	container.PreserveEncodedPathParams(true)
+	f("/api/users/John%20DOE/files/A%2Fb/C%2e.txt", http.StatusOK, "John%20DOE", "A%2Fb/C%2e.txt")
+	// encoded slashes are still rejected in single segment parameters
+	f("/api/users/a%2Fb/files/c", http.StatusBadRequest, "", "")
+}
+
+func FuzzMatchesRouteByPathTokens(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"/users/{id}", "/users/123"},
+		{"/users/{userId}/posts/{postId}", "/users/1/posts/2"},
+		{"/api/v1/users/{userId}", "/api/v1/users/999/profile"},
+		{"/api/v1/users", "/api/v1/users"},
+		{"/search/hello world", "/search/hello world"},
+		{"/search/hello%20world", "/search/hello world"},
+		{"/docs/über", "/docs/über"},
+		{"/files/test.file", "/files/test.file"},
+		{"/api/what?", "/api/what?"},
+		{"/users/{name}", "/users/John Doe"},
+		{"/{id}", "/a"},
+		{"", "/"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, template, path string) {
+		pe, err := newPathExpression(template)
+		if err != nil {
+			return
+		}
+		// The regexp is built from the template tokens, so it must accept every request path accepted by the token matcher.
+		// Only literals and plain parameters are checked, since the expressions of regex parameters are matched
+		// against decoded tokens, while the regexp is matched against the escaped path.
+		// Empty segments are matched only by the tokens, since the regexp skips them.
+		routeTokens := pe.tokens
+		for _, token := range routeTokens {
+			if token == "" || strings.ContainsAny(token, ":}") || (strings.Contains(token, "{") && !strings.HasPrefix(token, "{")) {
+				return
+			}
+		}
+		requestTokens := tokenizePath(path)
+		escapedTokens := make([]string, len(requestTokens))
+		for i, token := range requestTokens {
+			if token == "" {
+				return
+			}
+			escapedTokens[i] = url.PathEscape(token)
+		}
+		escapedPath := "/" + strings.Join(escapedTokens, "/")
+
+		matches, _, _ := CurlyRouter{}.matchesRouteByPathTokens(routeTokens, requestTokens, false)
+		if !matches {
+			return
+		}
+		if !pe.Matcher.MatchString(escapedPath) {
+			t.Fatalf("the token matcher accepts %q for template %q, while the regexp %q doesn't", escapedPath, template, pe.Source)
+		}
+	})
+}
+
+// TestCurlyRouter_ExtractParametersRoundTrip verifies on random route sets and request paths that the path parameters
+// extracted for the selected route reconstruct the request path when they are substituted back into the route template.
+func TestCurlyRouter_ExtractParametersRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	pick := func(a []string) string {
+		return a[rng.IntN(len(a))]
+	}
+	literals := []string{"users", "orders", "v1", "files", "a b", "über", "x.y", "a+b", "name@host"}
+	values := []string{"1", "42", "alice", "John Doe", "€", "a+b", "x.y", "100%", "users", "v1"}
+
+	// randomTemplate returns a route template with literals and parameters of all kinds
+	randomTemplate := func() string {
+		var segments []string
+		n := 1 + rng.IntN(4)
+		for i := 0; i < n; i++ {
+			switch rng.IntN(4) {
+			case 0, 1:
+				segments = append(segments, pick(literals))
+			case 2:
+				segments = append(segments, fmt.Sprintf("{p%d}", i))
+			case 3:
+				segments = append(segments, fmt.Sprintf("{n%d:[0-9]+}", i))
+			}
+		}
+		if rng.IntN(4) == 0 {
+			segments = append(segments, "{rest:*}")
+		}
+		return "/" + strings.Join(segments, "/")
+	}
+
+	// randomPath returns the decoded segments of a request path for the given template
+	randomPath := func(template string) []string {
+		var segments []string
+		for _, token := range tokenizeTemplate(template) {
+			switch {
+			case token == "{rest:*}":
+				for j := rng.IntN(3); j >= 0; j-- {
+					segments = append(segments, pick(values))
+				}
+			case strings.HasSuffix(token, ":[0-9]+}"):
+				segments = append(segments, fmt.Sprintf("%d", rng.IntN(1000)))
+			case strings.HasPrefix(token, "{"):
+				segments = append(segments, pick(values))
+			default:
+				segments = append(segments, token)
+			}
+		}
+		return segments
+	}
+
+	// substitute returns the decoded segments of the template with the parameters replaced by their values
+	substitute := func(template string, params map[string]string) []string {
+		var segments []string
+		for _, token := range tokenizeTemplate(template) {
+			if !strings.HasPrefix(token, "{") {
+				segments = append(segments, token)
+				continue
+			}
+			name := strings.Trim(token, "{}")
+			if n := strings.Index(name, ":"); n >= 0 {
+				name = name[:n]
+			}
+			value := params[name]
+			if token == "{rest:*}" {
+				segments = append(segments, strings.Split(value, "/")...)
+				continue
+			}
+			segments = append(segments, value)
+		}
+		return segments
+	}
+
+	for i := 0; i < 1000; i++ {
+		ws := new(WebService).Path("/")
+		templates := make(map[string]bool)
+		for j := 1 + rng.IntN(5); j > 0; j-- {
+			template := randomTemplate()
+			if templates[template] {
+				continue
+			}
+			templates[template] = true
+			ws.Route(ws.GET(template).To(mockRouteFunction))
+		}
+		c := NewContainer()
+		c.Add(ws)
+
+		var segments []string
+		if rng.IntN(4) == 0 {
+			// a path, which may not match any route
+			segments = randomPath(randomTemplate())
+		} else {
+			segments = randomPath(ws.routes[rng.IntN(len(ws.routes))].Path)
+		}
+		escaped := make([]string, len(segments))
+		for j, s := range segments {
+			escaped[j] = url.PathEscape(s)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/"+strings.Join(escaped, "/"), nil)
+
+		_, route, err := CurlyRouter{}.SelectRoute(c.RegisteredWebServices(), req)
+		if err != nil {
+			continue
+		}
+		params, err := CurlyRouter{}.ExtractParameters(route, ws, req.URL.EscapedPath())
+		if err != nil {
+			t.Fatalf("cannot extract parameters of route %q for %q: %v", route.Path, req.URL.EscapedPath(), err)
+		}
+		got := substitute(route.Path, params)
+		if !reflect.DeepEqual(got, segments) {
+			t.Fatalf("the parameters %v of route %q don't reconstruct %q; got %q; routes: %v",
+				params, route.Path, req.URL.EscapedPath(), got, templates)
+		}
+	}
+}
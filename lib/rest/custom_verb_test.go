@@ -14,6 +14,12 @@ func TestIsMatchCustomVerb(t *testing.T) {
 		{
 			"user:show", "user:show", true,
 		},
+		{
+			"{id:[0-9]+}:activate", "123:activate", true,
+		},
+		{
+			"{id:[0-9]+}:activate", "123:deactivate", false,
+		},
 	}
 
 	for _, c := range cases {
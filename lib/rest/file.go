@@ -2,8 +2,10 @@ package rest
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"lcp.io/lcp/lib/runtime"
 )
@@ -29,3 +31,18 @@ func writeFileResponse(w http.ResponseWriter, statusCode int, fr *FileResponse)
 	w.WriteHeader(statusCode)
 	_, _ = w.Write(fr.Data)
 }
+
+// ServeContent replies to r with the content, supporting Range requests with resume.
+//
+// It works like http.ServeContent: single ranges are answered with 206 Partial Content and Content-Range,
+// multiple ranges with a multipart/byteranges body, and Accept-Ranges, If-Range and conditional
+// headers are handled. name is used for detecting the Content-Type if it isn't set yet.
+//
+// The response is never compressed by the gzip handler of the http server, since byte ranges
+// of the compressed and the uncompressed representation differ; served artifacts are usually compressed already.
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	h := w.Header()
+	h.Set(HEADER_NoCompression, "1")
+	h.Set(HEADER_AcceptRanges, "bytes")
+	http.ServeContent(w, r, name, modtime, content)
+}
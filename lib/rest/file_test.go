@@ -2,9 +2,14 @@ package rest
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzhttp"
 
 	"lcp.io/lcp/lib/runtime"
 )
@@ -37,3 +42,69 @@ func TestHandle_FileResponse(t *testing.T) {
 		t.Fatalf("unexpected body: %s", rec.Body.String())
 	}
 }
+
+func TestServeContent(t *testing.T) {
+	content := strings.Repeat("0123456789", 1024)
+	handler := gzhttp.GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeContent(w, r, "artifact.txt", time.Unix(1700000000, 0), strings.NewReader(content))
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	f := func(rangeHeader string, statusCodeExpected int, contentRangeExpected, bodyExpected string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		// disable transparent decompression in order to verify the response isn't compressed
+		req.Header.Set(HEADER_AcceptEncoding, "gzip")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("cannot read response body: %v", err)
+		}
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, statusCodeExpected)
+		}
+		if ce := resp.Header.Get(HEADER_ContentEncoding); ce != "" {
+			t.Fatalf("unexpected Content-Encoding %q", ce)
+		}
+		if h := resp.Header.Get(HEADER_NoCompression); h != "" {
+			t.Fatalf("unexpected %s header in the response", HEADER_NoCompression)
+		}
+		if ar := resp.Header.Get(HEADER_AcceptRanges); ar != "bytes" {
+			t.Fatalf("unexpected Accept-Ranges; got %q; want %q", ar, "bytes")
+		}
+		if cr := resp.Header.Get("Content-Range"); cr != contentRangeExpected {
+			t.Fatalf("unexpected Content-Range; got %q; want %q", cr, contentRangeExpected)
+		}
+		if bodyExpected != "" && string(body) != bodyExpected {
+			t.Fatalf("unexpected body; got %q; want %q", body, bodyExpected)
+		}
+	}
+
+	f("", http.StatusOK, "", content)
+	f("bytes=10-19", http.StatusPartialContent, "bytes 10-19/10240", "0123456789")
+	f("bytes=10235-", http.StatusPartialContent, "bytes 10235-10239/10240", "56789")
+	f("bytes=20000-", http.StatusRequestedRangeNotSatisfiable, "bytes */10240", "")
+
+	// multiple ranges are returned as multipart/byteranges
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Range", "bytes=0-1,5-6")
+	rec := httptest.NewRecorder()
+	ServeContent(rec, req, "artifact.txt", time.Time{}, strings.NewReader(content))
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusPartialContent)
+	}
+	if ct := rec.Header().Get(HEADER_ContentType); !strings.HasPrefix(ct, "multipart/byteranges") {
+		t.Fatalf("unexpected Content-Type; got %q", ct)
+	}
+}
@@ -0,0 +1,15 @@
+package rest
+
+import "net/http"
+
+// FilterFunction is a middleware wrapping the handler of a route, like the ones in the filters package.
+// A filter may short-circuit the request by writing a response without calling next.
+type FilterFunction func(next http.Handler) http.Handler
+
+// applyFilters wraps h with filters, so the first filter runs first
+func applyFilters(h http.Handler, filters []FilterFunction) http.Handler {
+	for i := len(filters) - 1; i >= 0; i-- {
+		h = filters[i](h)
+	}
+	return h
+}
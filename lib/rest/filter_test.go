@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDispatch_Filters(t *testing.T) {
+	var calls []string
+	filter := func(name string, shortCircuit bool) FilterFunction {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				if shortCircuit && r.Header.Get("X-Stop") == name {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				calls = append(calls, "/"+name)
+			})
+		}
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler:"+PathParam(r, "name"))
+	}
+
+	private := new(WebService).Path("/apis/v1").
+		Filter(filter("service1", true)).
+		Filter(filter("service2", false))
+	private.Route(private.GET("/users/{name}").Filter(filter("route1", true)).Filter(filter("route2", false)).To(handler))
+	private.Route(private.GET("/groups/{name}").To(handler))
+	public := new(WebService).Path("/public")
+	public.Route(public.GET("/docs/{name}").To(handler))
+
+	c := NewContainer()
+	c.Filter(filter("container1", true))
+	c.Filter(filter("container2", false))
+	c.Add(private)
+	c.Add(public)
+
+	f := func(path, stop string, statusCodeExpected int, callsExpected string) {
+		t.Helper()
+		calls = nil
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if stop != "" {
+			req.Header.Set("X-Stop", stop)
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s; got %d; want %d", path, rec.Code, statusCodeExpected)
+		}
+		if s := strings.Join(calls, " "); s != callsExpected {
+			t.Fatalf("unexpected calls for %s;\ngot\n%s\nwant\n%s", path, s, callsExpected)
+		}
+	}
+
+	// container -> service -> route ordering
+	f("/apis/v1/users/alice", "", http.StatusOK,
+		"container1 container2 service1 service2 route1 route2 handler:alice /route2 /route1 /service2 /service1 /container2 /container1")
+	f("/apis/v1/groups/admins", "", http.StatusOK,
+		"container1 container2 service1 service2 handler:admins /service2 /service1 /container2 /container1")
+
+	// service filters don't run for the routes of other services
+	f("/public/docs/intro", "", http.StatusOK, "container1 container2 handler:intro /container2 /container1")
+
+	// short-circuit at every level
+	f("/apis/v1/users/alice", "container1", http.StatusUnauthorized, "container1")
+	f("/apis/v1/users/alice", "service1", http.StatusUnauthorized, "container1 container2 service1 /container2 /container1")
+	f("/apis/v1/users/alice", "route1", http.StatusUnauthorized,
+		"container1 container2 service1 service2 route1 /service2 /service1 /container2 /container1")
+
+	// container filters run before route selection
+	f("/apis/v1/missing", "", http.StatusNotFound, "container1 container2 /container2 /container1")
+	f("/apis/v1/missing", "container1", http.StatusUnauthorized, "container1")
+}
+
+func TestDispatch_FiltersWithErrFunction(t *testing.T) {
+	var filtered bool
+	ws := new(WebService).Path("/api").Filter(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			filtered = true
+			next.ServeHTTP(w, r)
+		})
+	})
+	ws.Route(ws.GET("/fail").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(http.StatusConflict, "409: conflict")
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/fail", nil))
+	if !filtered {
+		t.Fatalf("the service filter didn't run")
+	}
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestDispatch_ContainerFilterBeforeRouteSelection(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/items").Produces(MIME_JSON).To(func(w http.ResponseWriter, r *http.Request) {}))
+	c := NewContainer()
+	c.Add(ws)
+	c.Filter(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set(HEADER_Accept, MIME_JSON)
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// the request is routed with the Accept header set by the filter
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.Header.Set(HEADER_Accept, MIME_XML)
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusOK)
+	}
+}
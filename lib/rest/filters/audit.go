@@ -36,6 +36,37 @@ func (sw *statusWriter) Write(b []byte) (int, error) {
 	return sw.ResponseWriter.Write(b)
 }
 
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController,
+// so audited handlers can flush responses and set deadlines
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// bodyCapture records the first maxBodyCapture bytes of the request body read by the handler
+type bodyCapture struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (bc *bodyCapture) Read(p []byte) (int, error) {
+	n, err := bc.ReadCloser.Read(p)
+	captured := min(n, maxBodyCapture-bc.buf.Len())
+	if captured < n {
+		bc.truncated = true
+	}
+	bc.buf.Write(p[:captured])
+	return n, err
+}
+
+// detail returns the captured body if it is a complete JSON document
+func (bc *bodyCapture) detail() json.RawMessage {
+	if bc.truncated || bc.buf.Len() == 0 || !json.Valid(bc.buf.Bytes()) {
+		return nil
+	}
+	return bc.buf.Bytes()
+}
+
 // WithAudit returns middleware that logs API write operations (POST/PUT/PATCH/DELETE).
 func WithAudit(logger audit.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -45,24 +76,13 @@ func WithAudit(logger audit.Logger) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Capture request body before downstream consumes it.
-			// Read the full body (downstream json.Decode would do the same),
-			// restore it for the handler, and only truncate when writing to audit detail.
-			var bodyDetail json.RawMessage
+			// Capture the request body while downstream reads it instead of reading it upfront,
+			// so requests rejected by downstream (unauthorized, too big) don't transfer the body.
+			// This matters for clients sending `Expect: 100-continue`, which wait for the server to read the body.
+			var bc *bodyCapture
 			if r.Body != nil && hasRequestBody(r.Method) {
-				buf, err := io.ReadAll(r.Body)
-				if err == nil && len(buf) > 0 {
-					// Only store if it's valid JSON.
-					if json.Valid(buf) {
-						if len(buf) > maxBodyCapture {
-							bodyDetail = buf[:maxBodyCapture]
-						} else {
-							bodyDetail = buf
-						}
-					}
-				}
-				// Restore the full body so downstream handlers can read it.
-				r.Body = io.NopCloser(bytes.NewReader(buf))
+				bc = &bodyCapture{ReadCloser: r.Body}
+				r.Body = bc
 			}
 
 			_, _, verb := ResolveResourceAndVerb(r.Method, r.URL.Path)
@@ -77,7 +97,9 @@ func WithAudit(logger audit.Logger) func(http.Handler) http.Handler {
 
 			duration := time.Since(start)
 			event := buildAuditEvent(r, sw.code, duration)
-			event.Detail = bodyDetail
+			if bc != nil {
+				event.Detail = bc.detail()
+			}
 			if sw.buf.Len() > 0 {
 				respBytes := sw.buf.Bytes()
 				if len(respBytes) > maxBodyCapture {
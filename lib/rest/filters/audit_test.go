@@ -1,6 +1,7 @@
 package filters
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -52,6 +53,24 @@ func TestStatusWriter(t *testing.T) {
 	}
 }
 
+func TestResponseWriters_ResponseController(t *testing.T) {
+	f := func(name string, w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Fatalf("cannot flush %s: %v", name, err)
+		}
+		if !rec.Flushed {
+			t.Fatalf("%s must flush the underlying ResponseWriter", name)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	f("statusWriter", &statusWriter{ResponseWriter: rec}, rec)
+
+	rec = httptest.NewRecorder()
+	f("timingWriter", &timingWriter{ResponseWriter: rec}, rec)
+}
+
 func TestExtractResourceID(t *testing.T) {
 	tests := []struct {
 		path string
@@ -195,6 +214,81 @@ func TestWithAudit_ResponseBodyTruncated(t *testing.T) {
 	}
 }
 
+func TestWithAudit_RequestBody(t *testing.T) {
+	f := func(body string, readBody bool, wantDetail string) {
+		t.Helper()
+		sink := &captureSink{}
+		var bodyRead bool
+		inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !readBody {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("cannot read request body: %v", err)
+			}
+			if string(data) != body {
+				t.Fatalf("unexpected request body; got %q; want %q", data, body)
+			}
+			bodyRead = true
+			w.WriteHeader(http.StatusCreated)
+		})
+		handler := WithAudit(sink)(inner)
+
+		// the body must be read only by the handler
+		r := httptest.NewRequest("POST", "/api/iam/v1/users", io.MultiReader(strings.NewReader(body)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if readBody && !bodyRead {
+			t.Fatalf("the handler didn't read the request body")
+		}
+		if len(sink.events) != 1 {
+			t.Fatalf("expected 1 audit event, got %d", len(sink.events))
+		}
+		if detail := string(sink.events[0].Detail); detail != wantDetail {
+			t.Fatalf("unexpected Detail; got %q; want %q", detail, wantDetail)
+		}
+	}
+
+	f(`{"name":"alice"}`, true, `{"name":"alice"}`)
+
+	// the body isn't read by the rejecting handler
+	f(`{"name":"alice"}`, false, "")
+
+	// non-JSON body
+	f(`name=alice`, true, "")
+
+	// the body exceeding maxBodyCapture isn't valid JSON when truncated
+	f(`{"data":"`+strings.Repeat("x", maxBodyCapture)+`"}`, true, "")
+}
+
+func TestWithAudit_RequestBodyNotReadUpfront(t *testing.T) {
+	sink := &captureSink{}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	handler := WithAudit(sink)(inner)
+
+	r := httptest.NewRequest("POST", "/api/iam/v1/users", unreadableBody{t: t})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+// unreadableBody fails the test if the request body is read
+type unreadableBody struct {
+	t *testing.T
+}
+
+func (b unreadableBody) Read(_ []byte) (int, error) {
+	b.t.Fatalf("unexpected read of the request body")
+	return 0, io.EOF
+}
+
 func TestClientIP(t *testing.T) {
 	tests := []struct {
 		name string
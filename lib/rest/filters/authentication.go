@@ -3,9 +3,13 @@ package filters
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"lcp.io/lcp/lib/httpserver"
 	"lcp.io/lcp/lib/oidc"
+	"lcp.io/lcp/lib/rest"
 )
 
 // WithAuthentication returns middleware that validates Bearer tokens.
@@ -13,6 +17,7 @@ import (
 func WithAuthentication(provider *oidc.Provider) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				authError(w, "missing authorization header")
@@ -37,8 +42,13 @@ func WithAuthentication(provider *oidc.Provider) func(http.Handler) http.Handler
 				return
 			}
 
+			httpserver.SetPrincipal(r, strconv.FormatInt(userID, 10))
+			if !httpserver.CheckRateLimit(w, r) {
+				return
+			}
 			r = oidc.WithUserID(r, userID)
 			r = oidc.WithUsername(r, username)
+			rest.Timing(r).Measure("auth", time.Since(start))
 			next.ServeHTTP(w, r)
 		})
 	}
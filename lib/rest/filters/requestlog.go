@@ -6,10 +6,12 @@ import (
 	"lcp.io/lcp/lib/logger"
 )
 
-// WithRequestLog logs each incoming request URI.
+// WithRequestLog logs each incoming request URI at DEBUG level.
 func WithRequestLog(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Infof("%s %s", r.Method, r.RequestURI)
+		if logger.IsDebugEnabled() {
+			logger.Debugf("%s %s", r.Method, r.RequestURI)
+		}
 		handler.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,74 @@
+package filters
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"lcp.io/lcp/lib/rest"
+)
+
+var serverTiming = flag.Bool("http.serverTiming", false, "Whether to send 'Server-Timing' response header with the durations of API request processing phases "+
+	"such as auth, routing and serialization, which are shown by browser devtools. It is disabled by default, since it exposes internal timing to clients")
+
+// WithServerTiming writes the durations recorded via rest.Timing into the Server-Timing response header if -http.serverTiming is set.
+//
+// The header is written together with the response headers, so it contains the phases completed before the response is started
+// and the "total" time elapsed until then. It must be the first filter in order to measure the rest of filters.
+func WithServerTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !*serverTiming {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = rest.WithTiming(r)
+		tw := &timingWriter{
+			ResponseWriter: w,
+			tr:             rest.Timing(r),
+			start:          time.Now(),
+		}
+		next.ServeHTTP(tw, r)
+		// the handler hasn't written the response, so net/http sends the headers after the handler returns
+		tw.writeTimingHeader()
+	})
+}
+
+// timingWriter sets Server-Timing header before the response headers are sent
+type timingWriter struct {
+	http.ResponseWriter
+	tr          *rest.TimingRecorder
+	start       time.Time
+	wroteHeader bool
+}
+
+func (tw *timingWriter) writeTimingHeader() {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.tr.Measure("total", time.Since(tw.start))
+	tw.Header().Set("Server-Timing", tw.tr.HeaderValue())
+}
+
+func (tw *timingWriter) WriteHeader(code int) {
+	if code >= http.StatusOK || code == http.StatusSwitchingProtocols {
+		// informational responses such as 103 Early Hints are followed by the final response
+		tw.writeTimingHeader()
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	tw.writeTimingHeader()
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timingWriter) Flush() {
+	tw.writeTimingHeader()
+	_ = http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
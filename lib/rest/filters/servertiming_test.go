@@ -0,0 +1,67 @@
+package filters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"lcp.io/lcp/lib/rest"
+)
+
+func TestWithServerTiming(t *testing.T) {
+	defer func(v bool) {
+		*serverTiming = v
+	}(*serverTiming)
+
+	ws := new(rest.WebService).Path("/api")
+	ws.Route(ws.GET("/users").To(func(w http.ResponseWriter, r *http.Request) {
+		rest.Timing(r).Measure("db", 0)
+		_ = rest.ResponseEncoder(w, r)([]string{"alice"})
+	}))
+	ws.Route(ws.DELETE("/users").To(func(w http.ResponseWriter, r *http.Request) {
+		// the response is written by net/http after the handler returns
+		rest.Timing(r).Mark("handler")
+	}))
+	ws.Route(ws.GET("/stream").To(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Errorf("the response writer must support http.Flusher")
+		}
+		w.(http.Flusher).Flush()
+		rest.Timing(r).Mark("stream")
+	}))
+	c := rest.NewContainer()
+	c.Filter(WithServerTiming)
+	c.Add(ws)
+
+	f := func(method, path string, headerExpected string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, httptest.NewRequest(method, path, nil))
+		v := rec.Result().Header.Get("Server-Timing")
+		if headerExpected == "" {
+			if v != "" {
+				t.Fatalf("unexpected Server-Timing header for %s %s: %q", method, path, v)
+			}
+			return
+		}
+		if !regexp.MustCompile("^" + headerExpected + "$").MatchString(v) {
+			t.Fatalf("unexpected Server-Timing header for %s %s; got %q; want %q", method, path, v, headerExpected)
+		}
+	}
+
+	const dur = `;dur=[0-9.]+`
+
+	*serverTiming = false
+	f(http.MethodGet, "/api/users", "")
+
+	*serverTiming = true
+	f(http.MethodGet, "/api/users", "routing"+dur+", db"+dur+", serialization"+dur+", total"+dur)
+	f(http.MethodDelete, "/api/users", "routing"+dur+", handler"+dur+", total"+dur)
+
+	// phases completed after the response headers are sent are dropped
+	f(http.MethodGet, "/api/stream", "routing"+dur+", total"+dur)
+
+	// responses written before routing
+	f(http.MethodGet, "/api/missing", "total"+dur)
+}
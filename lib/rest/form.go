@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+)
+
+// ReadForm parses the url-encoded or multipart form in the request body and decodes it into v,
+// which must be a pointer to a struct. Fields are mapped by their `form:"name"` tag; fields without
+// the tag use the field name, fields tagged with `form:"-"` are skipped.
+//
+// Supported field types are string, bool, ints, uints, floats and slices of them for repeated values.
+// Only the body form is decoded; query parameters are available via QueryParam.
+// Routes reading the body with ReadForm should declare Consumes(MIME_FORM, MIME_MULTIPART_FORM).
+//
+// Decoding failures are returned as 400 Bad Request (*apierrors.StatusError)
+func ReadForm(r *http.Request, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ReadForm: v must be a non-nil pointer to a struct; got %T", v)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(HEADER_ContentType))
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("cannot parse Content-Type: %v", err), nil)
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(nil, r.Body, requestBodyLimit(r))
+	}
+	switch mediaType {
+	case MIME_FORM:
+		if err := r.ParseForm(); err != nil {
+			return newBodyReadError(r, err, fmt.Sprintf("cannot parse form: %v", err))
+		}
+	case MIME_MULTIPART_FORM:
+		if err := r.ParseMultipartForm(requestBodyLimit(r)); err != nil {
+			return newBodyReadError(r, err, fmt.Sprintf("cannot parse multipart form: %v", err))
+		}
+	default:
+		return apierrors.NewBadRequest(fmt.Sprintf("unsupported Content-Type: %s", mediaType), nil)
+	}
+
+	if err := decodeForm(r.PostForm, rv.Elem()); err != nil {
+		return apierrors.NewBadRequest(err.Error(), nil)
+	}
+	return nil
+}
+
+// decodeForm sets the fields of the struct sv from the form values
+func decodeForm(form url.Values, sv reflect.Value) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("form"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		values, ok := form[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		fv := sv.Field(i)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for j, s := range values {
+				if err := setFormValue(slice.Index(j), s); err != nil {
+					return fmt.Errorf("invalid value %q for form field %q: %w", s, name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setFormValue(fv, values[0]); err != nil {
+			return fmt.Errorf("invalid value %q for form field %q: %w", values[0], name, err)
+		}
+	}
+	return nil
+}
+
+// setFormValue converts s to the type of fv and stores it in fv
+func setFormValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+)
+
+type formObj struct {
+	Name     string   `form:"name"`
+	Replicas int      `form:"replicas"`
+	Enabled  bool     `form:"enabled"`
+	Ratio    float64  `form:"ratio"`
+	Tags     []string `form:"tag"`
+	Ports    []uint16 `form:"port"`
+	Limit    *int     `form:"limit"`
+	Ignored  string   `form:"-"`
+	Untagged string
+}
+
+func TestReadForm(t *testing.T) {
+	f := func(req *http.Request, want formObj) {
+		t.Helper()
+		var got formObj
+		if err := ReadForm(req, &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result;\ngot\n%+v\nwant\n%+v", got, want)
+		}
+	}
+
+	limit := 5
+	want := formObj{
+		Name:     "web",
+		Replicas: 3,
+		Enabled:  true,
+		Ratio:    0.5,
+		Tags:     []string{"a", "b"},
+		Ports:    []uint16{80, 443},
+		Limit:    &limit,
+		Untagged: "x",
+	}
+
+	body := "name=web&replicas=3&enabled=true&ratio=0.5&tag=a&tag=b&port=80&port=443&limit=5&Ignored=y&Untagged=x"
+	req := httptest.NewRequest(http.MethodPost, "/?name=query", strings.NewReader(body))
+	req.Header.Set(HEADER_ContentType, MIME_FORM+"; charset=utf-8")
+	f(req, want)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, kv := range [][2]string{
+		{"name", "web"}, {"replicas", "3"}, {"enabled", "true"}, {"ratio", "0.5"}, {"tag", "a"}, {"tag", "b"},
+		{"port", "80"}, {"port", "443"}, {"limit", "5"}, {"Untagged", "x"},
+	} {
+		if err := mw.WriteField(kv[0], kv[1]); err != nil {
+			t.Fatalf("cannot write multipart field: %v", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("cannot close multipart writer: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set(HEADER_ContentType, mw.FormDataContentType())
+	f(req, want)
+
+	// missing fields are left untouched
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("name=web"))
+	req.Header.Set(HEADER_ContentType, MIME_FORM)
+	f(req, formObj{Name: "web"})
+}
+
+func TestReadForm_Failure(t *testing.T) {
+	f := func(contentType, body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(HEADER_ContentType, contentType)
+		err := ReadForm(req, &formObj{})
+		if se, ok := err.(*apierrors.StatusError); !ok || se.Status != http.StatusBadRequest {
+			t.Fatalf("expected 400 StatusError; got %v", err)
+		}
+	}
+
+	f(MIME_FORM, "replicas=many")
+	f(MIME_FORM, "enabled=maybe")
+	f(MIME_FORM, "port=80&port=70000")
+	f(MIME_FORM, "ratio=half")
+	f(MIME_JSON, `{"name":"web"}`)
+	f("", "name=web")
+
+	if err := ReadForm(httptest.NewRequest(http.MethodPost, "/", nil), formObj{}); err == nil {
+		t.Fatalf("expected error for non-pointer value")
+	}
+}
+
+func TestDispatch_ReadForm(t *testing.T) {
+	ws := new(WebService)
+	ws.Route(ws.POST("/hooks").Consumes(MIME_FORM, MIME_MULTIPART_FORM).To(func(w http.ResponseWriter, r *http.Request) {
+		var obj formObj
+		if err := ReadForm(r, &obj); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(obj.Name))
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(contentType string, wantCode int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader("name=web"))
+		req.Header.Set(HEADER_ContentType, contentType)
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %q; got %d; want %d", contentType, rec.Code, wantCode)
+		}
+	}
+
+	f(MIME_FORM, http.StatusOK)
+	f(MIME_JSON, http.StatusUnsupportedMediaType)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 
 	"lcp.io/lcp/lib/runtime"
@@ -18,7 +19,8 @@ func handleError(ns runtime.NegotiatedSerializer, err error, w http.ResponseWrit
 // HandlerFunc is the unified function signature for all request handlers.
 type HandlerFunc func(ctx context.Context, params map[string]string, body []byte) (runtime.Object, error)
 
-// maxRequestBodySize is the maximum allowed request body size (1 MB).
+// maxRequestBodySize is the default maximum request body size (1 MB).
+// It can be overridden via Container.DefaultMaxBodyBytes and per route via RouteBuilder.MaxBodyBytes.
 const maxRequestBodySize = 1 << 20
 
 // Handle returns an http.HandlerFunc that:
@@ -33,11 +35,11 @@ func Handle(ns runtime.NegotiatedSerializer, statusCode int, fn HandlerFunc) htt
 
 		var body []byte
 		if req.Body != nil && req.ContentLength != 0 {
-			req.Body = http.MaxBytesReader(w, req.Body, maxRequestBodySize)
+			req.Body = http.MaxBytesReader(w, req.Body, requestBodyLimit(req))
 			var err error
 			body, err = io.ReadAll(req.Body)
 			if err != nil {
-				handleError(ns, err, w, req)
+				handleError(ns, newBodyReadError(req, err, fmt.Sprintf("cannot read request body: %v", err)), w, req)
 				return
 			}
 			defer func(Body io.ReadCloser) {
@@ -70,11 +72,11 @@ func HandleWithAPIVersion(ns runtime.NegotiatedSerializer, statusCode int, fn Ha
 
 		var body []byte
 		if req.Body != nil && req.ContentLength != 0 {
-			req.Body = http.MaxBytesReader(w, req.Body, maxRequestBodySize)
+			req.Body = http.MaxBytesReader(w, req.Body, requestBodyLimit(req))
 			var err error
 			body, err = io.ReadAll(req.Body)
 			if err != nil {
-				handleError(ns, err, w, req)
+				handleError(ns, newBodyReadError(req, err, fmt.Sprintf("cannot read request body: %v", err)), w, req)
 				return
 			}
 			defer func(Body io.ReadCloser) {
@@ -112,11 +114,11 @@ func HandleAction(ns runtime.NegotiatedSerializer, statusCode int, fn HandlerFun
 
 		var body []byte
 		if req.Body != nil && req.ContentLength != 0 {
-			req.Body = http.MaxBytesReader(w, req.Body, maxRequestBodySize)
+			req.Body = http.MaxBytesReader(w, req.Body, requestBodyLimit(req))
 			var err error
 			body, err = io.ReadAll(req.Body)
 			if err != nil {
-				handleError(ns, err, w, req)
+				handleError(ns, newBodyReadError(req, err, fmt.Sprintf("cannot read request body: %v", err)), w, req)
 				return
 			}
 			defer func(Body io.ReadCloser) {
@@ -154,7 +156,7 @@ func transformResponseObject(
 	WriteObjectNegotiated(ns, w, req, statusCode, result)
 }
 
-// readBody reads the full request body with a size limit.
+// readBody reads the full request body up to requestBodyLimit(req)+1 bytes, so callers can detect oversized bodies.
 func readBody(req *http.Request) ([]byte, error) {
 	if req.Body == nil {
 		return nil, nil
@@ -162,7 +164,11 @@ func readBody(req *http.Request) ([]byte, error) {
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(req.Body)
-	return io.ReadAll(io.LimitReader(req.Body, maxRequestBodySize+1))
+	limit := requestBodyLimit(req)
+	if limit == math.MaxInt64 {
+		return io.ReadAll(req.Body)
+	}
+	return io.ReadAll(io.LimitReader(req.Body, limit+1))
 }
 
 // jsonUnmarshal is a thin wrapper to avoid importing encoding/json in installer.go.
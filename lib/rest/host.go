@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// hostPattern is a compiled host pattern of a WebService, e.g. "tenant-a.lcp.io", "*.lcp.io" or "{tenant}.lcp.io".
+// The "*" label matches exactly one label of the request host, like in TLS certificates.
+// The "{name}" label matches one label as well and captures it into the name parameter.
+type hostPattern struct {
+	pattern string
+	labels  []string
+	// vars holds the parameter name for "{name}" labels and an empty string for the other labels
+	vars []string
+}
+
+func newHostPattern(pattern string) (*hostPattern, error) {
+	pattern = strings.TrimSuffix(pattern, ".")
+	if pattern == "" {
+		return nil, fmt.Errorf("host pattern cannot be empty")
+	}
+	labels := strings.Split(pattern, ".")
+	vars := make([]string, len(labels))
+	hasVars := false
+	for i, label := range labels {
+		if label == "" {
+			return nil, fmt.Errorf("host pattern %q contains an empty label", pattern)
+		}
+		if strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}") {
+			name := label[1 : len(label)-1]
+			if name == "" || strings.ContainsAny(name, "{}*/:") {
+				return nil, fmt.Errorf("host pattern %q contains an invalid parameter %q", pattern, label)
+			}
+			for _, v := range vars[:i] {
+				if v == name {
+					return nil, fmt.Errorf("host pattern %q contains duplicate parameter %q", pattern, name)
+				}
+			}
+			vars[i] = name
+			hasVars = true
+			continue
+		}
+		if label != "*" && strings.ContainsAny(label, "{}*/:") {
+			return nil, fmt.Errorf("host pattern %q contains an invalid label %q", pattern, label)
+		}
+		labels[i] = strings.ToLower(label)
+	}
+	if !hasVars {
+		vars = nil
+	}
+	return &hostPattern{
+		pattern: strings.Join(labels, "."),
+		labels:  labels,
+		vars:    vars,
+	}, nil
+}
+
+// isWildcard returns whether the i-th label of hp matches any request label
+func (hp *hostPattern) isWildcard(i int) bool {
+	return hp.labels[i] == "*" || (hp.vars != nil && hp.vars[i] != "")
+}
+
+// match returns whether the request host matches hp and the score of the match,
+// which is higher for patterns with more literal labels, so "tenant-a.lcp.io" is preferred over "*.lcp.io"
+func (hp *hostPattern) match(host string) (bool, int) {
+	labels := strings.Split(host, ".")
+	if len(labels) != len(hp.labels) {
+		return false, 0
+	}
+	score := 1
+	for i, label := range hp.labels {
+		if hp.isWildcard(i) {
+			continue
+		}
+		if label != labels[i] {
+			return false, 0
+		}
+		score++
+	}
+	return true, score
+}
+
+// params returns the parameters captured by "{name}" labels of hp from the request host matching hp
+func (hp *hostPattern) params(host string) map[string]string {
+	if hp.vars == nil {
+		return nil
+	}
+	labels := strings.Split(host, ".")
+	params := make(map[string]string)
+	for i, name := range hp.vars {
+		if name != "" {
+			params[name] = labels[i]
+		}
+	}
+	return params
+}
+
+// requestHost returns the host of the Host header value without port and trailing dot, lower-cased
+func requestHost(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,206 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewHostPattern_Failure(t *testing.T) {
+	f := func(pattern string) {
+		t.Helper()
+		if _, err := newHostPattern(pattern); err == nil {
+			t.Fatalf("expecting non-nil error for %q", pattern)
+		}
+	}
+
+	f("")
+	f(".")
+	f("lcp..io")
+	f(".lcp.io")
+	f("tenant*.lcp.io")
+	f("lcp.io:8080")
+	f("lcp.io/api")
+	f("{}.lcp.io")
+	f("api-{tenant}.lcp.io")
+	f("{tenant.lcp.io")
+	f("{tenant}.{tenant}.lcp.io")
+}
+
+func TestHostPattern_Match(t *testing.T) {
+	f := func(pattern, host string, matchesExpected bool, scoreExpected int) {
+		t.Helper()
+		hp, err := newHostPattern(pattern)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", pattern, err)
+		}
+		matches, score := hp.match(requestHost(host))
+		if matches != matchesExpected {
+			t.Fatalf("unexpected match of %q for host %q; got %v; want %v", pattern, host, matches, matchesExpected)
+		}
+		if score != scoreExpected {
+			t.Fatalf("unexpected score of %q for host %q; got %d; want %d", pattern, host, score, scoreExpected)
+		}
+	}
+
+	f("tenant-a.lcp.io", "tenant-a.lcp.io", true, 4)
+	f("tenant-a.lcp.io", "Tenant-A.LCP.io:8443", true, 4)
+	f("tenant-a.lcp.io.", "tenant-a.lcp.io.", true, 4)
+	f("TENANT-A.lcp.io", "tenant-a.lcp.io", true, 4)
+	f("*.lcp.io", "tenant-a.lcp.io", true, 3)
+	f("*.lcp.io", "tenant-b.lcp.io:80", true, 3)
+	f("*.*.io", "tenant-b.lcp.io", true, 2)
+	f("{tenant}.lcp.io", "tenant-b.lcp.io", true, 3)
+
+	f("tenant-a.lcp.io", "tenant-b.lcp.io", false, 0)
+	f("*.lcp.io", "lcp.io", false, 0)
+	f("*.lcp.io", "a.tenant.lcp.io", false, 0)
+	f("*.lcp.io", "tenant-a.lcp.com", false, 0)
+	f("lcp.io", "", false, 0)
+	f("{tenant}.lcp.io", "lcp.io", false, 0)
+}
+
+func TestHostPattern_Params(t *testing.T) {
+	f := func(pattern, host string, paramsExpected map[string]string) {
+		t.Helper()
+		hp, err := newHostPattern(pattern)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", pattern, err)
+		}
+		host = requestHost(host)
+		if ok, _ := hp.match(host); !ok {
+			t.Fatalf("pattern %q must match host %q", pattern, host)
+		}
+		params := hp.params(host)
+		if !reflect.DeepEqual(params, paramsExpected) {
+			t.Fatalf("unexpected params of %q for host %q; got %v; want %v", pattern, host, params, paramsExpected)
+		}
+	}
+
+	f("tenant-a.lcp.io", "tenant-a.lcp.io", nil)
+	f("*.lcp.io", "tenant-a.lcp.io", nil)
+	f("{tenant}.lcp.io", "Tenant-A.lcp.io:8443", map[string]string{"tenant": "tenant-a"})
+	f("{tenantID}.{region}.LCP.io", "t1.eu.lcp.io", map[string]string{"tenantID": "t1", "region": "eu"})
+	f("{tenant}.*.lcp.io", "t1.eu.lcp.io", map[string]string{"tenant": "t1"})
+}
+
+func TestDispatch_HostParams(t *testing.T) {
+	var params map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		params = PathParams(r)
+	}
+	tenants := new(WebService).Path("/api").Host("{tenant}.lcp.io")
+	tenants.Route(tenants.GET("/users/{id}").To(handler))
+	tenants.Route(tenants.GET("/tenants/{tenant}").To(handler))
+	tenants.Route(tenants.GET("/info").To(handler))
+	regions := new(WebService).Path("/api").Host("{tenant}.{region}.lcp.io")
+	regions.Route(regions.GET("/info").To(handler))
+	admin := new(WebService).Path("/api").Host("admin.lcp.io")
+	admin.Route(admin.GET("/info").To(handler))
+
+	c := NewContainer()
+	c.Add(tenants)
+	c.Add(regions)
+	c.Add(admin)
+
+	f := func(host, path string, paramsExpected map[string]string) {
+		t.Helper()
+		params = nil
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status code for %s%s; got %d; want %d", host, path, rec.Code, http.StatusOK)
+		}
+		if !reflect.DeepEqual(params, paramsExpected) {
+			t.Fatalf("unexpected params for %s%s; got %v; want %v", host, path, params, paramsExpected)
+		}
+	}
+
+	f("acme.lcp.io", "/api/info", map[string]string{"tenant": "acme"})
+	f("ACME.lcp.io:8443", "/api/users/42", map[string]string{"tenant": "acme", "id": "42"})
+	f("acme.eu.lcp.io", "/api/info", map[string]string{"tenant": "acme", "region": "eu"})
+
+	// path params take precedence over host params with the same name
+	f("acme.lcp.io", "/api/tenants/other", map[string]string{"tenant": "other"})
+
+	// literal hosts are preferred over host params
+	f("admin.lcp.io", "/api/info", map[string]string{})
+}
+
+func TestDispatch_HostRouting(t *testing.T) {
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	tenantA := new(WebService).Path("/api").Host("tenant-a.lcp.io")
+	tenantA.Route(tenantA.GET("/info").To(handler("tenant-a")))
+	tenants := new(WebService).Path("/api").Host("*.lcp.io")
+	tenants.Route(tenants.GET("/info").To(handler("tenants")))
+	tenants.Route(tenants.GET("/tenants-only").To(handler("tenants-only")))
+	any := new(WebService).Path("/api")
+	any.Route(any.GET("/info").To(handler("any")))
+	public := new(WebService).Path("/public")
+	public.Route(public.GET("/docs").To(handler("public")))
+
+	c := NewContainer()
+	c.Add(any)
+	c.Add(tenants)
+	c.Add(tenantA)
+	c.Add(public)
+
+	f := func(host, path string, statusCodeExpected int, bodyExpected string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s%s; got %d; want %d", host, path, rec.Code, statusCodeExpected)
+		}
+		if body := rec.Body.String(); statusCodeExpected == http.StatusOK && body != bodyExpected {
+			t.Fatalf("unexpected body for %s%s; got %q; want %q", host, path, body, bodyExpected)
+		}
+	}
+
+	// the most specific host wins
+	f("tenant-a.lcp.io", "/api/info", http.StatusOK, "tenant-a")
+	f("tenant-a.lcp.io:8443", "/api/info", http.StatusOK, "tenant-a")
+	f("tenant-b.lcp.io", "/api/info", http.StatusOK, "tenants")
+	f("lcp.io", "/api/info", http.StatusOK, "any")
+	f("", "/api/info", http.StatusOK, "any")
+
+	// WebServices without host serve all the hosts
+	f("tenant-a.lcp.io", "/public/docs", http.StatusOK, "public")
+	f("example.com", "/public/docs", http.StatusOK, "public")
+
+	// the route is looked up in the selected WebService only
+	f("tenant-a.lcp.io", "/api/tenants-only", http.StatusNotFound, "")
+	f("tenant-b.lcp.io", "/api/tenants-only", http.StatusOK, "tenants-only")
+	f("lcp.io", "/api/tenants-only", http.StatusNotFound, "")
+
+	var sb strings.Builder
+	if err := c.DumpRoutes(&sb); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `GET /api/info consumes=*/* produces=*/*
+GET /api/info consumes=*/* produces=*/* host=*.lcp.io
+GET /api/info consumes=*/* produces=*/* host=tenant-a.lcp.io
+GET /api/tenants-only consumes=*/* produces=*/* host=*.lcp.io
+GET /public/docs consumes=*/* produces=*/*
+`
+	if got := sb.String(); got != want {
+		t.Fatalf("unexpected routes;\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	// WebServices are removed by root path and host
+	if err := c.Remove(new(WebService).Path("/api").Host("tenant-a.lcp.io")); err != nil {
+		t.Fatalf("cannot remove WebService: %v", err)
+	}
+	f("tenant-a.lcp.io", "/api/info", http.StatusOK, "tenants")
+	f("lcp.io", "/api/info", http.StatusOK, "any")
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PreferredLanguage returns the best match from supported for the Accept-Language header of r.
+//
+// Language ranges are matched case-insensitively according to their q-values, ties are resolved
+// by the order in the header. A range matches a supported tag with the same primary language
+// if there is no exact match, e.g. en matches en-US and en-GB matches en.
+// The first supported language is returned if the header is missing or nothing matches.
+// An empty string is returned if supported is empty.
+//
+// It doesn't affect route selection; handlers may use it for localizing responses and error messages.
+func PreferredLanguage(r *http.Request, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+	best := ""
+	bestQuality := 0.0
+	remaining := r.Header.Get(HEADER_AcceptLanguage)
+	for len(remaining) > 0 {
+		var languageRange string
+		languageRange, remaining, _ = strings.Cut(remaining, ",")
+		tag, quality := parseLanguageRange(languageRange)
+		if tag == "" || quality <= bestQuality {
+			continue
+		}
+		if match := matchLanguage(tag, supported); match != "" {
+			best = match
+			bestQuality = quality
+		}
+	}
+	if best == "" {
+		return supported[0]
+	}
+	return best
+}
+
+// parseLanguageRange parses a single Accept-Language entry such as "en-US;q=0.8"
+func parseLanguageRange(s string) (tag string, quality float64) {
+	tag, params, _ := strings.Cut(s, ";")
+	tag = strings.TrimSpace(tag)
+	quality = 1
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.TrimSpace(name) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return "", 0
+		}
+		quality = q
+	}
+	return tag, quality
+}
+
+// matchLanguage returns the supported language matching tag or an empty string
+func matchLanguage(tag string, supported []string) string {
+	if tag == "*" {
+		return supported[0]
+	}
+	for _, s := range supported {
+		if strings.EqualFold(s, tag) {
+			return s
+		}
+	}
+	primary, _, _ := strings.Cut(tag, "-")
+	for _, s := range supported {
+		sPrimary, _, _ := strings.Cut(s, "-")
+		if strings.EqualFold(sPrimary, primary) {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	supported := []string{"en-US", "zh-CN", "de"}
+
+	f := func(acceptLanguage, expected string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/", nil)
+		if acceptLanguage != "" {
+			r.Header.Set(HEADER_AcceptLanguage, acceptLanguage)
+		}
+		if got := PreferredLanguage(r, supported); got != expected {
+			t.Fatalf("unexpected language for %q; got %q; want %q", acceptLanguage, got, expected)
+		}
+	}
+
+	// missing header
+	f("", "en-US")
+	// exact match, case-insensitive
+	f("zh-cn", "zh-CN")
+	// q-values
+	f("de;q=0.5, zh-CN;q=0.9", "zh-CN")
+	f("fr, de;q=0.1", "de")
+	// ties are resolved by the header order
+	f("de, zh-CN", "de")
+	// primary language match in both directions
+	f("zh", "zh-CN")
+	f("de-AT", "de")
+	// wildcard
+	f("fr, *;q=0.5", "en-US")
+	// q=0 means not acceptable
+	f("de;q=0", "en-US")
+	// nothing matches
+	f("fr, ja", "en-US")
+	// invalid q-value is ignored
+	f("de;q=abc, zh-CN;q=0.2", "zh-CN")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := PreferredLanguage(r, nil); got != "" {
+		t.Fatalf("unexpected language for empty supported list; got %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// validateMediaTypeHeaders returns an error if the Accept or Content-Type header of r is set but cannot be parsed.
+// See Container.StrictMediaTypes
+func validateMediaTypeHeaders(r *http.Request) error {
+	if contentType := r.Header.Get(HEADER_ContentType); contentType != "" {
+		if err := validateMediaType(contentType, false); err != nil {
+			return fmt.Errorf("malformed %s header %q: %w", HEADER_ContentType, contentType, err)
+		}
+	}
+	for _, accept := range r.Header.Values(HEADER_Accept) {
+		if err := validateAccept(accept); err != nil {
+			return fmt.Errorf("malformed %s header %q: %w", HEADER_Accept, accept, err)
+		}
+	}
+	return nil
+}
+
+// validateAccept validates the comma-separated media ranges of an Accept header value.
+// Empty list elements are allowed, see https://www.rfc-editor.org/rfc/rfc9110#section-5.6.1
+func validateAccept(accept string) error {
+	n := 0
+	for _, mediaRange := range splitQuoted(accept, ',') {
+		if strings.TrimSpace(mediaRange) == "" {
+			continue
+		}
+		if err := validateMediaType(mediaRange, true); err != nil {
+			return err
+		}
+		n++
+	}
+	if n == 0 {
+		return errors.New("no media range")
+	}
+	return nil
+}
+
+// validateMediaType validates a single media type such as "application/json; charset=utf-8".
+// Media ranges such as "application/*" with an optional quality value are allowed if isRange is set
+func validateMediaType(s string, isRange bool) error {
+	mediaType, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return err
+	}
+	typ, subType, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return errors.New("missing media subtype")
+	}
+	if !isRange {
+		if typ == "*" || subType == "*" {
+			return errors.New("wildcards aren't allowed")
+		}
+		return nil
+	}
+	if typ == "*" && subType != "*" {
+		return errors.New("wildcard type requires wildcard subtype")
+	}
+	if q, ok := params["q"]; ok {
+		f, err := strconv.ParseFloat(q, 64)
+		if err != nil || f < 0 || f > 1 {
+			return fmt.Errorf("invalid quality value %q; it must be in the range [0..1]", q)
+		}
+	}
+	return nil
+}
+
+// splitQuoted splits s by sep, which is ignored inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateAccept(t *testing.T) {
+	f := func(accept string, errExpected bool) {
+		t.Helper()
+		err := validateAccept(accept)
+		if (err != nil) != errExpected {
+			t.Fatalf("unexpected error for %q: %v; want error: %v", accept, err, errExpected)
+		}
+	}
+
+	// valid media ranges
+	f("*/*", false)
+	f("application/json", false)
+	f("application/*", false)
+	f("application/vnd.lcp.v1+json", false)
+	f("application/json; version=2", false)
+	f("text/html, application/json;q=0.9, */*;q=0.1", false)
+	f("application/json;q=0, text/plain;q=1.0", false)
+	f(`application/json; profile="a,b"`, false)
+	f("application/json, , text/plain", false)
+
+	// malformed media ranges
+	f("///;;;", true)
+	f("", true)
+	f(",", true)
+	f("json", true)
+	f("application/", true)
+	f("/json", true)
+	f("a/b/c", true)
+	f("*/json", true)
+	f("application/json;;", true)
+	f("application/json; charset", true)
+	f("application/json;q=2", true)
+	f("application/json;q=-0.5", true)
+	f("application/json;q=high", true)
+	f("application/json, garbage", true)
+	f(`application/json; profile="unterminated`, true)
+}
+
+func TestValidateMediaTypeHeaders_ContentType(t *testing.T) {
+	f := func(contentType string, errExpected bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(HEADER_ContentType, contentType)
+		err := validateMediaTypeHeaders(req)
+		if (err != nil) != errExpected {
+			t.Fatalf("unexpected error for %q: %v; want error: %v", contentType, err, errExpected)
+		}
+	}
+
+	f("application/json", false)
+	f("application/json; charset=utf-8", false)
+	f("multipart/form-data; boundary=xyz", false)
+
+	f("///;;;", true)
+	f("json", true)
+	f("application/*", true)
+	f("*/*", true)
+	f("application/json, text/plain", true)
+	f("application/json; charset", true)
+}
+
+func TestDispatch_StrictMediaTypes(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/items").Consumes(MIME_JSON).Produces(MIME_JSON).To(func(w http.ResponseWriter, r *http.Request) {}))
+	ws.Route(ws.GET("/items").To(func(w http.ResponseWriter, r *http.Request) {}))
+
+	f := func(strict bool, method, contentType, accept string, statusCodeExpected int) {
+		t.Helper()
+		c := NewContainer()
+		c.StrictMediaTypes(strict)
+		c.Add(ws)
+		req := httptest.NewRequest(method, "/api/items", strings.NewReader("{}"))
+		if contentType != "" {
+			req.Header.Set(HEADER_ContentType, contentType)
+		}
+		if accept != "" {
+			req.Header.Set(HEADER_Accept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for strict=%v, Content-Type %q and Accept %q; got %d; want %d; body: %s",
+				strict, contentType, accept, rec.Code, statusCodeExpected, rec.Body.String())
+		}
+	}
+
+	// lenient parsing by default
+	f(false, http.MethodGet, "", "///;;;", http.StatusOK)
+	f(false, http.MethodPost, MIME_JSON, "///;;;", http.StatusNotAcceptable)
+	f(false, http.MethodPost, "///;;;", MIME_JSON, http.StatusUnsupportedMediaType)
+
+	// malformed headers are rejected before routing in strict mode
+	errorsBefore := malformedMediaTypeErrors.Get()
+	f(true, http.MethodGet, "", "///;;;", http.StatusBadRequest)
+	f(true, http.MethodPost, MIME_JSON, "///;;;", http.StatusBadRequest)
+	f(true, http.MethodPost, "///;;;", MIME_JSON, http.StatusBadRequest)
+	f(true, http.MethodPost, MIME_JSON, "application/json;q=5", http.StatusBadRequest)
+	if n := malformedMediaTypeErrors.Get() - errorsBefore; n != 4 {
+		t.Fatalf("unexpected number of malformed media type errors; got %d; want 4", n)
+	}
+
+	// well-formed headers are routed as usual
+	f(true, http.MethodGet, "", "", http.StatusOK)
+	f(true, http.MethodPost, MIME_JSON, "text/html, application/json;q=0.9", http.StatusOK)
+	f(true, http.MethodPost, MIME_JSON, "text/html", http.StatusNotAcceptable)
+	f(true, http.MethodPost, "text/plain", MIME_JSON, http.StatusUnsupportedMediaType)
+}
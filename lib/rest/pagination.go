@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageInfo describes a page of a collection and links to the neighbouring pages.
+// The links are request-relative URLs with the page query parameter replaced.
+type PageInfo struct {
+	Total    int64  `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	First    string `json:"first,omitempty"`
+	Last     string `json:"last,omitempty"`
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+}
+
+// PaginatedResponse is the JSON envelope written by WritePaginated.
+type PaginatedResponse struct {
+	Items      any      `json:"items"`
+	Pagination PageInfo `json:"pagination"`
+}
+
+// NewPageInfo builds a PageInfo for the request r, which has been parsed into
+// pagination via ParseListOptions, and a collection holding total items.
+func NewPageInfo(r *http.Request, pagination Pagination, total int64) PageInfo {
+	info := PageInfo{
+		Total:    total,
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+	}
+	if info.Page < 1 || info.PageSize < 1 {
+		return info
+	}
+
+	lastPage := 1
+	if total > 0 {
+		lastPage = int((total + int64(info.PageSize) - 1) / int64(info.PageSize))
+	}
+	info.First = pageURL(r.URL, 1)
+	info.Last = pageURL(r.URL, lastPage)
+	if info.Page < lastPage {
+		info.Next = pageURL(r.URL, info.Page+1)
+	}
+	if info.Page > 1 {
+		info.Prev = pageURL(r.URL, min(info.Page-1, lastPage))
+	}
+	return info
+}
+
+// pageURL returns u with the page query parameter set to page
+func pageURL(u *url.URL, page int) string {
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	pu := url.URL{
+		Path:     u.Path,
+		RawPath:  u.RawPath,
+		RawQuery: q.Encode(),
+	}
+	return pu.String()
+}
+
+// SetLinkHeader sets the RFC 8288 (formerly RFC 5988) Link header with first, prev, next and last relations of info.
+func SetLinkHeader(w http.ResponseWriter, info PageInfo) {
+	var links []string
+	for _, l := range []struct{ rel, url string }{
+		{"first", info.First},
+		{"prev", info.Prev},
+		{"next", info.Next},
+		{"last", info.Last},
+	} {
+		if l.url != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=%q", l.url, l.rel))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(info.Total, 10))
+}
+
+// WritePaginated writes items wrapped into a PaginatedResponse envelope as JSON,
+// and sets the Link and X-Total-Count headers from info.
+//
+// If info carries no links, they are derived from r via NewPageInfo.
+func WritePaginated(w http.ResponseWriter, r *http.Request, items any, info PageInfo) {
+	if info.First == "" && info.Next == "" && info.Prev == "" {
+		info = NewPageInfo(r, Pagination{Page: info.Page, PageSize: info.PageSize}, info.Total)
+	}
+	SetLinkHeader(w, info)
+	WriteRawJSON(w, http.StatusOK, &PaginatedResponse{
+		Items:      items,
+		Pagination: info,
+	})
+}
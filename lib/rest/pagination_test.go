@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewPageInfo(t *testing.T) {
+	cases := []struct {
+		name  string
+		url   string
+		total int64
+		exp   PageInfo
+	}{
+		{
+			name:  "first page",
+			url:   "/api/v1/users?pageSize=10&status=active",
+			total: 25,
+			exp: PageInfo{
+				Total: 25, Page: 1, PageSize: 10,
+				First: "/api/v1/users?page=1&pageSize=10&status=active",
+				Last:  "/api/v1/users?page=3&pageSize=10&status=active",
+				Next:  "/api/v1/users?page=2&pageSize=10&status=active",
+			},
+		},
+		{
+			name:  "middle page",
+			url:   "/api/v1/users?page=2&pageSize=10",
+			total: 25,
+			exp: PageInfo{
+				Total: 25, Page: 2, PageSize: 10,
+				First: "/api/v1/users?page=1&pageSize=10",
+				Last:  "/api/v1/users?page=3&pageSize=10",
+				Next:  "/api/v1/users?page=3&pageSize=10",
+				Prev:  "/api/v1/users?page=1&pageSize=10",
+			},
+		},
+		{
+			name:  "empty collection",
+			url:   "/api/v1/users",
+			total: 0,
+			exp: PageInfo{
+				Total: 0, Page: 1, PageSize: 20,
+				First: "/api/v1/users?page=1",
+				Last:  "/api/v1/users?page=1",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			options := ParseListOptions(req.URL.Query())
+			info := NewPageInfo(req, options.Pagination, tc.total)
+			if info != tc.exp {
+				t.Errorf("unexpected page info\nexpected: %+v\ngot: %+v", tc.exp, info)
+			}
+		})
+	}
+}
+
+func TestWritePaginated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users?page=2&pageSize=1", nil)
+	rec := httptest.NewRecorder()
+	WritePaginated(rec, req, []string{"b"}, PageInfo{Total: 3, Page: 2, PageSize: 1})
+
+	expectedLink := `</api/v1/users?page=1&pageSize=1>; rel="first", </api/v1/users?page=1&pageSize=1>; rel="prev", ` +
+		`</api/v1/users?page=3&pageSize=1>; rel="next", </api/v1/users?page=3&pageSize=1>; rel="last"`
+	if link := rec.Header().Get("Link"); link != expectedLink {
+		t.Errorf("unexpected Link header: %s", link)
+	}
+	if total := rec.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("unexpected X-Total-Count header: %s", total)
+	}
+
+	var resp struct {
+		Items      []string `json:"items"`
+		Pagination PageInfo `json:"pagination"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Pagination.Total != 3 || resp.Pagination.Next == "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
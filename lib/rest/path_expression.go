@@ -3,6 +3,7 @@ package rest
 import (
 	"bytes"
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -19,6 +20,9 @@ type pathExpression struct {
 }
 
 func newPathExpression(path string) (*pathExpression, error) {
+	if err := checkPathTemplate(path); err != nil {
+		return nil, err
+	}
 	expression, literalCount, varNames, varCount, tokens := templateToRegExp(path)
 	compiled, err := regexp.Compile(expression)
 	if err != nil {
@@ -27,11 +31,30 @@ func newPathExpression(path string) (*pathExpression, error) {
 	return &pathExpression{literalCount, varNames, varCount, compiled, expression, tokens}, nil
 }
 
+// checkPathTemplate verifies that the parameters in the path template are enclosed by {},
+// so the template can be processed by templateToRegExp and the route matchers
+func checkPathTemplate(template string) error {
+	for _, each := range tokenizeTemplate(template) {
+		start := strings.Index(each, "{")
+		end := strings.Index(each, "}")
+		if start == -1 && end == -1 {
+			continue
+		}
+		if start == -1 || end < start {
+			return fmt.Errorf("unbalanced braces in path segment %q", each)
+		}
+		if strings.HasPrefix(each, "{") && !strings.HasSuffix(removeCustomVerb(each), "}") {
+			return fmt.Errorf("missing closing brace for path parameter %q", each)
+		}
+	}
+	return nil
+}
+
 func templateToRegExp(template string) (expression string, literalCount int, varNames []string, varCount int, tokens []string) {
 	var buf bytes.Buffer
 	varNames = []string{}
 	buf.WriteString("^")
-	tokens = tokenizePath(template)
+	tokens = tokenizeTemplate(template)
 	for _, each := range tokens {
 		if each == "" {
 			continue
@@ -60,8 +83,8 @@ func templateToRegExp(template string) (expression string, literalCount int, var
 			varCount += 1
 		} else {
 			literalCount += len(each)
-			//encoded := url.PathEscape(each)
-			encoded := each
+			// the expression matches the escaped form of the path, see http.Request.URL.EscapedPath
+			encoded := url.PathEscape(each)
 			buf.WriteString(regexp.QuoteMeta(encoded))
 		}
 	}
@@ -61,24 +61,42 @@ func TestTemplateToRegExp(t *testing.T) {
 			expVarCount:   1,
 			expTokens:     []string{"files", "{path:*}"},
 		},
-		//{
-		//	name:          "Path with special characters requiring URI encode",
-		//	template:      "/search/hello world",
-		//	expExpression: "^/search/hello%20world(/.*)?$",
-		//	expLiteral:    17,
-		//	expVarNames:   []string{},
-		//	expVarCount:   0,
-		//	expTokens:     []string{"search", "hello world"},
-		//},
-		//{
-		//	name:          "Path with multiple special characters",
-		//	template:      "api/v1/user@example.com",
-		//	expExpression: "^api/v1/user%40example.com(/.*)?$",
-		//	expLiteral:    21,
-		//	expVarNames:   []string{},
-		//	expVarCount:   0,
-		//	expTokens:     []string{"api", "v1", "user@example.com"},
-		//},
+		{
+			name:          "Path with special characters requiring URI encode",
+			template:      "/search/hello world",
+			expExpression: "^/search/hello%20world(/.*)?$",
+			expLiteral:    17,
+			expVarNames:   []string{},
+			expVarCount:   0,
+			expTokens:     []string{"search", "hello world"},
+		},
+		{
+			name:          "Path with already encoded literal",
+			template:      "/search/hello%20world",
+			expExpression: "^/search/hello%20world(/.*)?$",
+			expLiteral:    17,
+			expVarNames:   []string{},
+			expVarCount:   0,
+			expTokens:     []string{"search", "hello world"},
+		},
+		{
+			name:          "Path with multiple special characters",
+			template:      "api/v1/user@example.com",
+			expExpression: "^/api/v1/user@example\\.com(/.*)?$",
+			expLiteral:    21,
+			expVarNames:   []string{},
+			expVarCount:   0,
+			expTokens:     []string{"api", "v1", "user@example.com"},
+		},
+		{
+			name:          "Path with non-ASCII literal",
+			template:      "/docs/über",
+			expExpression: "^/docs/%C3%BCber(/.*)?$",
+			expLiteral:    9,
+			expVarNames:   []string{},
+			expVarCount:   0,
+			expTokens:     []string{"docs", "über"},
+		},
 		{
 			name:          "Path with slash in literal (should be encoded)",
 			template:      "/path/with/slash",
@@ -127,7 +145,7 @@ func TestTemplateToRegExp(t *testing.T) {
 		{
 			name:          "Path with question mark",
 			template:      "/api/what?",
-			expExpression: "^/api/what\\?(/.*)?$",
+			expExpression: "^/api/what%3F(/.*)?$",
 			expLiteral:    8,
 			expVarNames:   []string{},
 			expVarCount:   0,
@@ -136,7 +154,7 @@ func TestTemplateToRegExp(t *testing.T) {
 		{
 			name:          "Path with hash",
 			template:      "/api/section#1",
-			expExpression: "^/api/section#1(/.*)?$",
+			expExpression: "^/api/section%231(/.*)?$",
 			expLiteral:    12,
 			expVarNames:   []string{},
 			expVarCount:   0,
@@ -206,3 +224,36 @@ func TestTemplateToRegExp(t *testing.T) {
 		})
 	}
 }
+
+func FuzzTemplateToRegExp(f *testing.F) {
+	for _, template := range []string{
+		"/users/profile", "/users/{id}", "/users/{userId}/posts/{postId}", "/users/{id:[0-9]+}", "/files/{path:*}",
+		"/search/hello world", "/search/hello%20world", "api/v1/user@example.com", "/docs/über", "/files/test.file",
+		"/search/hello+world", "/api/a&b", "/api/key=value", "/api/what?", "/api/section#1",
+		`/users/{name}/files/{filename:.*\.txt}`, "", "/api", "/{id}", "/users/{id}:get",
+		// malformed parameters
+		"{:", "/users/{id", "/users/id}", "/users/}id{",
+	} {
+		f.Add(template)
+	}
+	f.Fuzz(func(t *testing.T, template string) {
+		if err := checkPathTemplate(template); err != nil {
+			// such templates are rejected by newPathExpression
+			if _, err := newPathExpression(template); err == nil {
+				t.Fatalf("expecting non-nil error for %q", template)
+			}
+			return
+		}
+		expression, _, varNames, varCount, tokens := templateToRegExp(template)
+		if varCount != len(varNames) {
+			t.Fatalf("unexpected varCount for %q; got %d; want %d", template, varCount, len(varNames))
+		}
+		if !reflect.DeepEqual(tokens, tokenizeTemplate(template)) {
+			t.Fatalf("unexpected tokens for %q; got %#v; want %#v", template, tokens, tokenizeTemplate(template))
+		}
+		// invalid parameter expressions result in an error instead of a panic
+		if pe, err := newPathExpression(template); err == nil && pe.Source != expression {
+			t.Fatalf("unexpected source for %q; got %q; want %q", template, pe.Source, expression)
+		}
+	})
+}
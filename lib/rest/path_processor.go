@@ -2,27 +2,54 @@ package rest
 
 import (
 	"bytes"
+	"fmt"
+	"net/url"
 	"strings"
 )
 
 // PathProcessor is extra behaviour that a Router can provide to extract path parameters from the path
 // If a Router does not implement this interface then the default behaviour will be used
 type PathProcessor interface {
-	// ExtractParameters gets the path parameters defined in the route and webService from the urlPath
-	ExtractParameters(route *Route, webService *WebService, urlPath string) map[string]string
+	// ExtractParameters gets the path parameters defined in the route and webService from the escaped urlPath.
+	// A returned error is reported to the client as 400 Bad Request.
+	ExtractParameters(route *Route, webService *WebService, urlPath string) (map[string]string, error)
 }
 
 type defaultPathProcessor struct{}
 
-// ExtractParameters extract the parameters from the request url path
-func (d defaultPathProcessor) ExtractParameters(r *Route, _ *WebService, urlPath string) map[string]string {
-	urlParts := tokenizePath(urlPath)
+// ExtractParameters extract the parameters from the escaped request url path and decodes their values
+func (d defaultPathProcessor) ExtractParameters(r *Route, _ *WebService, urlPath string) (map[string]string, error) {
+	urlParts, err := decodePathTokens(TokenizePath(urlPath))
+	if err != nil {
+		return nil, err
+	}
+	return extractPathParameters(r, urlParts), nil
+}
+
+// decodePathTokens decodes the escaped path tokens in place
+func decodePathTokens(tokens []string) ([]string, error) {
+	for i, each := range tokens {
+		if !strings.Contains(each, "%") {
+			continue
+		}
+		decoded, err := url.PathUnescape(each)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path segment %q: %w", each, err)
+		}
+		tokens[i] = decoded
+	}
+	return tokens, nil
+}
+
+// extractPathParameters extracts the parameters of r from the decoded request path tokens
+func extractPathParameters(r *Route, urlParts []string) map[string]string {
 	pathParameters := map[string]string{}
 	for i, key := range r.pathParts {
+		if !strings.Contains(key, "{") {
+			continue
+		}
 		var value string
-		if i >= len(urlParts) {
-			value = ""
-		} else {
+		if i < len(urlParts) {
 			value = urlParts[i]
 		}
 		if r.hasCustomVerb && hasCustomVerb(key) {
@@ -30,37 +57,64 @@ func (d defaultPathProcessor) ExtractParameters(r *Route, _ *WebService, urlPath
 			value = removeCustomVerb(value)
 		}
 
-		if strings.Contains(key, "{") { // path-parameter
-			if colon := strings.Index(key, ":"); colon != -1 {
-				// extract by regex
-				regPart := key[colon+1 : len(key)-1]
-				keyPart := key[1:colon]
-				if regPart == "*" {
-					pathParameters[keyPart] = unTokenizePath(i, urlParts)
-					break
-				} else {
-					pathParameters[keyPart] = value
-				}
-			} else {
-				// without enclosing {}
-				startIndex := strings.Index(key, "{")
-				endKeyIndex := strings.Index(key, "}")
-
-				suffixLength := len(key) - endKeyIndex - 1
-				endValueIndex := len(value) - suffixLength
+		if colon := strings.Index(key, ":"); colon != -1 && strings.HasPrefix(key, "{") {
+			// extract by regex
+			regPart := key[colon+1 : len(key)-1]
+			keyPart := key[1:colon]
+			if regPart == "*" {
+				pathParameters[keyPart] = unTokenizePath(i, urlParts)
+				break
+			}
+			pathParameters[keyPart] = value
+		} else {
+			// without enclosing {}
+			startIndex := strings.Index(key, "{")
+			endKeyIndex := strings.Index(key, "}")
 
-				pathParameters[key[startIndex+1:endKeyIndex]] = value[startIndex:endValueIndex]
+			suffixLength := len(key) - endKeyIndex - 1
+			endValueIndex := len(value) - suffixLength
+			if endValueIndex < startIndex {
+				// the value is shorter than the literal prefix and suffix of the key
+				pathParameters[key[startIndex+1:endKeyIndex]] = ""
+				continue
 			}
+
+			pathParameters[key[startIndex+1:endKeyIndex]] = value[startIndex:endValueIndex]
 		}
 	}
 	return pathParameters
 }
 
-// unTokenizePath back into a URL path using the slash separator
+// checkEncodedSlashes rejects values of single segment parameters of r containing a slash,
+// which can only originate from an encoded slash (%2F). Wildcard parameters ({path:*}) are allowed to contain slashes.
+func checkEncodedSlashes(r *Route, pathParameters map[string]string) error {
+	for _, key := range r.pathParts {
+		if !strings.Contains(key, "{") {
+			continue
+		}
+		key = removeCustomVerb(key)
+		var name string
+		if colon := strings.Index(key, ":"); colon != -1 && strings.HasPrefix(key, "{") {
+			if key[colon+1:len(key)-1] == "*" {
+				continue
+			}
+			name = key[1:colon]
+		} else {
+			name = key[strings.Index(key, "{")+1 : strings.Index(key, "}")]
+		}
+		if strings.Contains(pathParameters[name], "/") {
+			return fmt.Errorf("encoded slash is not allowed in path parameter %q", name)
+		}
+	}
+	return nil
+}
+
+// unTokenizePath joins the decoded parts back into a URL path using the slash separator.
+// Slashes inside a part originate from encoded slashes and are encoded again, so they stay distinguishable from the separator.
 func unTokenizePath(offset int, parts []string) string {
 	var buffer bytes.Buffer
 	for p := offset; p < len(parts); p++ {
-		buffer.WriteString(parts[p])
+		buffer.WriteString(strings.ReplaceAll(parts[p], "/", "%2F"))
 		// do not end
 		if p < len(parts)-1 {
 			buffer.WriteString("/")
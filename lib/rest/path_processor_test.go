@@ -55,6 +55,24 @@ func TestExtractParameters(t *testing.T) {
 			urlPath:   "/users/123:get",
 			expected:  map[string]string{"id": "123"},
 		},
+		{
+			name:      "encoded space",
+			routePath: "/users/{name}",
+			urlPath:   "/users/John%20Doe",
+			expected:  map[string]string{"name": "John Doe"},
+		},
+		{
+			name:      "encoded unicode",
+			routePath: "/users/{name}",
+			urlPath:   "/users/J%C3%BCrgen",
+			expected:  map[string]string{"name": "Jürgen"},
+		},
+		{
+			name:      "wildcard keeps encoded slash",
+			routePath: "/files/{path:*}",
+			urlPath:   "/files/dir/a%2Fb%20c.txt",
+			expected:  map[string]string{"path": "dir/a%2Fb c.txt"},
+		},
 	}
 
 	p := defaultPathProcessor{}
@@ -65,10 +83,139 @@ func TestExtractParameters(t *testing.T) {
 			hasCustomVerb: hasCustomVerb(c.routePath),
 		}
 		t.Run(c.name, func(t *testing.T) {
-			result := p.ExtractParameters(route, nil, c.urlPath)
+			result, err := p.ExtractParameters(route, nil, c.urlPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if !reflect.DeepEqual(result, c.expected) {
 				t.Errorf("ExtractParameters() = %v, expected %v", result, c.expected)
 			}
+
+			// CurlyRouter must return the same results from the tokens computed during route selection
+			requestTokens, err := decodePathTokens(TokenizePath(c.urlPath))
+			if err != nil {
+				t.Fatalf("cannot decode path: %v", err)
+			}
+			selected := *route
+			selected.requestTokens = requestTokens
+			result, err = CurlyRouter{}.ExtractParameters(&selected, nil, c.urlPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("CurlyRouter.ExtractParameters() = %v, expected %v", result, c.expected)
+			}
 		})
 	}
 }
+
+func TestExtractParameters_InvalidEscape(t *testing.T) {
+	p := defaultPathProcessor{}
+	for _, routePath := range []string{"/users/{id}", "/files/{path:*}"} {
+		route := &Route{
+			Path:      routePath,
+			pathParts: tokenizePath(routePath),
+		}
+		if _, err := p.ExtractParameters(route, nil, "/users/a%zz"); err == nil {
+			t.Errorf("expected error for route %s", routePath)
+		}
+	}
+}
+
+func TestExtractParameters_EncodedSlash(t *testing.T) {
+	cases := []struct {
+		name        string
+		routePath   string
+		urlPath     string
+		allowed     bool
+		expected    map[string]string
+		expectedErr bool
+	}{
+		{
+			name:        "rejected by default",
+			routePath:   "/users/{name}/orders",
+			urlPath:     "/users/a%2Fb/orders",
+			expectedErr: true,
+		},
+		{
+			name:        "rejected for regex parameter",
+			routePath:   "/users/{name:.+}/orders",
+			urlPath:     "/users/..%2F..%2Fadmin/orders",
+			expectedErr: true,
+		},
+		{
+			name:      "allowed",
+			routePath: "/users/{name}/orders",
+			urlPath:   "/users/a%2Fb/orders",
+			allowed:   true,
+			expected:  map[string]string{"name": "a/b"},
+		},
+		{
+			name:      "wildcard",
+			routePath: "/files/{path:*}",
+			urlPath:   "/files/a%2Fb/c",
+			expected:  map[string]string{"path": "a%2Fb/c"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			route := &Route{
+				Path:      c.routePath,
+				pathParts: tokenizePath(c.routePath),
+			}
+			result, err := defaultPathProcessor{}.ExtractParameters(route, nil, c.urlPath)
+			if err == nil && !c.allowed {
+				err = checkEncodedSlashes(route, result)
+			}
+			if c.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error; got params %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("ExtractParameters() = %v, expected %v", result, c.expected)
+			}
+		})
+	}
+}
+
+func FuzzExtractParameters(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"/users/{id}", "/users/123"},
+		{"/namespaces/{namespaceId}/users/{userId}", "/namespaces/ns1/users/123"},
+		{"/api/v1/users/{userId}", "/api/v1/users/999/profile"},
+		{"/users/{userId}", "/users/"},
+		{"/api/v1/users", "/api/v1/users"},
+		{"/users/{id:[0-9]+}", "/users/12345"},
+		{"/users/{id}:get", "/users/123:get"},
+		{"/users/{name}", "/users/John%20Doe"},
+		{"/users/{name}", "/users/J%C3%BCrgen"},
+		{"/files/{path:*}", "/files/dir/a%2Fb%20c.txt"},
+		{"/users/{name}/orders", "/users/a%2Fb/orders"},
+		{"/users/{name:.+}/orders", "/users/..%2F..%2Fadmin/orders"},
+		{"/users/{name}", "/users/%zz"},
+		// the value is shorter than the literal parts of the parameter segment
+		{"/v{version}", "/v"},
+		{"/:{name}", "/x"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, routePath, urlPath string) {
+		if _, err := newPathExpression(routePath); err != nil {
+			// such routes cannot be built
+			return
+		}
+		r := Route{Path: routePath}
+		r.postBuild()
+		params, err := defaultPathProcessor{}.ExtractParameters(&r, nil, urlPath)
+		if err != nil {
+			return
+		}
+		_ = checkEncodedSlashes(&r, params)
+	})
+}
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+	"lcp.io/lcp/lib/circuitbreaker"
+	"lcp.io/lcp/lib/logger"
+)
+
+// HEADER_XRequestId is propagated to proxied backends and returned to the client
+const HEADER_XRequestId = "X-Request-Id"
+
+var proxyErrorKey = any("proxyError")
+
+// ToProxy binds the route to a reverse proxy forwarding requests to targetURL.
+//
+// The WebService root path is stripped from the request path before it is appended to the path of targetURL,
+// e.g. with root path /api/v1/apps and target http://backend:8080/base the request /api/v1/apps/x/y
+// is forwarded to http://backend:8080/base/x/y. Request headers are forwarded together with X-Forwarded-* headers,
+// X-Request-Id is generated if missing and upgrade (websocket) requests are supported.
+// The proxy runs as the route function, so the filter chain (e.g. authentication) runs before proxying.
+// Backend failures are rendered as 502 Bad Gateway via the Container's ServiceErrorHandleFunction.
+// The backend request uses the request context, so it is canceled when the client closes the connection.
+// Register the route with a wildcard path such as "/{path:*}" in order to proxy a whole subtree.
+// The request body is streamed to the backend without a limit unless RouteBuilder.MaxBodyBytes is set for the route.
+func (b *RouteBuilder) ToProxy(targetURL string) *RouteBuilder {
+	return b.ToProxyWithCircuitBreaker(targetURL, nil)
+}
+
+// ToProxyWithCircuitBreaker works like ToProxy, but wraps the backend calls into cb if it isn't nil.
+//
+// Backend failures are counted by cb; while cb is open requests are rejected with 503 Service Unavailable
+// without contacting the backend, so a failing backend does not tie up the proxy.
+func (b *RouteBuilder) ToProxyWithCircuitBreaker(targetURL string, cb *circuitbreaker.CircuitBreaker) *RouteBuilder {
+	target, err := url.Parse(targetURL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		logger.Fatalf("invalid proxy target url %q for route %s: %v", targetURL, b.currentPath, err)
+	}
+	if b.maxBodyBytes == 0 {
+		// the backend enforces its own limit, so do not cap uploads by the Container default
+		b.maxBodyBytes = NoBodyLimit
+	}
+	rootTokens := len(TokenizePath(b.rootPath))
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			stripPathTokens(pr.Out.URL, rootTokens)
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(_ http.ResponseWriter, r *http.Request, err error) {
+			// the error is rendered by the route function below
+			*r.Context().Value(proxyErrorKey).(*error) = err
+		},
+	}
+	return b.ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		requestID := r.Header.Get(HEADER_XRequestId)
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(HEADER_XRequestId, requestID)
+		}
+		w.Header().Set(HEADER_XRequestId, requestID)
+
+		serveProxy := func() error {
+			var proxyErr error
+			proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyErrorKey, &proxyErr)))
+			if proxyErr != nil && errors.Is(r.Context().Err(), context.Canceled) {
+				// The backend call has been canceled because the client has gone away, so it isn't a backend failure.
+				// Wrap context.Canceled, since the transport may return other errors for canceled requests
+				proxyErr = fmt.Errorf("%w: %w", context.Canceled, proxyErr)
+			}
+			if _, ok := errors.AsType[*http.MaxBytesError](proxyErr); ok {
+				// The request body exceeds the limit of the route, so it isn't a backend failure either.
+				proxyErr = fmt.Errorf("%w: %w", context.Canceled, proxyErr)
+			}
+			return proxyErr
+		}
+		var proxyErr error
+		if cb != nil {
+			proxyErr = cb.Execute(serveProxy)
+			if errors.Is(proxyErr, circuitbreaker.ErrOpen) {
+				return NewError(http.StatusServiceUnavailable, fmt.Sprintf("503: Service Unavailable: %s", target.Host))
+			}
+		} else {
+			proxyErr = serveProxy()
+		}
+		if _, ok := errors.AsType[*http.MaxBytesError](proxyErr); ok {
+			return apierrors.NewRequestEntityTooLarge(requestBodyLimit(r))
+		}
+		if errors.Is(proxyErr, context.Canceled) {
+			return NewError(http.StatusBadGateway, "502: Bad Gateway: the client has canceled the request")
+		}
+		if proxyErr != nil {
+			logger.WithThrottler("proxyError", 5*time.Second).Warnf("cannot proxy %s %s to %s: %v", r.Method, r.URL.Path, target.Redacted(), proxyErr)
+			return NewError(http.StatusBadGateway, fmt.Sprintf("502: Bad Gateway: %s", target.Host))
+		}
+		return nil
+	})
+}
+
+// stripPathTokens removes the first n segments from the path of u while keeping the path encoding
+func stripPathTokens(u *url.URL, n int) {
+	escaped := u.EscapedPath()
+	tokens := TokenizePath(escaped)
+	if n > len(tokens) {
+		n = len(tokens)
+	}
+	stripped := "/" + strings.Join(tokens[n:], "/")
+	if strings.HasSuffix(escaped, "/") && n < len(tokens) {
+		stripped += "/"
+	}
+	path, err := url.PathUnescape(stripped)
+	if err != nil {
+		// cannot happen, since EscapedPath returns a valid escaping
+		path = stripped
+	}
+	u.Path = path
+	u.RawPath = stripped
+}
+
+// newRequestID returns a random identifier for requests without X-Request-Id header
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		logger.Panicf("FATAL: cannot generate request id: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,276 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cws "github.com/coder/websocket"
+
+	"lcp.io/lcp/lib/circuitbreaker"
+	"lcp.io/lcp/lib/websocket"
+)
+
+func newProxyContainer(targetURL string) *Container {
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api/v1/apps")
+	ws.Route(ws.GET("/{path:*}").ToProxy(targetURL))
+	container.Add(ws)
+	return container
+}
+
+func TestRouteBuilder_ToProxy(t *testing.T) {
+	var backendReq *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendReq = r
+		_, _ = io.WriteString(w, "backend")
+	}))
+	defer backend.Close()
+
+	cases := []struct {
+		name      string
+		url       string
+		requestID string
+		path      string
+		rawQuery  string
+	}{
+		{name: "strip root path", url: "/api/v1/apps/x/y", path: "/base/x/y"},
+		{name: "keep query", url: "/api/v1/apps/x?a=b", path: "/base/x", rawQuery: "a=b"},
+		{name: "keep encoding", url: "/api/v1/apps/a%2Fb/c", path: "/base/a%2Fb/c"},
+		{name: "propagate request id", url: "/api/v1/apps/x", requestID: "abc", path: "/base/x"},
+	}
+	container := newProxyContainer(backend.URL + "/base")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			backendReq = nil
+			req := httptest.NewRequest(http.MethodGet, c.url, nil)
+			if c.requestID != "" {
+				req.Header.Set(HEADER_XRequestId, c.requestID)
+			}
+			rec := httptest.NewRecorder()
+			container.Dispatch(rec, req)
+			if rec.Code != http.StatusOK || rec.Body.String() != "backend" {
+				t.Fatalf("unexpected response; got %d %q", rec.Code, rec.Body.String())
+			}
+			if backendReq == nil {
+				t.Fatalf("request did not reach the backend")
+			}
+			if got := backendReq.URL.EscapedPath(); got != c.path {
+				t.Errorf("unexpected backend path; got %q; want %q", got, c.path)
+			}
+			if backendReq.URL.RawQuery != c.rawQuery {
+				t.Errorf("unexpected backend query; got %q; want %q", backendReq.URL.RawQuery, c.rawQuery)
+			}
+			if backendReq.Header.Get("X-Forwarded-For") == "" {
+				t.Errorf("missing X-Forwarded-For header")
+			}
+			requestID := backendReq.Header.Get(HEADER_XRequestId)
+			if requestID == "" || (c.requestID != "" && requestID != c.requestID) {
+				t.Errorf("unexpected backend %s; got %q; want %q", HEADER_XRequestId, requestID, c.requestID)
+			}
+			if got := rec.Header().Get(HEADER_XRequestId); got != requestID {
+				t.Errorf("unexpected response %s; got %q; want %q", HEADER_XRequestId, got, requestID)
+			}
+		})
+	}
+}
+
+func TestRouteBuilder_ToProxyLargeBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "%d", n)
+	}))
+	defer backend.Close()
+
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api/v1/apps")
+	ws.Route(ws.POST("/uploads").ToProxy(backend.URL))
+	ws.Route(ws.POST("/limited").MaxBodyBytes(16).ToProxy(backend.URL))
+	container.Add(ws)
+
+	f := func(path string, size int, chunked bool, wantCode int) {
+		t.Helper()
+		var body io.Reader = strings.NewReader(strings.Repeat("a", size))
+		if chunked {
+			body = io.MultiReader(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, req)
+		if rec.Code != wantCode {
+			t.Fatalf("unexpected status code for %s with %d bytes (chunked=%v); got %d; want %d; body: %s",
+				path, size, chunked, rec.Code, wantCode, rec.Body.String())
+		}
+		if wantCode == http.StatusOK && rec.Body.String() != strconv.Itoa(size) {
+			t.Fatalf("unexpected number of bytes received by the backend; got %s; want %d", rec.Body.String(), size)
+		}
+	}
+
+	for _, chunked := range []bool{false, true} {
+		// proxy routes aren't limited by the default limit
+		f("/api/v1/apps/uploads", 4*maxRequestBodySize, chunked, http.StatusOK)
+
+		// the limit set for the proxy route is applied
+		f("/api/v1/apps/limited", 16, chunked, http.StatusOK)
+		f("/api/v1/apps/limited", 17, chunked, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestRouteBuilder_ToProxyBackendFailure(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	container := newProxyContainer(backendURL)
+	var handled ServiceError
+	container.ServiceErrorHandler(func(err ServiceError, w http.ResponseWriter, r *http.Request) {
+		handled = err
+		w.WriteHeader(err.Code)
+	})
+	rec := httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/v1/apps/x", nil))
+	if rec.Code != http.StatusBadGateway || handled.Code != http.StatusBadGateway {
+		t.Fatalf("unexpected status; got %d; want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRouteBuilder_ToProxyWebSocket(t *testing.T) {
+	echo := HandleWebSocket(func(ctx context.Context, params map[string]string, conn *websocket.Conn) {
+		defer conn.Close(websocket.StatusNormalClosure, "done")
+		msgType, data, err := conn.ReadMessage(ctx)
+		if err != nil {
+			return
+		}
+		_ = conn.WriteMessage(ctx, msgType, data)
+	})
+	backend := httptest.NewServer(echo)
+	defer backend.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(newProxyContainer(backend.URL).Dispatch))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, _, err := cws.Dial(ctx, "ws"+srv.URL[4:]+"/api/v1/apps/echo", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer c.CloseNow()
+
+	if err := c.Write(ctx, cws.MessageText, []byte("hello")); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	_, data, err := c.Read(ctx)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected message; got %q; want %q", data, "hello")
+	}
+}
+
+func TestRouteBuilder_ToProxyWithCircuitBreaker(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api/v1/apps")
+	ws.Route(ws.GET("/{path:*}").ToProxyWithCircuitBreaker(backendURL, circuitbreaker.New("test_proxy", 2, time.Hour)))
+	container.Add(ws)
+
+	for _, expected := range []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/v1/apps/x", nil))
+		if rec.Code != expected {
+			t.Fatalf("unexpected status; got %d; want %d", rec.Code, expected)
+		}
+	}
+}
+
+func TestRouteBuilder_ToProxyClientDisconnect(t *testing.T) {
+	backendStarted := make(chan struct{})
+	backendCanceled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(backendStarted)
+		select {
+		case <-r.Context().Done():
+			close(backendCanceled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	cb := circuitbreaker.New("test_proxy_client_disconnect", 1, time.Hour)
+	container := NewContainer()
+	ws := new(WebService)
+	ws.Path("/api/v1/apps")
+	ws.Route(ws.GET("/{path:*}").ToProxyWithCircuitBreaker(backend.URL, cb))
+	container.Add(ws)
+
+	proxyDone := make(chan struct{})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(proxyDone)
+		container.Dispatch(w, r)
+	}))
+	defer proxy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxy.URL+"/api/v1/apps/x", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	clientErr := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		clientErr <- err
+	}()
+
+	// disconnect the client while the backend is processing the request
+	select {
+	case <-backendStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the request didn't reach the backend")
+	}
+	cancel()
+	if err := <-clientErr; err == nil {
+		t.Fatalf("expecting non-nil error for the canceled client request")
+	}
+
+	select {
+	case <-backendCanceled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the backend request context wasn't canceled after the client disconnect")
+	}
+	select {
+	case <-proxyDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the proxy handler didn't return after the client disconnect")
+	}
+
+	// the client disconnect isn't a backend failure
+	if state := cb.State(); state != circuitbreaker.StateClosed {
+		t.Fatalf("unexpected circuit breaker state; got %s; want %s", state, circuitbreaker.StateClosed)
+	}
+}
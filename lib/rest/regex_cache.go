@@ -2,9 +2,12 @@ package rest
 
 import (
 	"regexp"
+	"strings"
 	"sync"
 )
 
+var regexCache sync.Map // Cache for compiled path parameter regex patterns
+
 // getCachedRegexp retrieves a compiled regex from the cache if found and valid.
 // Returns the regex and true if found and valid, nil and false otherwise.
 func getCachedRegexp(cache *sync.Map, pattern string) (*regexp.Regexp, bool) {
@@ -15,3 +18,49 @@ func getCachedRegexp(cache *sync.Map, pattern string) (*regexp.Regexp, bool) {
 	}
 	return nil, false
 }
+
+// compilePathParamRegexp returns the compiled regexp for the expression of a path parameter,
+// e.g. [0-9]+ for {id:[0-9]+}. The expression must match the whole request token,
+// so {id:[0-9]+} doesn't match abc1. Compiled regexps are cached in regexCache.
+//
+// Go regexps use RE2 syntax, so matching takes linear time in the length of the request token
+// and cannot suffer from catastrophic backtracking for patterns such as (a+)+.
+// The request token length is bounded by -http.maxPathLength in addition.
+func compilePathParamRegexp(regPart string) (*regexp.Regexp, error) {
+	if regex, found := getCachedRegexp(&regexCache, regPart); found {
+		return regex, nil
+	}
+	if _, err := regexp.Compile(regPart); err != nil {
+		// report the error for the original expression
+		return nil, err
+	}
+	regex, err := regexp.Compile("^(?:" + regPart + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(regPart, regex)
+	return regex, nil
+}
+
+// precompilePathParamRegexps compiles the expressions of all path parameters in tokens,
+// so invalid expressions are detected when the route is built instead of at request time
+func precompilePathParamRegexps(tokens []string) error {
+	for _, token := range tokens {
+		token = removeCustomVerb(token)
+		if !strings.HasPrefix(token, "{") {
+			continue
+		}
+		colon := strings.Index(token, ":")
+		if colon == -1 {
+			continue
+		}
+		regPart := token[colon+1 : len(token)-1]
+		if regPart == "*" {
+			continue
+		}
+		if _, err := compilePathParamRegexp(regPart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
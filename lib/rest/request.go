@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -12,6 +13,9 @@ type key int
 
 const (
 	PathParamsKey key = iota
+	responseMediaTypeKey
+	timingKey
+	serviceErrorHandlerKey
 )
 
 // WithPathParams add path params to request context (r = WithPathParams(r, pathParams))
@@ -20,6 +24,8 @@ func WithPathParams(r *http.Request, pathParams map[string]string) *http.Request
 	return r.WithContext(ctx)
 }
 
+// PathParams returns the path parameters of the route matched for r.
+// An empty non-nil map is returned if r has no path parameters, e.g. if it hasn't been dispatched by the Container
 func PathParams(r *http.Request) map[string]string {
 	params, _ := r.Context().Value(PathParamsKey).(map[string]string)
 	if params == nil {
@@ -28,6 +34,7 @@ func PathParams(r *http.Request) map[string]string {
 	return params
 }
 
+// PathParam returns the path parameter value by its name or an empty string if r has no such parameter
 func PathParam(r *http.Request, name string) string {
 	return PathParams(r)[name]
 }
@@ -59,6 +66,40 @@ func HeaderParam(r *http.Request, name string) string {
 	return r.Header.Get(name)
 }
 
+// StatusClientClosedRequest is the non-standard status code used by CheckContext
+// when the client has gone before the response was written
+const StatusClientClosedRequest = 499
+
+// errRequestTimeout is returned when the request deadline has been exceeded
+var errRequestTimeout = NewError(http.StatusServiceUnavailable, "503: Service Unavailable: request timeout exceeded")
+
+// IsClientGone returns true if the request context is done because the client has disconnected or the request timed out
+func IsClientGone(r *http.Request) bool {
+	return r.Context().Err() != nil
+}
+
+// CheckContext returns a ServiceError if the request context is done, so long-running handlers can abort early:
+//
+//	for _, item := range items {
+//		if err := rest.CheckContext(r); err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// It returns 499 if the client has disconnected and 503 if the request deadline has been exceeded.
+func CheckContext(r *http.Request) error {
+	err := r.Context().Err()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return errRequestTimeout
+	default:
+		return NewError(StatusClientClosedRequest, "499: Client Closed Request")
+	}
+}
+
 // DecodeBody decodes the request body into a runtime.Object using the
 // Content-Type header to select the appropriate serializer.
 //
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckContext(t *testing.T) {
+	f := func(ctx context.Context, wantCode int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		err := CheckContext(r)
+		if wantCode == 0 {
+			if err != nil || IsClientGone(r) {
+				t.Fatalf("unexpected error for active request: %v", err)
+			}
+			return
+		}
+		if !IsClientGone(r) {
+			t.Fatalf("expected IsClientGone to return true")
+		}
+		se, ok := errors.AsType[ServiceError](err)
+		if !ok {
+			t.Fatalf("expected ServiceError; got %T: %v", err, err)
+		}
+		if se.Code != wantCode {
+			t.Fatalf("unexpected status code; got %d; want %d", se.Code, wantCode)
+		}
+	}
+
+	f(context.Background(), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f(ctx, StatusClientClosedRequest)
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	f(ctx, http.StatusServiceUnavailable)
+}
+
+func TestPathParams_WithoutParams(t *testing.T) {
+	f := func(r *http.Request) {
+		t.Helper()
+		params := PathParams(r)
+		if params == nil {
+			t.Fatalf("expecting non-nil path params")
+		}
+		if len(params) != 0 {
+			t.Fatalf("unexpected path params; got %v; want empty", params)
+		}
+		if v := PathParam(r, "id"); v != "" {
+			t.Fatalf("unexpected path param; got %q; want empty", v)
+		}
+	}
+
+	// bare request
+	f(httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	// nil params
+	f(WithPathParams(httptest.NewRequest(http.MethodGet, "/users/1", nil), nil))
+
+	// unexpected value under the key
+	r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	f(r.WithContext(context.WithValue(r.Context(), PathParamsKey, "id=1")))
+}
+
+func TestPathParams_WithParams(t *testing.T) {
+	r := WithPathParams(httptest.NewRequest(http.MethodGet, "/users/1", nil), map[string]string{"id": "1"})
+	if v := PathParam(r, "id"); v != "1" {
+		t.Fatalf("unexpected path param; got %q; want %q", v, "1")
+	}
+	if v := PathParam(r, "name"); v != "" {
+		t.Fatalf("unexpected path param; got %q; want empty", v)
+	}
+	if params := PathParams(r); len(params) != 1 || params["id"] != "1" {
+		t.Fatalf("unexpected path params; got %v; want map[id:1]", params)
+	}
+}
@@ -1,14 +1,15 @@
 package rest
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	apierrors "lcp.io/lcp/lib/api/errors"
 	"lcp.io/lcp/lib/logger"
 	"lcp.io/lcp/lib/runtime"
+	"lcp.io/lcp/lib/utils/bytesutil"
 )
 
 // WriteObjectNegotiated serializes obj using a content-type negotiated from the
@@ -54,9 +55,12 @@ func ErrorNegotiated(
 	var errObj runtime.Object
 	var code int
 
-	if se, ok := err.(interface{ GetStatus() int }); ok {
+	if se, ok := err.(interface {
+		runtime.Object
+		GetStatus() int
+	}); ok {
 		code = se.GetStatus()
-		errObj = err.(runtime.Object)
+		errObj = se
 	} else {
 		code = http.StatusInternalServerError
 		errObj = apierrors.NewInternalError(err)
@@ -77,10 +81,10 @@ func ErrorNegotiated(
 
 // SerializeObject encodes the object and writes the HTTP response
 //
-//  1. Create a buffer for encoding
+//  1. Obtain a pooled buffer for encoding
 //  2. Encode the object via the encoder
-//  3. Set Content-Type header
-//  4. Write status code and body
+//  3. Set Content-Type and Content-Length headers, so small bodies aren't sent with chunked encoding
+//  4. Write status code and body at once
 func SerializeObject(
 	mediaType string,
 	encoder runtime.Encoder,
@@ -89,17 +93,33 @@ func SerializeObject(
 	obj runtime.Object,
 ) {
 	// Buffer the encoded output
-	buf := &bytes.Buffer{}
-	if err := encoder.Encode(obj, buf); err != nil {
+	bb := responseBufPool.Get()
+	defer putResponseBuf(bb)
+	if err := encoder.Encode(obj, bb); err != nil {
 		// If encoding fails, try to serialize an error status
 		internalError(w, fmt.Errorf("encoding response: %w", err))
 		return
 	}
 
 	// Set headers and write response
-	w.Header().Set("Content-Type", mediaType)
+	h := w.Header()
+	h.Set("Content-Type", mediaType)
+	h.Set("Content-Length", strconv.Itoa(len(bb.B)))
 	w.WriteHeader(statusCode)
-	_, _ = w.Write(buf.Bytes())
+	_, _ = w.Write(bb.B)
+}
+
+// maxPooledResponseBufSize is the maximum capacity of response buffers returned to responseBufPool,
+// so a single huge response doesn't pin its memory in the pool
+const maxPooledResponseBufSize = 1024 * 1024
+
+var responseBufPool bytesutil.ByteBufferPool
+
+func putResponseBuf(bb *bytesutil.ByteBuffer) {
+	if cap(bb.B) > maxPooledResponseBufSize {
+		return
+	}
+	responseBufPool.Put(bb)
 }
 
 // WriteRawJSON writes a non-API object in JSON
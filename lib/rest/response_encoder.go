@@ -0,0 +1,118 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lcp.io/lcp/lib/runtime"
+	"lcp.io/lcp/lib/utils/yamlutil"
+)
+
+// responseMediaType returns the media type of the response to a request with the given Accept header,
+// which is the first media range of accept matching r.Produces. Wildcard media ranges resolve to the
+// matching type declared in Produces. An empty string is returned if there is no concrete media type,
+// e.g. if the route doesn't declare Produces and accept is "*/*".
+func (r *Route) responseMediaType(accept string) string {
+	if len(accept) == 0 {
+		accept = "*/*"
+	}
+	remaining := accept
+	for {
+		var mimeType string
+		mimeType, remaining = parseNextMimeType(remaining)
+		if len(r.Produces) == 0 && !strings.Contains(mimeType, "*") {
+			return mimeType
+		}
+		for _, producibleType := range r.Produces {
+			if !mimeTypeMatches(producibleType, mimeType) && mimeType != "*/*" {
+				continue
+			}
+			if !strings.Contains(mimeType, "*") {
+				return mimeType
+			}
+			if !strings.Contains(producibleType, "*") {
+				return producibleType
+			}
+		}
+		if len(remaining) == 0 {
+			return ""
+		}
+	}
+}
+
+func withResponseMediaType(r *http.Request, mediaType string) *http.Request {
+	ctx := context.WithValue(r.Context(), responseMediaTypeKey, mediaType)
+	return r.WithContext(ctx)
+}
+
+// ResponseMediaType returns the media type negotiated by the Container from the Accept header of r
+// and the Produces of the matched route. An empty string is returned if any media type is acceptable.
+func ResponseMediaType(r *http.Request) string {
+	mediaType, _ := r.Context().Value(responseMediaTypeKey).(string)
+	return mediaType
+}
+
+// encodeFunc writes v to w in a specific format
+type encodeFunc func(w io.Writer, v any) error
+
+// responseEncoders contains the encoders used by ResponseEncoder by the structured subtype of the media type,
+// so "application/vnd.lcp.v1+json" is encoded as JSON
+var responseEncoders = map[string]encodeFunc{
+	"json": func(w io.Writer, v any) error {
+		return json.NewEncoder(w).Encode(v)
+	},
+	"xml": func(w io.Writer, v any) error {
+		return xml.NewEncoder(w).Encode(v)
+	},
+	"yaml": func(w io.Writer, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		yamlData, err := yamlutil.JSONToYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(yamlData)
+		return err
+	},
+}
+
+// ResponseEncoder returns a function writing v to w with 200 OK in the format negotiated for r,
+// see ResponseMediaType. JSON, XML and YAML structured types are supported; JSON is used
+// if the negotiated media type isn't one of them or if any media type is acceptable.
+//
+// The encoded value is buffered, so nothing is written to w if the encoding fails.
+// Use WriteObjectNegotiated for API objects and other status codes.
+func ResponseEncoder(w http.ResponseWriter, r *http.Request) func(v any) error {
+	mediaType := ResponseMediaType(r)
+	var encode encodeFunc
+	if mt, ok := runtime.ParseMediaType(mediaType); ok {
+		encode = responseEncoders[mt.StructuredSubType()]
+	}
+	if encode == nil {
+		mediaType = MIME_JSON
+		encode = responseEncoders["json"]
+	}
+	return func(v any) error {
+		bb := responseBufPool.Get()
+		defer putResponseBuf(bb)
+		start := time.Now()
+		if err := encode(bb, v); err != nil {
+			return fmt.Errorf("cannot encode response as %s: %w", mediaType, err)
+		}
+		Timing(r).Measure("serialization", time.Since(start))
+		h := w.Header()
+		h.Set(HEADER_ContentType, mediaType)
+		h.Set("Content-Length", strconv.Itoa(len(bb.B)))
+		_, err := w.Write(bb.B)
+		return err
+	}
+}
@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoute_ResponseMediaType(t *testing.T) {
+	f := func(produces []string, accept, mediaTypeExpected string) {
+		t.Helper()
+		r := Route{Produces: produces}
+		if mediaType := r.responseMediaType(accept); mediaType != mediaTypeExpected {
+			t.Fatalf("unexpected media type for Produces %q and Accept %q; got %q; want %q", produces, accept, mediaType, mediaTypeExpected)
+		}
+	}
+
+	// wildcards resolve to the first declared type
+	f([]string{MIME_JSON, MIME_XML}, "", MIME_JSON)
+	f([]string{MIME_JSON, MIME_XML}, "*/*", MIME_JSON)
+
+	// the first matching media range wins
+	f([]string{MIME_JSON, MIME_XML}, MIME_XML, MIME_XML)
+	f([]string{MIME_JSON, MIME_XML}, "text/html, application/xml;q=0.9, application/json", MIME_XML)
+	f([]string{MIME_JSON, MIME_XML}, "text/html, */*;q=0.1", MIME_JSON)
+
+	// structured types
+	f([]string{"application/*+json"}, "application/vnd.lcp.v1+json", "application/vnd.lcp.v1+json")
+	f([]string{"application/*+json", MIME_XML}, "*/*", MIME_XML)
+	f([]string{"application/*+json"}, "*/*", "")
+
+	// routes without Produces
+	f(nil, "", "")
+	f(nil, "*/*", "")
+	f(nil, "application/yaml", "application/yaml")
+	f(nil, "*/*, application/yaml", "application/yaml")
+
+	f([]string{MIME_JSON}, "text/html", "")
+}
+
+func TestResponseEncoder(t *testing.T) {
+	type item struct {
+		Name string `json:"name" xml:"name"`
+	}
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/item").Produces(MIME_JSON, MIME_XML, "application/yaml", "application/*+json").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return ResponseEncoder(w, r)(item{Name: "alice"})
+	}))
+	ws.Route(ws.GET("/any").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return ResponseEncoder(w, r)(item{Name: "bob"})
+	}))
+	ws.Route(ws.GET("/map").Produces(MIME_XML).ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return ResponseEncoder(w, r)(map[string]string{"name": "alice"})
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(path, accept string, statusCodeExpected int, contentTypeExpected, bodyExpected string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set(HEADER_Accept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s with Accept %q; got %d; want %d; body: %s", path, accept, rec.Code, statusCodeExpected, rec.Body.String())
+		}
+		if contentType := rec.Header().Get(HEADER_ContentType); contentType != contentTypeExpected {
+			t.Fatalf("unexpected Content-Type for %s with Accept %q; got %q; want %q", path, accept, contentType, contentTypeExpected)
+		}
+		if body := rec.Body.String(); body != bodyExpected {
+			t.Fatalf("unexpected body for %s with Accept %q; got %q; want %q", path, accept, body, bodyExpected)
+		}
+	}
+
+	f("/api/item", "", http.StatusOK, MIME_JSON, "{\"name\":\"alice\"}\n")
+	f("/api/item", MIME_XML, http.StatusOK, MIME_XML, "<item><name>alice</name></item>")
+	f("/api/item", "application/yaml", http.StatusOK, "application/yaml", "name: alice\n")
+	f("/api/item", "application/vnd.lcp.v1+json", http.StatusOK, "application/vnd.lcp.v1+json", "{\"name\":\"alice\"}\n")
+	f("/api/item", "text/html, application/xml;q=0.9", http.StatusOK, MIME_XML, "<item><name>alice</name></item>")
+
+	// unsupported formats fall back to JSON
+	f("/api/any", "text/html", http.StatusOK, MIME_JSON, "{\"name\":\"bob\"}\n")
+	f("/api/any", "application/xml", http.StatusOK, MIME_XML, "<item><name>bob</name></item>")
+
+	// nothing is written if encoding fails; the error is logged instead of being sent to the client
+	f("/api/map", MIME_XML, http.StatusInternalServerError, "", "500: Internal Server Error")
+}
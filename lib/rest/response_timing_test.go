@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"lcp.io/lcp/lib/runtime"
+)
+
+type discardResponseWriter struct {
+	h http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.h }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkSerializeObject(b *testing.B) {
+	obj := &testObj{TypeMeta: runtime.TypeMeta{Kind: "User"}, Name: "alice"}
+	encoder := &runtime.JSONSerializer{}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		w := &discardResponseWriter{h: make(http.Header)}
+		for pb.Next() {
+			SerializeObject("application/json", encoder, w, http.StatusOK, obj)
+		}
+	})
+}
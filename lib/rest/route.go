@@ -2,7 +2,11 @@ package rest
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
+
+	"lcp.io/lcp/lib/runtime"
 )
 
 // Route binds an HTTP Method, Path, Consumes combination to a RouteFunction
@@ -13,6 +17,12 @@ type Route struct {
 	Consumes []string
 	Function http.HandlerFunc
 
+	// Version is the API version set via RouteBuilder.Version; zero means the route is unversioned
+	Version int
+
+	// filters are set via RouteBuilder.Filter
+	filters []FilterFunction
+
 	// cached values for dispatching
 	relativePath string
 	pathParts    []string
@@ -21,10 +31,30 @@ type Route struct {
 	// indicate route path has custom verb
 	hasCustomVerb bool
 
+	// isDefault is set for fallback routes bound via RouteBuilder.ToDefault
+	isDefault bool
+
+	// maxBodyBytes is the request body limit set via RouteBuilder.MaxBodyBytes; see bodyLimit
+	maxBodyBytes int64
+
+	// timeout is the handler timeout set via RouteBuilder.Timeout; see timeoutOrDefault
+	timeout time.Duration
+
 	paramCount  int
 	staticCount int
+
+	// requestTokens are the decoded path tokens of the request the route has been selected for by CurlyRouter
+	requestTokens []string
 }
 
+// RouteErrorFunction is a route handler that reports failures by returning an error
+// instead of writing the error response itself.
+type RouteErrorFunction func(w http.ResponseWriter, r *http.Request) error
+
+// TokenizePath splits a path into its segments. It is used for both route templates and
+// escaped request paths, so a replacement must be installed before any WebService is built.
+var TokenizePath = tokenizePath
+
 func tokenizePath(path string) []string {
 	if "/" == path {
 		return nil
@@ -32,11 +62,36 @@ func tokenizePath(path string) []string {
 	return strings.Split(strings.Trim(path, "/"), "/")
 }
 
+// tokenizeTemplate splits a route template into segments and decodes percent-encoded literal segments,
+// so that "/search/hello%20world" and "/search/hello world" describe the same route.
+// Request paths are matched segment by segment in their decoded form, see requestPathTokens.
+func tokenizeTemplate(template string) []string {
+	tokens := TokenizePath(template)
+	for i, each := range tokens {
+		if strings.HasPrefix(each, "{") || !strings.Contains(each, "%") {
+			continue
+		}
+		if decoded, err := url.PathUnescape(each); err == nil {
+			tokens[i] = decoded
+		}
+	}
+	return tokens
+}
+
 func (r *Route) postBuild() {
-	r.pathParts = tokenizePath(r.Path)
+	r.pathParts = tokenizeTemplate(r.Path)
 	r.hasCustomVerb = hasCustomVerb(r.Path)
 }
 
+// timeoutOrDefault returns the handler timeout of r; defaultTimeout is used unless the route sets its own.
+// Non-positive values mean no timeout.
+func (r *Route) timeoutOrDefault(defaultTimeout time.Duration) time.Duration {
+	if r.timeout != 0 {
+		return r.timeout
+	}
+	return defaultTimeout
+}
+
 // for debugging
 func (r *Route) String() string {
 	return r.Method + " " + r.Path
@@ -68,7 +123,7 @@ func (r *Route) matchesContentType(mimeTypes string) bool {
 		mimeType, remaining = parseNextMimeType(remaining)
 
 		for _, consumableType := range r.Consumes {
-			if consumableType == "*/*" || consumableType == mimeType {
+			if mimeTypeMatches(consumableType, mimeType) {
 				return true
 			}
 		}
@@ -80,6 +135,11 @@ func (r *Route) matchesContentType(mimeTypes string) bool {
 
 // Return whether the mimeType matches to what this Route can produce
 func (r *Route) matchesAccept(mimeTypesWithQuality string) bool {
+	if len(r.Produces) == 0 {
+		// did not specify what it can produce; any media type ("*/*") is assumed
+		return true
+	}
+
 	remaining := mimeTypesWithQuality
 	for {
 		var mimeType string
@@ -89,7 +149,7 @@ func (r *Route) matchesAccept(mimeTypesWithQuality string) bool {
 			return true
 		}
 		for _, producibleType := range r.Produces {
-			if producibleType == "*/*" || producibleType == mimeType {
+			if mimeTypeMatches(producibleType, mimeType) {
 				return true
 			}
 		}
@@ -99,6 +159,24 @@ func (r *Route) matchesAccept(mimeTypesWithQuality string) bool {
 	}
 }
 
+// mimeTypeMatches reports whether the requested mime type matches the mime type declared by a route.
+// The declared type may be a pattern such as "application/*+json", which matches JSON-structured
+// vendor types like "application/vnd.lcp.v1+json". See runtime.MediaType.Matches
+func mimeTypeMatches(declared, requested string) bool {
+	if declared == "*/*" || declared == requested {
+		return true
+	}
+	d, ok := runtime.ParseMediaType(declared)
+	if !ok {
+		return false
+	}
+	mt, ok := runtime.ParseMediaType(requested)
+	if !ok {
+		return false
+	}
+	return mt.Matches(d)
+}
+
 func stringTrimSpaceCutset(r rune) bool {
 	return r == ' '
 }
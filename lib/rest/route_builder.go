@@ -3,6 +3,7 @@ package rest
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"lcp.io/lcp/lib/logger"
 )
@@ -15,6 +16,12 @@ type RouteBuilder struct {
 	consumes    []string
 	httpMethod  string
 	function    http.HandlerFunc
+	isDefault   bool
+	version     int
+	filters     []FilterFunction
+
+	maxBodyBytes int64
+	timeout      time.Duration
 }
 
 // To bind the route to a function
@@ -25,6 +32,35 @@ func (b *RouteBuilder) To(function http.HandlerFunc) *RouteBuilder {
 	return b
 }
 
+// ToErr binds the route to a function that may return an error.
+// A non-nil error is rendered by the ServiceErrorHandleFunction of the Container dispatching the request;
+// ServiceError and errors exposing GetStatus() int keep their status code, other errors are logged
+// and result in 500 Internal Server Error without exposing their text to the client.
+// Use either To or ToErr, not both
+func (b *RouteBuilder) ToErr(function RouteErrorFunction) *RouteBuilder {
+	b.function = func(w http.ResponseWriter, r *http.Request) {
+		if err := function(w, r); err != nil {
+			handleRouteError(err, w, r)
+		}
+	}
+	return b
+}
+
+// ToDefault binds the route to a function and makes it a fallback of its WebService.
+// A default route matches any path below its own path (a trailing "/*" is optional)
+// and is only selected if no other route of the WebService matches the request
+func (b *RouteBuilder) ToDefault(function http.HandlerFunc) *RouteBuilder {
+	b.function = function
+	b.isDefault = true
+	return b
+}
+
+// Filter adds a filter running for this route only, after the Container and WebService filters; see FilterFunction
+func (b *RouteBuilder) Filter(filter FilterFunction) *RouteBuilder {
+	b.filters = append(b.filters, filter)
+	return b
+}
+
 // Method specifies what HTTP method to match
 // Required
 func (b *RouteBuilder) Method(method string) *RouteBuilder {
@@ -64,8 +100,46 @@ func (b *RouteBuilder) Consumes(mimeTypes ...string) *RouteBuilder {
 	return b
 }
 
+// MaxBodyBytes limits the size of the request body of this route to n bytes; larger bodies are rejected with 413.
+// NoBodyLimit disables the limit and zero means the Container.DefaultMaxBodyBytes limit is used, which is 1 MB by default.
+// Use this for routes accepting larger bodies or to lower the limit for small ones
+func (b *RouteBuilder) MaxBodyBytes(n int64) *RouteBuilder {
+	b.maxBodyBytes = n
+	return b
+}
+
+// NoTimeout disables the Container.DefaultTimeout for a route when passed to RouteBuilder.Timeout,
+// e.g. for streaming or websocket routes
+const NoTimeout time.Duration = -1
+
+// Timeout sets the deadline of the request context of the handler of this route, overriding Container.DefaultTimeout.
+// Zero means the default timeout is used and NoTimeout disables it.
+//
+// Handlers must observe the context, e.g. via CheckContext, since the deadline doesn't interrupt them.
+// Errors caused by the expired deadline, which are returned from a function bound via ToErr,
+// are rendered as 503 Service Unavailable. If the handler returns after the deadline without writing
+// the response, e.g. a function bound via To, which only stops on the canceled context, 503 is written too.
+// A response written by the handler after the deadline is sent as is, so functions bound via To
+// must write their own error response if they write anything after the deadline.
+func (b *RouteBuilder) Timeout(d time.Duration) *RouteBuilder {
+	b.timeout = d
+	return b
+}
+
+// Version sets the API version of the route. Routes with the same method and path may differ by version only;
+// the router selects among them by the X-API-Version header or the version parameter of the Accept header,
+// e.g. "application/json; version=2". The latest version is selected if the request doesn't specify one.
+// An unversioned route with the same method and path serves requests for versions, which aren't registered.
+func (b *RouteBuilder) Version(v int) *RouteBuilder {
+	b.version = v
+	return b
+}
+
 // Build creates a new Route using the specification details collected by the RouteBuilder
 func (b *RouteBuilder) Build() Route {
+	if b.isDefault {
+		b.currentPath = strings.TrimSuffix(strings.TrimSuffix(b.currentPath, "*"), "/")
+	}
 	pathExpr, err := newPathExpression(b.currentPath)
 	if err != nil {
 		logger.Fatalf("invalid path: %s, error: %v", b.currentPath, err)
@@ -73,14 +147,28 @@ func (b *RouteBuilder) Build() Route {
 	if b.function == nil {
 		logger.Fatalf("no function specified for route: %s", b.currentPath)
 	}
+	if b.maxBodyBytes < NoBodyLimit {
+		logger.Fatalf("invalid body limit %d for route: %s; it must be positive or NoBodyLimit", b.maxBodyBytes, b.currentPath)
+	}
+	if b.version < 0 {
+		logger.Fatalf("invalid version %d for route: %s; it must be positive", b.version, b.currentPath)
+	}
+	if err := precompilePathParamRegexps(tokenizeTemplate(b.currentPath)); err != nil {
+		logger.Fatalf("invalid path parameter expression in route: %s, error: %v", b.currentPath, err)
+	}
 	route := Route{
 		Method:       b.httpMethod,
 		Path:         concatPath(b.rootPath, b.currentPath),
 		Produces:     b.produces,
 		Consumes:     b.consumes,
 		Function:     b.function,
+		Version:      b.version,
+		filters:      b.filters,
 		relativePath: b.currentPath,
 		pathExpr:     pathExpr,
+		isDefault:    b.isDefault,
+		maxBodyBytes: b.maxBodyBytes,
+		timeout:      b.timeout,
 	}
 	route.postBuild()
 	return route
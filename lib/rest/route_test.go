@@ -1,8 +1,15 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+
+	"lcp.io/lcp/lib/runtime"
 )
 
 func TestTokenizePath(t *testing.T) {
@@ -49,3 +56,260 @@ func TestTokenizePath(t *testing.T) {
 	}
 
 }
+
+type statusErr struct{ code int }
+
+func (e *statusErr) Error() string  { return "status error" }
+func (e *statusErr) GetStatus() int { return e.code }
+
+func TestRouteBuilder_ToErr(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "no error", err: nil, expected: http.StatusOK},
+		{name: "service error", err: NewError(http.StatusConflict, "conflict"), expected: http.StatusConflict},
+		{name: "service error pointer", err: &ServiceError{Code: http.StatusGone, Message: "gone"}, expected: http.StatusGone},
+		{name: "wrapped status error", err: fmt.Errorf("wrapped: %w", &statusErr{code: http.StatusForbidden}), expected: http.StatusForbidden},
+		{name: "plain error", err: errors.New("boom"), expected: http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			container := NewContainer()
+			ws := new(WebService)
+			ws.Path("/api/v1")
+			ws.Route(ws.GET("/items").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+				return tc.err
+			}))
+			container.Add(ws)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+			rec := httptest.NewRecorder()
+			container.Dispatch(rec, req)
+			if rec.Code != tc.expected {
+				t.Errorf("expected status %d, got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRouteBuilder_ToErrCustomHandler(t *testing.T) {
+	container := NewContainer()
+	var handled ServiceError
+	container.ServiceErrorHandler(func(err ServiceError, w http.ResponseWriter, r *http.Request) {
+		handled = err
+		w.WriteHeader(err.Code)
+	})
+	ws := new(WebService)
+	ws.Path("/api/v1")
+	ws.Route(ws.GET("/items").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(http.StatusBadRequest, "bad input")
+	}))
+	container.Add(ws)
+
+	rec := httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items", nil))
+	if handled.Code != http.StatusBadRequest || handled.Message != "bad input" {
+		t.Errorf("unexpected handled error: %+v", handled)
+	}
+}
+
+func TestRouteBuilder_ToErrHidesInternalErrors(t *testing.T) {
+	ws := new(WebService).Path("/api/v1")
+	ws.Route(ws.GET("/items").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("cannot query items: %w", errors.New(`pq: password authentication failed for user "lcp"`))
+	}))
+	container := NewContainer()
+	container.Add(ws)
+
+	rec := httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if body := rec.Body.String(); body != "500: Internal Server Error" {
+		t.Fatalf("unexpected response body; got %q; want %q", body, "500: Internal Server Error")
+	}
+}
+
+func TestRouteBuilder_ToErrFunction(t *testing.T) {
+	ws := new(WebService).Path("/api/v1")
+	ws.Route(ws.GET("/items").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(http.StatusBadRequest, "bad input")
+	}))
+	route := ws.Routes()[0]
+
+	// Route.Function renders errors via the handler of the Container dispatching the request
+	var handled ServiceError
+	container := NewContainer()
+	container.ServiceErrorHandler(func(err ServiceError, w http.ResponseWriter, r *http.Request) {
+		handled = err
+		w.WriteHeader(http.StatusTeapot)
+	})
+	proxy := new(WebService).Path("/proxy")
+	proxy.Route(proxy.GET("/items").To(route.Function))
+	container.Add(proxy)
+	rec := httptest.NewRecorder()
+	container.Dispatch(rec, httptest.NewRequest(http.MethodGet, "/proxy/items", nil))
+	if rec.Code != http.StatusTeapot || handled.Message != "bad input" {
+		t.Fatalf("the custom error handler hasn't been used; status code: %d; handled error: %+v", rec.Code, handled)
+	}
+
+	// the default handler is used outside the Container
+	rec = httptest.NewRecorder()
+	route.Function(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items", nil))
+	if rec.Code != http.StatusBadRequest || rec.Body.String() != "bad input" {
+		t.Fatalf("unexpected response; got %d %q; want %d %q", rec.Code, rec.Body.String(), http.StatusBadRequest, "bad input")
+	}
+}
+
+func TestDispatch_EmptyProduces(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/users").To(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"alice"}`))
+	}))
+	ws.Route(ws.GET("/orders").Produces(MIME_XML).To(func(w http.ResponseWriter, r *http.Request) {}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(path, accept string, statusCodeExpected int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set(HEADER_Accept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s with Accept %q; got %d; want %d", path, accept, rec.Code, statusCodeExpected)
+		}
+	}
+
+	// routes without Produces serve any Accept header
+	f("/api/users", "", http.StatusOK)
+	f("/api/users", "*/*", http.StatusOK)
+	f("/api/users", MIME_JSON, http.StatusOK)
+	f("/api/users", "text/html, application/xhtml+xml;q=0.9", http.StatusOK)
+
+	// explicit Produces are still negotiated
+	f("/api/orders", MIME_XML, http.StatusOK)
+	f("/api/orders", MIME_JSON, http.StatusNotAcceptable)
+}
+
+func TestDispatch_VendorMediaTypes(t *testing.T) {
+	ns := runtime.NewCodecFactory()
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.POST("/users").Consumes("application/*+json").Produces("application/*+json").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		var obj testObj
+		if err := ReadEntity(r, &obj); err != nil {
+			return err
+		}
+		WriteObjectNegotiated(ns, w, r, http.StatusCreated, &obj)
+		return nil
+	}))
+	ws.Route(ws.GET("/orders").Produces(MIME_JSON).To(func(w http.ResponseWriter, r *http.Request) {}))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(method, path, contentType, accept string, statusCodeExpected int, contentTypeExpected string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name":"alice"}`))
+		req.Header.Set(HEADER_ContentType, contentType)
+		req.Header.Set(HEADER_Accept, accept)
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for Content-Type %q and Accept %q; got %d; want %d; body: %s",
+				contentType, accept, rec.Code, statusCodeExpected, rec.Body.String())
+		}
+		if ct := rec.Header().Get(HEADER_ContentType); contentTypeExpected != "" && ct != contentTypeExpected {
+			t.Fatalf("unexpected response Content-Type for Accept %q; got %q; want %q", accept, ct, contentTypeExpected)
+		}
+		if statusCodeExpected == http.StatusCreated && !strings.Contains(rec.Body.String(), `"alice"`) {
+			t.Fatalf("unexpected response body: %s", rec.Body.String())
+		}
+	}
+
+	// JSON-structured vendor types
+	f(http.MethodPost, "/api/users", "application/vnd.lcp.v1+json", "application/vnd.lcp.v1+json", http.StatusCreated, "application/vnd.lcp.v1+json")
+	f(http.MethodPost, "/api/users", "application/vnd.lcp.v1+json; charset=utf-8", "application/vnd.lcp.v2+json", http.StatusCreated, "application/vnd.lcp.v2+json")
+	f(http.MethodPost, "/api/users", MIME_JSON, MIME_JSON, http.StatusCreated, MIME_JSON)
+
+	// types with other structures
+	f(http.MethodPost, "/api/users", "application/vnd.lcp.v1+xml", MIME_JSON, http.StatusUnsupportedMediaType, "")
+	f(http.MethodPost, "/api/users", MIME_JSON, "application/vnd.lcp.v1+xml", http.StatusNotAcceptable, "")
+
+	// vendor types must be declared by the route
+	f(http.MethodGet, "/api/orders", "", "application/vnd.lcp.v1+json", http.StatusNotAcceptable, "")
+}
+
+func TestRoute_MatchesContentType(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		consumes    []string
+		contentType string
+		exp         bool
+	}{
+		{name: "no consumes", method: http.MethodPost, contentType: MIME_XML, exp: true},
+		{name: "json to json", method: http.MethodPost, consumes: []string{MIME_JSON}, contentType: MIME_JSON, exp: true},
+		{name: "json with params to json", method: http.MethodPost, consumes: []string{MIME_JSON}, contentType: "application/json; charset=utf-8", exp: true},
+		{name: "json to xml", method: http.MethodPost, consumes: []string{MIME_XML}, contentType: MIME_JSON, exp: false},
+		{name: "xml to xml", method: http.MethodPut, consumes: []string{MIME_XML}, contentType: MIME_XML, exp: true},
+		{name: "xml to json", method: http.MethodPut, consumes: []string{MIME_JSON}, contentType: MIME_XML, exp: false},
+		{name: "xml to json or xml", method: http.MethodPost, consumes: []string{MIME_JSON, MIME_XML}, contentType: MIME_XML, exp: true},
+		{name: "octet to octet", method: http.MethodPost, consumes: []string{MIME_OCTET}, contentType: MIME_OCTET, exp: true},
+		{name: "octet to json", method: http.MethodPost, consumes: []string{MIME_JSON}, contentType: MIME_OCTET, exp: false},
+		{name: "json to octet", method: http.MethodPost, consumes: []string{MIME_OCTET}, contentType: MIME_JSON, exp: false},
+		{name: "json to wildcard", method: http.MethodPost, consumes: []string{"*/*"}, contentType: MIME_JSON, exp: true},
+		{name: "xml to wildcard", method: http.MethodPost, consumes: []string{"*/*"}, contentType: MIME_XML, exp: true},
+		{name: "json to structured wildcard", method: http.MethodPost, consumes: []string{"application/*+json"}, contentType: "application/vnd.lcp.v1+json", exp: true},
+		{name: "xml to structured wildcard", method: http.MethodPost, consumes: []string{"application/*+json"}, contentType: "application/vnd.lcp.v1+xml", exp: false},
+
+		// missing Content-Type defaults to octet-stream for methods with body
+		{name: "missing to octet", method: http.MethodPost, consumes: []string{MIME_OCTET}, exp: true},
+		{name: "missing to json", method: http.MethodPost, consumes: []string{MIME_JSON}, exp: false},
+		{name: "missing to wildcard", method: http.MethodPatch, consumes: []string{"*/*"}, exp: true},
+		{name: "missing for GET", method: http.MethodGet, consumes: []string{MIME_JSON}, exp: true},
+		{name: "missing for DELETE", method: http.MethodDelete, consumes: []string{MIME_XML}, exp: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &Route{
+				Method:   c.method,
+				Consumes: c.consumes,
+			}
+			if got := r.matchesContentType(c.contentType); got != c.exp {
+				t.Fatalf("unexpected match of %s %q for consumes %q; got %v; want %v", c.method, c.contentType, c.consumes, got, c.exp)
+			}
+		})
+	}
+}
+
+func TestDispatch_ConsumesMismatch(t *testing.T) {
+	ws := new(WebService)
+	ws.Path("/api")
+	ws.Route(ws.POST("/users").Consumes(MIME_XML).To(func(w http.ResponseWriter, r *http.Request) {}))
+	container := NewContainer()
+	container.Add(ws)
+
+	f := func(contentType string, statusCodeExpected int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader("{}"))
+		if contentType != "" {
+			req.Header.Set(HEADER_ContentType, contentType)
+		}
+		rec := httptest.NewRecorder()
+		container.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for Content-Type %q; got %d; want %d", contentType, rec.Code, statusCodeExpected)
+		}
+	}
+
+	f(MIME_XML, http.StatusOK)
+	f(MIME_JSON, http.StatusUnsupportedMediaType)
+	f("", http.StatusUnsupportedMediaType)
+}
@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// requestedAPIVersion returns the API version requested via the X-API-Version header
+// or the version parameter of the Accept header, e.g. "application/json; version=2".
+// The header takes precedence. Zero is returned if no version is requested.
+func requestedAPIVersion(r *http.Request) (int, error) {
+	s := strings.TrimSpace(r.Header.Get(HEADER_APIVersion))
+	if s == "" {
+		s = acceptVersionParam(r.Header.Get(HEADER_Accept))
+		if s == "" {
+			return 0, nil
+		}
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid API version %q; it must be a positive integer", s)
+	}
+	return v, nil
+}
+
+// acceptVersionParam returns the value of the first version parameter found in the Accept header
+func acceptVersionParam(accept string) string {
+	for _, clause := range strings.Split(accept, ",") {
+		params := strings.Split(clause, ";")
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "version") {
+				return strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return ""
+}
+
+// selectRouteVersion returns the route among candidates, which matches the API version requested by r.
+//
+// Only the routes sharing the path of the best matching candidate are considered. If none of them
+// is versioned, the best matching candidate is returned. Otherwise the route with the requested version
+// is selected, falling back to an unversioned route; the latest version is selected if r doesn't request one.
+func selectRouteVersion(candidates []*Route, r *http.Request) (*Route, error) {
+	best := candidates[0]
+	var versioned []*Route
+	var unversioned *Route
+	for _, each := range candidates {
+		if !slices.Equal(each.pathParts, best.pathParts) {
+			continue
+		}
+		if each.Version == 0 {
+			if unversioned == nil {
+				unversioned = each
+			}
+			continue
+		}
+		versioned = append(versioned, each)
+	}
+	if len(versioned) == 0 {
+		return best, nil
+	}
+
+	v, err := requestedAPIVersion(r)
+	if err != nil {
+		return nil, NewError(http.StatusBadRequest, "400: "+err.Error())
+	}
+	if v == 0 {
+		latest := versioned[0]
+		for _, each := range versioned[1:] {
+			if each.Version > latest.Version {
+				latest = each
+			}
+		}
+		return latest, nil
+	}
+	for _, each := range versioned {
+		if each.Version == v {
+			return each, nil
+		}
+	}
+	if unversioned != nil {
+		return unversioned, nil
+	}
+	var available []string
+	for _, each := range versioned {
+		available = append(available, strconv.Itoa(each.Version))
+	}
+	return nil, NewError(
+		http.StatusNotAcceptable,
+		fmt.Sprintf("406: Not Acceptable\n\nAvailable API versions: %s", strings.Join(available, ", ")))
+}
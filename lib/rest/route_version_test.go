@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestedAPIVersion(t *testing.T) {
+	f := func(apiVersion, accept string, versionExpected int, errExpected bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if apiVersion != "" {
+			req.Header.Set(HEADER_APIVersion, apiVersion)
+		}
+		if accept != "" {
+			req.Header.Set(HEADER_Accept, accept)
+		}
+		v, err := requestedAPIVersion(req)
+		if (err != nil) != errExpected {
+			t.Fatalf("unexpected error for X-API-Version %q and Accept %q: %v", apiVersion, accept, err)
+		}
+		if v != versionExpected {
+			t.Fatalf("unexpected version for X-API-Version %q and Accept %q; got %d; want %d", apiVersion, accept, v, versionExpected)
+		}
+	}
+
+	f("", "", 0, false)
+	f("", MIME_JSON, 0, false)
+	f("2", "", 2, false)
+	f("v2", "", 2, false)
+	f("", "application/json; version=3", 3, false)
+	f("", `application/json;q=0.9;Version="3"`, 3, false)
+	f("", "application/yaml, application/json; version=4", 4, false)
+	f("", "application/json; version=", 0, false)
+
+	// the header takes precedence
+	f("2", "application/json; version=3", 2, false)
+
+	f("two", "", 0, true)
+	f("0", "", 0, true)
+	f("-1", "", 0, true)
+	f("", "application/json; version=v", 0, true)
+}
+
+func TestDispatch_RouteVersion(t *testing.T) {
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/users").Version(1).To(handler("users v1")))
+	ws.Route(ws.GET("/users").Version(3).To(handler("users v3")))
+	ws.Route(ws.GET("/users").Version(2).To(handler("users v2")))
+	ws.Route(ws.GET("/orders").To(handler("orders")))
+	ws.Route(ws.GET("/orders").Version(2).To(handler("orders v2")))
+	ws.Route(ws.GET("/items").To(handler("items")))
+	ws.Route(ws.GET("/{kind}").Version(5).To(handler("kind v5")))
+	c := NewContainer()
+	c.Add(ws)
+
+	f := func(path, apiVersion, accept string, statusCodeExpected int, bodyExpected string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiVersion != "" {
+			req.Header.Set(HEADER_APIVersion, apiVersion)
+		}
+		if accept != "" {
+			req.Header.Set(HEADER_Accept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c.Dispatch(rec, req)
+		if rec.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %s with X-API-Version %q and Accept %q; got %d; want %d; body: %s",
+				path, apiVersion, accept, rec.Code, statusCodeExpected, rec.Body.String())
+		}
+		if body := rec.Body.String(); !strings.Contains(body, bodyExpected) {
+			t.Fatalf("unexpected body for %s with X-API-Version %q and Accept %q; got %q; want %q",
+				path, apiVersion, accept, body, bodyExpected)
+		}
+	}
+
+	// the latest version is selected by default
+	f("/api/users", "", "", http.StatusOK, "users v3")
+	f("/api/users", "", MIME_JSON, http.StatusOK, "users v3")
+
+	// explicit versions
+	f("/api/users", "1", "", http.StatusOK, "users v1")
+	f("/api/users", "v2", "", http.StatusOK, "users v2")
+	f("/api/users", "", "application/json; version=1", http.StatusOK, "users v1")
+	f("/api/users", "2", "application/json; version=1", http.StatusOK, "users v2")
+
+	// unregistered and invalid versions
+	f("/api/users", "4", "", http.StatusNotAcceptable, "Available API versions: 1, 3, 2")
+	f("/api/users", "latest", "", http.StatusBadRequest, "invalid API version")
+
+	// the unversioned route serves the versions, which aren't registered
+	f("/api/orders", "", "", http.StatusOK, "orders v2")
+	f("/api/orders", "2", "", http.StatusOK, "orders v2")
+	f("/api/orders", "1", "", http.StatusOK, "orders")
+
+	// versions of less specific routes don't affect unversioned routes
+	f("/api/items", "", "", http.StatusOK, "items")
+	f("/api/items", "7", "", http.StatusOK, "items")
+	f("/api/items", "bogus", "", http.StatusOK, "items")
+	f("/api/things", "", "", http.StatusOK, "kind v5")
+	f("/api/things", "4", "", http.StatusNotAcceptable, "Available API versions: 5")
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -26,3 +27,27 @@ func NewErrorWithHeader(code int, message string, header http.Header) ServiceErr
 func (s ServiceError) Error() string {
 	return fmt.Sprintf("[ServiceError:%v] %v", s.Code, s.Message)
 }
+
+// toServiceError converts an error returned by a route function into a ServiceError.
+// ServiceError values are passed through, errors exposing GetStatus() int
+// (e.g. *apierrors.StatusError, *httpserver.ErrorWithStatusCode) keep their status code,
+// and any other error results in 500 Internal Server Error with a generic message,
+// since the error text may contain internal details such as database errors.
+func toServiceError(err error) ServiceError {
+	if se, ok := errors.AsType[ServiceError](err); ok {
+		return se
+	}
+	if se, ok := errors.AsType[*ServiceError](err); ok && se != nil {
+		return *se
+	}
+	if se, ok := errors.AsType[interface {
+		error
+		GetStatus() int
+	}](err); ok {
+		return NewError(se.GetStatus(), err.Error())
+	}
+	return errInternalServerError
+}
+
+// errInternalServerError is returned to the client instead of errors without a status code
+var errInternalServerError = NewError(http.StatusInternalServerError, "500: Internal Server Error")
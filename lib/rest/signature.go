@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+)
+
+// VerifyHMACSignature verifies the HMAC signature of the raw request body as sent by webhook providers,
+// e.g. VerifyHMACSignature(r, secret, "X-Hub-Signature-256", "sha256") for GitHub.
+//
+// algo must be "sha1" or "sha256". The header value is the hex-encoded HMAC of the body,
+// optionally prefixed with "<algo>=". The body is read (up to the body limit of the route) and replaced
+// with an in-memory copy, so the handler can read it again with ReadEntity or ReadForm.
+//
+// A missing or mismatching signature is returned as 401 Unauthorized (*apierrors.StatusError).
+func VerifyHMACSignature(r *http.Request, secret []byte, headerName, algo string) error {
+	var newHash func() hash.Hash
+	switch algo {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	default:
+		return fmt.Errorf("unsupported HMAC algorithm %q; supported algorithms: sha1, sha256", algo)
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return newBodyReadError(r, err, fmt.Sprintf("cannot read request body: %v", err))
+	}
+	if int64(len(body)) > requestBodyLimit(r) {
+		return apierrors.NewRequestEntityTooLarge(requestBodyLimit(r))
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	signature := r.Header.Get(headerName)
+	if signature == "" {
+		return apierrors.NewUnauthorized(fmt.Sprintf("missing %s header", headerName))
+	}
+	signature = strings.TrimPrefix(signature, algo+"=")
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return apierrors.NewUnauthorized(fmt.Sprintf("malformed %s header", headerName))
+	}
+
+	mac := hmac.New(newHash, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return apierrors.NewUnauthorized("signature mismatch")
+	}
+	return nil
+}
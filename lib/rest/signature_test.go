@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+)
+
+func TestVerifyHMACSignature(t *testing.T) {
+	secret := []byte("s3cr3t")
+	body := `{"ref":"refs/heads/main"}`
+	sign := func(newHash func() hash.Hash, s string) string {
+		mac := hmac.New(newHash, secret)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	f := func(header, signature, algo string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(body))
+		req.Header.Set(header, signature)
+		if err := VerifyHMACSignature(req, secret, header, algo); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// the body must remain readable for the handler
+		got, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatalf("cannot read body: %v", err)
+		}
+		if string(got) != body {
+			t.Fatalf("unexpected body; got %q; want %q", got, body)
+		}
+	}
+
+	f("X-Hub-Signature-256", "sha256="+sign(sha256.New, body), "sha256")
+	f("X-Hub-Signature", "sha1="+sign(sha1.New, body), "sha1")
+	f("X-Gitlab-Signature", sign(sha256.New, body), "sha256")
+}
+
+func TestVerifyHMACSignature_Failure(t *testing.T) {
+	secret := []byte("s3cr3t")
+	f := func(signature string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader("payload"))
+		if signature != "" {
+			req.Header.Set("X-Signature", signature)
+		}
+		err := VerifyHMACSignature(req, secret, "X-Signature", "sha256")
+		if !apierrors.IsUnauthorized(err) {
+			t.Fatalf("expected 401 StatusError; got %v", err)
+		}
+	}
+
+	// missing header
+	f("")
+	// not hex
+	f("sha256=zzzz")
+	// signature of another payload
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("other payload"))
+	f("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	// sha1 signature for sha256 verification
+	mac = hmac.New(sha1.New, secret)
+	mac.Write([]byte("payload"))
+	f("sha1=" + hex.EncodeToString(mac.Sum(nil)))
+
+	req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader("payload"))
+	if err := VerifyHMACSignature(req, secret, "X-Signature", "md5"); err == nil || apierrors.IsUnauthorized(err) {
+		t.Fatalf("expected non-401 error for unsupported algorithm; got %v", err)
+	}
+}
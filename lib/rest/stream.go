@@ -0,0 +1,181 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var slowClientErrors = metrics.NewCounter(`lcp_http_request_errors_total{path="*", reason="slow_client"}`)
+
+// SetWriteDeadline sets the deadline for writing the response to w, so writes to a client, which doesn't read the response,
+// fail with os.ErrDeadlineExceeded instead of blocking the handler forever. The zero t clears the deadline.
+//
+// Streaming handlers should extend the deadline before every write, so only stalled writes fail,
+// and clear it when the response is complete, since HTTP/1.1 connections keep it for the next requests.
+// The request timeout doesn't cover this case, since it cancels the request context, which isn't checked by blocked writes.
+//
+// http.ErrNotSupported is returned if w doesn't support deadlines.
+func SetWriteDeadline(w http.ResponseWriter, t time.Time) error {
+	return http.NewResponseController(w).SetWriteDeadline(t)
+}
+
+// jsonArrayStreamFlushItems is the number of items after which JSONArrayStream flushes the response to the client
+const jsonArrayStreamFlushItems = 128
+
+// JSONArrayStream writes a JSON array to the response item by item, so memory usage stays bounded
+// regardless of the number of items. Use WriteObjectNegotiated for small responses instead.
+//
+//	s := rest.NewJSONArrayStream(w)
+//	for _, item := range items {
+//		if err := s.Write(item); err != nil {
+//			return err
+//		}
+//	}
+//	return s.Close()
+//
+// The response status is 200 OK; errors after the first Write cannot change it anymore.
+type JSONArrayStream struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+	dw  *deadlineWriter
+
+	items     int
+	unflushed int
+	closed    bool
+}
+
+// NewJSONArrayStream returns a JSONArrayStream writing to w and sets the Content-Type of the response.
+//
+// Close must be called after the last item in order to terminate the array.
+func NewJSONArrayStream(w http.ResponseWriter) *JSONArrayStream {
+	w.Header().Set(HEADER_ContentType, MIME_JSON)
+	dw := &deadlineWriter{
+		w:  w,
+		rc: http.NewResponseController(w),
+	}
+	bw := bufio.NewWriter(dw)
+	return &JSONArrayStream{
+		bw:  bw,
+		enc: json.NewEncoder(bw),
+		dw:  dw,
+	}
+}
+
+// WriteTimeout limits the duration of every write of the response to the client, so the stream fails
+// if the client stops reading it, see SetWriteDeadline. Zero d disables the limit, which is the default.
+func (s *JSONArrayStream) WriteTimeout(d time.Duration) *JSONArrayStream {
+	s.dw.timeout = d
+	return s
+}
+
+// Write appends item to the array
+func (s *JSONArrayStream) Write(item any) error {
+	if s.closed {
+		return errors.New("cannot write to closed JSONArrayStream")
+	}
+	sep := byte(',')
+	if s.items == 0 {
+		sep = '['
+	}
+	if err := s.bw.WriteByte(sep); err != nil {
+		return err
+	}
+	if err := s.enc.Encode(item); err != nil {
+		return fmt.Errorf("cannot encode item #%d: %w", s.items, err)
+	}
+	s.items++
+	s.unflushed++
+	if s.unflushed >= jsonArrayStreamFlushItems {
+		return s.flush()
+	}
+	return nil
+}
+
+// Close terminates the array and flushes the response. An empty array is written if no items were written.
+func (s *JSONArrayStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	end := "]"
+	if s.items == 0 {
+		end = "[]"
+	}
+	if _, err := s.bw.WriteString(end); err != nil {
+		return err
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	// Clear the deadline, so it doesn't apply to the next requests on the same connection
+	return s.dw.clearDeadline()
+}
+
+func (s *JSONArrayStream) flush() error {
+	s.unflushed = 0
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+	return s.dw.flush()
+}
+
+// deadlineWriter extends the write deadline of the response before every write if timeout is set
+type deadlineWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	if err := dw.extendDeadline(); err != nil {
+		return 0, err
+	}
+	n, err := dw.w.Write(p)
+	return n, dw.wrapErr(err)
+}
+
+func (dw *deadlineWriter) flush() error {
+	if err := dw.extendDeadline(); err != nil {
+		return err
+	}
+	if err := dw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return dw.wrapErr(err)
+	}
+	return nil
+}
+
+func (dw *deadlineWriter) extendDeadline() error {
+	if dw.timeout <= 0 {
+		return nil
+	}
+	return dw.setDeadline(time.Now().Add(dw.timeout))
+}
+
+func (dw *deadlineWriter) clearDeadline() error {
+	if dw.timeout <= 0 {
+		return nil
+	}
+	return dw.setDeadline(time.Time{})
+}
+
+func (dw *deadlineWriter) setDeadline(t time.Time) error {
+	if err := dw.rc.SetWriteDeadline(t); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("cannot set write deadline: %w", err)
+	}
+	return nil
+}
+
+func (dw *deadlineWriter) wrapErr(err error) error {
+	if err == nil || !errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+	slowClientErrors.Inc()
+	return fmt.Errorf("the client doesn't read the response during %s: %w", dw.timeout, err)
+}
@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONArrayStream(t *testing.T) {
+	f := func(n int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s := NewJSONArrayStream(rec)
+		for i := 0; i < n; i++ {
+			if err := s.Write(&testObj{Name: "item"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("unexpected error on close: %v", err)
+		}
+		if ct := rec.Header().Get(HEADER_ContentType); ct != MIME_JSON {
+			t.Fatalf("unexpected Content-Type; got %q; want %q", ct, MIME_JSON)
+		}
+		var items []testObj
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("cannot parse response %q: %v", rec.Body.String(), err)
+		}
+		if items == nil || len(items) != n {
+			t.Fatalf("unexpected number of items; got %d; want %d", len(items), n)
+		}
+	}
+
+	f(0)
+	f(1)
+	f(jsonArrayStreamFlushItems + 1)
+}
+
+func TestJSONArrayStream_Flush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := NewJSONArrayStream(rec)
+	for i := 0; i < jsonArrayStreamFlushItems; i++ {
+		if err := s.Write(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !rec.Flushed || rec.Body.Len() == 0 {
+		t.Fatalf("expected the response to be flushed after %d items", jsonArrayStreamFlushItems)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %v", err)
+	}
+	if err := s.Write(1); err == nil {
+		t.Fatalf("expected error when writing to closed stream")
+	}
+}
+
+func TestSetWriteDeadline_NotSupported(t *testing.T) {
+	err := SetWriteDeadline(httptest.NewRecorder(), time.Now().Add(time.Second))
+	if !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("unexpected error; got %v; want %v", err, http.ErrNotSupported)
+	}
+}
+
+// startSlowClient sends a GET request to the server at addr and never reads the response
+func startSlowClient(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("cannot connect to %s: %v", addr, err)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		// minimize the amount of response data buffered at the client side
+		_ = tc.SetReadBuffer(4 * 1024)
+	}
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+addr+"\r\n\r\n"); err != nil {
+		t.Fatalf("cannot send request: %v", err)
+	}
+	return conn
+}
+
+func TestSetWriteDeadline_SlowClient(t *testing.T) {
+	handlerErr := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := []byte(strings.Repeat("x", 64*1024))
+		// the amount of data is much bigger than the socket buffers, so writes must stall
+		for i := 0; i < 16*1024; i++ {
+			if err := SetWriteDeadline(w, time.Now().Add(100*time.Millisecond)); err != nil {
+				handlerErr <- err
+				return
+			}
+			if _, err := w.Write(chunk); err != nil {
+				handlerErr <- err
+				return
+			}
+		}
+		handlerErr <- nil
+	}))
+	defer ts.Close()
+
+	conn := startSlowClient(t, ts.Listener.Addr().String())
+	defer conn.Close()
+
+	select {
+	case err := <-handlerErr:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("unexpected error; got %v; want %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the stalled write hasn't been aborted")
+	}
+}
+
+func TestJSONArrayStream_WriteTimeout(t *testing.T) {
+	handlerErr := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := NewJSONArrayStream(w).WriteTimeout(100 * time.Millisecond)
+		item := &testObj{Name: strings.Repeat("x", 1024)}
+		for i := 0; i < 1024*1024; i++ {
+			if err := s.Write(item); err != nil {
+				handlerErr <- err
+				return
+			}
+		}
+		handlerErr <- s.Close()
+	}))
+	defer ts.Close()
+
+	conn := startSlowClient(t, ts.Listener.Addr().String())
+	defer conn.Close()
+
+	slowClientsBefore := slowClientErrors.Get()
+	select {
+	case err := <-handlerErr:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("unexpected error; got %v; want %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the stalled stream hasn't been aborted")
+	}
+	if n := slowClientErrors.Get() - slowClientsBefore; n != 1 {
+		t.Fatalf("unexpected number of slow client errors; got %d; want 1", n)
+	}
+}
+
+func TestJSONArrayStream_WriteTimeoutKeepAlive(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sleep" {
+			// the deadline of the previous stream must not apply to this response
+			time.Sleep(200 * time.Millisecond)
+			_, _ = io.WriteString(w, "ok")
+			return
+		}
+		s := NewJSONArrayStream(w).WriteTimeout(100 * time.Millisecond)
+		if err := s.Write(&testObj{Name: "item"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("unexpected error on close: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	// both requests share the same keep-alive connection
+	client := ts.Client()
+	for _, path := range []string{"/stream", "/sleep"} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("cannot read response for %s: %v", path, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code for %s; got %d; want %d; body: %q", path, resp.StatusCode, http.StatusOK, body)
+		}
+	}
+}
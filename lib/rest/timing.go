@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimingRecorder accumulates named durations of request processing phases for the Server-Timing response header,
+// see https://www.w3.org/TR/server-timing/ . Use Timing in order to obtain the recorder of a request.
+//
+// All the methods may be called on nil TimingRecorder, so handlers don't need to check whether timing is enabled.
+type TimingRecorder struct {
+	mu      sync.Mutex
+	last    time.Time
+	metrics []timingMetric
+}
+
+type timingMetric struct {
+	name     string
+	duration time.Duration
+}
+
+// WithTiming returns r with a new TimingRecorder, which is returned by Timing(r).
+//
+// It is used by the filter writing Server-Timing header.
+func WithTiming(r *http.Request) *http.Request {
+	tr := &TimingRecorder{
+		last: time.Now(),
+	}
+	ctx := context.WithValue(r.Context(), timingKey, tr)
+	return r.WithContext(ctx)
+}
+
+// Timing returns the TimingRecorder of r or nil if r has no recorder, since Server-Timing isn't enabled.
+func Timing(r *http.Request) *TimingRecorder {
+	tr, _ := r.Context().Value(timingKey).(*TimingRecorder)
+	return tr
+}
+
+// Mark records the duration since the previous Mark call under the given name,
+// or since the recorder creation for the first call.
+func (tr *TimingRecorder) Mark(name string) {
+	if tr == nil {
+		return
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	tr.metrics = append(tr.metrics, timingMetric{
+		name:     name,
+		duration: now.Sub(tr.last),
+	})
+	tr.last = now
+	tr.mu.Unlock()
+}
+
+// Measure records the duration d under the given name.
+func (tr *TimingRecorder) Measure(name string, d time.Duration) {
+	if tr == nil {
+		return
+	}
+	tr.mu.Lock()
+	tr.metrics = append(tr.metrics, timingMetric{
+		name:     name,
+		duration: d,
+	})
+	tr.mu.Unlock()
+}
+
+// HeaderValue returns the recorded durations in Server-Timing header format, e.g. "auth;dur=1.2, routing;dur=0.05".
+//
+// Durations are in milliseconds. Characters not allowed in metric names are replaced with '_'.
+func (tr *TimingRecorder) HeaderValue() string {
+	if tr == nil {
+		return ""
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	var b []byte
+	for i, m := range tr.metrics {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		b = append(b, timingMetricName(m.name)...)
+		b = append(b, ";dur="...)
+		b = strconv.AppendFloat(b, float64(m.duration.Microseconds())/1e3, 'f', -1, 64)
+	}
+	return string(b)
+}
+
+// timingMetricName converts name to a valid HTTP token, see https://www.rfc-editor.org/rfc/rfc9110#section-5.6.2
+func timingMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(c rune) rune {
+		if c < 0x80 && isTokenChar(byte(c)) {
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTimingRecorder_Nil(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	tr := Timing(r)
+	if tr != nil {
+		t.Fatalf("unexpected TimingRecorder for request without timing: %v", tr)
+	}
+
+	// the methods must not panic on nil recorder
+	tr.Mark("handler")
+	tr.Measure("db", time.Second)
+	if v := tr.HeaderValue(); v != "" {
+		t.Fatalf("unexpected header value for nil recorder; got %q; want empty", v)
+	}
+}
+
+func TestTimingRecorder_HeaderValue(t *testing.T) {
+	f := func(record func(tr *TimingRecorder), valueExpected string) {
+		t.Helper()
+		tr := Timing(WithTiming(httptest.NewRequest(http.MethodGet, "/", nil)))
+		record(tr)
+		if v := tr.HeaderValue(); v != valueExpected {
+			t.Fatalf("unexpected header value; got %q; want %q", v, valueExpected)
+		}
+	}
+
+	f(func(_ *TimingRecorder) {}, "")
+	f(func(tr *TimingRecorder) {
+		tr.Measure("auth", 1500*time.Microsecond)
+	}, "auth;dur=1.5")
+	f(func(tr *TimingRecorder) {
+		tr.Measure("auth", time.Millisecond)
+		tr.Measure("routing", 50*time.Microsecond)
+		tr.Measure("db", 2*time.Second)
+	}, "auth;dur=1, routing;dur=0.05, db;dur=2000")
+
+	// sub-microsecond precision is dropped
+	f(func(tr *TimingRecorder) {
+		tr.Measure("routing", 1234567*time.Nanosecond)
+	}, "routing;dur=1.234")
+
+	// invalid metric names
+	f(func(tr *TimingRecorder) {
+		tr.Measure("db query", time.Millisecond)
+		tr.Measure("a;b,c=d", time.Millisecond)
+		tr.Measure("", time.Millisecond)
+		tr.Measure("кэш", time.Millisecond)
+	}, "db_query;dur=1, a_b_c_d;dur=1, _;dur=1, ___;dur=1")
+}
+
+func TestTimingRecorder_Mark(t *testing.T) {
+	tr := Timing(WithTiming(httptest.NewRequest(http.MethodGet, "/", nil)))
+	time.Sleep(2 * time.Millisecond)
+	tr.Mark("first")
+	tr.Mark("second")
+
+	v := tr.HeaderValue()
+	m := regexp.MustCompile(`^first;dur=([0-9.]+), second;dur=([0-9.]+)$`).FindStringSubmatch(v)
+	if m == nil {
+		t.Fatalf("unexpected header value: %q", v)
+	}
+	// the first mark is measured since the recorder creation, the second one since the first mark
+	if first, second := tr.metrics[0].duration, tr.metrics[1].duration; first < 2*time.Millisecond || second >= first {
+		t.Fatalf("unexpected durations; first: %s; second: %s", first, second)
+	}
+}
+
+func TestDispatch_TimingRouting(t *testing.T) {
+	var tr *TimingRecorder
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/users").To(func(w http.ResponseWriter, r *http.Request) {
+		tr = Timing(r)
+		if err := ResponseEncoder(w, r)(map[string]string{"name": "alice"}); err != nil {
+			t.Fatalf("cannot encode response: %v", err)
+		}
+	}))
+	c := NewContainer()
+	c.Add(ws)
+
+	rec := httptest.NewRecorder()
+	c.Dispatch(rec, WithTiming(httptest.NewRequest(http.MethodGet, "/api/users", nil)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code; got %d; want %d", rec.Code, http.StatusOK)
+	}
+	if tr == nil {
+		t.Fatalf("missing TimingRecorder in the handler")
+	}
+	v := tr.HeaderValue()
+	if !regexp.MustCompile(`^routing;dur=[0-9.]+, serialization;dur=[0-9.]+$`).MatchString(v) {
+		t.Fatalf("unexpected header value: %q", v)
+	}
+}
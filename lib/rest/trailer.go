@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DeclareTrailers announces the trailers, which are set via SetTrailer after the response body, in the Trailer header.
+// It must be called before the response headers are sent. Declaring trailers is optional, but it lets
+// clients and proxies prepare for them.
+func DeclareTrailers(w http.ResponseWriter, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	w.Header().Add("Trailer", strings.Join(keys, ", "))
+}
+
+// SetTrailer sets the trailer key to value. It may be called after the response body is written,
+// e.g. with a checksum of the streamed data, and before the handler returns.
+//
+// Trailers are sent only with chunked responses, so they are lost if Content-Length is set.
+// This makes them suitable for streaming responses such as JSONArrayStream.
+func SetTrailer(w http.ResponseWriter, key, value string) {
+	w.Header().Set(http.TrailerPrefix+key, value)
+}
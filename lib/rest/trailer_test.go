@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetTrailer(t *testing.T) {
+	ws := new(WebService).Path("/api")
+	ws.Route(ws.GET("/export").ToErr(func(w http.ResponseWriter, r *http.Request) error {
+		DeclareTrailers(w, "X-Checksum", "X-Items")
+		h := sha256.New()
+		bw := io.MultiWriter(w, h)
+		for _, line := range []string{"a\n", "b\n", "c\n"} {
+			if _, err := io.WriteString(bw, line); err != nil {
+				return err
+			}
+			_ = http.NewResponseController(w).Flush()
+		}
+		SetTrailer(w, "X-Checksum", hex.EncodeToString(h.Sum(nil)))
+		SetTrailer(w, "X-Items", "3")
+		// undeclared trailers are sent too
+		SetTrailer(w, "X-Status", "complete")
+		return nil
+	}))
+	c := NewContainer()
+	c.Add(ws)
+	srv := httptest.NewServer(http.HandlerFunc(c.Dispatch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/export")
+	if err != nil {
+		t.Fatalf("cannot perform request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot read response body: %v", err)
+	}
+	if string(body) != "a\nb\nc\n" {
+		t.Fatalf("unexpected response body: %q", body)
+	}
+	sum := sha256.Sum256(body)
+	f := func(key, valueExpected string) {
+		t.Helper()
+		if value := resp.Trailer.Get(key); value != valueExpected {
+			t.Fatalf("unexpected %s trailer; got %q; want %q", key, value, valueExpected)
+		}
+	}
+	f("X-Checksum", hex.EncodeToString(sum[:]))
+	f("X-Items", "3")
+	f("X-Status", "complete")
+}
@@ -0,0 +1,224 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+	"lcp.io/lcp/lib/api/validation"
+	"lcp.io/lcp/lib/runtime"
+	"lcp.io/lcp/lib/utils/yamlutil"
+)
+
+// ReadEntity reads the request body (up to the body limit of the route) and decodes it into v
+// according to the Content-Type header. JSON is assumed if Content-Type is empty,
+// application/yaml bodies are converted to JSON before decoding.
+//
+// Decoding failures are returned as 400 Bad Request (*apierrors.StatusError)
+func ReadEntity(r *http.Request, v any) error {
+	body, err := readBody(r)
+	if err != nil {
+		return newBodyReadError(r, err, fmt.Sprintf("cannot read request body: %v", err))
+	}
+	if int64(len(body)) > requestBodyLimit(r) {
+		return apierrors.NewRequestEntityTooLarge(requestBodyLimit(r))
+	}
+
+	mediaType := MIME_JSON
+	if ct := r.Header.Get(HEADER_ContentType); ct != "" {
+		if mt, _, err := mime.ParseMediaType(ct); err == nil {
+			mediaType = mt
+		}
+		// structured types such as application/vnd.lcp.v1+json are decoded according to their suffix
+		if mt, ok := runtime.ParseMediaType(mediaType); ok && mt.Suffix != "" {
+			mediaType = mt.Type + "/" + mt.Suffix
+		}
+	}
+	switch mediaType {
+	case MIME_JSON:
+	case "application/yaml":
+		body, err = yamlutil.YAMLToJSON(body)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("cannot convert yaml request body: %v", err), nil)
+		}
+	default:
+		return apierrors.NewBadRequest(fmt.Sprintf("unsupported Content-Type: %s", mediaType), nil)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("cannot decode request body: %v", err), nil)
+	}
+	return nil
+}
+
+// ReadEntityAndValidate is ReadEntity followed by Validate
+func ReadEntityAndValidate(r *http.Request, v any) error {
+	if err := ReadEntity(r, v); err != nil {
+		return err
+	}
+	return Validate(v)
+}
+
+// Validate checks the struct v (or pointer to struct) against its `validate` struct tags.
+//
+// Supported rules (comma-separated):
+//   - required: the field must not be the zero value
+//   - min=N, max=N: bounds for the length of strings, slices and maps, or for the value of numbers
+//   - oneof=a b c: the field value must be one of the space-separated values
+//
+// Nested structs are validated recursively. Field names are reported by their json name,
+// e.g. "spec.displayName". All violations are returned as a single 400 Bad Request
+// with validation.ErrorList details, or nil if v is valid. Only the first violated rule
+// is reported per field
+func Validate(v any) error {
+	var errs validation.ErrorList
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if errs.HasErrors() {
+		return apierrors.NewBadRequest("validation failed", errs)
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, prefix string, errs *validation.ErrorList) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		var path string
+		if sf.Anonymous && name == sf.Name {
+			// embedded struct without json name: its fields are inlined
+			path = strings.TrimSuffix(prefix, ".")
+		} else {
+			path = prefix + name
+		}
+
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			for _, rule := range splitRules(tag) {
+				if msg := checkRule(fv, rule); msg != "" {
+					// report only the first violated rule per field
+					*errs = append(*errs, validation.FieldError{Field: path, Message: msg})
+					break
+				}
+			}
+		}
+
+		nestedPrefix := path + "."
+		if path == "" {
+			nestedPrefix = ""
+		}
+		validateValue(fv, nestedPrefix, errs)
+	}
+}
+
+// fieldName returns the json name of the field, falling back to the Go field name
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func splitRules(tag string) []string {
+	var rules []string
+	for _, rule := range strings.Split(tag, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// checkRule returns a violation message for the given rule, or an empty string if fv satisfies it
+func checkRule(fv reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if fv.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		if isEmptyOptional(fv) {
+			return ""
+		}
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid %s rule %q", name, rule)
+		}
+		n, isLen, ok := measure(fv)
+		if !ok {
+			return ""
+		}
+		if name == "min" && n < limit {
+			if isLen {
+				return fmt.Sprintf("must have at least %s items or characters", arg)
+			}
+			return fmt.Sprintf("must be greater than or equal to %s", arg)
+		}
+		if name == "max" && n > limit {
+			if isLen {
+				return fmt.Sprintf("must have at most %s items or characters", arg)
+			}
+			return fmt.Sprintf("must be less than or equal to %s", arg)
+		}
+	case "oneof":
+		if isEmptyOptional(fv) {
+			return ""
+		}
+		value := fmt.Sprint(reflect.Indirect(fv).Interface())
+		allowed := strings.Fields(arg)
+		for _, a := range allowed {
+			if a == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of: %s", strings.Join(allowed, ", "))
+	}
+	return ""
+}
+
+// isEmptyOptional returns true for nil pointers, which are skipped by all rules except required
+func isEmptyOptional(fv reflect.Value) bool {
+	return fv.Kind() == reflect.Pointer && fv.IsNil()
+}
+
+// measure returns the value compared by min/max rules: the length for strings, slices and maps
+// (isLen=true), or the numeric value for numbers
+func measure(fv reflect.Value) (n float64, isLen bool, ok bool) {
+	fv = reflect.Indirect(fv)
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(len([]rune(fv.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false, true
+	}
+	return 0, false, false
+}
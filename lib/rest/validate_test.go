@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apierrors "lcp.io/lcp/lib/api/errors"
+	"lcp.io/lcp/lib/api/validation"
+)
+
+type validateSpec struct {
+	DisplayName string   `json:"displayName" validate:"required,min=1,max=8"`
+	Replicas    int      `json:"replicas" validate:"min=1,max=3"`
+	Status      string   `json:"status" validate:"oneof=active inactive"`
+	Tags        []string `json:"tags,omitempty" validate:"max=2"`
+	Email       *string  `json:"email,omitempty" validate:"min=3"`
+}
+
+type validateObj struct {
+	Name string       `json:"name" validate:"required"`
+	Spec validateSpec `json:"spec"`
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		obj    *validateObj
+		fields []string
+	}{
+		{
+			name: "valid",
+			obj:  &validateObj{Name: "a", Spec: validateSpec{DisplayName: "x", Replicas: 1, Status: "active"}},
+		},
+		{
+			name:   "missing required",
+			obj:    &validateObj{Spec: validateSpec{Replicas: 1, Status: "active"}},
+			fields: []string{"name", "spec.displayName"},
+		},
+		{
+			name:   "out of bounds",
+			obj:    &validateObj{Name: "a", Spec: validateSpec{DisplayName: "too-long-name", Replicas: 5, Status: "active", Tags: []string{"a", "b", "c"}}},
+			fields: []string{"spec.displayName", "spec.replicas", "spec.tags"},
+		},
+		{
+			name:   "oneof and pointer",
+			obj:    &validateObj{Name: "a", Spec: validateSpec{DisplayName: "x", Replicas: 1, Status: "unknown", Email: new("a")}},
+			fields: []string{"spec.status", "spec.email"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.obj)
+			if len(tc.fields) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			se, ok := err.(*apierrors.StatusError)
+			if !ok || se.Status != http.StatusBadRequest {
+				t.Fatalf("expected 400 StatusError, got %v", err)
+			}
+			errs := se.Details.(validation.ErrorList)
+			if len(errs) != len(tc.fields) {
+				t.Fatalf("expected %d field errors, got %v", len(tc.fields), errs)
+			}
+			for i, field := range tc.fields {
+				if errs[i].Field != field {
+					t.Errorf("error[%d]: expected field %q, got %q", i, field, errs[i].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestReadEntityAndValidate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(`{"name":"a","spec":{"displayName":"x","replicas":2,"status":"active"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	var obj validateObj
+	if err := ReadEntityAndValidate(req, &obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj.Spec.Replicas != 2 {
+		t.Errorf("expected replicas 2, got %d", obj.Spec.Replicas)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/test", strings.NewReader("name: a\nspec:\n  replicas: 9\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	err := ReadEntityAndValidate(req, &validateObj{})
+	if se, ok := err.(*apierrors.StatusError); !ok || se.Status != http.StatusBadRequest {
+		t.Fatalf("expected 400 StatusError, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(`{"name":`))
+	err = ReadEntity(req, &validateObj{})
+	if se, ok := err.(*apierrors.StatusError); !ok || se.Status != http.StatusBadRequest {
+		t.Fatalf("expected 400 StatusError for malformed body, got %v", err)
+	}
+}
@@ -17,12 +17,14 @@ import (
 type WebService struct {
 	rootPath   string
 	pathExpr   *pathExpression // cached compilation of rootPath as RegExp
+	host       *hostPattern    // optional host the WebService is bound to
 	routes     []Route
 	produces   []string
 	consumes   []string
 	apiVersion string
+	filters    []FilterFunction
 
-	// protects `routes` if dynamic routes
+	// protects `routes` and `filters` if dynamic routes
 	routesLock sync.RWMutex
 }
 
@@ -42,6 +44,59 @@ func (w *WebService) Path(root string) *WebService {
 	return w
 }
 
+// Host binds the WebService to requests with a matching Host header, e.g. "tenant-a.lcp.io" or "*.lcp.io",
+// where "*" matches exactly one label. The port of the Host header is ignored.
+//
+// A "{name}" label matches one label like "*" and captures it, so for "{tenant}.lcp.io" the handlers
+// get the tenant via PathParam(r, "tenant"). Path parameters with the same name take precedence.
+//
+// WebServices without Host match any host. If several WebServices match the request path, the router prefers
+// the ones bound to the most specific host pattern, so WebServices with the same root path may serve different hosts.
+func (w *WebService) Host(pattern string) *WebService {
+	hp, err := newHostPattern(pattern)
+	if err != nil {
+		logger.Fatalf("invalid host: %v", err)
+	}
+	w.host = hp
+	return w
+}
+
+// HostPattern returns the host pattern set via Host or an empty string if the WebService matches any host
+func (w *WebService) HostPattern() string {
+	if w.host == nil {
+		return ""
+	}
+	return w.host.pattern
+}
+
+// matchHost returns whether the WebService matches the request host and the score of the match. See Host
+func (w *WebService) matchHost(host string) (bool, int) {
+	if w.host == nil {
+		return true, 0
+	}
+	return w.host.match(host)
+}
+
+// mergeHostParams adds the parameters captured from the request host to pathParams. See Host
+func (w *WebService) mergeHostParams(host string, pathParams map[string]string) map[string]string {
+	if w.host == nil {
+		return pathParams
+	}
+	hostParams := w.host.params(host)
+	if len(hostParams) == 0 {
+		return pathParams
+	}
+	if pathParams == nil {
+		pathParams = make(map[string]string, len(hostParams))
+	}
+	for name, value := range hostParams {
+		if _, ok := pathParams[name]; !ok {
+			pathParams[name] = value
+		}
+	}
+	return pathParams
+}
+
 // Route creates a new Route using the RouteBuilder and add to the ordered list of Routes
 func (w *WebService) Route(builder *RouteBuilder) *WebService {
 	w.routesLock.Lock()
@@ -63,6 +118,15 @@ func (w *WebService) Routes() []Route {
 	return result
 }
 
+// routesSnapshot returns the routes of w without copying them for dispatching.
+// The result must not be modified; it is safe to read while routes are added or removed,
+// since Route only appends beyond its length and RemoveRoute replaces the slice
+func (w *WebService) routesSnapshot() []Route {
+	w.routesLock.RLock()
+	defer w.routesLock.RUnlock()
+	return w.routes
+}
+
 // RemoveRoute removes the specified route, looks for something that matches 'path' and 'method'
 func (w *WebService) RemoveRoute(path, method string) error {
 	w.routesLock.Lock()
@@ -78,8 +142,25 @@ func (w *WebService) RemoveRoute(path, method string) error {
 	return nil
 }
 
+// Filter adds a filter running for the routes of this WebService only, e.g. authentication of an API group.
+// WebService filters run after the Container filters and before the route filters; see FilterFunction.
+func (w *WebService) Filter(filter FilterFunction) *WebService {
+	w.routesLock.Lock()
+	defer w.routesLock.Unlock()
+	w.filters = append(w.filters, filter)
+	return w
+}
+
+// Filters returns the filters of this WebService
+func (w *WebService) Filters() []FilterFunction {
+	w.routesLock.RLock()
+	defer w.routesLock.RUnlock()
+	return w.filters
+}
+
 // Produces specifies that this WebService can produce one or more MIME types.
 // Http requests must have one of these values set for the Accept header.
+// Routes of a WebService without Produces accept any Accept header, unless they set Produces themselves.
 func (w *WebService) Produces(contentTypes ...string) *WebService {
 	w.produces = contentTypes
 	return w
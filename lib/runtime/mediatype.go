@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"strings"
+)
+
+// MediaType is a parsed media type, e.g. "application/vnd.lcp.v1+json"
+type MediaType struct {
+	// Type is the primary type, e.g. "application"
+	Type string
+
+	// SubType is the subtype including the structured syntax suffix, e.g. "vnd.lcp.v1+json"
+	SubType string
+
+	// Suffix is the structured syntax suffix of SubType, e.g. "json" for "vnd.lcp.v1+json"
+	// See https://www.rfc-editor.org/rfc/rfc6839
+	Suffix string
+}
+
+// ParseMediaType parses s such as "application/vnd.lcp.v1+json; charset=utf-8" into a MediaType.
+// Parameters are ignored and the type is lower-cased, since media types are case-insensitive.
+// It returns false if s isn't a media type.
+func ParseMediaType(s string) (MediaType, bool) {
+	if n := strings.IndexByte(s, ';'); n >= 0 {
+		s = s[:n]
+	}
+	typ, subType, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "/")
+	typ = strings.TrimSpace(typ)
+	subType = strings.TrimSpace(subType)
+	if !ok || typ == "" || subType == "" {
+		return MediaType{}, false
+	}
+	mt := MediaType{
+		Type:    typ,
+		SubType: subType,
+	}
+	if n := strings.LastIndexByte(subType, '+'); n >= 0 {
+		mt.Suffix = subType[n+1:]
+	}
+	return mt, true
+}
+
+// String returns the media type in "type/subtype" form
+func (mt MediaType) String() string {
+	return mt.Type + "/" + mt.SubType
+}
+
+// StructuredSubType returns the subtype describing the syntax of mt, e.g. "json"
+// for both "application/json" and "application/vnd.lcp.v1+json"
+func (mt MediaType) StructuredSubType() string {
+	if mt.Suffix != "" {
+		return mt.Suffix
+	}
+	return mt.SubType
+}
+
+// Matches reports whether mt matches the pattern, which may contain wildcards:
+//
+//   - "*/*" matches any media type
+//   - "application/*" matches any media type of the application type
+//   - "application/*+json" matches JSON-structured media types of the application type,
+//     e.g. "application/json" and "application/vnd.lcp.v1+json"
+func (mt MediaType) Matches(pattern MediaType) bool {
+	if pattern.Type == "*" && pattern.SubType == "*" {
+		return true
+	}
+	if pattern.Type != mt.Type {
+		return false
+	}
+	switch {
+	case pattern.SubType == "*":
+		return true
+	case strings.HasPrefix(pattern.SubType, "*+"):
+		return mt.StructuredSubType() == pattern.Suffix
+	default:
+		return pattern.SubType == mt.SubType
+	}
+}
@@ -0,0 +1,86 @@
+package runtime
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseMediaType(t *testing.T) {
+	f := func(s string, expected MediaType, okExpected bool) {
+		t.Helper()
+		mt, ok := ParseMediaType(s)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for %q; got %v; want %v", s, ok, okExpected)
+		}
+		if mt != expected {
+			t.Fatalf("unexpected media type for %q; got %#v; want %#v", s, mt, expected)
+		}
+	}
+
+	f("application/json", MediaType{Type: "application", SubType: "json"}, true)
+	f(" Application/JSON ; charset=utf-8", MediaType{Type: "application", SubType: "json"}, true)
+	f("application/vnd.lcp.v1+json", MediaType{Type: "application", SubType: "vnd.lcp.v1+json", Suffix: "json"}, true)
+	f("application/*+json;q=0.9", MediaType{Type: "application", SubType: "*+json", Suffix: "json"}, true)
+	f("*/*", MediaType{Type: "*", SubType: "*"}, true)
+
+	f("", MediaType{}, false)
+	f("json", MediaType{}, false)
+	f("application/", MediaType{}, false)
+	f("/json", MediaType{}, false)
+}
+
+func TestMediaTypeMatches(t *testing.T) {
+	f := func(s, pattern string, resultExpected bool) {
+		t.Helper()
+		mt, _ := ParseMediaType(s)
+		p, _ := ParseMediaType(pattern)
+		if result := mt.Matches(p); result != resultExpected {
+			t.Fatalf("unexpected result for %q matching %q; got %v; want %v", s, pattern, result, resultExpected)
+		}
+	}
+
+	f("application/json", "application/json", true)
+	f("application/json", "*/*", true)
+	f("application/json", "application/*", true)
+	f("application/json", "application/*+json", true)
+	f("application/vnd.lcp.v1+json", "application/*+json", true)
+	f("application/vnd.lcp.v1+json", "application/vnd.lcp.v1+json", true)
+
+	// vendor types must be declared explicitly or via a structured pattern
+	f("application/vnd.lcp.v1+json", "application/json", false)
+	f("application/vnd.lcp.v1+json", "application/vnd.lcp.v2+json", false)
+	f("application/vnd.lcp.v1+xml", "application/*+json", false)
+	f("text/vnd.lcp+json", "application/*+json", false)
+}
+
+func TestNegotiateOutputMediaType_StructuredSuffix(t *testing.T) {
+	ns := NewCodecFactory()
+	f := func(accept, mediaTypeExpected, subTypeExpected string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		result, err := NegotiateOutputMediaType(req, ns)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", accept, err)
+		}
+		if result.MediaType != mediaTypeExpected {
+			t.Fatalf("unexpected media type for %q; got %q; want %q", accept, result.MediaType, mediaTypeExpected)
+		}
+		info, _ := SerializerInfoForMediaType(ns.SupportedMediaTypes(), result.MediaType)
+		if info.MediaTypeSubType != subTypeExpected {
+			t.Fatalf("unexpected serializer for %q; got %q; want %q", accept, info.MediaTypeSubType, subTypeExpected)
+		}
+	}
+
+	f("application/json", "application/json", "json")
+	f("application/vnd.lcp.v1+json", "application/vnd.lcp.v1+json", "json")
+	f("application/vnd.lcp.v1+yaml", "application/vnd.lcp.v1+yaml", "yaml")
+	f("application/*+json", "application/json", "json")
+	f("application/vnd.lcp.v1+xml, application/vnd.lcp.v1+json;q=0.9", "application/vnd.lcp.v1+json", "json")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/vnd.lcp.v1+xml")
+	if _, err := NegotiateOutputMediaType(req, ns); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported structured suffix")
+	}
+}
@@ -14,12 +14,6 @@ type NegotiateResult struct {
 	Serializer Serializer
 }
 
-// mediaTypeClause represents a single clause from the Accept header
-type mediaTypeClause struct {
-	Type    string // e.g. "application"
-	SubType string // e.g. "json"
-}
-
 // NotAcceptableError is returned when none of the registered serializers
 // match the client's Accept header
 type NotAcceptableError struct {
@@ -64,8 +58,14 @@ func NegotiateOutputMediaType(req *http.Request, ns NegotiatedSerializer) (Negot
 		for _, info := range supported {
 			if mediaTypeMatches(clause, info) {
 				s := chooseSerializer(info, isPrettyPrint(req))
+				mediaType := info.MediaType
+				if clause.Suffix != "" && !strings.Contains(clause.SubType, "*") {
+					// respond with the requested structured type, e.g. application/vnd.lcp.v1+json,
+					// so the client gets the version of the representation it asked for
+					mediaType = clause.String()
+				}
 				return NegotiateResult{
-					MediaType:  info.MediaType,
+					MediaType:  mediaType,
 					Serializer: s,
 				}, nil
 			}
@@ -78,22 +78,15 @@ func NegotiateOutputMediaType(req *http.Request, ns NegotiatedSerializer) (Negot
 }
 
 // parseAccept splits an Accept header value into clauses
-func parseAccept(accept string) []mediaTypeClause {
-	var clauses []mediaTypeClause
+func parseAccept(accept string) []MediaType {
+	var clauses []MediaType
 	for _, part := range strings.Split(accept, ",") {
-		part = strings.TrimSpace(part)
-		// Strip parameters (e.g. ";q=0.9", ";charset=utf-8")
-		if idx := strings.IndexByte(part, ';'); idx >= 0 {
-			part = strings.TrimSpace(part[:idx])
-		}
-		slash := strings.IndexByte(part, '/')
-		if slash < 0 {
+		// Parameters (e.g. ";q=0.9", ";charset=utf-8") are stripped
+		mt, ok := ParseMediaType(part)
+		if !ok {
 			continue
 		}
-		clauses = append(clauses, mediaTypeClause{
-			Type:    strings.TrimSpace(part[:slash]),
-			SubType: strings.TrimSpace(part[slash+1:]),
-		})
+		clauses = append(clauses, mt)
 	}
 	return clauses
 }
@@ -120,16 +113,19 @@ func isPrettyPrint(req *http.Request) bool {
 }
 
 // mediaTypeMatches checks whether an Accept clause matches a SerializerInfo
-// Supports wildcard matching ("*/*" and "application/*")
-func mediaTypeMatches(clause mediaTypeClause, info SerializerInfo) bool {
+// Supports wildcard matching ("*/*", "application/*" and "application/*+json")
+// and structured syntax suffixes, so "application/vnd.lcp.v1+json" matches the JSON serializer
+func mediaTypeMatches(clause MediaType, info SerializerInfo) bool {
 	if clause.Type == "*" && clause.SubType == "*" {
 		return true
 	}
-	if strings.EqualFold(clause.Type, info.MediaTypeType) && clause.SubType == "*" {
+	if !strings.EqualFold(clause.Type, info.MediaTypeType) {
+		return false
+	}
+	if clause.SubType == "*" {
 		return true
 	}
-	return strings.EqualFold(clause.Type, info.MediaTypeType) &&
-		strings.EqualFold(clause.SubType, info.MediaTypeSubType)
+	return strings.EqualFold(clause.StructuredSubType(), info.MediaTypeSubType)
 }
 
 func supportedMediaTypes(infos []SerializerInfo) []string {
@@ -25,9 +25,16 @@ type SerializerInfo struct {
 
 // SerializerInfoForMediaType finds the SerializerInfo that matches the given
 // media type string. Returns the matched info and true, or a zero value and false
+//
+// Parameters of the media type are ignored and structured types are matched by their suffix,
+// so "application/vnd.lcp.v1+json; charset=utf-8" matches the "application/json" serializer
 func SerializerInfoForMediaType(types []SerializerInfo, mediaType string) (SerializerInfo, bool) {
+	mt, ok := ParseMediaType(mediaType)
+	if !ok {
+		return SerializerInfo{}, false
+	}
 	for _, info := range types {
-		if strings.EqualFold(info.MediaType, mediaType) {
+		if strings.EqualFold(info.MediaTypeType, mt.Type) && strings.EqualFold(info.MediaTypeSubType, mt.StructuredSubType()) {
 			return info, true
 		}
 	}
@@ -0,0 +1,46 @@
+package httputil
+
+import (
+	"net/http"
+	"time"
+)
+
+// CheckNotModified sets the Last-Modified header to lastModified and checks it against
+// the If-Modified-Since request header.
+//
+// It returns true after writing 304 Not Modified if the client's cached copy is current;
+// the caller must not write the response body in this case.
+// It returns false if the response must be generated as usual.
+func CheckNotModified(w http.ResponseWriter, r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() || lastModified.Equal(time.Unix(0, 0)) {
+		return false
+	}
+	// HTTP dates have one-second resolution
+	lastModified = lastModified.Truncate(time.Second)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	// If-None-Match takes precedence over If-Modified-Since, see https://www.rfc-editor.org/rfc/rfc9110#section-13.1.3
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	if lastModified.After(t) {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
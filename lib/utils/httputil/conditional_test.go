@@ -0,0 +1,47 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	lastModified := time.Date(2026, 1, 2, 3, 4, 5, 600, time.UTC)
+
+	cases := []struct {
+		name        string
+		method      string
+		header      map[string]string
+		notModified bool
+	}{
+		{name: "no conditional header", method: http.MethodGet},
+		{name: "cached copy is current", method: http.MethodGet, header: map[string]string{"If-Modified-Since": "Fri, 02 Jan 2026 03:04:05 GMT"}, notModified: true},
+		{name: "cached copy is newer", method: http.MethodHead, header: map[string]string{"If-Modified-Since": "Sat, 03 Jan 2026 00:00:00 GMT"}, notModified: true},
+		{name: "cached copy is stale", method: http.MethodGet, header: map[string]string{"If-Modified-Since": "Thu, 01 Jan 2026 00:00:00 GMT"}},
+		{name: "malformed date", method: http.MethodGet, header: map[string]string{"If-Modified-Since": "yesterday"}},
+		{name: "non-GET method", method: http.MethodPost, header: map[string]string{"If-Modified-Since": "Fri, 02 Jan 2026 03:04:05 GMT"}},
+		{name: "If-None-Match takes precedence", method: http.MethodGet, header: map[string]string{"If-Modified-Since": "Fri, 02 Jan 2026 03:04:05 GMT", "If-None-Match": `"abc"`}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/test", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			got := CheckNotModified(rec, req, lastModified)
+			if got != tc.notModified {
+				t.Fatalf("expected %v, got %v", tc.notModified, got)
+			}
+			if lm := rec.Header().Get("Last-Modified"); lm != "Fri, 02 Jan 2026 03:04:05 GMT" {
+				t.Errorf("unexpected Last-Modified header: %q", lm)
+			}
+			if tc.notModified && rec.Code != http.StatusNotModified {
+				t.Errorf("expected 304, got %d", rec.Code)
+			}
+		})
+	}
+}
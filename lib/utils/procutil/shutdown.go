@@ -0,0 +1,75 @@
+package procutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+var (
+	shutdownHooksLock sync.Mutex
+	shutdownHooks     []func(ctx context.Context) error
+)
+
+// OnShutdown registers fn to be called by RunShutdownHooks during graceful shutdown.
+//
+// Hooks are called in LIFO order, so components registered later (which usually depend
+// on components registered earlier) are stopped first.
+// fn must return when ctx is done.
+func OnShutdown(fn func(ctx context.Context) error) {
+	shutdownHooksLock.Lock()
+	shutdownHooks = append(shutdownHooks, fn)
+	shutdownHooksLock.Unlock()
+}
+
+// RunShutdownHooks calls the hooks registered via OnShutdown in LIFO order until ctx is done.
+//
+// Hook failures are logged and returned joined together. Hooks, which haven't been started
+// before ctx is done, are skipped. Registered hooks are removed, so subsequent calls are no-op.
+func RunShutdownHooks(ctx context.Context) error {
+	shutdownHooksLock.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownHooksLock.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		name := funcName(hooks[i])
+		if err := runShutdownHook(ctx, hooks[i]); err != nil {
+			logger.Errorf("shutdown hook %s failed: %s", name, err)
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", name, err))
+		}
+		if ctx.Err() != nil && i > 0 {
+			logger.Errorf("skipping %d remaining shutdown hooks: %s", i, ctx.Err())
+			errs = append(errs, fmt.Errorf("%d shutdown hooks skipped: %w", i, ctx.Err()))
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runShutdownHook runs fn and waits until it returns or ctx is done
+func runShutdownHook(ctx context.Context, fn func(ctx context.Context) error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func funcName(fn any) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
@@ -0,0 +1,55 @@
+package procutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunShutdownHooks_LIFO(t *testing.T) {
+	var order []int
+	for i := 0; i < 3; i++ {
+		OnShutdown(func(_ context.Context) error {
+			order = append(order, i)
+			if i == 1 {
+				return errors.New("flush failed")
+			}
+			return nil
+		})
+	}
+
+	err := RunShutdownHooks(context.Background())
+	if err == nil {
+		t.Fatalf("expected error from the failed hook")
+	}
+	if !reflect.DeepEqual(order, []int{2, 1, 0}) {
+		t.Fatalf("unexpected hooks order: %v", order)
+	}
+	if err := RunShutdownHooks(context.Background()); err != nil {
+		t.Fatalf("expected no-op on the second call, got %v", err)
+	}
+}
+
+func TestRunShutdownHooks_Deadline(t *testing.T) {
+	called := false
+	OnShutdown(func(_ context.Context) error {
+		called = true
+		return nil
+	})
+	OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := RunShutdownHooks(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+	if called {
+		t.Fatalf("hooks after the deadline must be skipped")
+	}
+}
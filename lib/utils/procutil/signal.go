@@ -16,6 +16,10 @@ var onlyOneSignalHandler = make(chan struct{})
 // SetupSignalContext registers for SIGTERM and SIGINT.
 // A context is returned which is cancelled on one of these signals.
 // If a second signal is caught, the program is terminated with exit code 1.
+//
+// It must be called at the start of the program before starting any components, so signals received
+// during startup aren't lost. Such signals cancel the returned context, so the caller may check it
+// before starting listeners and stop the already started components in an orderly manner.
 func SetupSignalContext() context.Context {
 	close(onlyOneSignalHandler) // panics if called twice
 
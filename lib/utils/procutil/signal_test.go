@@ -0,0 +1,24 @@
+//go:build !windows
+
+package procutil
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSetupSignalContext_SignalDuringStartup(t *testing.T) {
+	ctx := SetupSignalContext()
+
+	// Simulate SIGTERM received before the program reaches the point where it waits for ctx.
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("cannot send SIGTERM: %s", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the context must be cancelled after SIGTERM received during startup")
+	}
+}
@@ -0,0 +1,121 @@
+package procutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"lcp.io/lcp/lib/logger"
+)
+
+type startupHook struct {
+	name string
+	deps []string
+	fn   func() error
+}
+
+var (
+	startupHooksLock sync.Mutex
+	startupHooks     []startupHook
+)
+
+// OnStartup registers fn under the given name to be called by RunStartupHooks
+// after the hooks for all the deps have been called.
+//
+// Hooks without mutual dependencies are called in registration order.
+func OnStartup(name string, deps []string, fn func() error) {
+	startupHooksLock.Lock()
+	startupHooks = append(startupHooks, startupHook{
+		name: name,
+		deps: deps,
+		fn:   fn,
+	})
+	startupHooksLock.Unlock()
+}
+
+// RunStartupHooks calls the hooks registered via OnStartup in dependency order.
+//
+// It stops at the first failed hook and returns its error. An error is returned without calling
+// any hook if hook names are duplicated, a dependency isn't registered or dependencies form a cycle.
+// Registered hooks are removed, so subsequent calls are no-op.
+func RunStartupHooks() error {
+	startupHooksLock.Lock()
+	hooks := startupHooks
+	startupHooks = nil
+	startupHooksLock.Unlock()
+
+	ordered, err := sortStartupHooks(hooks)
+	if err != nil {
+		return err
+	}
+	for _, h := range ordered {
+		if err := h.fn(); err != nil {
+			return fmt.Errorf("startup hook %q failed: %w", h.name, err)
+		}
+		logger.Infof("startup hook %q completed", h.name)
+	}
+	return nil
+}
+
+// sortStartupHooks orders hooks, so every hook goes after its dependencies
+func sortStartupHooks(hooks []startupHook) ([]startupHook, error) {
+	byName := make(map[string]int, len(hooks))
+	for i, h := range hooks {
+		if _, ok := byName[h.name]; ok {
+			return nil, fmt.Errorf("duplicate startup hook %q", h.name)
+		}
+		byName[h.name] = i
+	}
+	for _, h := range hooks {
+		for _, dep := range h.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("startup hook %q depends on unregistered hook %q", h.name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(hooks))
+	ordered := make([]startupHook, 0, len(hooks))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[indexOf(path, hooks[i].name):], hooks[i].name)
+			return fmt.Errorf("startup hooks dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[i] = visiting
+		path = append(path, hooks[i].name)
+		for _, dep := range hooks[i].deps {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		ordered = append(ordered, hooks[i])
+		return nil
+	}
+	for i := range hooks {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+func indexOf(a []string, s string) int {
+	for i, v := range a {
+		if v == s {
+			return i
+		}
+	}
+	return 0
+}
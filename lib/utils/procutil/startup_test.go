@@ -0,0 +1,77 @@
+package procutil
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunStartupHooks_Order(t *testing.T) {
+	var order []string
+	hook := func(name string) func() error {
+		return func() error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	OnStartup("servers", []string{"metrics", "config"}, hook("servers"))
+	OnStartup("metrics", []string{"logger"}, hook("metrics"))
+	OnStartup("config", nil, hook("config"))
+	OnStartup("logger", []string{"config"}, hook("logger"))
+
+	if err := RunStartupHooks(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"config", "logger", "metrics", "servers"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("unexpected order\nexpected: %v\ngot: %v", expected, order)
+	}
+}
+
+func TestRunStartupHooks_Cycle(t *testing.T) {
+	called := false
+	noop := func() error {
+		called = true
+		return nil
+	}
+	OnStartup("config", nil, noop)
+	OnStartup("a", []string{"config", "c"}, noop)
+	OnStartup("b", []string{"a"}, noop)
+	OnStartup("c", []string{"b"}, noop)
+
+	err := RunStartupHooks()
+	if err == nil || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	if called {
+		t.Fatalf("no hooks must be called when a cycle is detected")
+	}
+}
+
+func TestRunStartupHooks_Errors(t *testing.T) {
+	OnStartup("a", []string{"missing"}, func() error { return nil })
+	if err := RunStartupHooks(); err == nil || !strings.Contains(err.Error(), `unregistered hook "missing"`) {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+
+	OnStartup("a", nil, func() error { return nil })
+	OnStartup("a", nil, func() error { return nil })
+	if err := RunStartupHooks(); err == nil || !strings.Contains(err.Error(), `duplicate startup hook "a"`) {
+		t.Fatalf("expected duplicate hook error, got %v", err)
+	}
+
+	errInit := errors.New("init failed")
+	calledAfterFailure := false
+	OnStartup("a", nil, func() error { return errInit })
+	OnStartup("b", []string{"a"}, func() error {
+		calledAfterFailure = true
+		return nil
+	})
+	if err := RunStartupHooks(); !errors.Is(err, errInit) {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+	if calledAfterFailure {
+		t.Fatalf("hooks after the failed one must not be called")
+	}
+}
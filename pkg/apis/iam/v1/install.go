@@ -39,6 +39,13 @@ func NewIAMModule(ctx context.Context, database *db.DB) ModuleResult {
 	}
 }
 
+// NewAPIGroupInfo builds the IAM API group without seeding the database.
+// It is used for inspecting the API routes, e.g. by -dryRun.
+func NewAPIGroupInfo(database *db.DB) *rest.APIGroupInfo {
+	group, _ := newAPIGroupInfo(database)
+	return group
+}
+
 // newAPIGroupInfo initializes the full IAM storage stack and builds the API group.
 func newAPIGroupInfo(database *db.DB) (*rest.APIGroupInfo, *iam.RESTStorageProvider) {
 	p := iam.NewRESTStorageProvider(iamstore.NewStores(database))
@@ -29,28 +29,11 @@ type Result struct {
 // NewAPIGroupInfos assembles all API modules, syncs permissions for all groups,
 // and returns the aggregated result.
 func NewAPIGroupInfos(ctx context.Context, database *db.DB) Result {
-	// --- IAM module ---
+	// IAM module seeds the admin user and built-in roles; PKI module loads the encryption key
 	iamResult := iamv1.NewIAMModule(ctx, database)
-
-	// --- Dashboard module ---
-	dashboardResult := dashboardv1.NewDashboardModule(database)
-
-	// --- Audit module ---
-	auditResult := auditv1.NewAuditModule(database)
-
-	// --- Infra module ---
-	infraResult := infrav1.NewInfraModule(database)
-
-	// --- Network module ---
-	networkResult := networkv1.NewNetworkModule(database)
-
-	// --- O11y module ---
-	o11yResult := o11yv1.NewO11yModule(database)
-
-	// --- PKI module ---
 	pkiResult := pkiv1.NewPKIModule(database)
 
-	groups := []*rest.APIGroupInfo{iamResult.Group, dashboardResult.Group, auditResult.Group, infraResult.Group, networkResult.Group, o11yResult.Group, pkiResult.Group}
+	groups := newAPIGroupInfos(database, iamResult.Group, pkiResult.Group)
 
 	// Sync permissions for ALL modules centrally
 	iamv1.SyncAllPermissions(ctx, database, groups)
@@ -60,6 +43,30 @@ func NewAPIGroupInfos(ctx context.Context, database *db.DB) Result {
 	}
 }
 
+// NewAPIGroupInfosForRoutes assembles all API modules like NewAPIGroupInfos, but without accessing the database:
+// nothing is seeded, permissions aren't synced and the PKI encryption key isn't loaded.
+//
+// The returned groups are meant for inspecting the API routes, e.g. by -dryRun, and must not serve requests.
+func NewAPIGroupInfosForRoutes(database *db.DB) Result {
+	groups := newAPIGroupInfos(database, iamv1.NewAPIGroupInfo(database), pkiv1.NewAPIGroupInfo(database, nil))
+	return Result{
+		Groups: groups,
+	}
+}
+
+// newAPIGroupInfos returns the API groups of all modules in the installation order
+func newAPIGroupInfos(database *db.DB, iamGroup, pkiGroup *rest.APIGroupInfo) []*rest.APIGroupInfo {
+	return []*rest.APIGroupInfo{
+		iamGroup,
+		dashboardv1.NewDashboardModule(database).Group,
+		auditv1.NewAuditModule(database).Group,
+		infrav1.NewInfraModule(database).Group,
+		networkv1.NewNetworkModule(database).Group,
+		o11yv1.NewO11yModule(database).Group,
+		pkiGroup,
+	}
+}
+
 // NewAuthorizer creates a fully-wired Authorizer from API group definitions and database.
 func NewAuthorizer(database *db.DB, groups []*rest.APIGroupInfo) *filters.Authorizer {
 	return iamv1.NewAuthorizer(database, groups)
@@ -29,11 +29,17 @@ func NewPKIModule(database *db.DB) ModuleResult {
 	}
 	logger.Infof("PKI encryption key ready")
 
+	return ModuleResult{Group: NewAPIGroupInfo(database, encryptionKey)}
+}
+
+// NewAPIGroupInfo builds the PKI API group with the given encryption key for private keys.
+// It doesn't access the database, so it may be used for inspecting the API routes, e.g. by -dryRun.
+func NewAPIGroupInfo(database *db.DB, encryptionKey []byte) *rest.APIGroupInfo {
 	p := pki.NewRESTStorageProvider(pkistore.NewStores(database))
 	certStorage := pki.NewCertificateStorage(p.Certificate, encryptionKey)
 	exportHandler := pki.NewExportHandler(p.Certificate, encryptionKey)
 
-	group := &rest.APIGroupInfo{
+	return &rest.APIGroupInfo{
 		GroupName: "pki",
 		Version:   "v1",
 		Resources: []rest.ResourceInfo{
@@ -50,8 +56,6 @@ func NewPKIModule(database *db.DB) ModuleResult {
 			},
 		},
 	}
-
-	return ModuleResult{Group: group}
 }
 
 // loadOrGenerateEncryptionKey loads the AES-256 encryption key from the database,